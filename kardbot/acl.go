@@ -0,0 +1,151 @@
+package kardbot
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Kardbord/Kard-bot/kardbot/config"
+	"github.com/bwmarrin/discordgo"
+)
+
+// privilegeLevel is the bot-wide standing a user needs to run a command,
+// independent of their permissions in any guild.
+type privilegeLevel int
+
+const (
+	// Anyone may use the command.
+	privilegeNone privilegeLevel = iota
+	// Bot admins, including the owner, may use the command.
+	privilegeBotAdmin
+	// Only the bot owner may use the command.
+	privilegeOwner
+)
+
+type aclConfig struct {
+	// User IDs of bot admins. The owner is always a bot admin.
+	BotAdmins []string `json:"bot-admins"`
+	// Guild permissions needed to use a command, on top of any the
+	// command requires on its own. Permissions are named as in Discord's
+	// documentation, e.g. MANAGE_MESSAGES.
+	// Key: command name
+	CommandPermissions map[string][]string `json:"command-permissions"`
+}
+
+// Loaded once at startup, along with the rest of setup.json.
+var (
+	botAdmins          = []string{}
+	commandPermissions = map[string]int64{}
+)
+
+// Permissions that can be named in the acl section of setup.json.
+// See https://discord.com/developers/docs/topics/permissions#permissions-bitwise-permission-flags
+func permissionsByName() map[string]int64 {
+	return map[string]int64{
+		"ADMINISTRATOR":              discordgo.PermissionAdministrator,
+		"ATTACH_FILES":               discordgo.PermissionAttachFiles,
+		"BAN_MEMBERS":                discordgo.PermissionBanMembers,
+		"EMBED_LINKS":                discordgo.PermissionEmbedLinks,
+		"KICK_MEMBERS":               discordgo.PermissionKickMembers,
+		"MANAGE_CHANNELS":            discordgo.PermissionManageChannels,
+		"MANAGE_EMOJIS_AND_STICKERS": discordgo.PermissionManageEmojis,
+		"MANAGE_EVENTS":              discordgo.PermissionManageEvents,
+		"MANAGE_GUILD":               discordgo.PermissionManageServer,
+		"MANAGE_MESSAGES":            discordgo.PermissionManageMessages,
+		"MANAGE_NICKNAMES":           discordgo.PermissionManageNicknames,
+		"MANAGE_ROLES":               discordgo.PermissionManageRoles,
+		"MANAGE_THREADS":             discordgo.PermissionManageThreads,
+		"MANAGE_WEBHOOKS":            discordgo.PermissionManageWebhooks,
+		"MENTION_EVERYONE":           discordgo.PermissionMentionEveryone,
+		"MODERATE_MEMBERS":           discordgo.PermissionModerateMembers,
+		"SEND_MESSAGES":              discordgo.PermissionSendMessages,
+		"VIEW_AUDIT_LOG":             discordgo.PermissionViewAuditLogs,
+	}
+}
+
+func loadACL() error {
+	cfg := struct {
+		ACL aclConfig `json:"acl"`
+	}{}
+
+	jsonCfg, err := config.NewJsonConfig(kardbotConfigFile)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(jsonCfg.Raw, &cfg); err != nil {
+		return err
+	}
+
+	names := permissionsByName()
+	perms := make(map[string]int64, len(cfg.ACL.CommandPermissions))
+	for cmd, required := range cfg.ACL.CommandPermissions {
+		for _, name := range required {
+			bit, ok := names[strings.ToUpper(name)]
+			if !ok {
+				return fmt.Errorf("acl: command-permissions: %s: unknown permission %s", cmd, name)
+			}
+			perms[cmd] |= bit
+		}
+	}
+	for _, id := range cfg.ACL.BotAdmins {
+		if id == "" {
+			return fmt.Errorf("acl: bot-admins may not contain an empty user ID")
+		}
+	}
+
+	if cfg.ACL.BotAdmins != nil {
+		botAdmins = cfg.ACL.BotAdmins
+	}
+	commandPermissions = perms
+	return nil
+}
+
+func isBotOwner(userID string) bool {
+	return getOwnerID() != "" && userID == getOwnerID()
+}
+
+func isBotAdmin(userID string) bool {
+	return isBotOwner(userID) || (userID != "" && slices.Contains(botAdmins, userID))
+}
+
+// isBotManager reports whether any of a member's roles has been made
+// a bot manager role in the guild with /settings.
+func isBotManager(guildID string, roleIDs []string) bool {
+	if guildID == "" {
+		return false
+	}
+	for _, roleID := range settingsFor(guildID).BotManagerRoleIDs {
+		if slices.Contains(roleIDs, roleID) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasGuildPrivilege reports whether the author of an interaction may act
+// as if they hold perms in the interaction's guild. Bot admins and members
+// with a bot manager role always may.
+func hasGuildPrivilege(mdata *interactionMetaData, perms int64) bool {
+	return hasPermissions(mdata.AuthorPermissions, perms) ||
+		isBotAdmin(mdata.AuthorID) ||
+		isBotManager(mdata.GuildID, mdata.AuthorGuildRoles)
+}
+
+// requiredPermissions combines the guild permissions a command asks for
+// with any required of it in setup.json.
+func requiredPermissions(cmd Command) int64 {
+	return cmd.Metadata().Permissions | commandPermissions[cmd.Name()]
+}
+
+// defaultMemberPermissions is what Discord is told a member needs to see
+// a command. Privileged commands are limited to server administrators,
+// so that the rest of a server never sees them. Server admins can change
+// this per command in their server's integration settings, e.g. to let
+// a bot manager role see a command.
+func defaultMemberPermissions(cmd Command) int64 {
+	if cmd.Metadata().Privilege != privilegeNone {
+		return discordgo.PermissionAdministrator
+	}
+	return requiredPermissions(cmd)
+}
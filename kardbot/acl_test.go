@@ -0,0 +1,116 @@
+package kardbot
+
+import (
+	"testing"
+
+	"github.com/Kardbord/Kard-bot/kardbot/fakediscord"
+	"github.com/bwmarrin/discordgo"
+)
+
+// withACL replaces the loaded ACL for the duration of a test.
+func withACL(t *testing.T, admins []string, perms map[string]int64) {
+	t.Helper()
+	prevAdmins, prevPerms := botAdmins, commandPermissions
+	botAdmins, commandPermissions = admins, perms
+	t.Cleanup(func() { botAdmins, commandPermissions = prevAdmins, prevPerms })
+}
+
+func getCommand(t *testing.T, name string) Command {
+	t.Helper()
+	cmd, ok := commandFor(name)
+	if !ok {
+		t.Fatalf("no command named %s", name)
+	}
+	return cmd
+}
+
+func TestBotAdminsCanUsePrivilegedCommands(t *testing.T) {
+	fake := newTestBot(t)
+	withACL(t, []string{testUser.ID}, map[string]int64{})
+
+	if err := checkCommandRestrictions(getCommand(t, logLevelCmd), fake.Command(logLevelCmd, nil, inTestGuild()...)); err != nil {
+		t.Errorf("bot admin was rejected: %v", err)
+	}
+	if err := checkCommandRestrictions(getCommand(t, adminCmd), fake.Command(adminCmd, nil, inTestGuild()...)); err == nil {
+		t.Error("bot admin was allowed to use an owner only command")
+	}
+}
+
+func TestBotManagerRoleGrantsGuildPermissions(t *testing.T) {
+	fake := newTestBot(t)
+	const managerRole = "500"
+	cmd := getCommand(t, roleSelectMenuCommand)
+
+	if err := checkCommandRestrictions(cmd, fake.Command(roleSelectMenuCommand, nil, inTestGuild(managerRole)...)); err == nil {
+		t.Fatal("member without Manage Roles was allowed before the role was a manager role")
+	}
+
+	enable := fake.Command(settingsCmd, []*discordgo.ApplicationCommandInteractionDataOption{
+		fakediscord.SubCommand(settingsSubCmdManagerRole,
+			fakediscord.RoleOpt(settingsOptRole, managerRole),
+			fakediscord.BoolOpt(settingsOptEnabled, true)),
+	}, inTestGuildAsAdmin()...)
+	bot().routeInteraction(fake, enable)
+	mustRespond(t, fake, enable)
+
+	if err := checkCommandRestrictions(cmd, fake.Command(roleSelectMenuCommand, nil, inTestGuild(managerRole)...)); err != nil {
+		t.Errorf("bot manager was rejected: %v", err)
+	}
+	if err := checkCommandRestrictions(cmd, fake.Command(roleSelectMenuCommand, nil, inTestGuild()...)); err == nil {
+		t.Error("member without the manager role was allowed")
+	}
+
+	// Managers can't promote other roles, since they could give those roles to themselves.
+	promote := fake.Command(settingsCmd, []*discordgo.ApplicationCommandInteractionDataOption{
+		fakediscord.SubCommand(settingsSubCmdManagerRole,
+			fakediscord.RoleOpt(settingsOptRole, "501"),
+			fakediscord.BoolOpt(settingsOptEnabled, true)),
+	}, inTestGuild(managerRole)...)
+	bot().routeInteraction(fake, promote)
+	if !isEphemeral(mustRespond(t, fake, promote)) || len(settingsFor(testGuildID).BotManagerRoleIDs) != 1 {
+		t.Errorf("bot manager changed the manager roles: %v", settingsFor(testGuildID).BotManagerRoleIDs)
+	}
+}
+
+func TestDefaultMemberPermissions(t *testing.T) {
+	withACL(t, []string{}, map[string]int64{pastaCmd: discordgo.PermissionManageMessages})
+
+	cases := map[string]int64{
+		roleSelectMenuCommand: discordgo.PermissionManageRoles,
+		adminCmd:              discordgo.PermissionAdministrator,
+		logLevelCmd:           discordgo.PermissionAdministrator,
+		pastaCmd:              discordgo.PermissionManageMessages,
+	}
+	for name, want := range cases {
+		for _, def := range getCommand(t, name).Definitions() {
+			if def.DefaultMemberPermissions == nil || *def.DefaultMemberPermissions != want {
+				t.Errorf("%s: default member permissions = %v, want %d", def.Name, def.DefaultMemberPermissions, want)
+			}
+		}
+	}
+	for _, def := range getCommand(t, oddsCmd).Definitions() {
+		if def.DefaultMemberPermissions != nil {
+			t.Errorf("%s should be visible to everyone", def.Name)
+		}
+	}
+}
+
+func TestLoadACL(t *testing.T) {
+	withACL(t, botAdmins, commandPermissions)
+
+	inTempConfigDir(t, map[string]string{kardbotConfigFile: `{"acl": {"bot-admins": ["123"], "command-permissions": {"pasta": ["manage_messages", "EMBED_LINKS"]}}}`})
+	if err := loadACL(); err != nil {
+		t.Fatal(err)
+	}
+	if !isBotAdmin("123") {
+		t.Error("bot-admins were not loaded")
+	}
+	if got := commandPermissions[pastaCmd]; got != discordgo.PermissionManageMessages|discordgo.PermissionEmbedLinks {
+		t.Errorf("command-permissions for pasta = %d", got)
+	}
+
+	inTempConfigDir(t, map[string]string{kardbotConfigFile: `{"acl": {"command-permissions": {"pasta": ["MANAGE_EVERYTHING"]}}}`})
+	if err := loadACL(); err == nil {
+		t.Error("unknown permission was accepted")
+	}
+}
@@ -0,0 +1,336 @@
+package kardbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/Kardbord/Kard-bot/kardbot/dg_helpers"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	adminCmd = "admin"
+
+	adminSubCmdGuilds     = "guilds"
+	adminSubCmdLeave      = "leave"
+	adminSubCmdAnnounce   = "announce"
+	adminSubCmdReregister = "reregister"
+	adminSubCmdShutdown   = "shutdown"
+	adminSubCmdStats      = "stats"
+	adminSubCmdTrace      = "trace"
+	adminSubCmdReset      = "reset-command"
+
+	adminOptGuildID = "guild-id"
+	adminOptMessage = "message"
+	adminOptEnabled = "enabled"
+	adminOptCommand = "command"
+)
+
+func init() {
+	registerCommand(&command{
+		name:       adminCmd,
+		definition: adminCmdDefinition,
+		handler:    handleAdminCmd,
+		metadata:   CommandMetadata{Privilege: privilegeOwner},
+	})
+}
+
+func adminCmdDefinition() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        adminCmd,
+		Description: "Manage the bot. Only works for the bot owner.",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        adminSubCmdGuilds,
+				Description: "List the servers the bot is in.",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        adminSubCmdLeave,
+				Description: "Make the bot leave a server.",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        adminOptGuildID,
+						Description: "ID of the server to leave.",
+						Required:    true,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        adminSubCmdAnnounce,
+				Description: "Post an announcement in every server's announcement channel.",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        adminOptMessage,
+						Description: "The announcement.",
+						Required:    true,
+						MaxLength:   2000,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        adminSubCmdReregister,
+				Description: "Sync every command with Discord.",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        adminSubCmdShutdown,
+				Description: "Gracefully shut the bot down.",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        adminSubCmdStats,
+				Description: "Show runtime statistics.",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        adminSubCmdTrace,
+				Description: "Turn trace regions on or off.",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionBoolean,
+						Name:        adminOptEnabled,
+						Description: "Whether interactions should be traced.",
+						Required:    true,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        adminSubCmdReset,
+				Description: "Switch a command back on after it was disabled for panicking.",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        adminOptCommand,
+						Description: "Name of the command, without the slash.",
+						Required:    true,
+					},
+				},
+			},
+		},
+	}
+}
+
+// Restricted to the bot owner by the command's metadata.
+func handleAdminCmd(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
+	subCmd := i.ApplicationCommandData().Options[0]
+	opts := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(subCmd.Options))
+	for _, opt := range subCmd.Options {
+		opts[opt.Name] = opt
+	}
+
+	switch subCmd.Name {
+	case adminSubCmdGuilds:
+		deferAdminResponse(s, i, func() (string, *discordgo.MessageEmbed, error) {
+			embed, err := buildGuildListEmbed(s)
+			return "", embed, err
+		})
+	case adminSubCmdLeave:
+		guildID := opts[adminOptGuildID].StringValue()
+		g, err := s.Guild(guildID)
+		if err != nil {
+			interactionRespondEphemeralError(s, i, false, fmt.Errorf("could not find server %s: %w", guildID, err))
+			return
+		}
+		if err = s.GuildLeave(guildID); err != nil {
+			logFor(i).Error(err)
+			interactionRespondEphemeralError(s, i, true, err)
+			return
+		}
+		logFor(i).Infof("Left guild %s (%s)", g.Name, g.ID)
+		respondAdmin(s, i, fmt.Sprintf("Left %s.", g.Name), nil)
+	case adminSubCmdAnnounce:
+		msg := opts[adminOptMessage].StringValue()
+		deferAdminResponse(s, i, func() (string, *discordgo.MessageEmbed, error) {
+			content, err := broadcastAnnouncement(s, msg)
+			return content, nil, err
+		})
+	case adminSubCmdReregister:
+		deferAdminResponse(s, i, func() (string, *discordgo.MessageEmbed, error) {
+			changes, err := syncAllCommands(s)
+			if err != nil {
+				return "", nil, err
+			}
+			return fmt.Sprintf("Commands are in sync, %d needed changes.", len(changes)), nil, nil
+		})
+	case adminSubCmdShutdown:
+		respondAdmin(s, i, "Shutting down. 👋", nil)
+		logFor(i).Info("Shutdown requested")
+		// Shutdown waits for in-flight handlers, including this one,
+		// so it can't be run until this handler has returned.
+		goSafely("shutdown", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), bot().shutdownTimeout())
+			defer cancel()
+			if err := Shutdown(ctx); err != nil {
+				logFor(i).Error(err)
+			}
+		})
+	case adminSubCmdStats:
+		respondAdmin(s, i, "", buildStatsEmbed())
+	case adminSubCmdTrace:
+		enabled := opts[adminOptEnabled].BoolValue()
+		bot().traceEnabled.Store(enabled)
+		logFor(i).Infof("Trace regions enabled: %t", enabled)
+		if enabled {
+			respondAdmin(s, i, "Trace regions enabled. They are only recorded while a trace is being collected, e.g. from `/debug/pprof/trace`.", nil)
+		} else {
+			respondAdmin(s, i, "Trace regions disabled.", nil)
+		}
+	case adminSubCmdReset:
+		cmd := strings.TrimPrefix(strings.TrimSpace(opts[adminOptCommand].StringValue()), "/")
+		if commandTripped(cmd, time.Now()) == 0 {
+			interactionRespondEphemeralError(s, i, false, fmt.Errorf("`/%s` isn't disabled", cmd))
+			return
+		}
+		resetCircuitBreaker(cmd)
+		logFor(i).Infof("Circuit breaker reset for %s", cmd)
+		respondAdmin(s, i, fmt.Sprintf("`/%s` is back on.", cmd), nil)
+	default:
+		interactionRespondEphemeralError(s, i, true, fmt.Errorf("unknown subcommand %s", subCmd.Name))
+	}
+}
+
+// respondAdmin sends an ephemeral response, since admin output is for the owner's eyes only.
+func respondAdmin(s discordSession, i *discordgo.InteractionCreate, content string, embed *discordgo.MessageEmbed) {
+	data := &discordgo.InteractionResponseData{
+		Content: content,
+		Flags:   discordgo.MessageFlagsEphemeral,
+	}
+	if embed != nil {
+		data.Embeds = []*discordgo.MessageEmbed{embed}
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: data,
+	})
+	if err != nil {
+		logFor(i).Error(err)
+	}
+}
+
+// deferAdminResponse acknowledges the interaction, then edits the
+// response with the results of work that may take a while.
+func deferAdminResponse(s discordSession, i *discordgo.InteractionCreate, work func() (string, *discordgo.MessageEmbed, error)) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+	})
+	if err != nil {
+		logFor(i).Error(err)
+		interactionRespondEphemeralError(s, i, false, err)
+		return
+	}
+
+	content, embed, err := work()
+	if err != nil {
+		logFor(i).Error(err)
+		interactionFollowUpEphemeralError(s, i, true, err)
+		return
+	}
+
+	edit := &discordgo.WebhookEdit{Content: &content}
+	if embed != nil {
+		edit.Embeds = &[]*discordgo.MessageEmbed{embed}
+	}
+	if _, err = s.InteractionResponseEdit(i.Interaction, edit); err != nil {
+		logFor(i).Error(err)
+	}
+}
+
+func buildGuildListEmbed(s discordSession) (*discordgo.MessageEmbed, error) {
+	guilds, err := bot().GetAllGuilds()
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]string, 0, len(guilds))
+	for _, ug := range guilds {
+		members := "unknown"
+		if g, err := s.GuildWithCounts(ug.ID); err == nil {
+			members = fmt.Sprint(g.ApproximateMemberCount)
+		}
+		lines = append(lines, fmt.Sprintf("**%s** (`%s`): %s members", ug.Name, ug.ID, members))
+	}
+
+	color, _ := fastHappyColorInt64()
+	return dg_helpers.NewEmbed().
+		SetTitle(fmt.Sprintf("In %d servers", len(guilds))).
+		SetDescription(strings.Join(lines, "\n")).
+		SetColor(int(color)).
+		Truncate().
+		MessageEmbed, nil
+}
+
+// broadcastAnnouncement posts msg to the announcement channel of every
+// guild, and returns a summary of where it was posted.
+func broadcastAnnouncement(s discordSession, msg string) (string, error) {
+	guilds, err := bot().GetAllGuilds()
+	if err != nil {
+		return "", err
+	}
+
+	sent := 0
+	failed := []string{}
+	for _, g := range guilds {
+		channelID, err := announcementChannel(s, g.ID)
+		if err == nil {
+			_, err = s.ChannelMessageSend(channelID, msg)
+		}
+		if err != nil {
+			logFor(nil).Warnf("Could not announce to guild %s: %v", g.ID, err)
+			failed = append(failed, g.Name)
+			continue
+		}
+		sent++
+	}
+
+	summary := fmt.Sprintf("Announced to %d of %d servers.", sent, len(guilds))
+	if len(failed) > 0 {
+		summary += fmt.Sprintf(" Failed: %s", strings.Join(failed, ", "))
+	}
+	if sent == 0 && len(guilds) > 0 {
+		return "", errors.New(summary)
+	}
+	return summary, nil
+}
+
+func buildStatsEmbed() *discordgo.MessageEmbed {
+	mem := runtime.MemStats{}
+	runtime.ReadMemStats(&mem)
+
+	tripped := "none"
+	if cmds := trippedCommands(time.Now()); len(cmds) > 0 {
+		tripped = strings.Join(cmds, ", ")
+	}
+
+	uptime := "unknown"
+	if !bot().startTime.IsZero() {
+		uptime = time.Since(bot().startTime).Round(time.Second).String()
+	}
+
+	color, _ := fastHappyColorInt64()
+	return dg_helpers.NewEmbed().
+		SetTitle("Runtime Stats").
+		AddField("Uptime", uptime).
+		AddField("Goroutines", fmt.Sprint(runtime.NumGoroutine())).
+		AddField("Heap In Use", fmt.Sprintf("%.1f MiB", float64(mem.HeapInuse)/(1<<20))).
+		AddField("Memory From OS", fmt.Sprintf("%.1f MiB", float64(mem.Sys)/(1<<20))).
+		AddField("GC Cycles", fmt.Sprint(mem.NumGC)).
+		AddField("Trace Regions", fmt.Sprint(bot().traceEnabled.Load())).
+		AddField("Tripped Commands", tripped).
+		AddField("Go Version", runtime.Version()).
+		InlineAllFields().
+		SetColor(int(color)).
+		Truncate().
+		MessageEmbed
+}
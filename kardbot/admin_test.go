@@ -0,0 +1,104 @@
+package kardbot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Kardbord/Kard-bot/kardbot/fakediscord"
+	"github.com/bwmarrin/discordgo"
+)
+
+func adminCommand(fake *fakediscord.Session, subCmd string, opts ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	return fake.Command(adminCmd, []*discordgo.ApplicationCommandInteractionDataOption{
+		fakediscord.SubCommand(subCmd, opts...),
+	}, fakediscord.FromUser(testUser))
+}
+
+func TestAdminGuildsListsEveryPage(t *testing.T) {
+	fake := newTestBot(t)
+	// More guilds than fit in a single page of UserGuilds.
+	for n := 0; n < 150; n++ {
+		fake.AddGuild(&discordgo.Guild{ID: fmt.Sprint(1000 + n), Name: fmt.Sprintf("guild %d", n)})
+	}
+
+	i := adminCommand(fake, adminSubCmdGuilds)
+	handleAdminCmd(context.Background(), fake, i)
+
+	resp := mustRespond(t, fake, i)
+	if !isEphemeral(resp) {
+		t.Error("guild list should be ephemeral")
+	}
+	if len(resp.Edits) != 1 || resp.Edits[0].Embeds == nil {
+		t.Fatalf("expected the deferred response to be edited with an embed, got %+v", resp.Edits)
+	}
+	embed := (*resp.Edits[0].Embeds)[0]
+	if embed.Title != "In 151 servers" {
+		t.Errorf("title = %q", embed.Title)
+	}
+	if !strings.Contains(embed.Description, fmt.Sprintf("(`%s`): 1 members", testGuildID)) {
+		t.Errorf("member count missing from %q", embed.Description)
+	}
+}
+
+func TestAdminLeave(t *testing.T) {
+	fake := newTestBot(t)
+
+	i := adminCommand(fake, adminSubCmdLeave, fakediscord.StringOpt(adminOptGuildID, testGuildID))
+	handleAdminCmd(context.Background(), fake, i)
+
+	if resp := mustRespond(t, fake, i); resp.Initial.Data.Content != "Left test guild." {
+		t.Errorf("response = %q", resp.Initial.Data.Content)
+	}
+	if _, err := fake.Guild(testGuildID); err == nil {
+		t.Error("bot is still in the guild")
+	}
+}
+
+func TestAdminAnnounce(t *testing.T) {
+	fake := newTestBot(t)
+	fake.AddGuild(&discordgo.Guild{ID: "301", Name: "no channels"})
+
+	i := adminCommand(fake, adminSubCmdAnnounce, fakediscord.StringOpt(adminOptMessage, "hello everyone"))
+	handleAdminCmd(context.Background(), fake, i)
+
+	msgs := fake.Messages(testChannelID)
+	if len(msgs) != 1 || msgs[0].Content != "hello everyone" {
+		t.Errorf("announcement was not posted, got %+v", msgs)
+	}
+	resp := mustRespond(t, fake, i)
+	if len(resp.Edits) != 1 || !strings.HasPrefix(*resp.Edits[0].Content, "Announced to 1 of 2 servers.") {
+		t.Errorf("unexpected summary %+v", resp.Edits)
+	}
+}
+
+func TestAdminTraceToggle(t *testing.T) {
+	fake := newTestBot(t)
+
+	for _, enabled := range []bool{true, false} {
+		i := adminCommand(fake, adminSubCmdTrace, fakediscord.BoolOpt(adminOptEnabled, enabled))
+		handleAdminCmd(context.Background(), fake, i)
+		mustRespond(t, fake, i)
+		if bot().traceEnabled.Load() != enabled {
+			t.Errorf("traceEnabled = %t, want %t", bot().traceEnabled.Load(), enabled)
+		}
+	}
+}
+
+func TestAdminIsOwnerOnly(t *testing.T) {
+	fake := newTestBot(t)
+	prevOwner := getOwnerID
+	getOwnerID = func() string { return testSelf.ID }
+	t.Cleanup(func() { getOwnerID = prevOwner })
+
+	i := adminCommand(fake, adminSubCmdLeave, fakediscord.StringOpt(adminOptGuildID, testGuildID))
+	bot().routeInteraction(fake, i)
+
+	if !isEphemeral(mustRespond(t, fake, i)) {
+		t.Error("expected an ephemeral rejection")
+	}
+	if _, err := fake.Guild(testGuildID); err != nil {
+		t.Error("non-owner made the bot leave a guild")
+	}
+}
@@ -0,0 +1,184 @@
+package kardbot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Kardbord/gopenai/common"
+	"github.com/Kardbord/gopenai/images"
+	"github.com/Kardbord/gopenai/moderations"
+	"github.com/Kardbord/hfapigo/v3"
+)
+
+// hfapigo and gopenai have no way to cancel a request, so the requests
+// the bot makes to them are built here instead, where they can be tied
+// to the handler's context.
+
+// apiHTTPClient sends requests to Hugging Face and OpenAI. Its timeout is
+// only a backstop, since a handler's own timeout is usually shorter.
+var apiHTTPClient = &http.Client{Timeout: 10 * time.Minute, Transport: newRetryTransport(nil)}
+
+// Where Hugging Face models are served from. A var so that tests can
+// point it at a local server.
+var hfAPIBaseURL = hfapigo.APIBaseURL
+
+// hfRequest sends request to a Hugging Face model, and returns the
+// response body.
+func hfRequest(ctx context.Context, model string, request any) ([]byte, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	// Inference has no side effects, so it can always be retried.
+	req, err := http.NewRequestWithContext(withRetry(ctx), http.MethodPost, hfAPIBaseURL+model, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if key := hfapigo.APIKey(); key != "" {
+		req.Header.Set(hfapigo.AuthHeaderKey, hfapigo.AuthHeaderPrefix+key)
+	}
+
+	resp, err := apiHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	apiErr := struct {
+		Error any `json:"error"`
+	}{}
+	_ = json.Unmarshal(respBody, &apiErr)
+	if resp.StatusCode != http.StatusOK || apiErr.Error != nil {
+		return nil, fmt.Errorf("%s: %s", resp.Status, respBody)
+	}
+	return respBody, nil
+}
+
+// textToImageRequest sends a text-to-image request to Hugging Face.
+func textToImageRequest(ctx context.Context, model string, request *hfapigo.TextToImageRequest) (image.Image, string, error) {
+	body, err := hfRequest(ctx, model, request)
+	if err != nil {
+		return nil, "", err
+	}
+	return image.Decode(bytes.NewReader(body))
+}
+
+// textGenerationRequest sends a text generation request to Hugging Face.
+func textGenerationRequest(ctx context.Context, model string, request *hfapigo.TextGenerationRequest) ([]*hfapigo.TextGenerationResponse, error) {
+	body, err := hfRequest(ctx, model, request)
+	if err != nil {
+		return nil, err
+	}
+	resps := []*hfapigo.TextGenerationResponse{}
+	if err = json.Unmarshal(body, &resps); err != nil {
+		return nil, err
+	}
+	if len(resps) == 0 {
+		return nil, fmt.Errorf("expected at least 1 response, got none; response=%s", body)
+	}
+	return resps, nil
+}
+
+// fillMaskRequest sends a fill mask request to Hugging Face.
+func fillMaskRequest(ctx context.Context, model string, request *hfapigo.FillMaskRequest) ([]*hfapigo.FillMaskResponse, error) {
+	body, err := hfRequest(ctx, model, request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Several inputs or masks get a list of lists, and a single one gets a list.
+	nested := [][]*hfapigo.FillMaskResponseEntry{}
+	if err = json.Unmarshal(body, &nested); err == nil {
+		resps := make([]*hfapigo.FillMaskResponse, 0, len(nested))
+		for _, masks := range nested {
+			resps = append(resps, &hfapigo.FillMaskResponse{Masks: masks})
+		}
+		return resps, nil
+	}
+	masks := []*hfapigo.FillMaskResponseEntry{}
+	if err := json.Unmarshal(body, &masks); err != nil {
+		return nil, err
+	}
+	return []*hfapigo.FillMaskResponse{{Masks: masks}}, nil
+}
+
+// openAIRequest sends request to an OpenAI endpoint, and decodes the
+// response into a Resp.
+func openAIRequest[Req, Resp any](ctx context.Context, endpoint string, request *Req) (*Resp, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	common.SetRequestHeaders(req, "application/json", nil)
+
+	resp, err := apiHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, respBody)
+	}
+
+	r := new(Resp)
+	if err = json.Unmarshal(respBody, r); err != nil {
+		return nil, fmt.Errorf("%s: %w", resp.Status, err)
+	}
+	return r, nil
+}
+
+// moderatedImageRequest asks OpenAI for an image, once the prompt has
+// passed moderation. A flagged prompt returns a moderations.ModerationFlagError.
+func moderatedImageRequest(ctx context.Context, request *images.CreationRequest) (*images.Response, *moderations.Response, error) {
+	// Unlike creating an image, checking the prompt costs nothing to repeat.
+	modr, err := openAIRequest[moderations.Request, moderations.Response](withRetry(ctx), moderations.Endpoint, &moderations.Request{
+		Input: []string{request.Prompt},
+		Model: moderations.ModelLatest,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if modr.Error != nil {
+		return nil, modr, modr.Error
+	}
+	if len(modr.Results) == 0 {
+		return nil, modr, errors.New("no moderation results in response")
+	}
+	for _, res := range modr.Results {
+		if res.Flagged {
+			return nil, modr, moderations.NewModerationFlagError()
+		}
+	}
+
+	resp, err := openAIRequest[images.CreationRequest, images.Response](ctx, images.CreateEndpoint, request)
+	if err != nil {
+		return nil, modr, err
+	}
+	if resp.Error != nil {
+		return nil, modr, resp.Error
+	}
+	if len(resp.Data) == 0 {
+		return nil, modr, errors.New("no images in response")
+	}
+	return resp, modr, nil
+}
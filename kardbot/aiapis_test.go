@@ -0,0 +1,105 @@
+package kardbot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kardbord/gopenai/moderations"
+	"github.com/Kardbord/hfapigo/v3"
+)
+
+// useHFServer points Hugging Face requests at handler for the duration
+// of the test.
+func useHFServer(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	prev := hfAPIBaseURL
+	hfAPIBaseURL = srv.URL + "/"
+	t.Cleanup(func() { hfAPIBaseURL = prev })
+}
+
+func TestHFRequestIsCancelled(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	useHFServer(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := textGenerationRequest(ctx, "model", &hfapigo.TextGenerationRequest{Input: "hello"})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the deadline to be exceeded, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request outlived its context")
+	}
+}
+
+func TestFillMaskRequest(t *testing.T) {
+	cases := map[string]struct {
+		body  string
+		masks []int
+	}{
+		"single mask":    {`[{"token_str": "a"}, {"token_str": "b"}]`, []int{2}},
+		"several masks":  {`[[{"token_str": "a"}], [{"token_str": "b"}, {"token_str": "c"}]]`, []int{1, 2}},
+		"error response": {`{"error": "bad input"}`, nil},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			useHFServer(t, func(w http.ResponseWriter, r *http.Request) {
+				if c.masks == nil {
+					w.WriteHeader(http.StatusBadRequest)
+				}
+				_, _ = w.Write([]byte(c.body))
+			})
+
+			resps, err := fillMaskRequest(context.Background(), "model", &hfapigo.FillMaskRequest{Inputs: []string{"[MASK]"}})
+			if c.masks == nil {
+				if err == nil {
+					t.Error("error response was accepted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(resps) != len(c.masks) {
+				t.Fatalf("expected %d responses, got %d", len(c.masks), len(resps))
+			}
+			for n, want := range c.masks {
+				if got := len(resps[n].Masks); got != want {
+					t.Errorf("response %d: expected %d masks, got %d", n, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenAIRequestChecksStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"results": [{"flagged": false}]}`))
+	}))
+	defer srv.Close()
+
+	_, err := openAIRequest[moderations.Request, moderations.Response](context.Background(), srv.URL, &moderations.Request{Input: []string{"hello"}})
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected the 401 to be returned, got %v", err)
+	}
+}
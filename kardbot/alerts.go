@@ -0,0 +1,470 @@
+package kardbot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Kardbord/Kard-bot/kardbot/config"
+	"github.com/Kardbord/Kard-bot/kardbot/dg_helpers"
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// How urgent an alert is. Alerts below the configured minimum are only logged.
+type alertSeverity int
+
+const (
+	severityInfo alertSeverity = iota
+	severityWarning
+	severityError
+	severityCritical
+)
+
+var severityNames = map[alertSeverity]string{
+	severityInfo:     "info",
+	severityWarning:  "warning",
+	severityError:    "error",
+	severityCritical: "critical",
+}
+
+func (s alertSeverity) String() string {
+	if name, ok := severityNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+func (s *alertSeverity) UnmarshalJSON(raw []byte) error {
+	name := ""
+	if err := json.Unmarshal(raw, &name); err != nil {
+		return err
+	}
+	for severity, n := range severityNames {
+		if strings.EqualFold(n, name) {
+			*s = severity
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity %q", name)
+}
+
+func (s alertSeverity) color() int {
+	switch s {
+	case severityCritical:
+		return 0x992D22
+	case severityError:
+		return 0xE74C3C
+	case severityWarning:
+		return 0xF1C40F
+	default:
+		return 0x3498DB
+	}
+}
+
+func (s alertSeverity) emoji() string {
+	switch s {
+	case severityCritical:
+		return "🚨"
+	case severityError:
+		return "❗"
+	case severityWarning:
+		return "⚠️"
+	default:
+		return "ℹ️"
+	}
+}
+
+// Where alerts can be sent.
+const (
+	alertSinkOwnerDM        = "owner-dm"
+	alertSinkChannel        = "channel"
+	alertSinkDiscordWebhook = "discord-webhook"
+	alertSinkWebhook        = "webhook"
+)
+
+// alertConfig is the "alerts" section of setup.json.
+type alertConfig struct {
+	// One of the alertSink* constants.
+	Sink string `json:"sink"`
+	// Channel ID or webhook URL, depending on the sink.
+	Target      string        `json:"target,omitempty"`
+	MinSeverity alertSeverity `json:"min-severity"`
+	// Repeats of an alert within this many seconds of the first are
+	// summarized in a single alert once the time is up.
+	AggregateSeconds float64 `json:"aggregate-seconds"`
+	// Limits how many alerts are sent in total.
+	RateLimit bucketConfig `json:"rate-limit"`
+}
+
+func defaultAlertConfig() alertConfig {
+	return alertConfig{
+		Sink:             alertSinkOwnerDM,
+		MinSeverity:      severityWarning,
+		AggregateSeconds: 300,
+		RateLimit:        bucketConfig{Burst: 5, RefillSeconds: 60},
+	}
+}
+
+func (c *alertConfig) aggregateWindow() time.Duration {
+	return time.Duration(c.AggregateSeconds * float64(time.Second))
+}
+
+func (c *alertConfig) validate() error {
+	switch c.Sink {
+	case alertSinkOwnerDM:
+	case alertSinkChannel:
+		if c.Target == "" {
+			return errors.New("target must be a channel ID")
+		}
+	case alertSinkDiscordWebhook, alertSinkWebhook:
+		u, err := url.Parse(c.Target)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("target must be an http(s) URL, got %q", c.Target)
+		}
+	default:
+		return fmt.Errorf("unknown sink %q", c.Sink)
+	}
+	if c.AggregateSeconds < 0 {
+		return fmt.Errorf("aggregate-seconds may not be negative, got %v", c.AggregateSeconds)
+	}
+	if err := c.RateLimit.validate(); err != nil {
+		return fmt.Errorf("rate-limit: %w", err)
+	}
+	return nil
+}
+
+func loadAlertConfig() error {
+	cfg := struct {
+		Alerts alertConfig `json:"alerts"`
+	}{defaultAlertConfig()}
+
+	jsonCfg, err := config.NewJsonConfig(kardbotConfigFile)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(jsonCfg.Raw, &cfg); err != nil {
+		return fmt.Errorf("alerts: %w", err)
+	}
+	if err = cfg.Alerts.validate(); err != nil {
+		return fmt.Errorf("alerts: %w", err)
+	}
+	resetAlerts(cfg.Alerts)
+	return nil
+}
+
+type alertField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// alert is a notification for whoever runs the bot.
+type alert struct {
+	Severity alertSeverity
+	// Alerts with the same key are aggregated. Defaults to the title.
+	Key     string
+	Title   string
+	Message string
+	Fields  []alertField
+	// Long text, such as a stack trace, that is attached as a file
+	// where the sink allows it.
+	AttachmentName string
+	Attachment     string
+	// How many times the alert was raised, and when, if it summarizes repeats.
+	Count     int
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+func (a *alert) key() string {
+	if a.Key != "" {
+		return a.Key
+	}
+	return a.Title
+}
+
+// alertWindow tracks repeats of an alert after the first was sent.
+type alertWindow struct {
+	start time.Time
+	// The latest repeat, the most severe severity among repeats,
+	// and how many repeats there were and when.
+	latest      alert
+	severity    alertSeverity
+	repeats     int
+	first, last time.Time
+}
+
+func (w *alertWindow) repeat(a alert, now time.Time) {
+	if w.repeats == 0 {
+		w.first = now
+	}
+	w.latest = a
+	w.severity = max(w.severity, a.Severity)
+	w.repeats++
+	w.last = now
+}
+
+var alertState = struct {
+	sync.Mutex
+	cfg     alertConfig
+	bucket  *tokenBucket
+	windows map[string]*alertWindow
+}{}
+
+func init() {
+	resetAlerts(defaultAlertConfig())
+}
+
+// resetAlerts applies cfg and forgets every aggregated alert.
+func resetAlerts(cfg alertConfig) {
+	alertState.Lock()
+	defer alertState.Unlock()
+	alertState.cfg = cfg
+	alertState.bucket = &tokenBucket{cfg: &alertState.cfg.RateLimit, tokens: float64(cfg.RateLimit.Burst), last: time.Now()}
+	alertState.windows = map[string]*alertWindow{}
+}
+
+// takeAlertToken must be called with alertState locked.
+func takeAlertToken(now time.Time) bool {
+	alertState.bucket.refill(now)
+	if alertState.bucket.tokens < 1 {
+		return false
+	}
+	alertState.bucket.tokens--
+	return true
+}
+
+// prepareAlert decides whether a should be sent now, and if so returns a
+// function that sends it. Repeats of an alert that was sent recently, and
+// alerts over the rate limit, are held back to be summarized by flushAlerts.
+func prepareAlert(a alert, now time.Time) func() error {
+	alertState.Lock()
+	defer alertState.Unlock()
+
+	cfg := alertState.cfg
+	if a.Severity < cfg.MinSeverity {
+		alertsTotal.WithLabelValues(a.Severity.String(), "below-threshold").Inc()
+		return nil
+	}
+
+	if w, ok := alertState.windows[a.key()]; ok {
+		w.repeat(a, now)
+		alertsTotal.WithLabelValues(a.Severity.String(), "aggregated").Inc()
+		return nil
+	}
+
+	w := &alertWindow{start: now}
+	alertState.windows[a.key()] = w
+	if !takeAlertToken(now) {
+		// Summarized once a token is available, like any other repeat.
+		w.repeat(a, now)
+		alertsTotal.WithLabelValues(a.Severity.String(), "rate-limited").Inc()
+		return nil
+	}
+
+	if a.Count == 0 {
+		a.Count = 1
+	}
+	return alertSender(cfg, a)
+}
+
+// alertSender returns a function that sends a to the configured sink.
+// Everything the sink needs is captured now, so that the function can
+// be run from another goroutine.
+func alertSender(cfg alertConfig, a alert) func() error {
+	var send func() error
+	switch cfg.Sink {
+	case alertSinkOwnerDM:
+		s, ownerID := bot().api, getOwnerID()
+		send = func() error {
+			if ownerID == "" {
+				return errors.New("no owner ID provided")
+			}
+			uc, err := s.UserChannelCreate(ownerID)
+			if err != nil {
+				return err
+			}
+			_, err = s.ChannelMessageSendComplex(uc.ID, alertMessage(a))
+			return err
+		}
+	case alertSinkChannel:
+		s := bot().api
+		send = func() error {
+			_, err := s.ChannelMessageSendComplex(cfg.Target, alertMessage(a))
+			return err
+		}
+	case alertSinkDiscordWebhook:
+		send = func() error {
+			msg := alertMessage(a)
+			contentType, body, err := discordgo.MultipartBodyWithJSON(discordgo.WebhookParams{Embeds: msg.Embeds}, msg.Files)
+			if err != nil {
+				return err
+			}
+			return postAlert(cfg.Target, contentType, body)
+		}
+	case alertSinkWebhook:
+		send = func() error {
+			body, err := json.Marshal(newAlertPayload(a))
+			if err != nil {
+				return err
+			}
+			return postAlert(cfg.Target, "application/json", body)
+		}
+	default:
+		send = func() error { return fmt.Errorf("unknown alert sink %q", cfg.Sink) }
+	}
+
+	return func() error {
+		err := send()
+		if err != nil {
+			alertsTotal.WithLabelValues(a.Severity.String(), "failed").Inc()
+			return fmt.Errorf("could not send %s alert %q to %s: %w", a.Severity, a.Title, cfg.Sink, err)
+		}
+		alertsTotal.WithLabelValues(a.Severity.String(), "sent").Inc()
+		return nil
+	}
+}
+
+var alertHTTPClient = &http.Client{Timeout: 10 * time.Second, Transport: newRetryTransport(nil)}
+
+func postAlert(target, contentType string, body []byte) error {
+	// A repeated alert is better than a lost one.
+	req, err := http.NewRequestWithContext(withRetry(context.Background()), http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := alertHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+func alertMessage(a alert) *discordgo.MessageSend {
+	embed := dg_helpers.NewEmbed().
+		SetTitle(fmt.Sprintf("%s %s", a.Severity.emoji(), a.Title)).
+		SetDescription(a.Message).
+		SetColor(a.Severity.color())
+	for _, f := range a.Fields {
+		embed.AddField(f.Name, f.Value)
+	}
+	if a.Count > 1 {
+		embed.AddField("Occurrences", fmt.Sprintf("%d between <t:%d:T> and <t:%d:T>", a.Count, a.FirstSeen.Unix(), a.LastSeen.Unix()))
+	}
+	embed.SetFooter(a.Severity.String()).SetTimestamp()
+
+	msg := &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed.Truncate().MessageEmbed}}
+	if a.Attachment != "" {
+		msg.Files = []*discordgo.File{{
+			Name:        a.AttachmentName,
+			ContentType: "text/plain",
+			Reader:      strings.NewReader(a.Attachment),
+		}}
+	}
+	return msg
+}
+
+// alertPayload is the JSON body posted to a generic webhook.
+type alertPayload struct {
+	Severity   string       `json:"severity"`
+	Key        string       `json:"key"`
+	Title      string       `json:"title"`
+	Message    string       `json:"message,omitempty"`
+	Fields     []alertField `json:"fields,omitempty"`
+	Attachment string       `json:"attachment,omitempty"`
+	Count      int          `json:"count"`
+	FirstSeen  *time.Time   `json:"first-seen,omitempty"`
+	LastSeen   *time.Time   `json:"last-seen,omitempty"`
+}
+
+func newAlertPayload(a alert) alertPayload {
+	p := alertPayload{
+		Severity:   a.Severity.String(),
+		Key:        a.key(),
+		Title:      a.Title,
+		Message:    a.Message,
+		Fields:     a.Fields,
+		Attachment: a.Attachment,
+		Count:      a.Count,
+	}
+	if a.Count > 1 {
+		p.FirstSeen, p.LastSeen = &a.FirstSeen, &a.LastSeen
+	}
+	return p
+}
+
+// raiseAlert sends an alert in the background. Failures are only logged.
+func raiseAlert(a alert) {
+	if send := prepareAlert(a, time.Now()); send != nil {
+		goSafely("alert", func() {
+			if err := send(); err != nil {
+				log.Error(err)
+			}
+		})
+	}
+}
+
+// deliverAlert sends an alert, and returns an error if it could not be sent.
+// An alert that is held back to be summarized later is not an error.
+func deliverAlert(a alert) error {
+	if send := prepareAlert(a, time.Now()); send != nil {
+		return send()
+	}
+	return nil
+}
+
+// flushAlerts sends a summary of each alert that was repeated or rate
+// limited once its aggregation window has passed.
+func flushAlerts() {
+	now := time.Now()
+	sends := []func() error{}
+
+	alertState.Lock()
+	cfg := alertState.cfg
+	for key, w := range alertState.windows {
+		if now.Sub(w.start) < cfg.aggregateWindow() {
+			continue
+		}
+		if w.repeats == 0 {
+			delete(alertState.windows, key)
+			continue
+		}
+		if !takeAlertToken(now) {
+			// Tried again on the next flush.
+			continue
+		}
+		delete(alertState.windows, key)
+		a := w.latest
+		a.Severity = w.severity
+		a.Count, a.FirstSeen, a.LastSeen = w.repeats, w.first, w.last
+		sends = append(sends, alertSender(cfg, a))
+	}
+	alertState.Unlock()
+
+	for _, send := range sends {
+		if err := send(); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// fatalWithAlert raises a critical alert before exiting, since nobody
+// will be watching the logs of a bot that failed to start.
+func fatalWithAlert(msg string, err error) {
+	if alertErr := deliverAlert(alert{Severity: severityCritical, Title: msg, Message: err.Error()}); alertErr != nil {
+		log.Error(alertErr)
+	}
+	log.Fatalf("%s: %v", msg, err)
+}
@@ -0,0 +1,175 @@
+package kardbot
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// alertWebhook records the bodies posted to it.
+type alertWebhook struct {
+	*httptest.Server
+	mutex  sync.Mutex
+	bodies []string
+}
+
+func newAlertWebhook(t *testing.T) *alertWebhook {
+	t.Helper()
+	hook := &alertWebhook{}
+	hook.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		hook.mutex.Lock()
+		defer hook.mutex.Unlock()
+		hook.bodies = append(hook.bodies, string(body))
+	}))
+	t.Cleanup(hook.Close)
+	return hook
+}
+
+func (h *alertWebhook) payloads(t *testing.T) []alertPayload {
+	t.Helper()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	payloads := make([]alertPayload, len(h.bodies))
+	for idx, body := range h.bodies {
+		if err := json.Unmarshal([]byte(body), &payloads[idx]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return payloads
+}
+
+func useAlertWebhook(t *testing.T, sink string, configure func(*alertConfig)) *alertWebhook {
+	t.Helper()
+	hook := newAlertWebhook(t)
+	cfg := defaultAlertConfig()
+	cfg.Sink, cfg.Target = sink, hook.URL
+	if configure != nil {
+		configure(&cfg)
+	}
+	resetAlerts(cfg)
+	t.Cleanup(func() { resetAlerts(defaultAlertConfig()) })
+	return hook
+}
+
+func TestAlertsAreAggregated(t *testing.T) {
+	hook := useAlertWebhook(t, alertSinkWebhook, func(cfg *alertConfig) {
+		// Every window has passed by the time flushAlerts runs.
+		cfg.AggregateSeconds = 0
+	})
+
+	for n := 0; n < 3; n++ {
+		if err := deliverAlert(alert{Severity: severityWarning, Title: "Clock broke", Message: "again"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := deliverAlert(alert{Severity: severityInfo, Title: "Not important"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := hook.payloads(t); len(got) != 1 || got[0].Title != "Clock broke" || got[0].Count != 1 {
+		t.Fatalf("expected only the first alert to be sent, got %+v", got)
+	}
+
+	flushAlerts()
+	got := hook.payloads(t)
+	if len(got) != 2 || got[1].Count != 2 || got[1].FirstSeen == nil || got[1].Severity != "warning" {
+		t.Fatalf("expected the repeats to be summarized, got %+v", got)
+	}
+
+	// Once summarized, the alert starts over.
+	flushAlerts()
+	if err := deliverAlert(alert{Severity: severityWarning, Title: "Clock broke"}); err != nil {
+		t.Fatal(err)
+	}
+	if got = hook.payloads(t); len(got) != 3 || got[2].Count != 1 {
+		t.Errorf("expected a fresh alert, got %+v", got)
+	}
+}
+
+func TestAlertsAreRateLimited(t *testing.T) {
+	hook := useAlertWebhook(t, alertSinkWebhook, func(cfg *alertConfig) {
+		cfg.AggregateSeconds = 0
+		cfg.RateLimit = bucketConfig{Burst: 1, RefillSeconds: 3600}
+	})
+
+	for _, title := range []string{"first", "second"} {
+		if err := deliverAlert(alert{Severity: severityError, Title: title}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	flushAlerts()
+	if got := hook.payloads(t); len(got) != 1 || got[0].Title != "first" {
+		t.Fatalf("expected the second alert to be held back, got %+v", got)
+	}
+
+	alertState.Lock()
+	alertState.bucket.tokens = 1
+	alertState.Unlock()
+	flushAlerts()
+	if got := hook.payloads(t); len(got) != 2 || got[1].Title != "second" {
+		t.Errorf("expected the held back alert once a token was available, got %+v", got)
+	}
+}
+
+func TestDiscordWebhookAlert(t *testing.T) {
+	hook := useAlertWebhook(t, alertSinkDiscordWebhook, nil)
+
+	err := deliverAlert(alert{Severity: severityCritical, Title: "Startup failed", AttachmentName: "stack.txt", Attachment: "goroutine 1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook.mutex.Lock()
+	defer hook.mutex.Unlock()
+	if len(hook.bodies) != 1 || !strings.Contains(hook.bodies[0], `"payload_json"`) || !strings.Contains(hook.bodies[0], "Startup failed") || !strings.Contains(hook.bodies[0], "goroutine 1") {
+		t.Errorf("expected a multipart webhook execution with the embed and attachment, got %q", hook.bodies)
+	}
+}
+
+func TestChannelAlert(t *testing.T) {
+	fake := newTestBot(t)
+	cfg := defaultAlertConfig()
+	cfg.Sink, cfg.Target = alertSinkChannel, testChannelID
+	resetAlerts(cfg)
+
+	if err := deliverAlert(alert{Severity: severityError, Title: "Something broke"}); err != nil {
+		t.Fatal(err)
+	}
+	msgs := fake.Messages(testChannelID)
+	if len(msgs) != 1 || len(msgs[0].Embeds) != 1 || !strings.Contains(msgs[0].Embeds[0].Title, "Something broke") {
+		t.Errorf("expected the alert in the alert channel, got %+v", msgs)
+	}
+}
+
+func TestLoadAlertConfig(t *testing.T) {
+	t.Cleanup(func() { resetAlerts(defaultAlertConfig()) })
+
+	cases := map[string]string{
+		"unknown sink":     `{"alerts": {"sink": "pager"}}`,
+		"missing channel":  `{"alerts": {"sink": "channel"}}`,
+		"bad webhook URL":  `{"alerts": {"sink": "webhook", "target": "not a url"}}`,
+		"unknown severity": `{"alerts": {"min-severity": "apocalyptic"}}`,
+		"bad rate limit":   `{"alerts": {"rate-limit": {"burst": 0, "refill-seconds": 60}}}`,
+	}
+	for name, setup := range cases {
+		t.Run(name, func(t *testing.T) {
+			inTempConfigDir(t, map[string]string{kardbotConfigFile: setup})
+			if err := loadAlertConfig(); err == nil {
+				t.Error("invalid config was accepted")
+			}
+		})
+	}
+
+	inTempConfigDir(t, map[string]string{kardbotConfigFile: `{"alerts": {"sink": "webhook", "target": "https://example.com/hook", "min-severity": "Error"}}`})
+	if err := loadAlertConfig(); err != nil {
+		t.Fatal(err)
+	}
+	alertState.Lock()
+	defer alertState.Unlock()
+	if alertState.cfg.MinSeverity != severityError || alertState.cfg.AggregateSeconds != defaultAlertConfig().AggregateSeconds {
+		t.Errorf("unexpected config %+v", alertState.cfg)
+	}
+}
@@ -0,0 +1,200 @@
+package kardbot
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// focusedOption returns the option the user is typing in, looking
+// inside subcommands and subcommand groups. Nil if there isn't one.
+func focusedOption(opts []*discordgo.ApplicationCommandInteractionDataOption) *discordgo.ApplicationCommandInteractionDataOption {
+	for _, opt := range opts {
+		if opt.Focused {
+			return opt
+		}
+		if focused := focusedOption(opt.Options); focused != nil {
+			return focused
+		}
+	}
+	return nil
+}
+
+// How closely a candidate matches a query. Lower is better.
+type matchRank int
+
+const (
+	matchExact matchRank = iota
+	matchPrefix
+	// The query starts a word within the candidate, e.g. "york" in "America/New_York".
+	matchWordPrefix
+	matchSubstring
+	// The characters of the query appear in order, e.g. "ny" in "America/New_York".
+	matchSubsequence
+	noMatch
+)
+
+func normalizeForMatch(s string) string {
+	return strings.ToLower(strings.NewReplacer("_", " ", "-", " ").Replace(strings.TrimSpace(s)))
+}
+
+func rankMatch(query, candidate string) matchRank {
+	query, candidate = normalizeForMatch(query), normalizeForMatch(candidate)
+	switch {
+	case candidate == query:
+		return matchExact
+	case strings.HasPrefix(candidate, query):
+		return matchPrefix
+	}
+
+	if strings.Contains(candidate, query) {
+		for idx := 1; idx < len(candidate); idx++ {
+			if strings.ContainsRune(" /.", rune(candidate[idx-1])) && strings.HasPrefix(candidate[idx:], query) {
+				return matchWordPrefix
+			}
+		}
+		return matchSubstring
+	}
+
+	remaining := []rune(query)
+	for _, r := range candidate {
+		if len(remaining) > 0 && r == remaining[0] {
+			remaining = remaining[1:]
+		}
+	}
+	if len(remaining) == 0 {
+		return matchSubsequence
+	}
+	return noMatch
+}
+
+// fuzzyMatch returns up to limit candidates that match query, best
+// matches first. Candidates that match equally well keep their order,
+// so callers can list more relevant candidates (e.g. recently used
+// ones) first. An empty query matches everything.
+func fuzzyMatch(query string, candidates []string, limit int) []string {
+	type match struct {
+		value string
+		rank  matchRank
+	}
+	matches := []match{}
+	seen := map[string]bool{}
+	for _, c := range candidates {
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		if rank := rankMatch(query, c); rank != noMatch {
+			matches = append(matches, match{c, rank})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].rank < matches[j].rank })
+
+	out := make([]string, 0, limit)
+	for _, m := range matches {
+		if len(out) == limit {
+			break
+		}
+		out = append(out, m.value)
+	}
+	return out
+}
+
+// completeLastField wraps a suggestion function for options that take a
+// space-separated list, so that only the word being typed is completed.
+func completeLastField(suggest func(string) []string) func(string) []string {
+	return func(value string) []string {
+		head, last := "", value
+		if idx := strings.LastIndex(value, " "); idx >= 0 {
+			head, last = value[:idx+1], value[idx+1:]
+		}
+		suggestions := suggest(last)
+		out := make([]string, 0, len(suggestions))
+		for _, s := range suggestions {
+			if full := head + s; len(full) <= maxDiscordChoiceStringValue {
+				out = append(out, full)
+			}
+		}
+		return out
+	}
+}
+
+// autocompleteOptions builds an autocomplete handler from a suggestion
+// function for each option that has autocomplete enabled. Suggestions
+// are given the text typed so far and used as both choice name and value.
+func autocompleteOptions(suggesters map[string]func(string) []string) onInteractionHandler {
+	return func(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
+		choices := []*discordgo.ApplicationCommandOptionChoice{}
+		opt := focusedOption(i.ApplicationCommandData().Options)
+		if opt == nil {
+			logFor(i).Warn("Autocomplete interaction has no focused option")
+		} else if suggest, ok := suggesters[opt.Name]; !ok {
+			logFor(i).Warnf("No autocomplete suggestions for option %s", opt.Name)
+		} else {
+			value, _ := opt.Value.(string)
+			for _, suggestion := range suggest(value) {
+				if len(choices) == maxDiscordOptionChoices {
+					break
+				}
+				if suggestion == "" || len(suggestion) > maxDiscordChoiceStringValue {
+					continue
+				}
+				choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+					Name:  truncateChoiceName(suggestion),
+					Value: suggestion,
+				})
+			}
+		}
+
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+			Data: &discordgo.InteractionResponseData{Choices: choices},
+		})
+		if err != nil {
+			logFor(i).Error(err)
+		}
+	}
+}
+
+func truncateChoiceName(name string) string {
+	runes := []rune(name)
+	if len(runes) <= maxDiscordChoiceName {
+		return name
+	}
+	return string(runes[:maxDiscordChoiceName-1]) + "…"
+}
+
+// recentValues is a bounded list of values, most recently used first.
+type recentValues struct {
+	mutex  sync.Mutex
+	values []string
+	limit  int
+}
+
+func newRecentValues(limit int) *recentValues {
+	return &recentValues{limit: limit}
+}
+
+// add moves v to the front of the list, dropping the oldest value if the
+// list is full.
+func (r *recentValues) add(v string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	values := make([]string, 0, r.limit)
+	values = append(values, v)
+	for _, existing := range r.values {
+		if existing != v && len(values) < r.limit {
+			values = append(values, existing)
+		}
+	}
+	r.values = values
+}
+
+func (r *recentValues) list() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string{}, r.values...)
+}
@@ -0,0 +1,93 @@
+package kardbot
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/Kardbord/Kard-bot/kardbot/fakediscord"
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestFuzzyMatchRanksMatches(t *testing.T) {
+	candidates := []string{"America/Los_Angeles", "America/New_York", "Asia/Yangon", "Europe/London", "US/Pacific"}
+	cases := map[string][]string{
+		"america/new_york": {"America/New_York"},
+		"new york":         {"America/New_York"},
+		"york":             {"America/New_York"},
+		"ang":              {"America/Los_Angeles", "Asia/Yangon"},
+		"ny":               {"America/New_York"},
+		"zzz":              {},
+	}
+	for query, want := range cases {
+		if got := fuzzyMatch(query, candidates, maxDiscordOptionChoices); !reflect.DeepEqual(got, want) {
+			t.Errorf("fuzzyMatch(%q) = %v, want %v", query, got, want)
+		}
+	}
+
+	if got := fuzzyMatch("", candidates, 2); !reflect.DeepEqual(got, candidates[:2]) {
+		t.Errorf("empty query = %v, want the first candidates in order", got)
+	}
+}
+
+func autocompleteChoices(t *testing.T, fake *fakediscord.Session, i *discordgo.InteractionCreate) []string {
+	t.Helper()
+	bot().routeInteraction(fake, i)
+	resp := mustRespond(t, fake, i)
+	if resp.Initial.Type != discordgo.InteractionApplicationCommandAutocompleteResult {
+		t.Fatalf("response type %d is not an autocomplete result", resp.Initial.Type)
+	}
+	values := []string{}
+	for _, c := range resp.Initial.Data.Choices {
+		values = append(values, fmt.Sprint(c.Value))
+	}
+	return values
+}
+
+func TestTimezoneAutocomplete(t *testing.T) {
+	fake := newTestBot(t)
+
+	info := fake.Autocomplete(timeCmd, []*discordgo.ApplicationCommandInteractionDataOption{
+		fakediscord.SubCommandGroup(timeSubCmdGroupTZ, fakediscord.SubCommand(tzSubCmdInfo,
+			fakediscord.Focused(tzSubCmdInfoTZOpt, "new_york"),
+		)),
+	}, inTestGuild()...)
+	if got := autocompleteChoices(t, fake, info); len(got) == 0 || got[0] != "America/New_York" {
+		t.Errorf("suggested %v for new_york", got)
+	}
+
+	clock := fake.Autocomplete(timeCmd, []*discordgo.ApplicationCommandInteractionDataOption{
+		fakediscord.SubCommandGroup(timeSubCmdGroupTZ, fakediscord.SubCommand(tzSubCmdServerClock,
+			fakediscord.Focused(tzSubCmdServerClockTZOpt, "UTC europe/lond"),
+		)),
+	}, inTestGuild()...)
+	if got := autocompleteChoices(t, fake, clock); len(got) == 0 || got[0] != "UTC Europe/London" {
+		t.Errorf("suggested %v for a list of timezones", got)
+	}
+}
+
+func TestPastaAutocompleteIsNotLimitedToChoiceCount(t *testing.T) {
+	fake := newTestBot(t)
+	prev := pastaCfg.Load()
+	t.Cleanup(func() { pastaCfg.Store(prev) })
+
+	menu := map[string]pasta{"random": {Name: "random"}}
+	for n := 0; n < 2*maxDiscordOptionChoices; n++ {
+		name := fmt.Sprintf("pasta-%02d", n)
+		menu[name] = pasta{Name: name}
+	}
+	pastaCfg.Store(pastaConfig{menu: menu})
+
+	i := fake.Autocomplete(pastaCmd, []*discordgo.ApplicationCommandInteractionDataOption{
+		fakediscord.Focused(pastaOptionSelection, "pasta-4"),
+	}, inTestGuild()...)
+	got := autocompleteChoices(t, fake, i)
+	// Prefix matches come before the likes of pasta-04.
+	if len(got) != 14 || got[0] != "pasta-40" || got[9] != "pasta-49" {
+		t.Errorf("suggested %v", got)
+	}
+
+	if got := suggestPastas(""); len(got) != maxDiscordOptionChoices {
+		t.Errorf("%d suggestions for an empty query", len(got))
+	}
+}
@@ -1,7 +1,7 @@
 package kardbot
 
 import (
-	"fmt"
+	"context"
 	"os"
 	"strconv"
 	"strings"
@@ -10,40 +10,65 @@ import (
 	"github.com/bwmarrin/discordgo"
 	"github.com/gabriel-vasile/mimetype"
 	"github.com/lucasb-eyer/go-colorful"
-
-	log "github.com/sirupsen/logrus"
 )
 
 const helpCmd = "help"
 const roboCatPng string = "Robo_cat.png"
 
-func botInfo(s *discordgo.Session, i *discordgo.InteractionCreate) {
+// IDs of /help response messages.
+const (
+	msgHelpDescription = "help.description"
+	msgHelpMenus       = "help.menus"
+	msgHelpMenusList   = "help.menus-list"
+)
+
+func init() {
+	registerMessages(map[string]string{
+		msgHelpDescription: "Hello! I'm %s! You can find my code or submit an issue about my behavior on [GitHub](https://github.com/Kardbord/Kard-bot). Below is some information about the commands I offer.",
+		msgHelpMenus:       "Right-click menus",
+		msgHelpMenusList:   "Right-click a message or a user and open Apps.\n**Messages:** %s\n**Users:** %s",
+	})
+	registerCommand(&command{
+		name:       helpCmd,
+		definition: helpCmdDefinition,
+		handler:    botInfo,
+	})
+}
+
+func helpCmdDefinition() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        helpCmd,
+		Description: "Get helpful information about the bot.",
+	}
+}
+
+func botInfo(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	if isSelf, err := authorIsSelf(s, i); err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	} else if isSelf {
-		log.Trace("Ignoring message from self")
+		logFor(i).Trace("Ignoring message from self")
 		return
 	}
 
-	log.Debugf("Opening %s", roboCatPng)
+	logFor(i).Debugf("Opening %s", roboCatPng)
 	fd, err := os.Open(roboCatPng)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
 	defer fd.Close()
 	mimeType, err := mimetype.DetectReader(fd)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
 	_, err = fd.Seek(0, 0)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
@@ -51,13 +76,26 @@ func botInfo(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	hexColor, _ := strconv.ParseInt(strings.Replace(colorful.FastHappyColor().Hex(), "#", "", -1), 16, 32)
 	embed := dg_helpers.NewEmbed().
 		SetColor(int(hexColor)).
-		SetTitle(s.State.User.Username).
+		SetTitle(s.SelfUser().Username).
 		SetURL("https://github.com/Kardbord/Kard-bot").
-		SetDescription(fmt.Sprintf("Hello! I'm %s! You can find my code or submit an issue about my behavior on [GitHub](https://github.com/Kardbord/Kard-bot). Below is some information about the commands I offer.", s.State.User.Username)).
+		SetDescription(localized(i, msgHelpDescription, s.SelfUser().Username)).
 		SetThumbnail("attachment://" + roboCatPng)
 
+	var messageMenus, userMenus []string
 	for _, cmd := range getCommands() {
-		embed.AddField("/"+cmd.Name, cmd.Description)
+		name := localizedFor(i.Locale, cmd.Name, cmd.NameLocalizations)
+		switch cmd.Type {
+		case discordgo.MessageApplicationCommand:
+			messageMenus = append(messageMenus, name)
+		case discordgo.UserApplicationCommand:
+			userMenus = append(userMenus, name)
+		default:
+			embed.AddField("/"+name, localizedFor(i.Locale, cmd.Description, cmd.DescriptionLocalizations))
+		}
+	}
+	if len(messageMenus) > 0 || len(userMenus) > 0 {
+		embed.AddField(localized(i, msgHelpMenus), localized(i, msgHelpMenusList,
+			strings.Join(messageMenus, ", "), strings.Join(userMenus, ", ")))
 	}
 
 	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
@@ -75,7 +113,7 @@ func botInfo(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		},
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 	}
 }
@@ -1,13 +1,12 @@
 package kardbot
 
 import (
+	"context"
 	"fmt"
 	"sort"
-	"time"
 
 	"github.com/Kardbord/ubiquity/mathutils"
 	"github.com/bwmarrin/discordgo"
-	log "github.com/sirupsen/logrus"
 )
 
 const delBotDMCmd = "del-bot-dm"
@@ -15,21 +14,45 @@ const delBotDMCmd = "del-bot-dm"
 // API-defined limit of messages that can be retrieved or deleted at once
 const msgLimit = 100
 
-func deleteBotDMs(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func init() {
+	registerCommand(&command{
+		name:       delBotDMCmd,
+		definition: delBotDMCmdDefinition,
+		handler:    deleteBotDMs,
+		metadata:   CommandMetadata{DMOnly: true},
+	})
+}
+
+func delBotDMCmdDefinition() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        delBotDMCmd,
+		Description: "Clear your DM history with the bot. Only works when issued from DMs.",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "msg-count",
+				Description: fmt.Sprintf("Number of messages to delete. Messages from you will be skipped. Max of %d.", msgLimit),
+				Required:    true,
+			},
+		},
+	}
+}
+
+func deleteBotDMs(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	fromSelf, err := authorIsSelf(s, i)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
 	if fromSelf {
-		log.Warn("Ignoring deleteDM request from self")
+		logFor(i).Warn("Ignoring deleteDM request from self")
 		return
 	}
 
 	imeta, err := getInteractionMetaData(i)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
@@ -41,39 +64,18 @@ func deleteBotDMs(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		},
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 		return
 	}
 
+	// Restricted to DMs by the command's metadata.
 	ch, err := s.Channel(imeta.ChannelID)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 		return
 	}
-	if ch.Type != discordgo.ChannelTypeDM {
-		uc, err := s.UserChannelCreate(imeta.AuthorID)
-		if err != nil {
-			log.Error(err)
-			interactionFollowUpEphemeralError(s, i, true, err)
-			return
-		}
-
-		_, err = s.ChannelMessageSend(uc.ID, fmt.Sprintf("Looks like you tried to use `/%s` outside of our DMs. Run it from here instead! :)", delBotDMCmd))
-		if err != nil {
-			log.Error(err)
-			interactionFollowUpEphemeralError(s, i, true, err)
-			return
-		}
-
-		time.Sleep(time.Millisecond * 100)
-		errMsg := fmt.Sprintf("looks like you tried to use `/%s` outside of our DMs. Run it from there instead! :)", delBotDMCmd)
-		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
-			Content: &errMsg,
-		})
-		return
-	}
 
 	msgsToDelete := int(i.ApplicationCommandData().Options[0].IntValue())
 	if msgsToDelete <= 0 {
@@ -83,7 +85,7 @@ func deleteBotDMs(s *discordgo.Session, i *discordgo.InteractionCreate) {
 
 	msgs, err := s.ChannelMessages(ch.ID, mathutils.Min(msgsToDelete, msgLimit), "", "", "")
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 		return
 	}
@@ -95,8 +97,7 @@ func deleteBotDMs(s *discordgo.Session, i *discordgo.InteractionCreate) {
 
 	// No way to bulk delete messages in a DM channel
 	deletedCount := 0
-	for i := 0; i < len(msgs); i++ {
-		msg := msgs[i]
+	for _, msg := range msgs {
 		msgAuthorID := ""
 		if msg.Author != nil {
 			msgAuthorID = msg.Author.ID
@@ -104,17 +105,17 @@ func deleteBotDMs(s *discordgo.Session, i *discordgo.InteractionCreate) {
 			msgAuthorID = msg.Member.User.ID
 		}
 		if msgAuthorID == "" {
-			log.Errorf("Could not ascertain msg author, skipping msg:\n> %s", msg.Content)
+			logFor(i).Errorf("Could not ascertain msg author, skipping msg:\n> %s", msg.Content)
 			continue
 		}
 
-		if msgAuthorID != s.State.User.ID {
-			log.Tracef("Not deleting user message:\n> %s", msg.Content)
+		if msgAuthorID != s.SelfUser().ID {
+			logFor(i).Tracef("Not deleting user message:\n> %s", msg.Content)
 			continue
 		}
 		err = s.ChannelMessageDelete(ch.ID, msg.ID)
 		if err != nil {
-			log.Error(err)
+			logFor(i).Error(err)
 		}
 		deletedCount++
 	}
@@ -124,7 +125,7 @@ func deleteBotDMs(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		Content: &errMsg,
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 	}
 }
@@ -0,0 +1,355 @@
+package kardbot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+type commandChangeKind string
+
+const (
+	commandCreate commandChangeKind = "create"
+	commandEdit   commandChangeKind = "edit"
+	commandDelete commandChangeKind = "delete"
+)
+
+// commandChange is a single REST call needed to bring the commands
+// registered with Discord in line with the bot's own.
+type commandChange struct {
+	Kind    commandChangeKind
+	GuildID string
+	// The command as Discord has it. Nil for creates.
+	Registered *discordgo.ApplicationCommand
+	// The command as the bot defines it. Nil for deletes.
+	Desired *discordgo.ApplicationCommand
+	// Top level fields that differ, for edits.
+	Fields []string
+}
+
+func (c commandChange) String() string {
+	cmd := c.Desired
+	if cmd == nil {
+		cmd = c.Registered
+	}
+	where := commandScopeLabel(c.GuildID)
+	if c.Kind == commandEdit {
+		return fmt.Sprintf("%s %s %s (%s)", c.Kind, commandLabel(cmd), where, strings.Join(c.Fields, ", "))
+	}
+	return fmt.Sprintf("%s %s %s", c.Kind, commandLabel(cmd), where)
+}
+
+// commandLabel names a command the way users see it.
+func commandLabel(cmd *discordgo.ApplicationCommand) string {
+	if cmd.Type == 0 || cmd.Type == discordgo.ChatApplicationCommand {
+		return "/" + cmd.Name
+	}
+	return fmt.Sprintf("%q", cmd.Name)
+}
+
+// Discord allows a chat command and a context menu command to share a name.
+func commandKey(cmd *discordgo.ApplicationCommand) string {
+	t := cmd.Type
+	if t == 0 {
+		t = discordgo.ChatApplicationCommand
+	}
+	return fmt.Sprintf("%d:%s", t, cmd.Name)
+}
+
+// diffCommands works out what needs to be created, edited, and deleted in
+// a guild (or globally, if guildID is empty) so that the registered
+// commands match the desired ones.
+func diffCommands(guildID string, registered, desired []*discordgo.ApplicationCommand) []commandChange {
+	byKey := make(map[string]*discordgo.ApplicationCommand, len(registered))
+	for _, cmd := range registered {
+		byKey[commandKey(cmd)] = cmd
+	}
+
+	changes := []commandChange{}
+	for _, want := range desired {
+		key := commandKey(want)
+		have, ok := byKey[key]
+		delete(byKey, key)
+		if !ok {
+			changes = append(changes, commandChange{Kind: commandCreate, GuildID: guildID, Desired: want})
+			continue
+		}
+		if fields := commandFieldDiff(guildID, have, want); len(fields) > 0 {
+			changes = append(changes, commandChange{Kind: commandEdit, GuildID: guildID, Registered: have, Desired: want, Fields: fields})
+		}
+	}
+
+	stale := make([]*discordgo.ApplicationCommand, 0, len(byKey))
+	for _, cmd := range byKey {
+		stale = append(stale, cmd)
+	}
+	sort.Slice(stale, func(i, j int) bool { return commandKey(stale[i]) < commandKey(stale[j]) })
+	for _, cmd := range stale {
+		changes = append(changes, commandChange{Kind: commandDelete, GuildID: guildID, Registered: cmd})
+	}
+	return changes
+}
+
+// commandFieldDiff lists the top level fields that differ between two
+// commands, ignoring those assigned by Discord and defaults that Discord
+// fills in for fields left unset.
+func commandFieldDiff(guildID string, a, b *discordgo.ApplicationCommand) []string {
+	ca, cb := canonicalCommand(guildID, a), canonicalCommand(guildID, b)
+	fields := []string{}
+	for field := range ca {
+		if !reflect.DeepEqual(ca[field], cb[field]) {
+			fields = append(fields, field)
+		}
+	}
+	for field := range cb {
+		if _, ok := ca[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func canonicalCommand(guildID string, cmd *discordgo.ApplicationCommand) map[string]any {
+	c := *cmd
+	c.ID, c.ApplicationID, c.GuildID, c.Version = "", "", "", ""
+	c.DefaultPermission = nil
+	if c.Type == 0 {
+		c.Type = discordgo.ChatApplicationCommand
+	}
+	// DM permission only applies to global commands, and defaults to true.
+	if guildID != "" {
+		c.DMPermission = nil
+	} else if c.DMPermission == nil {
+		dmPermission := true
+		c.DMPermission = &dmPermission
+	}
+	if c.NSFW != nil && !*c.NSFW {
+		c.NSFW = nil
+	}
+	if c.NameLocalizations != nil && len(*c.NameLocalizations) == 0 {
+		c.NameLocalizations = nil
+	}
+	if c.DescriptionLocalizations != nil && len(*c.DescriptionLocalizations) == 0 {
+		c.DescriptionLocalizations = nil
+	}
+	c.Options = canonicalOptions(c.Options)
+
+	// Round trip through JSON so that, for example, an int choice value
+	// compares equal to the float64 Discord hands back.
+	buf, err := json.Marshal(c)
+	if err != nil {
+		log.Error(err)
+		return nil
+	}
+	out := map[string]any{}
+	if err = json.Unmarshal(buf, &out); err != nil {
+		log.Error(err)
+		return nil
+	}
+	return out
+}
+
+func canonicalOptions(opts []*discordgo.ApplicationCommandOption) []*discordgo.ApplicationCommandOption {
+	if len(opts) == 0 {
+		return nil
+	}
+	out := make([]*discordgo.ApplicationCommandOption, len(opts))
+	for idx, opt := range opts {
+		o := *opt
+		if len(o.NameLocalizations) == 0 {
+			o.NameLocalizations = nil
+		}
+		if len(o.DescriptionLocalizations) == 0 {
+			o.DescriptionLocalizations = nil
+		}
+		if len(o.ChannelTypes) == 0 {
+			o.ChannelTypes = nil
+		}
+		if len(o.Choices) == 0 {
+			o.Choices = nil
+		} else {
+			o.Choices = make([]*discordgo.ApplicationCommandOptionChoice, len(opt.Choices))
+			for cidx, choice := range opt.Choices {
+				c := *choice
+				if len(c.NameLocalizations) == 0 {
+					c.NameLocalizations = nil
+				}
+				o.Choices[cidx] = &c
+			}
+		}
+		o.Options = canonicalOptions(o.Options)
+		out[idx] = &o
+	}
+	return out
+}
+
+// commandScopes lists where commands are registered: globally, and in
+// the testbed guild if there is one, where changes show up immediately.
+func commandScopes() []string {
+	scopes := []string{""}
+	if getTestbedGuild() != "" {
+		scopes = append(scopes, getTestbedGuild())
+	}
+	return scopes
+}
+
+func commandScopeLabel(guildID string) string {
+	if guildID == "" {
+		return "globally"
+	}
+	return "in guild " + guildID
+}
+
+// syncCommands fetches the commands registered in a guild (or globally,
+// if guildID is empty) and makes only the changes needed for them to
+// match desired. With dryRun, the changes are returned but not made.
+func syncCommands(s discordSession, guildID string, desired []*discordgo.ApplicationCommand, dryRun bool) ([]commandChange, error) {
+	appID := s.SelfUser().ID
+	registered, err := s.ApplicationCommands(appID, guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := diffCommands(guildID, registered, desired)
+	if dryRun {
+		return changes, nil
+	}
+
+	errs := []error{}
+	for _, c := range changes {
+		log.Infof("Command registration: %s", c)
+		switch c.Kind {
+		case commandCreate:
+			_, err = s.ApplicationCommandCreate(appID, guildID, c.Desired)
+		case commandEdit:
+			_, err = s.ApplicationCommandEdit(appID, guildID, c.Registered.ID, c.Desired)
+		case commandDelete:
+			err = s.ApplicationCommandDelete(appID, guildID, c.Registered.ID)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c, err))
+		}
+	}
+	return changes, errors.Join(errs...)
+}
+
+// allCommandScopes lists everywhere commands could be registered:
+// globally, and in every guild the bot is a member of.
+func (kbot *kardbot) allCommandScopes() ([]string, error) {
+	guilds, err := kbot.GetAllGuilds()
+	if err != nil {
+		return nil, err
+	}
+	scopes := []string{""}
+	for _, g := range guilds {
+		scopes = append(scopes, g.ID)
+	}
+	return scopes, nil
+}
+
+// unregisterAllCommands deletes every command the bot has registered,
+// globally and in every guild.
+func (kbot *kardbot) unregisterAllCommands() error {
+	scopes, err := kbot.allCommandScopes()
+	if err != nil {
+		return err
+	}
+	errs := []error{}
+	for _, guildID := range scopes {
+		if _, err = syncCommands(kbot.api, guildID, nil, false); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// connectREST sets up the global bot to make REST calls to Discord
+// without connecting to the gateway or loading any state.
+func connectREST() error {
+	loadEnv()
+	dgs, err := discordgo.New("Bot " + getBotToken())
+	if err != nil {
+		return err
+	}
+	gbot = &kardbot{Session: dgs, api: dgSession{dgs}}
+	gbot.configure()
+	dgs.State.User, err = dgs.User("@me")
+	return err
+}
+
+func printCommandChanges(guildID string, changes []commandChange) {
+	if len(changes) == 0 {
+		fmt.Printf("Commands registered %s are up to date\n", commandScopeLabel(guildID))
+	}
+	for _, c := range changes {
+		fmt.Println(c)
+	}
+}
+
+// RegisterCommands brings the commands registered with Discord in line
+// with the bot's own, globally and in the testbed guild, or only in the
+// given guild if guildID is not empty. With dryRun, the changes are
+// printed but not made.
+func RegisterCommands(guildID string, dryRun bool) error {
+	if err := connectREST(); err != nil {
+		return err
+	}
+	loadFeatureConfigs()
+	if !commandsAreValid() {
+		return errors.New("one or more commands is invalid")
+	}
+
+	scopes := commandScopes()
+	if guildID != "" {
+		scopes = []string{guildID}
+	}
+	cmds := getCommands()
+	for _, scope := range scopes {
+		changes, err := syncCommands(gbot.api, scope, cmds, dryRun)
+		if changes == nil {
+			// The registered commands couldn't be fetched.
+			return err
+		}
+		printCommandChanges(scope, changes)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnregisterCommands deletes every command the bot has registered,
+// globally and in every guild, or only in the given guild if guildID is
+// not empty. With dryRun, the deletions are printed but not made.
+func UnregisterCommands(guildID string, dryRun bool) error {
+	if err := connectREST(); err != nil {
+		return err
+	}
+
+	scopes := []string{guildID}
+	if guildID == "" {
+		var err error
+		if scopes, err = gbot.allCommandScopes(); err != nil {
+			return err
+		}
+	}
+	for _, scope := range scopes {
+		changes, err := syncCommands(gbot.api, scope, nil, dryRun)
+		if changes == nil {
+			// The registered commands couldn't be fetched.
+			return err
+		}
+		printCommandChanges(scope, changes)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package kardbot
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestSyncCommandsOnlySendsChanges(t *testing.T) {
+	fake := newTestBot(t)
+	cmds := getCommands()
+
+	changes, err := syncCommands(fake, "", cmds, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != len(cmds) || len(fake.Commands("")) != len(cmds) {
+		t.Fatalf("expected %d creates on first sync, got %d changes and %d commands", len(cmds), len(changes), len(fake.Commands("")))
+	}
+
+	// Discord hands back defaults and IDs that were never sent, and
+	// none of them should count as a change.
+	for _, method := range []string{"ApplicationCommandCreate", "ApplicationCommandEdit", "ApplicationCommandDelete"} {
+		fake.FailOn(method, errors.New("unexpected request"))
+	}
+	changes, err = syncCommands(fake, "", getCommands(), false)
+	if err != nil || len(changes) != 0 {
+		t.Errorf("unchanged commands were re-registered: %v %v", changes, err)
+	}
+}
+
+func TestSyncCommandsCreatesEditsAndDeletes(t *testing.T) {
+	fake := newTestBot(t)
+	stale := &discordgo.ApplicationCommand{Name: "stale", Description: "from an older version"}
+	edited := &discordgo.ApplicationCommand{Name: "edited", Description: "before"}
+	kept := &discordgo.ApplicationCommand{
+		Name:        "kept",
+		Description: "unchanged",
+		Options: []*discordgo.ApplicationCommandOption{{
+			Type:        discordgo.ApplicationCommandOptionInteger,
+			Name:        "n",
+			Description: "a number",
+			Choices:     []*discordgo.ApplicationCommandOptionChoice{{Name: "one", Value: 1}},
+		}},
+	}
+	if _, err := syncCommands(fake, testGuildID, []*discordgo.ApplicationCommand{stale, edited, kept}, false); err != nil {
+		t.Fatal(err)
+	}
+	editedID := fake.Commands(testGuildID)[1].ID
+
+	desired := []*discordgo.ApplicationCommand{
+		{Name: "edited", Description: "after"},
+		kept,
+		{Name: "created", Description: "new"},
+	}
+	dryRun, err := syncCommands(fake, testGuildID, desired, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.Commands(testGuildID)) != 3 || fake.Commands(testGuildID)[0].Name != "stale" {
+		t.Fatal("dry run changed the registered commands")
+	}
+
+	changes, err := syncCommands(fake, testGuildID, desired, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"edit /edited in guild 300 (description)",
+		"create /created in guild 300",
+		"delete /stale in guild 300",
+	}
+	if len(changes) != len(want) || len(dryRun) != len(want) {
+		t.Fatalf("got changes %v, want %v", changes, want)
+	}
+	for idx, c := range changes {
+		if c.String() != want[idx] || dryRun[idx].String() != want[idx] {
+			t.Errorf("change %d = %q (dry run %q), want %q", idx, c, dryRun[idx], want[idx])
+		}
+	}
+
+	registered := map[string]*discordgo.ApplicationCommand{}
+	for _, cmd := range fake.Commands(testGuildID) {
+		registered[cmd.Name] = cmd
+	}
+	if _, ok := registered["stale"]; ok {
+		t.Error("stale command was not deleted")
+	}
+	if cmd := registered["edited"]; cmd == nil || cmd.ID != editedID || cmd.Description != "after" {
+		t.Errorf("command was not edited in place: %+v", cmd)
+	}
+}
+
+func TestUnregisterAllCommands(t *testing.T) {
+	fake := newTestBot(t)
+	for _, guildID := range []string{"", testGuildID} {
+		if _, err := syncCommands(fake, guildID, getCommands(), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := bot().unregisterAllCommands(); err != nil {
+		t.Fatal(err)
+	}
+	for _, guildID := range []string{"", testGuildID} {
+		if cmds := fake.Commands(guildID); len(cmds) != 0 {
+			t.Errorf("%d commands still registered %s", len(cmds), commandScopeLabel(guildID))
+		}
+	}
+}
@@ -1,13 +1,19 @@
 package kardbot
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
+	cmap "github.com/orcaman/concurrent-map/v2"
 	log "github.com/sirupsen/logrus"
 )
 
-type onInteractionHandler func(*discordgo.Session, *discordgo.InteractionCreate)
+type onInteractionHandler func(context.Context, discordSession, *discordgo.InteractionCreate)
 
 // The max number of command options any single command is allowed to have.
 const (
@@ -16,458 +22,357 @@ const (
 	maxDiscordSelectMenuOpts             = 25
 	maxDiscordActionRows                 = 5
 	maxDiscordSelectMenuPlaceholderChars = 150
+	// Applies to the label, value and description of a select menu option.
+	maxDiscordSelectMenuOptionChars = 100
 )
 
-func getCommands() []*discordgo.ApplicationCommand {
-	allcmds := []*discordgo.ApplicationCommand{
-		{
-			Name:        RollCmd,
-			Description: "Dice rolling fun!",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionSubCommand,
-					Name:        RollSubCmdDnD,
-					Description: "Get a set of buttons for rolling DnD dice.",
-				},
-				{
-					Type:        discordgo.ApplicationCommandOptionSubCommand,
-					Name:        RollSubCmdCustom,
-					Description: "Rolls a D{X} die {Y} times, where X and Y are provided by the user.",
-					Options: []*discordgo.ApplicationCommandOption{
-						{
-							Type:        discordgo.ApplicationCommandOptionInteger,
-							Name:        "dice-count",
-							Description: "How many dice should be rolled?",
-							Required:    true,
-						},
-						{
-							Type:        discordgo.ApplicationCommandOptionString,
-							Name:        "dice-sides",
-							Description: "How many sides on the dice? Can optionally be prefixed with 'D' or 'd'.",
-							Required:    true,
-						},
-					},
-				},
-			},
-		},
-		{
-			Name:        oddsCmd,
-			Description: "What are the odds that an event will occur? Use third-person voice for best results.",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        "event",
-					Description: "something that you want to know the odds of",
-					Required:    true,
-				},
-			},
-		},
-		{
-			Name:        logLevelCmd,
-			Description: "Update the log level of the bot. Only works for whitelisted users.",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        "level",
-					Description: "Level at which to log.",
-					Required:    true,
-					Choices:     logLevelChoices(),
-				},
-			},
-		},
-		{
-			Name:        pastaCmd,
-			Description: "Serves you a delicious pasta!",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        "selection",
-					Description: "Your choice of delicious pasta!",
-					Required:    true,
-					Choices:     pastaChoices(),
-				},
-				{
-					Type:        discordgo.ApplicationCommandOptionBoolean,
-					Name:        pastaOptionTTS,
-					Description: "Read the copy-pasta aloud to everyone viewing the channel using text-to-speech",
-					Required:    false,
-				},
-				{
-					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        pastaOptionUwu,
-					Description: "Sprinkle a healthy dose of UwU on your pasta!",
-					Required:    false,
-					Choices:     uwuChoices(),
-				},
-			},
-		},
-		{
-			Name:        uwuCmd,
-			Description: "UwU-ifies messages, because why wouldn't it?",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionSubCommand,
-					Name:        "custom",
-					Description: "UwU-ify your own custom message!",
-					Options: []*discordgo.ApplicationCommandOption{
-						{
-							Type:        discordgo.ApplicationCommandOptionString,
-							Name:        "uwulevel",
-							Description: "How badly should your message be uwu-ed?",
-							Required:    true,
-							Choices:     uwuChoices(),
-						},
-						{
-							Type:        discordgo.ApplicationCommandOptionString,
-							Name:        "message",
-							Description: "Your message, soon to be uwuified!",
-							Required:    true,
-						},
-						{
-							Type:        discordgo.ApplicationCommandOptionBoolean,
-							Name:        "tts",
-							Description: "Read the uwuified copy-pasta aloud to everyone viewing the channel using text-to-speech",
-							Required:    false,
-						},
-					},
-				},
-				{
-					Type:        discordgo.ApplicationCommandOptionSubCommand,
-					Name:        uwuSubCmdPasta,
-					Description: "UwU-ify a copy-pasta!",
-					Options: []*discordgo.ApplicationCommandOption{
-						{
-							Type:        discordgo.ApplicationCommandOptionString,
-							Name:        "uwulevel",
-							Description: "How badly should your message be uwu-ed?",
-							Required:    true,
-							Choices:     uwuChoices(),
-						},
-						{
-							Type:        discordgo.ApplicationCommandOptionString,
-							Name:        uwuSubCmdPasta,
-							Description: "A pasta, but served with a healthy topping of UwU!",
-							Required:    true,
-							Choices:     pastaChoices(),
-						},
-						{
-							Type:        discordgo.ApplicationCommandOptionBoolean,
-							Name:        "tts",
-							Description: "Read the uwuified copy-pasta aloud to everyone viewing the channel using text-to-speech",
-							Required:    false,
-						},
-					},
-				},
-			},
-		},
-		{
-			Name:        redditRouletteCmd,
-			Description: "Retrieve a random reddit post",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Name:        redditRouletteSubCmdAny,
-					Description: "Retrieve a random reddit post. May be NSFW.",
-					Type:        discordgo.ApplicationCommandOptionSubCommand,
-					Options: []*discordgo.ApplicationCommandOption{
-						{
-							Type:        discordgo.ApplicationCommandOptionString,
-							Name:        "subreddits",
-							Description: "Subreddits from which you want the random post to be retrieved, separated by spaces",
-							Required:    false,
-						},
-					},
-				},
-				{
-					Name:        redditRouletteSubCmdSFW,
-					Description: "Retrieve a random reddit post that is not marked as NSFW",
-					Type:        discordgo.ApplicationCommandOptionSubCommand,
-					Options: []*discordgo.ApplicationCommandOption{
-						{
-							Type:        discordgo.ApplicationCommandOptionString,
-							Name:        "subreddits",
-							Description: "Subreddits from which you want the random post to be retrieved, separated by spaces",
-							Required:    false,
-						},
-					},
-				},
-				{
-					Name:        redditRouletteSubCmdNSFW,
-					Description: "Retrieve a random reddit post that is marked as NSFW.",
-					Type:        discordgo.ApplicationCommandOptionSubCommand,
-					Options: []*discordgo.ApplicationCommandOption{
-						{
-							Type:        discordgo.ApplicationCommandOptionString,
-							Name:        "subreddits",
-							Description: "Subreddits from which you want the random post to be retrieved, separated by spaces",
-							Required:    false,
-						},
-					},
-				},
-			},
-		},
-		{
-			Name:        complimentsCmd,
-			Description: "Receive a daily compliment!",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionSubCommand,
-					Name:        complimentsGet,
-					Description: "Get a compliment!",
-					Options: []*discordgo.ApplicationCommandOption{
-						{
-							Type:        discordgo.ApplicationCommandOptionBoolean,
-							Name:        complimentInDM,
-							Description: "Get the compliment as a DM",
-							Required:    false,
-						},
-					},
-				},
-				{
-					Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
-					Name:        complimentsOptIn,
-					Description: "Opt-in to daily DM compliments",
-					Options: []*discordgo.ApplicationCommandOption{
-						{
-							Type:        discordgo.ApplicationCommandOptionSubCommand,
-							Name:        complimentsMorning,
-							Description: "Opt in to daily DM compliments in the morning",
-						},
-						{
-							Type:        discordgo.ApplicationCommandOptionSubCommand,
-							Name:        complimentsEvening,
-							Description: "Opt in to daily DM compliments in the evening",
-						},
-					},
-				},
-				{
-					Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
-					Name:        complimentsOptOut,
-					Description: "Opt-out of daily DM compliments",
-					Options: []*discordgo.ApplicationCommandOption{
-						{
-							Type:        discordgo.ApplicationCommandOptionSubCommand,
-							Name:        complimentsMorning,
-							Description: "Opt out of daily DM compliments in the morning",
-						},
-						{
-							Type:        discordgo.ApplicationCommandOptionSubCommand,
-							Name:        complimentsEvening,
-							Description: "Opt out of daily DM compliments in the evening",
-						},
-					},
-				},
-			},
-		},
-		{
-			Name:        creepyDMCmd,
-			Description: "What do you mean you don't want to receive creepy DMs?",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionSubCommand,
-					Name:        creepyDMGet,
-					Description: "Get a creepy DM ASAP",
-					Options: []*discordgo.ApplicationCommandOption{
-						{
-							Type:        discordgo.ApplicationCommandOptionBoolean,
-							Name:        creepyChannelDM,
-							Description: "Send the message to the channel instead of as a DM",
-							Required:    false,
-						},
-					},
-				},
-				{
-					Type:        discordgo.ApplicationCommandOptionSubCommand,
-					Name:        creepyDMOptIn,
-					Description: "Opt in to random creepy DMs (1 per day max)",
-				},
-				{
-					Type:        discordgo.ApplicationCommandOptionSubCommand,
-					Name:        creepyDMOptOut,
-					Description: "Opt out of random creepy DMs",
-				},
-			},
-		},
-		{
-			Name:        delBotDMCmd,
-			Description: "Clear your DM history with the bot. Only works when issued from DMs.",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionInteger,
-					Name:        "msg-count",
-					Description: fmt.Sprintf("Number of messages to delete. Messages from you will be skipped. Max of %d.", msgLimit),
-					Required:    true,
-				},
-			},
-		},
-		{
-			Name:        madlibCmd,
-			Description: "The bot will fill in any blanks indicated with " + madlibBlank,
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        "prompt",
-					Description: fmt.Sprintf("An input prompt containing blanks. Example: 'The %s jumps over the %s.'", madlibBlank, madlibBlank),
-					Required:    true,
-				},
-			},
-		},
-		{
-			Name:        pollCmd,
-			Description: "Create a poll",
-			Options:     getPollOpts(),
-		},
-		{
-			Name:        storyTimeCmd,
-			Description: "The bot will tell you a short story (but not a good or sensical one) based on a given prompt.",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        storyTimePromptOpt,
-					Description: "A prompt to generate a story from.",
-					Required:    false,
-				},
-				{
-					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        storyTimeModelOpt,
-					Description: "The text generation AI model to use. For example, gpt2 or EleutherAI/gpt-neo-125M.",
-					Required:    false,
-				},
-				{
-					Type:        discordgo.ApplicationCommandOptionBoolean,
-					Name:        storyTimeHelpOpt,
-					Description: "Print a helpful message about how to use this command.",
-					Required:    false,
-				},
-			},
-		},
-		{
-			Name:        roleSelectMenuCommand,
-			Description: "Allow users to select roles for themselves",
-			Options:     roleSelectCmdOpts(),
-		},
-		{
-			Name:        embedCmd,
-			Description: "Build a custom embed",
-			Options:     embedCmdOpts(),
-		},
-		{
-			Name:        timeCmd,
-			Description: "Time related commands",
-			Options:     timeCmdOpts(),
-		},
-		{
-			Name:        renderCmd,
-			Description: "Ask an AI to generate an image from a prompt.",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Name:        dalle2SubCmd,
-					Description: "Ask Open AI's DALL·E 2 model to generate an image from a prompt.",
-					Type:        discordgo.ApplicationCommandOptionSubCommand,
-					Options:     dalle2Opts(),
-				},
-				{
-					Name:        dalle3SubCmd,
-					Description: "Ask Open AI's DALL·E 3 model to generate an image from a prompt.",
-					Type:        discordgo.ApplicationCommandOptionSubCommand,
-					Options:     dalle3Opts(),
-				},
-				{
-					Name:        hfSubCmd,
-					Description: "Ask a HuggingFace model to generate an image from a prompt.",
-					Type:        discordgo.ApplicationCommandOptionSubCommand,
-					Options:     hfOpts(),
-				},
-			},
-		},
-		{
-			Name:        helpCmd,
-			Description: "Get helpful information about the bot.",
-		},
+// CommandMetadata describes restrictions enforced by the interaction
+// router before a command's handlers are invoked.
+type CommandMetadata struct {
+	// The command may only be used from within a guild.
+	GuildOnly bool
+	// The command may only be used from within the user's DMs with the bot.
+	DMOnly bool
+	// Who may use the command, regardless of their guild permissions.
+	Privilege privilegeLevel
+	// Minimum time a user must wait between uses of the command.
+	Cooldown time.Duration
+	// Guild permissions a member needs to use the command. Sent to Discord
+	// as the command's default member permissions, and checked again here
+	// since server admins can override those. Bot managers and bot admins
+	// are treated as having every permission.
+	Permissions int64
+}
+
+// Command is a self-describing bot feature. Everything needed to register,
+// route, and document a command lives on the Command itself, so adding a
+// feature only requires calling registerCommand from the feature's file.
+type Command interface {
+	// Name of the command, as shown in /help.
+	Name() string
+	// The application commands to register with Discord. Called each time
+	// commands are registered, so choices reflect the current configuration.
+	Definitions() []*discordgo.ApplicationCommand
+	// Reports whether an application command name belongs to this Command.
+	Matches(name string) bool
+	Metadata() CommandMetadata
+	// Handles the InteractionApplicationCommand event.
+	HandleCommand(context.Context, discordSession, *discordgo.InteractionCreate)
+	// Handles InteractionApplicationCommandAutocomplete events. May be nil.
+	AutocompleteHandler() onInteractionHandler
+	// Message components (buttons, select menus) owned by this Command.
+	ComponentRoutes() []interactionRoute
+	// Modals owned by this Command.
+	ModalRoutes() []interactionRoute
+}
+
+// Maps a component or modal custom ID to its handler.
+type interactionRoute struct {
+	// Exact custom ID to match. Ignored if pattern is set.
+	id string
+	// Optional pattern for dynamically generated custom IDs.
+	pattern *regexp.Regexp
+	handler onInteractionHandler
+	// Name of the Command the route belongs to, filled in when the route
+	// is looked up. Empty for routes that don't belong to any command.
+	owner string
+}
+
+// label identifies the route without the dynamic parts of its custom IDs.
+func (r interactionRoute) label() string {
+	if r.pattern != nil {
+		return r.pattern.String()
 	}
+	return r.id
+}
 
-	// Have to get creative when adding meme template commands
-	// since there is a limit to the number of options a command
-	// can have.
-	allcmds = append(allcmds, memeCommands()...)
-	return allcmds
+func (r interactionRoute) matches(customID string) bool {
+	if r.pattern != nil {
+		return r.pattern.MatchString(customID)
+	}
+	return r.id == customID
+}
+
+// A right-click menu entry on a message or a user. Context menus belong
+// to the command whose logic they reuse, and share its metadata.
+type contextMenu struct {
+	// Shown in Discord's Apps menu. Unlike slash command names, this may
+	// contain capitals and spaces.
+	name string
+	// discordgo.MessageApplicationCommand or discordgo.UserApplicationCommand
+	target  discordgo.ApplicationCommandType
+	handler onInteractionHandler
+}
+
+// command is the standard implementation of Command.
+type command struct {
+	name string
+	// Builds the application command. Use definitions instead if
+	// a single feature needs to register more than one command.
+	definition  func() *discordgo.ApplicationCommand
+	definitions func() []*discordgo.ApplicationCommand
+	// Defaults to an exact match on name if not set.
+	matches func(string) bool
+
+	metadata     CommandMetadata
+	handler      onInteractionHandler
+	autocomplete onInteractionHandler
+	components   []interactionRoute
+	modals       []interactionRoute
+	contextMenus []contextMenu
 }
 
-func getCommandImpls() map[string]onInteractionHandler {
-	return map[string]onInteractionHandler{
-		RollCmd:               roll,
-		logLevelCmd:           updateLogLevel,
-		pastaCmd:              servePasta,
-		redditRouletteCmd:     redditRoulette,
-		uwuCmd:                uwuify,
-		complimentsCmd:        complimentHandler,
-		creepyDMCmd:           creepyDMHandler,
-		helpCmd:               botInfo,
-		oddsCmd:               whatAreTheOdds,
-		memeCommand:           buildAMeme,
-		delBotDMCmd:           deleteBotDMs,
-		storyTimeCmd:          storyTime,
-		roleSelectMenuCommand: handleRoleSelectMenuCommand,
-		embedCmd:              handleEmbedCmd,
-		madlibCmd:             handleMadLibCmd,
-		timeCmd:               handleTimeCmd,
-		pollCmd:               handlePollCmd,
-		renderCmd:             handleRenderCmd,
+func (c *command) Name() string { return c.name }
+
+func (c *command) Definitions() []*discordgo.ApplicationCommand {
+	var defs []*discordgo.ApplicationCommand
+	if c.definitions != nil {
+		defs = c.definitions()
+	} else if c.definition != nil {
+		defs = []*discordgo.ApplicationCommand{c.definition()}
+	}
+	for _, menu := range c.contextMenus {
+		defs = append(defs, &discordgo.ApplicationCommand{Name: menu.name, Type: menu.target})
 	}
+
+	for _, def := range defs {
+		if c.metadata.GuildOnly {
+			dmPermission := false
+			def.DMPermission = &dmPermission
+		}
+		if perms := defaultMemberPermissions(c); perms != 0 {
+			def.DefaultMemberPermissions = &perms
+		}
+	}
+	return defs
 }
 
-// TODO: expand on this for all fields
-func validateCmdRegex() bool {
-	conforms := true
-	for _, cmd := range getCommands() {
-		if !validCommandRegex().MatchString(cmd.Name) {
-			log.Errorf(`Command %s does not conform to Discord's command naming requirements`, cmd.Name)
-			conforms = false
+func (c *command) Matches(name string) bool {
+	if _, ok := c.contextMenu(name); ok {
+		return true
+	}
+	if c.matches != nil {
+		return c.matches(name)
+	}
+	return name == c.name
+}
+
+func (c *command) Metadata() CommandMetadata { return c.metadata }
+
+func (c *command) contextMenu(name string) (contextMenu, bool) {
+	for _, menu := range c.contextMenus {
+		if menu.name == name {
+			return menu, true
 		}
-		for _, opt1 := range cmd.Options {
-			if !validCommandRegex().MatchString(opt1.Name) {
-				log.Errorf(`Option %s.%s does not conform to Discord's command naming requirements`, cmd.Name, opt1.Name)
-				conforms = false
-			}
+	}
+	return contextMenu{}, false
+}
 
-			switch opt1.Type {
-			case discordgo.ApplicationCommandOptionSubCommand:
-				for _, opt2 := range opt1.Options {
-					if !validCommandRegex().MatchString(opt2.Name) {
-						log.Errorf(`Option %s.%s.%s does not conform to Discord's command naming requirements`, cmd.Name, opt1.Name, opt2.Name)
-						conforms = false
-					}
-				}
-
-			case discordgo.ApplicationCommandOptionSubCommandGroup:
-				for _, opt2 := range opt1.Options {
-					if !validCommandRegex().MatchString(opt2.Name) {
-						log.Errorf(`Option %s.%s.%s does not conform to Discord's command naming requirements`, cmd.Name, opt1.Name, opt2.Name)
-						conforms = false
-					}
-
-					for _, opt3 := range opt2.Options {
-						if !validCommandRegex().MatchString(opt3.Name) {
-							log.Errorf(`Option %s.%s.%s.%s does not conform to Discord's command naming requirements`, cmd.Name, opt1.Name, opt2.Name, opt3.Name)
-							conforms = false
-						}
-					}
-				}
-			}
+func (c *command) HandleCommand(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
+	// Only context menus have a target.
+	if data := i.ApplicationCommandData(); data.TargetID != "" {
+		if menu, ok := c.contextMenu(data.Name); ok {
+			menu.handler(ctx, s, i)
+			return
 		}
 	}
+	c.handler(ctx, s, i)
+}
+
+func (c *command) AutocompleteHandler() onInteractionHandler { return c.autocomplete }
+func (c *command) ComponentRoutes() []interactionRoute       { return c.components }
+func (c *command) ModalRoutes() []interactionRoute           { return c.modals }
+
+var commandRegistry = struct {
+	sync.RWMutex
+	commands []Command
+	// Components that don't belong to any particular command.
+	components []interactionRoute
+}{}
 
-	return conforms
+// registerCommand adds a Command to the registry. It is intended
+// to be called from the init function of the file implementing
+// the command.
+func registerCommand(c Command) {
+	commandRegistry.Lock()
+	defer commandRegistry.Unlock()
+	for _, existing := range commandRegistry.commands {
+		if existing.Name() == c.Name() {
+			log.Fatalf("Command %s registered more than once", c.Name())
+		}
+	}
+	commandRegistry.commands = append(commandRegistry.commands, c)
+}
+
+// registerComponent adds a message component handler that is
+// not owned by any particular command.
+func registerComponent(route interactionRoute) {
+	commandRegistry.Lock()
+	defer commandRegistry.Unlock()
+	commandRegistry.components = append(commandRegistry.components, route)
+}
+
+// registeredCommands returns every registered Command, sorted by name.
+func registeredCommands() []Command {
+	commandRegistry.RLock()
+	cmds := make([]Command, len(commandRegistry.commands))
+	copy(cmds, commandRegistry.commands)
+	commandRegistry.RUnlock()
+
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].Name() < cmds[j].Name() })
+	return cmds
 }
 
-func getComponentImpls() map[string]onInteractionHandler {
-	return map[string]onInteractionHandler{
-		selectMenuErrorReport:           handleErrorReportSelection,
-		dndRollButtonID:                 handleDnDButtonPress,
-		dndDiceCountSelectID:            handleDiceCountMenuSelection,
-		dndDiceFacesSelectID:            handleDiceFacesMenuSelection,
-		dndOtherOptionsSelectID:         handleDnDOtherOptionsSelection,
-		roleSelectMenuComponentIDPrefix: handleRoleSelection,
-		roleSelectResetButtonID:         handleRoleSelectReset,
-		pollSelectMenuID:                handlePollSubmission,
+func getCommands() []*discordgo.ApplicationCommand {
+	allcmds := []*discordgo.ApplicationCommand{}
+	for _, cmd := range registeredCommands() {
+		for _, def := range cmd.Definitions() {
+			allcmds = append(allcmds, localizeCommand(def))
+		}
+	}
+	return allcmds
+}
+
+// commandFor returns the Command that owns the given application command name.
+func commandFor(name string) (Command, bool) {
+	for _, cmd := range registeredCommands() {
+		if cmd.Matches(name) {
+			return cmd, true
+		}
+	}
+	return nil, false
+}
+
+// componentHandlerFor returns the handler for a message component custom ID.
+func componentHandlerFor(customID string) (onInteractionHandler, bool) {
+	r, ok := componentRouteFor(customID)
+	return r.handler, ok
+}
+
+// modalHandlerFor returns the handler for a modal custom ID.
+func modalHandlerFor(customID string) (onInteractionHandler, bool) {
+	r, ok := modalRouteFor(customID)
+	return r.handler, ok
+}
+
+// componentRouteFor returns the route for a message component custom ID.
+func componentRouteFor(customID string) (interactionRoute, bool) {
+	commandRegistry.RLock()
+	routes := append([]interactionRoute{}, commandRegistry.components...)
+	commandRegistry.RUnlock()
+	for _, cmd := range registeredCommands() {
+		routes = append(routes, ownedRoutes(cmd, cmd.ComponentRoutes())...)
+	}
+	return routeFor(customID, routes)
+}
+
+// modalRouteFor returns the route for a modal custom ID.
+func modalRouteFor(customID string) (interactionRoute, bool) {
+	routes := []interactionRoute{}
+	for _, cmd := range registeredCommands() {
+		routes = append(routes, ownedRoutes(cmd, cmd.ModalRoutes())...)
+	}
+	return routeFor(customID, routes)
+}
+
+func ownedRoutes(cmd Command, routes []interactionRoute) []interactionRoute {
+	owned := make([]interactionRoute, len(routes))
+	for idx, r := range routes {
+		r.owner = cmd.Name()
+		owned[idx] = r
+	}
+	return owned
+}
+
+func routeFor(customID string, routes []interactionRoute) (interactionRoute, bool) {
+	for _, r := range routes {
+		if r.matches(customID) {
+			return r, true
+		}
+	}
+	return interactionRoute{}, false
+}
+
+// Tracks the last time a user issued a command with a cooldown.
+// Key: cooldownKey(command name, user ID)
+// Val: time the command was last accepted
+var commandCooldowns = cmap.New[time.Time]()
+
+func cooldownKey(cmd, userID string) string { return cmd + ":" + userID }
+
+// checkCommandRestrictions enforces a Command's metadata, other than its
+// cooldown and rate limits, which chargeCommandUse enforces. A non-nil
+// error is safe to show to the user who issued the interaction.
+func checkCommandRestrictions(cmd Command, i *discordgo.InteractionCreate) error {
+	meta := cmd.Metadata()
+	mdata, err := getInteractionMetaData(i)
+	if err != nil {
+		return err
+	}
+	isAdmin := isBotAdmin(mdata.AuthorID)
+
+	switch {
+	case meta.Privilege == privilegeOwner && !isBotOwner(mdata.AuthorID):
+		logFor(i).Warnf("user %s (%s) does not have privilege to use %s", mdata.AuthorUsername, mdata.AuthorID, cmd.Name())
+		return errors.New(localized(i, msgOwnerOnly, cmd.Name()))
+	case meta.Privilege == privilegeBotAdmin && !isAdmin:
+		logFor(i).Warnf("user %s (%s) does not have privilege to use %s", mdata.AuthorUsername, mdata.AuthorID, cmd.Name())
+		return errors.New(localized(i, msgBotAdminOnly, cmd.Name()))
+	}
+	if meta.GuildOnly && i.GuildID == "" {
+		return errors.New(localized(i, msgGuildOnly, cmd.Name()))
+	}
+	if meta.DMOnly && i.GuildID != "" {
+		return errors.New(localized(i, msgDMOnly, cmd.Name()))
+	}
+	if perms := requiredPermissions(cmd); perms != 0 && i.GuildID != "" && !hasGuildPrivilege(mdata, perms) {
+		return errors.New(localized(i, msgMissingPerms, cmd.Name()))
+	}
+	if i.GuildID != "" && !featureEnabled(i.GuildID, cmd.Name()) {
+		return errors.New(localized(i, msgCommandDisabled, cmd.Name()))
+	}
+	return nil
+}
+
+// chargeCommandUse starts the user's cooldown for cmd and takes their
+// rate limit tokens, or returns an error that is safe to show them if
+// they have to wait. It is called once nothing else can turn the
+// interaction away, so that users aren't charged for interactions that
+// never ran.
+func chargeCommandUse(cmd Command, i *discordgo.InteractionCreate) error {
+	meta := cmd.Metadata()
+	mdata, err := getInteractionMetaData(i)
+	if err != nil {
+		return err
+	}
+	if isBotAdmin(mdata.AuthorID) {
+		return nil
+	}
+
+	// Undoes the cooldown if the rate limits turn the interaction away.
+	refund := func() {}
+	if meta.Cooldown > 0 {
+		key := cooldownKey(cmd.Name(), mdata.AuthorID)
+		remaining := time.Duration(0)
+		commandCooldowns.Upsert(key, time.Now(), func(exists bool, last, now time.Time) time.Time {
+			if exists && now.Sub(last) < meta.Cooldown {
+				remaining = meta.Cooldown - now.Sub(last)
+				return last
+			}
+			if exists {
+				refund = func() { commandCooldowns.Set(key, last) }
+			} else {
+				refund = func() { commandCooldowns.Remove(key) }
+			}
+			return now
+		})
+		if remaining > 0 {
+			return errors.New(localized(i, msgCooldown, cmd.Name(), remaining.Round(time.Second)))
+		}
+	}
+	if err := takeRateLimitTokens(cmd, i, mdata.AuthorID, time.Now()); err != nil {
+		refund()
+		return err
 	}
+	return nil
 }
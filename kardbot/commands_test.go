@@ -0,0 +1,165 @@
+package kardbot
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kardbord/Kard-bot/kardbot/fakediscord"
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestRouteInteractionEnforcesMetadata(t *testing.T) {
+	cases := []struct {
+		name    string
+		command string
+		opts    []fakediscord.InteractionOption
+		want    string
+	}{
+		{
+			name:    "guild only command from DM",
+			command: roleSelectMenuCommand,
+			opts:    []fakediscord.InteractionOption{fakediscord.FromUser(testUser)},
+			want:    "within a server",
+		},
+		{
+			name:    "DM only command from guild",
+			command: delBotDMCmd,
+			opts:    inTestGuild(),
+			want:    "outside of our DMs",
+		},
+		{
+			name:    "owner only command",
+			command: adminCmd,
+			opts:    inTestGuild(),
+			want:    "only the bot owner",
+		},
+		{
+			name:    "bot admin only command",
+			command: logLevelCmd,
+			opts:    inTestGuild(),
+			want:    "only bot admins",
+		},
+		{
+			name:    "command requiring guild permissions",
+			command: roleSelectMenuCommand,
+			opts:    inTestGuild(),
+			want:    "server permissions",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := newTestBot(t)
+			i := fake.Command(tc.command, nil, tc.opts...)
+
+			bot().routeInteraction(fake, i)
+
+			resp := mustRespond(t, fake, i)
+			if !isEphemeral(resp) || !strings.Contains(resp.Initial.Data.Content, tc.want) {
+				t.Errorf("expected an ephemeral rejection containing %q, got %+v", tc.want, resp.Initial.Data)
+			}
+		})
+	}
+}
+
+func TestRouteInteractionDispatchesComponents(t *testing.T) {
+	fake := newTestBot(t)
+	msg := createTestPoll(t, fake, 1, "Tacos", "Pizza")
+
+	vote := fake.Component(pollSelectMenuID, discordgo.SelectMenuComponent, []string{"Tacos"},
+		append(inTestGuild(), fakediscord.OnMessage(msg))...)
+	bot().routeInteraction(fake, vote)
+
+	if resp := mustRespond(t, fake, vote); len(resp.Edits) != 1 {
+		t.Errorf("poll submission was not handled: %+v", resp)
+	}
+}
+
+func TestChargeCommandUseCooldown(t *testing.T) {
+	fake := newTestBot(t)
+	cmd := &command{name: "cooldown-test", metadata: CommandMetadata{Cooldown: time.Hour}}
+	t.Cleanup(func() { commandCooldowns.Remove(cooldownKey(cmd.Name(), testUser.ID)) })
+
+	if err := chargeCommandUse(cmd, fake.Command(cmd.Name(), nil, inTestGuild()...)); err != nil {
+		t.Fatalf("first use was rejected: %v", err)
+	}
+	err := chargeCommandUse(cmd, fake.Command(cmd.Name(), nil, inTestGuild()...))
+	if err == nil || !strings.Contains(err.Error(), "slow down") {
+		t.Errorf("second use within the cooldown was not rejected: %v", err)
+	}
+}
+
+func TestTurnedAwayInteractionsAreNotCharged(t *testing.T) {
+	fake := newTestBot(t)
+	withRateLimits(t, map[string]rateLimitConfig{
+		"charge-test": {User: &bucketConfig{Burst: 1, RefillSeconds: 3600}},
+	})
+	cmd := &command{
+		name:     "charge-test",
+		metadata: CommandMetadata{Cooldown: time.Hour},
+		handler: func(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
+			if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+				Type: discordgo.InteractionResponseChannelMessageWithSource,
+				Data: &discordgo.InteractionResponseData{Content: "done"},
+			}); err != nil {
+				t.Error(err)
+			}
+		},
+	}
+	registerTestCommand(t, cmd)
+	t.Cleanup(func() { commandCooldowns.Remove(cooldownKey(cmd.Name(), testUser.ID)) })
+
+	for n := 0; n < breakerMaxPanics; n++ {
+		recordCommandPanic(cmd.Name(), time.Now())
+	}
+	i := fake.Command(cmd.Name(), nil, inTestGuild()...)
+	bot().routeInteraction(fake, i)
+	if resp := mustRespond(t, fake, i); !strings.Contains(resp.Initial.Data.Content, "taking a break") {
+		t.Fatalf("expected the command to be switched off, got %+v", resp.Initial.Data)
+	}
+
+	resetCircuitBreaker(cmd.Name())
+	i = fake.Command(cmd.Name(), nil, inTestGuild()...)
+	bot().routeInteraction(fake, i)
+	if resp := mustRespond(t, fake, i); resp.Initial.Data.Content != "done" {
+		t.Errorf("user was charged for an interaction that was turned away, got %+v", resp.Initial.Data)
+	}
+}
+
+func TestContextMenus(t *testing.T) {
+	fake := newTestBot(t)
+
+	cmd, ok := commandFor(uwuMessageMenu)
+	if !ok || cmd.Name() != uwuCmd {
+		t.Fatalf("%s should belong to /%s, got %v", uwuMessageMenu, uwuCmd, cmd)
+	}
+	found := false
+	for _, def := range cmd.Definitions() {
+		if def.Name == uwuMessageMenu {
+			found = true
+			if def.Type != discordgo.MessageApplicationCommand || def.Description != "" || len(def.Options) != 0 {
+				t.Errorf("context menu definition has a description, options or the wrong type: %+v", def)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("%s was not registered", uwuMessageMenu)
+	}
+
+	target := &discordgo.Message{ID: fake.NewID(), ChannelID: testChannelID, Content: "Hello there", Author: testUser}
+	i := fake.MessageCommand(uwuMessageMenu, target, inTestGuild()...)
+	bot().routeInteraction(fake, i)
+	resp := mustRespond(t, fake, i)
+	if isEphemeral(resp) || resp.Initial.Data.Content == "" || resp.Initial.Data.Content == target.Content {
+		t.Errorf("expected the message to be UwU-ified, got %+v", resp.Initial.Data)
+	}
+
+	target.Content = ""
+	i = fake.MessageCommand(uwuMessageMenu, target, inTestGuild()...)
+	bot().routeInteraction(fake, i)
+	if resp := mustRespond(t, fake, i); !isEphemeral(resp) {
+		t.Errorf("expected an ephemeral error for a message with no text, got %+v", resp.Initial.Data)
+	}
+}
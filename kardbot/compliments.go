@@ -1,14 +1,16 @@
 package kardbot
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"math/rand"
 	"sync"
 	"time"
 
 	"github.com/Kardbord/Kard-bot/kardbot/config"
+	"github.com/Kardbord/Kard-bot/kardbot/jobqueue"
+	"github.com/Kardbord/Kard-bot/kardbot/store"
 	"github.com/bwmarrin/discordgo"
 
 	log "github.com/sirupsen/logrus"
@@ -22,6 +24,7 @@ const (
 	complimentsEvening = "evening"
 	complimentsGet     = "get-compliment"
 	complimentInDM     = "dm"
+	complimentUserMenu = "Send compliment"
 )
 
 var (
@@ -38,70 +41,159 @@ var (
 	complimentSubsPMMutex sync.RWMutex
 
 	// List of compliments
-	compliments []string
+	compliments hotConfig[[]string]
 )
 
-const complimentSubscribersFilepath = "config/compliment-subscribers.json"
+// IDs of /compliments response messages.
+const (
+	msgComplimentAMSubscribed     = "compliments.morning-subscribed"
+	msgComplimentAMSubscribeErr   = "compliments.morning-subscribe-error"
+	msgComplimentAMUnsubscribed   = "compliments.morning-unsubscribed"
+	msgComplimentAMUnsubscribeErr = "compliments.morning-unsubscribe-error"
+	msgComplimentPMSubscribed     = "compliments.evening-subscribed"
+	msgComplimentPMSubscribeErr   = "compliments.evening-subscribe-error"
+	msgComplimentPMUnsubscribed   = "compliments.evening-unsubscribed"
+	msgComplimentPMUnsubscribeErr = "compliments.evening-unsubscribe-error"
+	msgComplimentSentToYou        = "compliments.sent-to-you"
+	msgComplimentSent             = "compliments.sent"
+	msgComplimentBot              = "compliments.bot"
+	msgComplimentNoDM             = "compliments.no-dm"
+)
 
-var complimentSubscribersFileMutex sync.RWMutex
+func init() {
+	registerMessages(map[string]string{
+		msgComplimentAMSubscribed:     "%s has subscribed to receive daily morning compliments. :)",
+		msgComplimentAMSubscribeErr:   "%s, you are subscribed to receive morning compliments as long as the bot is up, but there was an error persisting your subscription. Please try to opt-in again.",
+		msgComplimentAMUnsubscribed:   "%s has unsubscribed from daily morning compliments. :(",
+		msgComplimentAMUnsubscribeErr: "%s, you are unsubscribed from morning compliments as long as the bot is up, but there was an error persisting your opt-out. Please try to opt-out again.",
+		msgComplimentPMSubscribed:     "%s has subscribed to receive daily evening compliments. :)",
+		msgComplimentPMSubscribeErr:   "%s, you are subscribed to receive evening compliments as long as the bot is up, but there was an error persisting your subscription. Please try to opt-in again.",
+		msgComplimentPMUnsubscribed:   "%s has unsubscribed from daily evening compliments. :(",
+		msgComplimentPMUnsubscribeErr: "%s, you are unsubscribed from evening compliments as long as the bot is up, but there was an error persisting your opt-out. Please try to opt-out again.",
+		msgComplimentSentToYou:        "Sent you a compliment! 💛",
+		msgComplimentSent:             "Sent %s a compliment! 💛",
+		msgComplimentBot:              "bots don't need compliments, they know they're great",
+		msgComplimentNoDM:             "couldn't send %s a DM, they may have DMs turned off",
+	})
+	registerCommand(&command{
+		name:       complimentsCmd,
+		definition: complimentsCmdDefinition,
+		handler:    complimentHandler,
+		contextMenus: []contextMenu{
+			{name: complimentUserMenu, target: discordgo.UserApplicationCommand, handler: sendCompliment},
+		},
+	})
+}
 
-type complimentSubscribersConfig struct {
-	SubsAM map[string]bool `json:"compliment-subscribers-morning"`
-	SubsPM map[string]bool `json:"compliment-subscribers-evening"`
+func complimentsCmdDefinition() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        complimentsCmd,
+		Description: "Receive a daily compliment!",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        complimentsGet,
+				Description: "Get a compliment!",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionBoolean,
+						Name:        complimentInDM,
+						Description: "Get the compliment as a DM",
+						Required:    false,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+				Name:        complimentsOptIn,
+				Description: "Opt-in to daily DM compliments",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        complimentsMorning,
+						Description: "Opt in to daily DM compliments in the morning",
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        complimentsEvening,
+						Description: "Opt in to daily DM compliments in the evening",
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+				Name:        complimentsOptOut,
+				Description: "Opt-out of daily DM compliments",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        complimentsMorning,
+						Description: "Opt out of daily DM compliments in the morning",
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        complimentsEvening,
+						Description: "Opt out of daily DM compliments in the evening",
+					},
+				},
+			},
+		},
+	}
 }
 
-func init() {
-	complimentSubscribersFileMutex.RLock()
-	defer complimentSubscribersFileMutex.RUnlock()
+func loadComplimentSubscribers(st store.Store) error {
 	complimentSubsAMMutex.Lock()
 	defer complimentSubsAMMutex.Unlock()
 	complimentSubsPMMutex.Lock()
 	defer complimentSubsPMMutex.Unlock()
 
-	cfg := complimentSubscribersConfig{}
-
-	jsonCfg, err := config.NewJsonConfig(complimentSubscribersFilepath)
-	if err != nil {
-		log.Fatal(err)
+	complimentSubsAM = map[string]bool{}
+	complimentSubsPM = map[string]bool{}
+
+	load := func(bucket string, subs map[string]bool) error {
+		return st.ForEach(bucket, func(userID string, raw json.RawMessage) error {
+			subbed := false
+			if err := json.Unmarshal(raw, &subbed); err != nil {
+				return err
+			}
+			subs[userID] = subbed
+			return nil
+		})
 	}
 
-	err = json.Unmarshal(jsonCfg.Raw, &cfg)
-	if err != nil {
-		log.Fatal(err)
+	if err := load(complimentSubsAMBucket, complimentSubsAM); err != nil {
+		return err
 	}
-
-	complimentSubsAM = cfg.SubsAM
-	complimentSubsPM = cfg.SubsPM
+	return load(complimentSubsPMBucket, complimentSubsPM)
 }
 
 const complimentListFilepath = "config/compliments.json"
 
-func init() {
+func parseCompliments() (func(), error) {
 	cfg := struct {
 		Compliments []string `json:"compliments"`
 	}{}
 
 	jsonCfg, err := config.NewJsonConfig(complimentListFilepath)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	err = json.Unmarshal(jsonCfg.Raw, &cfg)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	compliments = cfg.Compliments
-
 	// Validate compliments
-	if len(compliments) == 0 {
-		log.Fatal("No compliments configured.")
+	if len(cfg.Compliments) == 0 {
+		return nil, errors.New("no compliments configured")
 	}
+	return func() { compliments.Store(cfg.Compliments) }, nil
 }
 
-func complimentHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func complimentHandler(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	if s == nil || i == nil {
-		log.Errorf("nil session or interaction; s=%v, i=%v", s, i)
+		logFor(i).Errorf("nil session or interaction; s=%v, i=%v", s, i)
 		return
 	}
 
@@ -113,7 +205,7 @@ func complimentHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		case complimentsEvening:
 			eveningComplimentOptIn(s, i)
 		default:
-			log.Error("Unknown subcommand")
+			logFor(i).Error("Unknown subcommand")
 		}
 	case complimentsOptOut:
 		switch i.ApplicationCommandData().Options[0].Options[0].Name {
@@ -122,19 +214,19 @@ func complimentHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		case complimentsEvening:
 			eveningComplimentOptOut(s, i)
 		default:
-			log.Error("Unknown subcommand")
+			logFor(i).Error("Unknown subcommand")
 		}
 	case complimentsGet:
 		getCompliment(s, i)
 	default:
-		log.Error("Unknown subcommand group")
+		logFor(i).Error("Unknown subcommand group")
 	}
 }
 
-func morningComplimentOptIn(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func morningComplimentOptIn(s discordSession, i *discordgo.InteractionCreate) {
 	metadata, err := getInteractionMetaData(i)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
@@ -143,40 +235,40 @@ func morningComplimentOptIn(s *discordgo.Session, i *discordgo.InteractionCreate
 	complimentSubsAM[metadata.AuthorID] = true
 	complimentSubsAMMutex.Unlock()
 
-	err = writeComplimentSubscribersToDisk()
+	err = stateStore().Put(complimentSubsAMBucket, metadata.AuthorID, true)
 	if err != nil {
-		log.Errorf("Error persisting user %s's subscription: %v", metadata.AuthorUsername, err)
+		logFor(i).Errorf("Error persisting user %s's subscription: %v", metadata.AuthorUsername, err)
 		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
-				Content: fmt.Sprintf("%s, you are subscribed to receive morning compliments as long as the bot is up, but there was an error persisting your subscription. Please try to opt-in again.", metadata.AuthorUsername),
+				Content: localized(i, msgComplimentAMSubscribeErr, metadata.AuthorUsername),
 				Flags:   discordgo.MessageFlagsEphemeral,
 			},
 		})
 		if err != nil {
-			log.Error(err)
+			logFor(i).Error(err)
 			interactionRespondEphemeralError(s, i, true, err)
 		}
 		return
 	}
 
-	log.Infof("User %s subscribed to morning compliments", metadata.AuthorUsername)
+	logFor(i).Infof("User %s subscribed to morning compliments", metadata.AuthorUsername)
 	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: fmt.Sprintf("%s has subscribed to receive daily morning compliments. :)", metadata.AuthorUsername),
+			Content: localized(i, msgComplimentAMSubscribed, metadata.AuthorUsername),
 		},
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 	}
 }
 
-func morningComplimentOptOut(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func morningComplimentOptOut(s discordSession, i *discordgo.InteractionCreate) {
 	metadata, err := getInteractionMetaData(i)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
@@ -184,42 +276,43 @@ func morningComplimentOptOut(s *discordgo.Session, i *discordgo.InteractionCreat
 	complimentSubsAMMutex.Lock()
 	complimentSubsAM[metadata.AuthorID] = false
 	complimentSubsAMMutex.Unlock()
+	cancelJob(jobCompliment, complimentsMorning+"/"+metadata.AuthorID)
 
-	err = writeComplimentSubscribersToDisk()
+	err = stateStore().Put(complimentSubsAMBucket, metadata.AuthorID, false)
 	if err != nil {
-		log.Errorf("Error persisting user %s's opt-out: %v", metadata.AuthorUsername, err)
+		logFor(i).Errorf("Error persisting user %s's opt-out: %v", metadata.AuthorUsername, err)
 		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
-				Content: fmt.Sprintf("%s, you are unsubscribed from morning compliments as long as the bot is up, but there was an error persisting your opt-out. Please try to opt-out again.", metadata.AuthorUsername),
+				Content: localized(i, msgComplimentAMUnsubscribeErr, metadata.AuthorUsername),
 				Flags:   discordgo.MessageFlagsEphemeral,
 			},
 		})
 		if err != nil {
-			log.Error(err)
+			logFor(i).Error(err)
 			interactionRespondEphemeralError(s, i, true, err)
 		}
 		return
 	}
 
-	log.Infof("User %s un-subscribed to morning compliments", metadata.AuthorUsername)
+	logFor(i).Infof("User %s un-subscribed to morning compliments", metadata.AuthorUsername)
 
 	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: fmt.Sprintf("%s has unsubscribed from daily morning compliments. :(", metadata.AuthorUsername),
+			Content: localized(i, msgComplimentAMUnsubscribed, metadata.AuthorUsername),
 		},
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 	}
 }
 
-func eveningComplimentOptIn(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func eveningComplimentOptIn(s discordSession, i *discordgo.InteractionCreate) {
 	metadata, err := getInteractionMetaData(i)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
@@ -228,40 +321,40 @@ func eveningComplimentOptIn(s *discordgo.Session, i *discordgo.InteractionCreate
 	complimentSubsPM[metadata.AuthorID] = true
 	complimentSubsPMMutex.Unlock()
 
-	err = writeComplimentSubscribersToDisk()
+	err = stateStore().Put(complimentSubsPMBucket, metadata.AuthorID, true)
 	if err != nil {
-		log.Errorf("Error persisting user %s's subscription: %v", metadata.AuthorUsername, err)
+		logFor(i).Errorf("Error persisting user %s's subscription: %v", metadata.AuthorUsername, err)
 		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
-				Content: fmt.Sprintf("%s, you are subscribed to receive evening compliments as long as the bot is up, but there was an error persisting your subscription. Please try to opt-in again.", metadata.AuthorUsername),
+				Content: localized(i, msgComplimentPMSubscribeErr, metadata.AuthorUsername),
 				Flags:   discordgo.MessageFlagsEphemeral,
 			},
 		})
 		if err != nil {
-			log.Error(err)
+			logFor(i).Error(err)
 			interactionRespondEphemeralError(s, i, true, err)
 		}
 		return
 	}
 
-	log.Infof("User %s subscribed to evening compliments", metadata.AuthorUsername)
+	logFor(i).Infof("User %s subscribed to evening compliments", metadata.AuthorUsername)
 	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: fmt.Sprintf("%s has subscribed to receive daily evening compliments. :)", metadata.AuthorUsername),
+			Content: localized(i, msgComplimentPMSubscribed, metadata.AuthorUsername),
 		},
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 	}
 }
 
-func eveningComplimentOptOut(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func eveningComplimentOptOut(s discordSession, i *discordgo.InteractionCreate) {
 	metadata, err := getInteractionMetaData(i)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
@@ -269,46 +362,47 @@ func eveningComplimentOptOut(s *discordgo.Session, i *discordgo.InteractionCreat
 	complimentSubsPMMutex.Lock()
 	complimentSubsPM[metadata.AuthorID] = false
 	complimentSubsPMMutex.Unlock()
+	cancelJob(jobCompliment, complimentsEvening+"/"+metadata.AuthorID)
 
-	err = writeComplimentSubscribersToDisk()
+	err = stateStore().Put(complimentSubsPMBucket, metadata.AuthorID, false)
 	if err != nil {
-		log.Errorf("Error persisting user %s's opt-out: %v", metadata.AuthorUsername, err)
+		logFor(i).Errorf("Error persisting user %s's opt-out: %v", metadata.AuthorUsername, err)
 		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
-				Content: fmt.Sprintf("%s, you are unsubscribed from evening compliments as long as the bot is up, but there was an error persisting your opt-out. Please try to opt-out again.", metadata.AuthorUsername),
+				Content: localized(i, msgComplimentPMUnsubscribeErr, metadata.AuthorUsername),
 				Flags:   discordgo.MessageFlagsEphemeral,
 			},
 		})
 		if err != nil {
-			log.Error(err)
+			logFor(i).Error(err)
 			interactionRespondEphemeralError(s, i, true, err)
 		}
 		return
 	}
 
-	log.Infof("User %s un-subscribed to evening compliments", metadata.AuthorUsername)
+	logFor(i).Infof("User %s un-subscribed to evening compliments", metadata.AuthorUsername)
 	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: fmt.Sprintf("%s has unsubscribed from daily evening compliments. :(", metadata.AuthorUsername),
+			Content: localized(i, msgComplimentPMUnsubscribed, metadata.AuthorUsername),
 		},
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 	}
 }
 
-func getCompliment(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func getCompliment(s discordSession, i *discordgo.InteractionCreate) {
 	metadata, err := getInteractionMetaData(i)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
 
-	compliment := compliments[rand.Intn(len(compliments))]
+	compliment := randomEntry(compliments.Load())
 
 	sendAsDM := false
 	if len(i.ApplicationCommandData().Options[0].Options) > 0 {
@@ -323,28 +417,28 @@ func getCompliment(s *discordgo.Session, i *discordgo.InteractionCreate) {
 			},
 		})
 		if err != nil {
-			log.Error(err)
+			logFor(i).Error(err)
 			interactionRespondEphemeralError(s, i, true, err)
 			return
 		}
 
-		uc, err := bot().Session.UserChannelCreate(metadata.AuthorID)
+		uc, err := bot().api.UserChannelCreate(metadata.AuthorID)
 		if err != nil {
-			log.Error(err)
+			logFor(i).Error(err)
 		}
-		_, err = bot().Session.ChannelMessageSend(uc.ID, compliment)
+		_, err = bot().api.ChannelMessageSend(uc.ID, compliment)
 		if err != nil {
-			log.Error(err)
+			logFor(i).Error(err)
 		}
-		log.Infof("Told %s that '%s'", metadata.AuthorUsername, compliment)
+		logFor(i).Infof("Told %s that '%s'", metadata.AuthorUsername, compliment)
 
 		time.Sleep(time.Millisecond * 250) // give a bit for the initial response to be received
-		content := "Sent you a compliment! 💛"
+		content := localized(i, msgComplimentSentToYou)
 		_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
 			Content: &content,
 		})
 		if err != nil {
-			log.Error(err)
+			logFor(i).Error(err)
 			interactionFollowUpEphemeralError(s, i, true, err)
 		}
 		return
@@ -357,85 +451,125 @@ func getCompliment(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		},
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 	}
 }
 
-func sendMorningCompliments() {
-	wg := bot().updateLastActive()
-	defer wg.Wait()
+// sendCompliment DMs a compliment to the user a context menu was used on.
+func sendCompliment(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
+	metadata, err := getInteractionMetaData(i)
+	if err != nil {
+		logFor(i).Error(err)
+		interactionRespondEphemeralError(s, i, true, err)
+		return
+	}
+	target, err := targetUser(i)
+	if err != nil {
+		logFor(i).Error(err)
+		interactionRespondEphemeralError(s, i, true, err)
+		return
+	}
+	if target.Bot {
+		interactionRespondEphemeralError(s, i, false, errors.New(localized(i, msgComplimentBot)))
+		return
+	}
 
+	compliment := randomEntry(compliments.Load())
+	uc, err := s.UserChannelCreate(target.ID)
+	if err == nil {
+		_, err = s.ChannelMessageSend(uc.ID, fmt.Sprintf("%s wanted you to know: %s", metadata.AuthorUsername, compliment))
+	}
+	if err != nil {
+		logFor(i).Errorf("Could not DM %s: %v", target.Username, err)
+		interactionRespondEphemeralError(s, i, false, errors.New(localized(i, msgComplimentNoDM, target.Username)))
+		return
+	}
+	logFor(i).Infof("%s told %s that '%s'", metadata.AuthorUsername, target.Username, compliment)
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: localized(i, msgComplimentSent, target.Username),
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		logFor(i).Error(err)
+	}
+}
+
+func scheduleMorningCompliments() {
 	complimentSubsAMMutex.RLock()
 	defer complimentSubsAMMutex.RUnlock()
-	sendCompliments(complimentSubsAM)
+	scheduleCompliments(complimentsMorning, complimentSubsAM)
 }
 
-func sendEveningCompliments() {
-	wg := bot().updateLastActive()
-	defer wg.Wait()
-
+func scheduleEveningCompliments() {
 	complimentSubsPMMutex.RLock()
 	defer complimentSubsPMMutex.RUnlock()
-	sendCompliments(complimentSubsPM)
+	scheduleCompliments(complimentsEvening, complimentSubsPM)
 }
 
-func sendCompliments(subscribers map[string]bool) error {
-	var sendCompliment = func(subscriberID string, wg *sync.WaitGroup) {
-		if wg == nil {
-			log.Error("nil waitgroup provided")
-			return
-		}
-		wg.Add(1)
-		defer wg.Done()
-
-		user, err := bot().Session.User(subscriberID)
-		if err != nil {
-			log.Error(err)
-			return
-		}
+// Identifies the recipient of a compliment job.
+type complimentJobPayload struct {
+	UserID string `json:"user-id"`
+	// complimentsMorning or complimentsEvening
+	Period string `json:"period"`
+}
 
-		uc, err := bot().Session.UserChannelCreate(subscriberID)
-		if err != nil {
-			log.Error(err)
+// scheduleCompliments queues a compliment for each subscriber to be sent right away.
+// Queueing them means that any that fail are retried, even across restarts.
+func scheduleCompliments(period string, subscribers map[string]bool) {
+	for sid, isSubbed := range subscribers {
+		if !isSubbed {
+			continue
 		}
-
-		compliment := compliments[rand.Intn(len(compliments))]
-		_, err = bot().Session.ChannelMessageSend(uc.ID, compliment)
+		err := jobQueue().Schedule(jobID(jobCompliment, period+"/"+sid), jobCompliment, time.Now(),
+			complimentJobPayload{UserID: sid, Period: period})
 		if err != nil {
 			log.Error(err)
 		}
-		log.Infof("Told %s that '%s'", user.Username, compliment)
 	}
+}
 
-	wg := sync.WaitGroup{}
-	for sid, isSubbed := range subscribers {
-		if isSubbed {
-			go sendCompliment(sid, &wg)
-		}
+func isSubbedToCompliments(subscriberID, period string) bool {
+	mutex, subs := &complimentSubsAMMutex, complimentSubsAM
+	if period == complimentsEvening {
+		mutex, subs = &complimentSubsPMMutex, complimentSubsPM
 	}
-
-	wg.Wait()
-	return nil
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return subs[subscriberID]
 }
 
-func writeComplimentSubscribersToDisk() error {
-	complimentSubscribersFileMutex.Lock()
-	defer complimentSubscribersFileMutex.Unlock()
-	complimentSubsAMMutex.RLock()
-	defer complimentSubsAMMutex.RUnlock()
-	complimentSubsPMMutex.RLock()
-	defer complimentSubsPMMutex.RUnlock()
+func runComplimentJob(ctx context.Context, job jobqueue.Job) error {
+	payload := complimentJobPayload{}
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return err
+	}
+	if !isSubbedToCompliments(payload.UserID, payload.Period) {
+		return nil
+	}
+
+	wg := bot().updateLastActive()
+	defer wg.Wait()
 
-	cfg := complimentSubscribersConfig{
-		SubsAM: complimentSubsAM,
-		SubsPM: complimentSubsPM,
+	user, err := bot().api.User(payload.UserID)
+	if err != nil {
+		return err
 	}
 
-	fileBytes, err := json.MarshalIndent(cfg, "", "  ")
+	uc, err := bot().api.UserChannelCreate(payload.UserID)
 	if err != nil {
 		return err
 	}
 
-	return ioutil.WriteFile(complimentSubscribersFilepath, fileBytes, 0664)
+	compliment := randomEntry(compliments.Load())
+	_, err = bot().api.ChannelMessageSend(uc.ID, compliment)
+	if err != nil {
+		return err
+	}
+	log.Infof("Told %s that '%s'", user.Username, compliment)
+	return nil
 }
@@ -0,0 +1,29 @@
+package kardbot
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSendCompliment(t *testing.T) {
+	fake := newTestBot(t)
+	prev := compliments.Load()
+	compliments.Store([]string{"You're great!"})
+	t.Cleanup(func() { compliments.Store(prev) })
+
+	i := fake.UserCommand(complimentUserMenu, testUser, inTestGuild()...)
+	bot().routeInteraction(fake, i)
+	if resp := mustRespond(t, fake, i); !isEphemeral(resp) || !strings.Contains(resp.Initial.Data.Content, "Sent") {
+		t.Errorf("expected an ephemeral confirmation, got %+v", resp.Initial.Data)
+	}
+	dms := fake.DMs(testUser.ID)
+	if len(dms) != 1 || !strings.Contains(dms[0].Content, "You're great!") {
+		t.Errorf("expected a compliment DM, got %+v", dms)
+	}
+
+	i = fake.UserCommand(complimentUserMenu, testSelf, inTestGuild()...)
+	bot().routeInteraction(fake, i)
+	if resp := mustRespond(t, fake, i); !isEphemeral(resp) || len(fake.DMs(testSelf.ID)) != 0 {
+		t.Errorf("bots should not be complimented: %+v", resp.Initial.Data)
+	}
+}
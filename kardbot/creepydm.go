@@ -1,14 +1,17 @@
 package kardbot
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"math/rand"
 	"sync"
 	"time"
 
 	"github.com/Kardbord/Kard-bot/kardbot/config"
+	"github.com/Kardbord/Kard-bot/kardbot/jobqueue"
+	"github.com/Kardbord/Kard-bot/kardbot/store"
 	"github.com/bwmarrin/discordgo"
 
 	log "github.com/sirupsen/logrus"
@@ -36,73 +39,137 @@ var (
 	creepyDMOdds float32
 
 	// List of creepy DMs
-	creepyDMs []string
+	creepyDMs hotConfig[[]string]
 )
 
-type creepyDmSubscribersConfig struct {
-	Subs map[string]bool `json:"creepy-dm-subscribers"`
-	Odds float32         `json:"creepy-dm-odds"`
-}
-
+// The creepy DM config file also held the subscriber list
+// before subscribers were moved into the state store.
 const creepyDmSubscribersFilepath = "config/creepy-dm-subscribers.json"
 
-var creepyDmSubscribersFileMutex sync.RWMutex
+// IDs of /creepy-dm response messages.
+const (
+	msgCreepyDMSubscribed     = "creepy-dm.subscribed"
+	msgCreepyDMSubscribeErr   = "creepy-dm.subscribe-error"
+	msgCreepyDMUnsubscribed   = "creepy-dm.unsubscribed"
+	msgCreepyDMUnsubscribeErr = "creepy-dm.unsubscribe-error"
+	msgCreepyDMSent           = "creepy-dm.sent"
+)
 
 func init() {
-	creepyDmSubscribersFileMutex.RLock()
-	defer creepyDmSubscribersFileMutex.RUnlock()
-	creepyDMSubsMutex.Lock()
-	defer creepyDMSubsMutex.Unlock()
+	registerMessages(map[string]string{
+		msgCreepyDMSubscribed:     "%s subscribed to creepy DMs 😈",
+		msgCreepyDMSubscribeErr:   "%s, you are subscribed to creepy DMs as long as the bot remains up, but there was an error persisting your subscription. Please try to opt-in again.",
+		msgCreepyDMUnsubscribed:   "%s unsubscribed from creepy DMs 👿",
+		msgCreepyDMUnsubscribeErr: "%s, you are unsubscribed to creepy DMs as long as the bot remains up, but there was an error persisting your opt-out. Please try to opt-out again.",
+		msgCreepyDMSent:           "Sent you a creepy DM 😈",
+	})
+	registerCommand(&command{
+		name:       creepyDMCmd,
+		definition: creepyDMCmdDefinition,
+		handler:    creepyDMHandler,
+	})
+}
 
-	cfg := creepyDmSubscribersConfig{}
+func creepyDMCmdDefinition() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        creepyDMCmd,
+		Description: "What do you mean you don't want to receive creepy DMs?",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        creepyDMGet,
+				Description: "Get a creepy DM ASAP",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionBoolean,
+						Name:        creepyChannelDM,
+						Description: "Send the message to the channel instead of as a DM",
+						Required:    false,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        creepyDMOptIn,
+				Description: "Opt in to random creepy DMs (1 per day max)",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        creepyDMOptOut,
+				Description: "Opt out of random creepy DMs",
+			},
+		},
+	}
+}
 
-	cfg.Odds = defaultCreepyDMOdds
+func loadCreepyDMOdds() error {
+	cfg := struct {
+		Odds float32 `json:"creepy-dm-odds"`
+	}{defaultCreepyDMOdds}
 
 	jsonCfg, err := config.NewJsonConfig(creepyDmSubscribersFilepath)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	err = json.Unmarshal(jsonCfg.Raw, &cfg)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	creepyDMOdds = cfg.Odds
-	creepyDMSubs = cfg.Subs
 
 	if creepyDMOdds < 0.0 || creepyDMOdds > 1.0 {
-		log.Fatalf("creepyDMOdds configuration value (%f) is out of range. Valid values are [0.0, 1.0]", creepyDMOdds)
+		return fmt.Errorf("creepyDMOdds configuration value (%f) is out of range. Valid values are [0.0, 1.0]", creepyDMOdds)
 	}
 
 	if creepyDMOdds < 0.01 {
 		log.Warn("creepyDMOdds set at less than 1%")
 	}
+	return nil
+}
+
+func loadCreepyDMSubscribers(st store.Store) error {
+	creepyDMSubsMutex.Lock()
+	defer creepyDMSubsMutex.Unlock()
+
+	creepyDMSubs = map[string]bool{}
+	return st.ForEach(creepyDMSubsBucket, func(userID string, raw json.RawMessage) error {
+		subbed := false
+		if err := json.Unmarshal(raw, &subbed); err != nil {
+			return err
+		}
+		creepyDMSubs[userID] = subbed
+		return nil
+	})
 }
 
 const creepyDmListFilepath = "config/creepy-dms.json"
 
-func init() {
+func parseCreepyDMs() (func(), error) {
 	cfg := struct {
 		CreepyDMs []string `json:"creepy-dms"`
 	}{}
 
 	jsonCfg, err := config.NewJsonConfig(creepyDmListFilepath)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	err = json.Unmarshal(jsonCfg.Raw, &cfg)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	creepyDMs = cfg.CreepyDMs
+	if len(cfg.CreepyDMs) == 0 {
+		return nil, errors.New("no creepy DMs configured")
+	}
+	return func() { creepyDMs.Store(cfg.CreepyDMs) }, nil
 }
 
-func creepyDMHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func creepyDMHandler(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	if s == nil || i == nil {
-		log.Errorf("nil session or interaction; s=%v, i=%v", s, i)
+		logFor(i).Errorf("nil session or interaction; s=%v, i=%v", s, i)
 		return
 	}
 
@@ -119,12 +186,12 @@ func creepyDMHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	}
 
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 	}
 }
 
-func creepyDMsOptIn(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+func creepyDMsOptIn(s discordSession, i *discordgo.InteractionCreate) error {
 	metadata, err := getInteractionMetaData(i)
 	if err != nil {
 		return err
@@ -134,12 +201,12 @@ func creepyDMsOptIn(s *discordgo.Session, i *discordgo.InteractionCreate) error
 	creepyDMSubs[metadata.AuthorID] = true
 	creepyDMSubsMutex.Unlock()
 
-	err = writeCreepyDmSubscribersToDisk()
+	err = stateStore().Put(creepyDMSubsBucket, metadata.AuthorID, true)
 	if err != nil {
 		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
-				Content: fmt.Sprintf("%s, you are subscribed to creepy DMs as long as the bot remains up, but there was an error persisting your subscription. Please try to opt-in again.", metadata.AuthorUsername),
+				Content: localized(i, msgCreepyDMSubscribeErr, metadata.AuthorUsername),
 				Flags:   discordgo.MessageFlagsEphemeral,
 			},
 		})
@@ -152,12 +219,12 @@ func creepyDMsOptIn(s *discordgo.Session, i *discordgo.InteractionCreate) error
 	return s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: fmt.Sprintf("%s subscribed to creepy DMs 😈", metadata.AuthorUsername),
+			Content: localized(i, msgCreepyDMSubscribed, metadata.AuthorUsername),
 		},
 	})
 }
 
-func creepyDMsOptOut(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+func creepyDMsOptOut(s discordSession, i *discordgo.InteractionCreate) error {
 	metadata, err := getInteractionMetaData(i)
 	if err != nil {
 		return err
@@ -166,13 +233,14 @@ func creepyDMsOptOut(s *discordgo.Session, i *discordgo.InteractionCreate) error
 	creepyDMSubsMutex.Lock()
 	creepyDMSubs[metadata.AuthorID] = false
 	creepyDMSubsMutex.Unlock()
+	cancelJob(jobCreepyDM, metadata.AuthorID)
 
-	err = writeCreepyDmSubscribersToDisk()
+	err = stateStore().Put(creepyDMSubsBucket, metadata.AuthorID, false)
 	if err != nil {
 		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
-				Content: fmt.Sprintf("%s, you are unsubscribed to creepy DMs as long as the bot remains up, but there was an error persisting your opt-out. Please try to opt-out again.", metadata.AuthorUsername),
+				Content: localized(i, msgCreepyDMUnsubscribeErr, metadata.AuthorUsername),
 			},
 		})
 		if err != nil {
@@ -184,13 +252,13 @@ func creepyDMsOptOut(s *discordgo.Session, i *discordgo.InteractionCreate) error
 	return s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: fmt.Sprintf("%s unsubscribed from creepy DMs 👿", metadata.AuthorUsername),
+			Content: localized(i, msgCreepyDMUnsubscribed, metadata.AuthorUsername),
 		},
 	})
 }
 
-func getCreepyDM(s *discordgo.Session, i *discordgo.InteractionCreate) error {
-	msg := creepyDMs[rand.Intn(len(creepyDMs))]
+func getCreepyDM(s discordSession, i *discordgo.InteractionCreate) error {
+	msg := randomEntry(creepyDMs.Load())
 
 	sendToChannel := false
 	if len(i.ApplicationCommandData().Options[0].Options) > 0 {
@@ -224,75 +292,75 @@ func getCreepyDM(s *discordgo.Session, i *discordgo.InteractionCreate) error {
 	if err != nil {
 		return err
 	}
-	log.Tracef("Sent %s a creepy DM", metadata.AuthorUsername)
+	logFor(i).Tracef("Sent %s a creepy DM", metadata.AuthorUsername)
 
 	time.Sleep(time.Millisecond * 250) // sleep a bit for the initial response to be received
 	return s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: "Sent you a creepy DM 😈",
+			Content: localized(i, msgCreepyDMSent),
 			Flags:   discordgo.MessageFlagsEphemeral,
 		},
 	})
 }
 
-// sendCreepyDMs is run every day. It spawns a goroutine for each
-// subscriber and randomly decides whether or not said subscriber
-// will receive creepy-PM that day. If so the goroutine sleeps
-// for a random amount of time, not exceeding 24 hours, before
-// sending the DM.
-func sendCreepyDMs() {
-	wg := sync.WaitGroup{}
-	defer wg.Wait()
+// dmJobPayload is persisted with each jobCreepyDM job in the job queue.
+// Only the recipient is stored; the DM itself is picked when the job runs.
+type dmJobPayload struct {
+	UserID string `json:"user-id"`
+}
+
+// scheduleCreepyDMs is run every day. It randomly decides whether or not
+// each subscriber will receive a creepy DM that day, and if so schedules
+// the DM for a random time within the next 24 hours.
+func scheduleCreepyDMs() {
 	creepyDMSubsMutex.RLock()
-	// Defers are LIFO; this MUST happen prior to wg.Wait
-	// or any subscribe/unsubscribe commands will be deadlocked.
 	defer creepyDMSubsMutex.RUnlock()
 
-	// Made this an anonymous inner function so that I wouldn't
-	// accidentally use an uncopied value from bot().CreepyDMSubs
-	// after the mutex is released.
-	sendDM := func(subID string) error {
-		user, err := bot().Session.User(subID)
-		if err != nil {
-			return err
+	const minutesPerDay = 1440
+	for subID, isSubbed := range creepyDMSubs {
+		if !isSubbed {
+			continue
 		}
-
 		if rand.Float32() > creepyDMOdds {
-			log.Infof("%s escaped a creepy DM this time...", user.Username)
-			return nil
+			log.Infof("%s escaped a creepy DM this time...", subID)
+			continue
 		}
-		log.Infof("%s will get a creepy DM today >:) (unless they unsubscribe before we send it)", user.Username)
 
-		const minutesPerDay = 1440
-		time.Sleep(time.Minute * time.Duration(rand.Intn(minutesPerDay)))
-
-		activeWG := bot().updateLastActive()
-		defer activeWG.Wait()
-
-		if !isSubbedToCreepyDMs(subID, user.Username) {
-			log.Infof("%s has unsubbed from creepy DMs since this routine started", user.Username)
-			return nil
-		}
-		dm := creepyDMs[rand.Intn(len(creepyDMs))]
-		uc, err := bot().Session.UserChannelCreate(subID)
+		runAt := time.Now().Add(time.Minute * time.Duration(rand.Intn(minutesPerDay)))
+		err := jobQueue().Schedule(jobID(jobCreepyDM, subID), jobCreepyDM, runAt, dmJobPayload{UserID: subID})
 		if err != nil {
-			return err
+			log.Error(err)
+			continue
 		}
+		log.Infof("%s will get a creepy DM today >:) (unless they unsubscribe before we send it)", subID)
+	}
+}
 
-		_, err = bot().Session.ChannelMessageSend(uc.ID, dm)
+func runCreepyDMJob(ctx context.Context, job jobqueue.Job) error {
+	payload := dmJobPayload{}
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return err
+	}
+
+	activeWG := bot().updateLastActive()
+	defer activeWG.Wait()
+
+	user, err := bot().api.User(payload.UserID)
+	if err != nil {
 		return err
 	}
+	if !isSubbedToCreepyDMs(payload.UserID, user.Username) {
+		log.Infof("%s has unsubbed from creepy DMs since their DM was scheduled", user.Username)
+		return nil
+	}
 
-	for subscriberID := range creepyDMSubs {
-		wg.Add(1)
-		go func(subID string) {
-			defer wg.Done()
-			if err := sendDM(subID); err != nil {
-				log.Error(err)
-			}
-		}(subscriberID)
+	uc, err := bot().api.UserChannelCreate(payload.UserID)
+	if err != nil {
+		return err
 	}
+	_, err = bot().api.ChannelMessageSend(uc.ID, randomEntry(creepyDMs.Load()))
+	return err
 }
 
 func isSubbedToCreepyDMs(subscriberID, subscriberName string) bool {
@@ -304,22 +372,3 @@ func isSubbedToCreepyDMs(subscriberID, subscriberName string) bool {
 	}
 	return true
 }
-
-func writeCreepyDmSubscribersToDisk() error {
-	creepyDmSubscribersFileMutex.Lock()
-	defer creepyDmSubscribersFileMutex.Unlock()
-	creepyDMSubsMutex.RLock()
-	defer creepyDMSubsMutex.RUnlock()
-
-	cfg := creepyDmSubscribersConfig{
-		Subs: creepyDMSubs,
-		Odds: creepyDMOdds,
-	}
-
-	fileBytes, err := json.MarshalIndent(cfg, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	return ioutil.WriteFile(creepyDmSubscribersFilepath, fileBytes, 0664)
-}
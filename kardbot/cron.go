@@ -1,6 +1,7 @@
 package kardbot
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
@@ -25,36 +26,83 @@ func init() {
 	}
 	scheduler = func() *gocron.Scheduler { return s }
 
-	// https://crontab.guru/#0_9_*_*_3
-	scheduler().Cron("0 9 * * 3").Do(itIsWednesdayMyDudes)
+	// Runs hourly so that each guild can be posted to at 9am Wednesday in its own timezone.
+	// https://crontab.guru/#0_*_*_*_*
+	scheduleCron("0 * * * *", "wednesday", itIsWednesdayMyDudes)
 
 	// https://crontab.guru/#*_*_*_*_*
-	scheduler().Cron("* * * * *").Do(setStatus)
+	scheduleCron("* * * * *", "set-status", setStatus)
 
 	// https://crontab.guru/#30_7_*_*_*
-	scheduler().Cron("30 7 * * *").Do(sendMorningCompliments)
+	scheduleCron("30 7 * * *", "morning-compliments", noError(scheduleMorningCompliments))
 
 	// https://crontab.guru/#30_20_*_*_*
-	scheduler().Cron("30 20 * * *").Do(sendEveningCompliments)
+	scheduleCron("30 20 * * *", "evening-compliments", noError(scheduleEveningCompliments))
 
 	// https://crontab.guru/#0_0_*_*_*
-	scheduler().Cron("0 0 * * *").Do(sendCreepyDMs)
+	scheduleCron("0 0 * * *", "creepy-dms", noError(scheduleCreepyDMs))
 
 	// https://crontab.guru/#*_*_*_*_*
-	scheduler().Cron("* * * * *").Do(updateServerClocks)
+	scheduleCron("* * * * *", "server-clocks", noError(updateServerClocks))
 
-	// https://crontab.guru/#0_1_*_*_*
-	scheduler().Cron("0 1 * * *").Do(func() {
-		if err := purgeFinishedPolls(); err != nil {
-			log.Error(err)
-		}
-	})
+	// https://crontab.guru/#*/10_*_*_*_*
+	scheduleCron("*/10 * * * *", "prune-rate-limits", noError(pruneRateLimitBuckets))
+
+	// https://crontab.guru/#15_*_*_*_*
+	scheduleCron("15 * * * *", "prune-error-reports", pruneErrorReports)
+
+	// https://crontab.guru/#*_*_*_*_*
+	scheduleCron("* * * * *", "flush-alerts", noError(flushAlerts))
+
+	// Jobs that return an error are counted as failures.
+	scheduler().RegisterEventListeners(
+		gocron.BeforeJobRuns(func(jobName string) {
+			cronRunsTotal.WithLabelValues(jobName).Inc()
+		}),
+		gocron.WhenJobReturnsError(func(jobName string, err error) {
+			cronFailuresTotal.WithLabelValues(jobName).Inc()
+			log.Errorf("%s failed: %v", jobName, err)
+			// Panics have already raised an alert of their own.
+			var pe *panicError
+			if !errors.As(err, &pe) {
+				raiseAlert(alert{
+					Severity: severityWarning,
+					Title:    "Scheduled job failed",
+					Key:      "cron " + jobName,
+					Message:  fmt.Sprintf("`%s` failed: %v", jobName, err),
+				})
+			}
+		}),
+	)
 
 	// ^The above only initializes the scheduler, it does not start it.
 }
 
+// scheduleCron adds a job to the scheduler. A panic in the job fails
+// that run, like returning an error would, instead of the whole bot.
+func scheduleCron(spec, name string, job func() error) {
+	scheduler().Cron(spec).Name(name).Do(recoverJob(name, job))
+}
+
 const WednesdayAssetsDir string = AssetsDir + "/wednesday"
 
+// checkWednesdayAssets makes sure there is something to post on Wednesday.
+func checkWednesdayAssets() error {
+	imgs, err := os.ReadDir(WednesdayAssetsDir)
+	if err != nil {
+		return err
+	}
+	if len(imgs) < 1 {
+		return fmt.Errorf("%s: no wednesday images", WednesdayAssetsDir)
+	}
+	for _, img := range imgs {
+		if !isImageRegex().MatchString(img.Name()) {
+			return fmt.Errorf("%s/%s is not an image", WednesdayAssetsDir, img.Name())
+		}
+	}
+	return nil
+}
+
 var genChanRegexp = func() *regexp.Regexp { return nil }
 
 func init() {
@@ -65,51 +113,74 @@ func init() {
 	genChanRegexp = func() *regexp.Regexp { return r }
 }
 
-func itIsWednesdayMyDudes() {
-	wg := bot().updateLastActive()
-	defer wg.Wait()
+const (
+	wednesdayPostWeekday = time.Wednesday
+	wednesdayPostHour    = 9
+)
 
-	log.Info("It is wednesday my dudes")
-	session := bot().Session
+// isWednesdayMorning reports whether t, in loc, falls within the hour
+// that the Wednesday post goes out.
+func isWednesdayMorning(t time.Time, loc *time.Location) bool {
+	t = t.In(loc)
+	return t.Weekday() == wednesdayPostWeekday && t.Hour() == wednesdayPostHour
+}
+
+func itIsWednesdayMyDudes() error {
+	session := bot().api
 	if session == nil {
-		log.Error("nil session")
-		return
+		return errors.New("nil session")
 	}
 
-	guilds, err := session.UserGuilds(100, "", "")
+	allGuilds, err := bot().GetAllGuilds()
 	if err != nil {
-		log.Error(err)
+		return err
+	}
+
+	now := time.Now()
+	guilds := make([]*discordgo.UserGuild, 0, len(allGuilds))
+	for _, g := range allGuilds {
+		if g == nil {
+			log.Warn("nil guild encountered")
+			continue
+		}
+		gs := settingsFor(g.ID)
+		if gs.featureEnabled(featureWednesday) && isWednesdayMorning(now, gs.location()) {
+			guilds = append(guilds, g)
+		}
+	}
+	if len(guilds) == 0 {
+		return nil
 	}
 
+	wg := bot().updateLastActive()
+	defer wg.Wait()
+
+	log.Info("It is wednesday my dudes")
+
 	// Prepare the message contents
 	imgCandidates, err := ioutil.ReadDir(WednesdayAssetsDir)
 	if err != nil {
-		log.Error(err)
-		return
+		return err
 	}
 	if len(imgCandidates) < 1 {
-		log.Error("No wednesday images")
-		return
+		return errors.New("no wednesday images")
 	}
 
 	img := imgCandidates[rand.Intn(len(imgCandidates))]
 	if !isImageRegex().MatchString(img.Name()) {
-		log.Errorf("%s is not an image", img.Name())
-		return
+		return fmt.Errorf("%s is not an image", img.Name())
 	}
 
 	log.Debugf("Opening %s/%s", WednesdayAssetsDir, img.Name())
 	fd, err := os.Open(fmt.Sprintf("%s/%s", WednesdayAssetsDir, img.Name()))
 	if err != nil {
-		log.Error(err)
-		return
+		return err
 	}
 	defer fd.Close()
 
 	mimeType, err := mimetype.DetectReader(fd)
 	if err != nil {
-		log.Error(err)
-		return
+		return err
 	}
 	hexColor, _ := fastHappyColorInt64()
 	e := dg_helpers.NewEmbed()
@@ -119,65 +190,75 @@ func itIsWednesdayMyDudes() {
 		Truncate()
 
 	for _, g := range guilds {
-		if g == nil {
-			log.Warn("nil guild encountered")
+		channelID, err := announcementChannel(session, g.ID)
+		if err != nil {
+			log.Error(err)
 			continue
 		}
 
-		chans, err := session.GuildChannels(g.ID)
+		_, err = fd.Seek(0, 0)
 		if err != nil {
 			log.Error(err)
 			continue
 		}
+		attachment := &discordgo.File{
+			Name:        img.Name(),
+			ContentType: mimeType.String(),
+			Reader:      fd,
+		}
+		_, err = session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+			Embed: e.MessageEmbed,
+			Files: []*discordgo.File{attachment},
+		})
+		if err != nil {
+			log.Error(err)
+		}
+	}
+	return nil
+}
 
-		for _, c := range chans {
-			if c.Type != discordgo.ChannelTypeGuildText {
-				continue
-			}
-			if genChanRegexp().MatchString(c.Name) {
-				_, err = fd.Seek(0, 0)
-				if err != nil {
-					log.Error(err)
-					break
-				}
-				attachment := &discordgo.File{
-					Name:        img.Name(),
-					ContentType: mimeType.String(),
-					Reader:      fd,
-				}
-				_, err := session.ChannelMessageSendComplex(c.ID, &discordgo.MessageSend{
-					Embed: e.MessageEmbed,
-					Files: []*discordgo.File{attachment},
-				})
-				if err != nil {
-					log.Error(err)
-				}
-				break
-			}
+// announcementChannel returns the ID of the channel that scheduled posts
+// should be sent to in a guild. The channel configured with /settings is
+// preferred, falling back to the first text channel named "general".
+func announcementChannel(s discordSession, guildID string) (string, error) {
+	if channelID := settingsFor(guildID).AnnouncementChannelID; channelID != "" {
+		return channelID, nil
+	}
+
+	chans, err := s.GuildChannels(guildID)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range chans {
+		if c.Type == discordgo.ChannelTypeGuildText && genChanRegexp().MatchString(c.Name) {
+			return c.ID, nil
 		}
 	}
+	return "", fmt.Errorf("no announcement channel found in guild %s", guildID)
 }
 
 const idleTimeoutMinutes time.Duration = time.Minute * 5
 
-func setStatus() {
-	if bot().status.Load() != string(discordgo.StatusIdle) && time.Since(bot().lastActive.Load()) > idleTimeoutMinutes {
-		err := bot().Session.UpdateListeningStatus("")
-		if err != nil {
-			log.Error(err)
-		}
+func setStatus() error {
+	if bot().status.Load() == string(discordgo.StatusIdle) || time.Since(bot().lastActive.Load()) <= idleTimeoutMinutes {
+		return nil
+	}
 
-		idleSince := int(time.Now().Local().UnixMilli())
-		err = bot().Session.UpdateStatusComplex(discordgo.UpdateStatusData{
-			IdleSince: &idleSince,
-			AFK:       true,
-			Status:    string(discordgo.StatusIdle),
-		})
-		if err != nil {
-			log.Error(err)
-		} else {
-			bot().status.Store(string(discordgo.StatusIdle))
-			log.Infof("Set bot status to %s", bot().status.Load())
-		}
+	err := bot().Session.UpdateListeningStatus("")
+	if err != nil {
+		log.Error(err)
+	}
+
+	idleSince := int(time.Now().Local().UnixMilli())
+	err = bot().Session.UpdateStatusComplex(discordgo.UpdateStatusData{
+		IdleSince: &idleSince,
+		AFK:       true,
+		Status:    string(discordgo.StatusIdle),
+	})
+	if err != nil {
+		return err
 	}
+	bot().status.Store(string(discordgo.StatusIdle))
+	log.Infof("Set bot status to %s", bot().status.Load())
+	return nil
 }
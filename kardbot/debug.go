@@ -1,7 +1,7 @@
 package kardbot
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"strings"
 
@@ -11,6 +11,31 @@ import (
 
 const logLevelCmd = "loglevel"
 
+func init() {
+	registerCommand(&command{
+		name:       logLevelCmd,
+		definition: logLevelCmdDefinition,
+		handler:    updateLogLevel,
+		metadata:   CommandMetadata{Privilege: privilegeBotAdmin},
+	})
+}
+
+func logLevelCmdDefinition() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        logLevelCmd,
+		Description: "Update the log level of the bot. Only works for bot admins.",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "level",
+				Description: "Level at which to log.",
+				Required:    true,
+				Choices:     logLevelChoices(),
+			},
+		},
+	}
+}
+
 // Map logrus log levels to discordgo log levels
 func logrusToDiscordGo() map[log.Level]int {
 	return map[log.Level]int{
@@ -24,40 +49,25 @@ func logrusToDiscordGo() map[log.Level]int {
 	}
 }
 
-func updateLogLevel(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func updateLogLevel(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	if isSelf, err := authorIsSelf(s, i); err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	} else if isSelf {
-		log.Trace("Ignoring message from self")
-		return
-	}
-
-	metadata, err := getInteractionMetaData(i)
-	if err != nil {
-		log.Error(err)
-		return
-	}
-
-	if isOwner, err := authorIsOwner(i); err != nil {
-		log.Error(err)
-		interactionRespondEphemeralError(s, i, true, err)
-		return
-	} else if !isOwner {
-		log.Warnf("user %s (%s) does not have privilege to update log level", metadata.AuthorUsername, metadata.AuthorID)
-		interactionRespondEphemeralError(s, i, false, errors.New("you do not have permissions to update the log level. :("))
+		logFor(i).Trace("Ignoring message from self")
 		return
 	}
 
+	// Restricted to bot admins by the command's metadata.
 	levelStr := strings.ToLower(i.ApplicationCommandData().Options[0].StringValue())
 
 	if lvl, err := log.ParseLevel(levelStr); err == nil {
 		info := fmt.Sprintf(`Set logging level to "%s"`, levelStr)
-		log.Info(info)
+		logFor(i).Info(info)
 		log.SetLevel(lvl)
 		if bot().EnableDGLogging {
 			bot().dgLoggingMutex.Lock()
-			s.LogLevel = logrusToDiscordGo()[lvl]
+			bot().Session.LogLevel = logrusToDiscordGo()[lvl]
 			bot().dgLoggingMutex.Unlock()
 		}
 		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
@@ -67,11 +77,11 @@ func updateLogLevel(s *discordgo.Session, i *discordgo.InteractionCreate) {
 			},
 		})
 		if err != nil {
-			log.Error(err)
+			logFor(i).Error(err)
 			interactionRespondEphemeralError(s, i, true, err)
 		}
 	} else {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 	}
 }
@@ -1,6 +1,8 @@
 package kardbot
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"regexp"
 	"strconv"
@@ -8,7 +10,6 @@ import (
 	"github.com/Kardbord/ubiquity/mathutils/random"
 	"github.com/bwmarrin/discordgo"
 	cmap "github.com/orcaman/concurrent-map/v2"
-	log "github.com/sirupsen/logrus"
 )
 
 const (
@@ -20,13 +21,102 @@ const (
 	DieStartVal uint64 = 1 // Dice numbering starts at this value
 )
 
-func roll(s *discordgo.Session, i *discordgo.InteractionCreate) {
+// IDs of /roll response messages.
+const (
+	msgRollTooFewDice      = "roll.too-few-dice"
+	msgRollInvalidSides    = "roll.invalid-sides"
+	msgRollRolling         = "roll.rolling"
+	msgRollTotal           = "roll.total"
+	msgRollRolled          = "roll.rolled"
+	msgRollPickOptions     = "roll.pick-options"
+	msgRollCountMenu       = "roll.count-menu"
+	msgRollCountOption     = "roll.count-option"
+	msgRollFacesMenu       = "roll.faces-menu"
+	msgRollFacesOption     = "roll.faces-option"
+	msgRollOptionsMenu     = "roll.options-menu"
+	msgRollOptNone         = "roll.opt-none"
+	msgRollOptNoneDesc     = "roll.opt-none-description"
+	msgRollOptDM           = "roll.opt-dm"
+	msgRollOptDMDesc       = "roll.opt-dm-description"
+	msgRollOptEphemeral    = "roll.opt-ephemeral"
+	msgRollOptEphemeralDsc = "roll.opt-ephemeral-description"
+	msgRollButton          = "roll.button"
+)
+
+func init() {
+	registerMessages(map[string]string{
+		msgRollTooFewDice:      "you must roll at least one die",
+		msgRollInvalidSides:    "%s is not a valid number of sides, try something like `d20` or `6`",
+		msgRollRolling:         "Rolling %d D%d's...",
+		msgRollTotal:           "Total: %d",
+		msgRollRolled:          "%s rolled %d%s:",
+		msgRollPickOptions:     "Select the desired options, then press the button to roll the dice!",
+		msgRollCountMenu:       "How many dice?",
+		msgRollCountOption:     "Roll %d dice",
+		msgRollFacesMenu:       "How many faces?",
+		msgRollFacesOption:     "Roll a %s",
+		msgRollOptionsMenu:     "Additional Options ❔",
+		msgRollOptNone:         "None ❌",
+		msgRollOptNoneDesc:     "No additional options desired",
+		msgRollOptDM:           "DM 📫",
+		msgRollOptDMDesc:       "Get the result as a direct message.",
+		msgRollOptEphemeral:    "Ephemeral 🔮",
+		msgRollOptEphemeralDsc: "Get the result as a message that only you can see and dismiss.",
+		msgRollButton:          "Roll the 🎲!",
+	})
+	registerCommand(&command{
+		name:       RollCmd,
+		definition: rollCmdDefinition,
+		handler:    roll,
+		components: []interactionRoute{
+			{id: dndRollButtonID, handler: handleDnDButtonPress},
+			{id: dndDiceCountSelectID, handler: handleDiceCountMenuSelection},
+			{id: dndDiceFacesSelectID, handler: handleDiceFacesMenuSelection},
+			{id: dndOtherOptionsSelectID, handler: handleDnDOtherOptionsSelection},
+		},
+	})
+}
+
+func rollCmdDefinition() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        RollCmd,
+		Description: "Dice rolling fun!",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        RollSubCmdDnD,
+				Description: "Get a set of buttons for rolling DnD dice.",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        RollSubCmdCustom,
+				Description: "Rolls a D{X} die {Y} times, where X and Y are provided by the user.",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Name:        "dice-count",
+						Description: "How many dice should be rolled?",
+						Required:    true,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "dice-sides",
+						Description: "How many sides on the dice? Can optionally be prefixed with 'D' or 'd'.",
+						Required:    true,
+					},
+				},
+			},
+		},
+	}
+}
+
+func roll(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	if isSelf, err := authorIsSelf(s, i); err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	} else if isSelf {
-		log.Trace("Ignoring message from self")
+		logFor(i).Trace("Ignoring message from self")
 		return
 	}
 
@@ -37,35 +127,34 @@ func roll(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		addDnDButtons(s, i)
 	default:
 		err := fmt.Errorf("unknown subcommand: %s", i.ApplicationCommandData().Options[0].Name)
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 	}
 }
 
-func rollCustomDice(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func rollCustomDice(s discordSession, i *discordgo.InteractionCreate) {
 	count := i.ApplicationCommandData().Options[0].Options[0].IntValue()
 	if count < 1 {
-		err := fmt.Errorf("cannot roll a die <1 times")
-		log.Error(err)
-		interactionRespondEphemeralError(s, i, false, err)
+		interactionRespondEphemeralError(s, i, false, errors.New(localized(i, msgRollTooFewDice)))
 		return
 	}
 
-	sides, err := parseDieSides(i.ApplicationCommandData().Options[0].Options[1].StringValue())
+	rawSides := i.ApplicationCommandData().Options[0].Options[1].StringValue()
+	sides, err := parseDieSides(rawSides)
 	if err != nil {
-		log.Error(err)
-		interactionRespondEphemeralError(s, i, false, err)
+		logFor(i).Debug(err)
+		interactionRespondEphemeralError(s, i, false, errors.New(localized(i, msgRollInvalidSides, rawSides)))
 		return
 	}
 
-	output := fmt.Sprintf("Rolling %d D%d's...\n", count, sides)
+	output := localized(i, msgRollRolling, count, sides) + "\n"
 	printIndividualRolls := uint64(count)*uint64(len(strconv.FormatUint(sides, 10)))+uint64(len(output)) < MaxDiscordMsgLen
 	total := uint64(0)
 	if printIndividualRolls {
 		for j := int64(0); j < count; j++ {
 			roll, err := random.Range(DieStartVal, sides)
 			if err != nil {
-				log.Error(err)
+				logFor(i).Error(err)
 				interactionRespondEphemeralError(s, i, true, err)
 				return
 			}
@@ -78,20 +167,20 @@ func rollCustomDice(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		// No need to track individual dice rolls if we are only printing a total
 		roll, err := random.Range(DieStartVal*uint64(count), sides*uint64(count))
 		if err != nil {
-			log.Error(err)
+			logFor(i).Error(err)
 			interactionRespondEphemeralError(s, i, true, err)
 			return
 		}
 		total = roll
 	}
 	if count > 1 {
-		output += fmt.Sprintf("Total: %d", total)
+		output += localized(i, msgRollTotal, total)
 	}
 
 	// Cheap sanity check in case the above logic did not catch a message that is too large
 	if len(output) > int(MaxDiscordMsgLen) {
-		log.Warnf("There is a bug in msg length validation when rolling %d D%d's. Possible overflow?", count, sides)
-		output = fmt.Sprintf("Rolling %d D%d's...\nTotal: %d", count, sides, total)
+		logFor(i).Warnf("There is a bug in msg length validation when rolling %d D%d's. Possible overflow?", count, sides)
+		output = localized(i, msgRollRolling, count, sides) + "\n" + localized(i, msgRollTotal, total)
 	}
 	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
@@ -101,7 +190,7 @@ func rollCustomDice(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	})
 	if err != nil {
 		interactionRespondEphemeralError(s, i, true, err)
-		log.Error(err)
+		logFor(i).Error(err)
 	}
 }
 
@@ -191,18 +280,18 @@ func allDnDDice() []dndDie {
 	return []dndDie{d4, d6, d8, d10, d12, d20, d100}
 }
 
-func addDnDButtons(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func addDnDButtons(s discordSession, i *discordgo.InteractionCreate) {
 	const maxNumDice = maxDiscordSelectMenuOpts
 	diceCountSelectMenu := discordgo.SelectMenu{
 		CustomID:    dndDiceCountSelectID,
-		Placeholder: "How many dice?",
+		Placeholder: localized(i, msgRollCountMenu),
 		Options:     make([]discordgo.SelectMenuOption, maxNumDice),
 	}
-	for i := maxNumDice; i > 0; i-- {
-		diceCountSelectMenu.Options[i-1] = discordgo.SelectMenuOption{
-			Label:       fmt.Sprintf("%d 🎲", i),
-			Description: fmt.Sprintf("Roll %d dice", i),
-			Value:       fmt.Sprint(i),
+	for n := maxNumDice; n > 0; n-- {
+		diceCountSelectMenu.Options[n-1] = discordgo.SelectMenuOption{
+			Label:       fmt.Sprintf("%d 🎲", n),
+			Description: localized(i, msgRollCountOption, n),
+			Value:       fmt.Sprint(n),
 			Default:     false,
 		}
 	}
@@ -210,17 +299,17 @@ func addDnDButtons(s *discordgo.Session, i *discordgo.InteractionCreate) {
 
 	diceFacesSelectMenu := discordgo.SelectMenu{
 		CustomID:    dndDiceFacesSelectID,
-		Placeholder: "How many faces?",
+		Placeholder: localized(i, msgRollFacesMenu),
 		Options:     make([]discordgo.SelectMenuOption, len(allDnDDice())),
 	}
-	for i, die := range allDnDDice() {
+	for n, die := range allDnDDice() {
 		dflt := false
 		if die == d20 {
 			dflt = true
 		}
-		diceFacesSelectMenu.Options[i] = discordgo.SelectMenuOption{
+		diceFacesSelectMenu.Options[n] = discordgo.SelectMenuOption{
 			Label:       fmt.Sprintf("%s 🔢", die),
-			Description: fmt.Sprintf("Roll a %s", die),
+			Description: localized(i, msgRollFacesOption, die),
 			Value:       fmt.Sprint(die),
 			Default:     dflt,
 		}
@@ -229,7 +318,7 @@ func addDnDButtons(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: "Select the desired options, then press the button to roll the dice!",
+			Content: localized(i, msgRollPickOptions),
 			Components: []discordgo.MessageComponent{
 				discordgo.ActionsRow{
 					Components: []discordgo.MessageComponent{diceCountSelectMenu},
@@ -241,21 +330,21 @@ func addDnDButtons(s *discordgo.Session, i *discordgo.InteractionCreate) {
 					Components: []discordgo.MessageComponent{
 						discordgo.SelectMenu{
 							CustomID:    dndOtherOptionsSelectID,
-							Placeholder: "Additional Options ❔",
+							Placeholder: localized(i, msgRollOptionsMenu),
 							Options: []discordgo.SelectMenuOption{
 								{
-									Label:       dndDiceRollOptNone,
-									Description: "No additional options desired",
+									Label:       localized(i, msgRollOptNone),
+									Description: localized(i, msgRollOptNoneDesc),
 									Value:       dndDiceRollOptNone,
 								},
 								{
-									Label:       dndDiceRollOptDM,
-									Description: "Get the result as a direct message.",
+									Label:       localized(i, msgRollOptDM),
+									Description: localized(i, msgRollOptDMDesc),
 									Value:       dndDiceRollOptDM,
 								},
 								{
-									Label:       dndDiceRollOptEphemeral,
-									Description: "Get the result as a message that only you can see and dismiss.",
+									Label:       localized(i, msgRollOptEphemeral),
+									Description: localized(i, msgRollOptEphemeralDsc),
 									Value:       dndDiceRollOptEphemeral,
 								},
 							},
@@ -265,7 +354,7 @@ func addDnDButtons(s *discordgo.Session, i *discordgo.InteractionCreate) {
 				discordgo.ActionsRow{
 					Components: []discordgo.MessageComponent{
 						discordgo.Button{
-							Label:    "Roll the 🎲!",
+							Label:    localized(i, msgRollButton),
 							Style:    discordgo.PrimaryButton,
 							CustomID: dndRollButtonID,
 						},
@@ -275,15 +364,15 @@ func addDnDButtons(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		},
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 	}
 }
 
-func handleDnDButtonPress(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func handleDnDButtonPress(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	metadata, err := getInteractionMetaData(i)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
@@ -294,13 +383,13 @@ func handleDnDButtonPress(s *discordgo.Session, i *discordgo.InteractionCreate)
 	}
 
 	faces := cfg.Faces
-	content := fmt.Sprintf("%s rolled %d%s:\n", metadata.AuthorMention, cfg.DiceCount, faces)
+	content := localized(i, msgRollRolled, metadata.AuthorMention, cfg.DiceCount, faces) + "\n"
 
 	total := uint64(0)
 	for j := uint64(0); j < cfg.DiceCount; j++ {
 		rollResult, err := random.Range(1, uint64(faces))
 		if err != nil {
-			log.Error(err)
+			logFor(i).Error(err)
 			interactionRespondEphemeralError(s, i, true, err)
 			return
 		}
@@ -308,7 +397,7 @@ func handleDnDButtonPress(s *discordgo.Session, i *discordgo.InteractionCreate)
 		content += fmt.Sprintf("%d\n", rollResult)
 	}
 	if cfg.DiceCount > 1 {
-		content += fmt.Sprintf("Total: %d", total)
+		content += localized(i, msgRollTotal, total)
 	}
 
 	var flags discordgo.MessageFlags = 0
@@ -319,14 +408,14 @@ func handleDnDButtonPress(s *discordgo.Session, i *discordgo.InteractionCreate)
 	if cfg.DM {
 		uc, err := s.UserChannelCreate(metadata.AuthorID)
 		if err != nil {
-			log.Error(err)
+			logFor(i).Error(err)
 			interactionRespondEphemeralError(s, i, true, err)
 			return
 		}
 
 		_, err = s.ChannelMessageSend(uc.ID, content)
 		if err != nil {
-			log.Error(err)
+			logFor(i).Error(err)
 			interactionRespondEphemeralError(s, i, true, err)
 			return
 		}
@@ -334,7 +423,7 @@ func handleDnDButtonPress(s *discordgo.Session, i *discordgo.InteractionCreate)
 			Type: discordgo.InteractionResponseDeferredMessageUpdate,
 		})
 		if err != nil {
-			log.Error(err)
+			logFor(i).Error(err)
 			interactionRespondEphemeralError(s, i, true, err)
 		}
 		return
@@ -348,16 +437,16 @@ func handleDnDButtonPress(s *discordgo.Session, i *discordgo.InteractionCreate)
 		},
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
 }
 
-func handleDiceCountMenuSelection(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func handleDiceCountMenuSelection(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	metadata, err := getInteractionMetaData(i)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
@@ -369,14 +458,14 @@ func handleDiceCountMenuSelection(s *discordgo.Session, i *discordgo.Interaction
 
 	if len(i.MessageComponentData().Values) == 0 {
 		err = fmt.Errorf("no values sent")
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
 
 	diceCount, err := strconv.ParseUint(i.MessageComponentData().Values[0], 10, 64)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
@@ -388,15 +477,15 @@ func handleDiceCountMenuSelection(s *discordgo.Session, i *discordgo.Interaction
 		Type: discordgo.InteractionResponseDeferredMessageUpdate,
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 	}
 }
 
-func handleDiceFacesMenuSelection(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func handleDiceFacesMenuSelection(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	metadata, err := getInteractionMetaData(i)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
@@ -408,7 +497,7 @@ func handleDiceFacesMenuSelection(s *discordgo.Session, i *discordgo.Interaction
 
 	if len(i.MessageComponentData().Values) == 0 {
 		err = fmt.Errorf("no values sent")
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
@@ -416,7 +505,7 @@ func handleDiceFacesMenuSelection(s *discordgo.Session, i *discordgo.Interaction
 	var die dndDie
 	err = die.parseFromString(i.MessageComponentData().Values[0])
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
@@ -428,15 +517,15 @@ func handleDiceFacesMenuSelection(s *discordgo.Session, i *discordgo.Interaction
 		Type: discordgo.InteractionResponseDeferredMessageUpdate,
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 	}
 }
 
-func handleDnDOtherOptionsSelection(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func handleDnDOtherOptionsSelection(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	metadata, err := getInteractionMetaData(i)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
@@ -467,7 +556,7 @@ func handleDnDOtherOptionsSelection(s *discordgo.Session, i *discordgo.Interacti
 		Type: discordgo.InteractionResponseDeferredMessageUpdate,
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 	}
 }
@@ -0,0 +1,79 @@
+package kardbot
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Kardbord/Kard-bot/kardbot/fakediscord"
+	"github.com/bwmarrin/discordgo"
+)
+
+func customRoll(fake *fakediscord.Session, count int64, sides string) *discordgo.InteractionCreate {
+	return fake.Command(RollCmd, []*discordgo.ApplicationCommandInteractionDataOption{
+		fakediscord.SubCommand(RollSubCmdCustom,
+			fakediscord.IntOpt("dice-count", count),
+			fakediscord.StringOpt("dice-sides", sides),
+		),
+	}, inTestGuild()...)
+}
+
+func TestRollCustomDice(t *testing.T) {
+	fake := newTestBot(t)
+	i := customRoll(fake, 3, "d6")
+
+	rollCustomDice(fake, i)
+
+	resp := mustRespond(t, fake, i)
+	if isEphemeral(resp) {
+		t.Fatalf("expected a public response, got %+v", resp.Initial.Data)
+	}
+	lines := strings.Split(resp.Initial.Data.Content, "\n")
+	if lines[0] != "Rolling 3 D6's..." {
+		t.Errorf("unexpected header %q", lines[0])
+	}
+	if len(lines) != 5 {
+		t.Fatalf("expected 3 rolls and a total, got %q", resp.Initial.Data.Content)
+	}
+
+	sum := uint64(0)
+	for _, l := range lines[1:4] {
+		roll, err := strconv.ParseUint(l, 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if roll < DieStartVal || roll > 6 {
+			t.Errorf("roll %d out of range", roll)
+		}
+		sum += roll
+	}
+	if want := "Total: " + strconv.FormatUint(sum, 10); lines[4] != want {
+		t.Errorf("got %q, want %q", lines[4], want)
+	}
+}
+
+func TestRollCustomDiceInvalidArgs(t *testing.T) {
+	cases := []struct {
+		name  string
+		count int64
+		sides string
+	}{
+		{"zero dice", 0, "6"},
+		{"negative sides", 1, "-6"},
+		{"not a die", 1, "d6s"},
+		{"one sided", 1, "1"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := newTestBot(t)
+			i := customRoll(fake, tc.count, tc.sides)
+
+			rollCustomDice(fake, i)
+
+			if resp := mustRespond(t, fake, i); !isEphemeral(resp) {
+				t.Errorf("expected an ephemeral error, got %+v", resp.Initial.Data)
+			}
+		})
+	}
+}
@@ -36,8 +36,10 @@ var (
 	getOpenAIToken      = func() string { return "" }
 )
 
-// Retrieves the bot's auth token from the environment
-func init() {
+// Reads the bot's auth token and other settings from the environment.
+// Called by Run rather than init so that the package can be loaded
+// (e.g. by tests) without a token.
+func loadEnv() {
 	// This will only add new environment variables,
 	// and will NOT overwrite existing ones.
 	_ = godotenv.Load( /*.env by default*/ )
@@ -0,0 +1,521 @@
+package kardbot
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Kardbord/Kard-bot/kardbot/dg_helpers"
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	errorsCmd = "errors"
+
+	errorsSubCmdList    = "list"
+	errorsSubCmdShow    = "show"
+	errorsSubCmdResolve = "resolve"
+	errorsSubCmdExport  = "export"
+
+	errorsOptID       = "id"
+	errorsOptResolved = "include-resolved"
+)
+
+const (
+	// How long a user has to choose whether to send an error report.
+	errorReportTTL = 24 * time.Hour
+	// How long an error is kept after it was last seen.
+	errorRecordTTL = 30 * 24 * time.Hour
+	// Most errors listed by /errors list.
+	maxListedErrors = 20
+)
+
+// errorRecord is every occurrence of one error, as identified by its
+// signature: where it came from and what it said.
+type errorRecord struct {
+	ID       string `json:"id"`
+	Message  string `json:"message"`
+	Filename string `json:"filename"`
+	Line     int    `json:"line"`
+	// Stack trace of the most recent occurrence, if the error was a panic.
+	Stack string `json:"stack,omitempty"`
+	// Command and payload of the most recent interaction to hit the error.
+	Command     string    `json:"command,omitempty"`
+	Payload     string    `json:"payload,omitempty"`
+	FirstSeen   time.Time `json:"first-seen"`
+	LastSeen    time.Time `json:"last-seen"`
+	Occurrences int       `json:"occurrences"`
+	// How many times users chose to send the error to the bot owner.
+	Reports  int  `json:"reports,omitempty"`
+	Resolved bool `json:"resolved,omitempty"`
+}
+
+func (r *errorRecord) location() string {
+	return fmt.Sprintf("%s:%d", sourcePath(r.Filename), r.Line)
+}
+
+func (r *errorRecord) status() string {
+	if r.Resolved {
+		return "resolved"
+	}
+	return "open"
+}
+
+// Serializes read-modify-write cycles on errorRecordsBucket.
+var errorRecordsMutex sync.Mutex
+
+// errorSignature identifies an error by where it came from and what it
+// said, so that repeats of the same error share one errorRecord.
+func errorSignature(filename string, line int, msg string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d %s", filename, line, msg)))
+	return hex.EncodeToString(sum[:])[:10]
+}
+
+// sourcePath trims a file path down to its path within the repository.
+func sourcePath(filename string) string {
+	if idx := strings.LastIndex(filename, "/kardbot/"); idx >= 0 {
+		return filename[idx+1:]
+	}
+	return filename
+}
+
+// interactionPayload returns the data an interaction was issued with,
+// as indented JSON.
+func interactionPayload(i *discordgo.InteractionCreate) (string, error) {
+	var data any
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand, discordgo.InteractionApplicationCommandAutocomplete:
+		data = i.ApplicationCommandData()
+	case discordgo.InteractionMessageComponent:
+		data = i.MessageComponentData()
+	case discordgo.InteractionModalSubmit:
+		data = i.ModalSubmitData()
+	default:
+		return "", nil
+	}
+	buf, err := json.MarshalIndent(data, "", "  ")
+	return string(buf), err
+}
+
+// saveErrorReport stores an error that a user has been offered to report,
+// and counts it against the error's record.
+func saveErrorReport(report errorReport) {
+	if err := stateStore().Put(errorReportsBucket, report.UUID.String(), report); err != nil {
+		log.Error(err)
+	}
+	if err := recordError(report); err != nil {
+		log.Error(err)
+	}
+}
+
+// recordError adds an occurrence of an error to its record. A resolved
+// error is reopened if it happens again.
+func recordError(report errorReport) error {
+	errorRecordsMutex.Lock()
+	defer errorRecordsMutex.Unlock()
+
+	id := errorSignature(report.Filename, report.Line, report.Error)
+	rec := errorRecord{}
+	found, err := stateStore().Get(errorRecordsBucket, id, &rec)
+	if err != nil {
+		return err
+	}
+	if !found {
+		rec = errorRecord{
+			ID:        id,
+			Message:   report.Error,
+			Filename:  report.Filename,
+			Line:      report.Line,
+			FirstSeen: report.Created,
+		}
+	} else if rec.Resolved {
+		log.Warnf("Resolved error %s has happened again", id)
+		rec.Resolved = false
+	}
+
+	payload, err := interactionPayload(&report.InteractionCreate)
+	if err != nil {
+		log.Error(err)
+	}
+	rec.Stack = report.Stack
+	rec.Command = interactionName(&report.InteractionCreate)
+	rec.Payload = payload
+	rec.LastSeen = report.Created
+	rec.Occurrences++
+	return stateStore().Put(errorRecordsBucket, id, rec)
+}
+
+// loadErrorReport returns the error report with the given UUID, unless it
+// doesn't exist or has expired.
+func loadErrorReport(id string) (errorReport, bool, error) {
+	report := errorReport{}
+	found, err := stateStore().Get(errorReportsBucket, id, &report)
+	if err != nil || !found {
+		return report, false, err
+	}
+	if time.Since(report.Created) > errorReportTTL {
+		return report, false, nil
+	}
+	return report, true, nil
+}
+
+// markErrorReported removes an error report once it has been sent to
+// the bot owner, and counts it against the error's record.
+func markErrorReported(report errorReport) error {
+	if err := stateStore().Delete(errorReportsBucket, report.UUID.String()); err != nil {
+		return err
+	}
+	_, err := updateErrorRecord(errorSignature(report.Filename, report.Line, report.Error), func(rec *errorRecord) {
+		rec.Reports++
+	})
+	return err
+}
+
+// updateErrorRecord applies update to the record with the given ID, and
+// returns the updated record. It is an error if there is no such record.
+func updateErrorRecord(id string, update func(*errorRecord)) (errorRecord, error) {
+	errorRecordsMutex.Lock()
+	defer errorRecordsMutex.Unlock()
+
+	rec := errorRecord{}
+	found, err := stateStore().Get(errorRecordsBucket, id, &rec)
+	if err != nil {
+		return rec, err
+	}
+	if !found {
+		return rec, fmt.Errorf("no error with ID %s", id)
+	}
+	update(&rec)
+	return rec, stateStore().Put(errorRecordsBucket, id, rec)
+}
+
+func getErrorRecord(id string) (errorRecord, error) {
+	rec := errorRecord{}
+	found, err := stateStore().Get(errorRecordsBucket, strings.TrimSpace(id), &rec)
+	if err == nil && !found {
+		err = fmt.Errorf("no error with ID %s", id)
+	}
+	return rec, err
+}
+
+// errorRecords returns every stored error, most recently seen first.
+func errorRecords(includeResolved bool) ([]errorRecord, error) {
+	recs := []errorRecord{}
+	err := stateStore().ForEach(errorRecordsBucket, func(key string, raw json.RawMessage) error {
+		rec := errorRecord{}
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		if includeResolved || !rec.Resolved {
+			recs = append(recs, rec)
+		}
+		return nil
+	})
+	sort.Slice(recs, func(i, j int) bool { return recs[i].LastSeen.After(recs[j].LastSeen) })
+	return recs, err
+}
+
+// pruneErrorReports drops error reports that users never sent, and
+// errors that haven't been seen for a while.
+func pruneErrorReports() error {
+	now := time.Now()
+	expired := []string{}
+	err := stateStore().ForEach(errorReportsBucket, func(key string, raw json.RawMessage) error {
+		report := errorReport{}
+		if err := json.Unmarshal(raw, &report); err != nil || now.Sub(report.Created) > errorReportTTL {
+			expired = append(expired, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range expired {
+		if err = stateStore().Delete(errorReportsBucket, key); err != nil {
+			return err
+		}
+	}
+
+	errorRecordsMutex.Lock()
+	defer errorRecordsMutex.Unlock()
+	stale := []string{}
+	err = stateStore().ForEach(errorRecordsBucket, func(key string, raw json.RawMessage) error {
+		rec := errorRecord{}
+		if err := json.Unmarshal(raw, &rec); err != nil || now.Sub(rec.LastSeen) > errorRecordTTL {
+			stale = append(stale, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range stale {
+		if err = stateStore().Delete(errorRecordsBucket, key); err != nil {
+			return err
+		}
+	}
+	if len(expired)+len(stale) > 0 {
+		log.Infof("Pruned %d expired error reports and %d stale errors", len(expired), len(stale))
+	}
+	return nil
+}
+
+func init() {
+	registerCommand(&command{
+		name:         errorsCmd,
+		definition:   errorsCmdDefinition,
+		handler:      handleErrorsCmd,
+		autocomplete: autocompleteErrorIDs,
+		metadata:     CommandMetadata{Privilege: privilegeOwner},
+	})
+}
+
+func errorsCmdDefinition() *discordgo.ApplicationCommand {
+	idOpt := func(desc string) []*discordgo.ApplicationCommandOption {
+		return []*discordgo.ApplicationCommandOption{
+			{
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         errorsOptID,
+				Description:  desc,
+				Required:     true,
+				Autocomplete: true,
+			},
+		}
+	}
+	return &discordgo.ApplicationCommand{
+		Name:        errorsCmd,
+		Description: "Triage errors users have run into. Only works for the bot owner.",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        errorsSubCmdList,
+				Description: "List recent errors.",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionBoolean,
+						Name:        errorsOptResolved,
+						Description: "Also list errors that have been marked resolved.",
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        errorsSubCmdShow,
+				Description: "Show an error along with its stack trace and the interaction that caused it.",
+				Options:     idOpt("ID of the error to show."),
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        errorsSubCmdResolve,
+				Description: "Mark an error as resolved. It is reopened if it happens again.",
+				Options:     idOpt("ID of the error to resolve."),
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        errorsSubCmdExport,
+				Description: "Export an error as Markdown, ready to paste into a GitHub issue.",
+				Options:     idOpt("ID of the error to export."),
+			},
+		},
+	}
+}
+
+// Restricted to the bot owner by the command's metadata.
+func handleErrorsCmd(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
+	subCmd := i.ApplicationCommandData().Options[0]
+	opts := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(subCmd.Options))
+	for _, opt := range subCmd.Options {
+		opts[opt.Name] = opt
+	}
+
+	switch subCmd.Name {
+	case errorsSubCmdList:
+		includeResolved := false
+		if opt, ok := opts[errorsOptResolved]; ok {
+			includeResolved = opt.BoolValue()
+		}
+		recs, err := errorRecords(includeResolved)
+		if err != nil {
+			logFor(i).Error(err)
+			interactionRespondEphemeralError(s, i, false, err)
+			return
+		}
+		respondAdmin(s, i, "", buildErrorListEmbed(recs))
+	case errorsSubCmdShow:
+		rec, err := getErrorRecord(opts[errorsOptID].StringValue())
+		if err != nil {
+			interactionRespondEphemeralError(s, i, false, err)
+			return
+		}
+		data := &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{buildErrorEmbed(rec)},
+			Flags:  discordgo.MessageFlagsEphemeral,
+		}
+		if rec.Stack != "" {
+			data.Files = []*discordgo.File{{
+				Name:        fmt.Sprintf("stack-%s.txt", rec.ID),
+				ContentType: "text/plain",
+				Reader:      strings.NewReader(rec.Stack),
+			}}
+		}
+		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: data,
+		})
+		if err != nil {
+			logFor(i).Error(err)
+		}
+	case errorsSubCmdResolve:
+		rec, err := updateErrorRecord(strings.TrimSpace(opts[errorsOptID].StringValue()), func(rec *errorRecord) {
+			rec.Resolved = true
+		})
+		if err != nil {
+			interactionRespondEphemeralError(s, i, false, err)
+			return
+		}
+		logFor(i).Infof("Error %s marked resolved", rec.ID)
+		respondAdmin(s, i, fmt.Sprintf("Marked `%s` as resolved. It will be reopened if it happens again.", rec.ID), nil)
+	case errorsSubCmdExport:
+		rec, err := getErrorRecord(opts[errorsOptID].StringValue())
+		if err != nil {
+			interactionRespondEphemeralError(s, i, false, err)
+			return
+		}
+		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "Here's an issue ready to paste into GitHub.",
+				Flags:   discordgo.MessageFlagsEphemeral,
+				Files: []*discordgo.File{{
+					Name:        fmt.Sprintf("error-%s.md", rec.ID),
+					ContentType: "text/markdown",
+					Reader:      strings.NewReader(errorMarkdown(rec)),
+				}},
+			},
+		})
+		if err != nil {
+			logFor(i).Error(err)
+		}
+	default:
+		interactionRespondEphemeralError(s, i, true, fmt.Errorf("unknown subcommand %s", subCmd.Name))
+	}
+}
+
+// autocompleteErrorIDs suggests open errors, most recently seen first,
+// labelled with their messages since IDs alone mean nothing.
+func autocompleteErrorIDs(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	query := ""
+	if opt := focusedOption(i.ApplicationCommandData().Options); opt != nil {
+		query, _ = opt.Value.(string)
+	}
+	recs, err := errorRecords(true)
+	if err != nil {
+		logFor(i).Error(err)
+	}
+	labels := make([]string, 0, len(recs))
+	ids := make(map[string]string, len(recs))
+	for _, rec := range recs {
+		label := fmt.Sprintf("%s: %s (%s)", rec.ID, rec.Message, rec.status())
+		labels = append(labels, label)
+		ids[label] = rec.ID
+	}
+	for _, label := range fuzzyMatch(query, labels, maxDiscordOptionChoices) {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  truncateChoiceName(label),
+			Value: ids[label],
+		})
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+	if err != nil {
+		logFor(i).Error(err)
+	}
+}
+
+func buildErrorListEmbed(recs []errorRecord) *discordgo.MessageEmbed {
+	lines := make([]string, 0, maxListedErrors)
+	for idx, rec := range recs {
+		if idx == maxListedErrors {
+			lines = append(lines, fmt.Sprintf("…and %d more", len(recs)-maxListedErrors))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("`%s` **%s** ×%d, last seen <t:%d:R>\n%s", rec.ID, rec.location(), rec.Occurrences, rec.LastSeen.Unix(), rec.Message))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "No errors. 🎉")
+	}
+
+	color, _ := fastHappyColorInt64()
+	return dg_helpers.NewEmbed().
+		SetTitle(fmt.Sprintf("%d errors", len(recs))).
+		SetDescription(strings.Join(lines, "\n")).
+		SetColor(int(color)).
+		Truncate().
+		MessageEmbed
+}
+
+func buildErrorEmbed(rec errorRecord) *discordgo.MessageEmbed {
+	color, _ := fastHappyColorInt64()
+	embed := dg_helpers.NewEmbed().
+		SetTitle(fmt.Sprintf("Error %s", rec.ID)).
+		SetColor(int(color)).
+		AddField("Error", fmt.Sprintf("```\n%s %s\n```", rec.location(), rec.Message)).
+		AddField("Status", rec.status()).
+		AddField("Occurrences", fmt.Sprint(rec.Occurrences)).
+		AddField("Reports", fmt.Sprint(rec.Reports)).
+		AddField("First Seen", fmt.Sprintf("<t:%d:f>", rec.FirstSeen.Unix())).
+		AddField("Last Seen", fmt.Sprintf("<t:%d:f>", rec.LastSeen.Unix()))
+	if rec.Command != "" {
+		embed.AddField("Command", rec.Command)
+	}
+	if rec.Payload != "" {
+		embed.AddField("Interaction", fmt.Sprintf("```json\n%s\n```", rec.Payload))
+	}
+	return embed.Truncate().MessageEmbed
+}
+
+// errorMarkdown formats an error as the body of a GitHub issue.
+func errorMarkdown(rec errorRecord) string {
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, "## %s\n\n", rec.Message)
+	fmt.Fprintf(&sb, "- **Location:** `%s`\n", rec.location())
+	if rec.Command != "" {
+		fmt.Fprintf(&sb, "- **Command:** `%s`\n", rec.Command)
+	}
+	fmt.Fprintf(&sb, "- **Occurrences:** %d (%d reported by users)\n", rec.Occurrences, rec.Reports)
+	fmt.Fprintf(&sb, "- **First seen:** %s\n", rec.FirstSeen.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&sb, "- **Last seen:** %s\n", rec.LastSeen.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&sb, "- **Error ID:** `%s`\n", rec.ID)
+	if rec.Payload != "" {
+		fmt.Fprintf(&sb, "\n### Interaction\n\n```json\n%s\n```\n", rec.Payload)
+	}
+	if rec.Stack != "" {
+		fmt.Fprintf(&sb, "\n<details>\n<summary>Stack trace</summary>\n\n```\n%s\n```\n\n</details>\n", strings.TrimRight(rec.Stack, "\n"))
+	}
+	return sb.String()
+}
+
+// newErrorReport builds the report offered to the user who ran into errResp.
+func newErrorReport(i *discordgo.InteractionCreate, errUUID uuid.UUID, errResp error, filename string, line int) errorReport {
+	return errorReport{
+		UUID:              errUUID,
+		InteractionCreate: *i,
+		Error:             errResp.Error(),
+		Filename:          filename,
+		Line:              line,
+		Stack:             errorStack(errResp),
+		Created:           time.Now(),
+	}
+}
@@ -0,0 +1,191 @@
+package kardbot
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kardbord/Kard-bot/kardbot/fakediscord"
+	"github.com/bwmarrin/discordgo"
+)
+
+func errorsCommand(fake *fakediscord.Session, subCmd string, opts ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	return fake.Command(errorsCmd, []*discordgo.ApplicationCommandInteractionDataOption{
+		fakediscord.SubCommand(subCmd, opts...),
+	}, fakediscord.FromUser(testUser))
+}
+
+// offerErrorReport fails i with errResp, as a handler would, and returns
+// the ID of the report the user was offered.
+func offerErrorReport(t *testing.T, fake *fakediscord.Session, i *discordgo.InteractionCreate, errResp error) string {
+	t.Helper()
+	interactionRespondEphemeralError(fake, i, true, errResp)
+	resp := mustRespond(t, fake, i)
+	menu := resp.Initial.Data.Components[0].(discordgo.ActionsRow).Components[0].(discordgo.SelectMenu)
+	selection := errReportSelectionValue{}
+	if err := selection.UnmarshalFromString(menu.Options[0].Value); err != nil {
+		t.Fatal(err)
+	}
+	return selection.ErrUUID.String()
+}
+
+func TestErrorReportsAreDeduplicated(t *testing.T) {
+	fake := newTestBot(t)
+	prevOwner := getOwnerID
+	getOwnerID = func() string { return testUser.ID }
+	t.Cleanup(func() { getOwnerID = prevOwner })
+
+	first := offerErrorReport(t, fake, fake.Command(pollCmd, nil, inTestGuild()...), errors.New("kaboom"))
+	offerErrorReport(t, fake, fake.Command(pollCmd, nil, inTestGuild()...), errors.New("kaboom"))
+	offerErrorReport(t, fake, fake.Command(pollCmd, nil, inTestGuild()...), errors.New("something else"))
+
+	recs, err := errorRecords(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("expected 2 distinct errors, got %+v", recs)
+	}
+	var rec errorRecord
+	for _, r := range recs {
+		if r.Message == "kaboom" {
+			rec = r
+		}
+	}
+	if rec.Occurrences != 2 || rec.Command != pollCmd || rec.Payload == "" {
+		t.Errorf("unexpected record %+v", rec)
+	}
+
+	report, ok, err := loadErrorReport(first)
+	if err != nil || !ok {
+		t.Fatalf("report %s was not stored: %v", first, err)
+	}
+	if report.Error != "kaboom" || interactionName(&report.InteractionCreate) != pollCmd {
+		t.Errorf("report did not survive the store: %+v", report)
+	}
+
+	// Sending the report counts it against the error and removes the report.
+	msg := &discordgo.Message{ID: fake.NewID(), ChannelID: testChannelID, Content: localize("", msgErrorReportPrompt)}
+	selection := errReportSelectionValue{ErrUUID: report.UUID, Anonymous: true}.MarshalToString()
+	i := fake.Component(selectMenuErrorReport, discordgo.SelectMenuComponent, []string{selection},
+		append(inTestGuild(), fakediscord.OnMessage(msg))...)
+	bot().routeInteraction(fake, i)
+	mustRespond(t, fake, i)
+
+	dms := fake.DMs(testUser.ID)
+	if len(dms) != 1 || len(dms[0].Embeds) == 0 || !strings.Contains(embedText(dms[0].Embeds[0]), rec.ID) {
+		t.Errorf("expected the owner to be sent the report with its error ID, got %+v", dms)
+	}
+	if _, ok, _ := loadErrorReport(first); ok {
+		t.Error("sent report was not removed")
+	}
+	if rec, err = getErrorRecord(rec.ID); err != nil || rec.Reports != 1 {
+		t.Errorf("report was not counted: %+v, %v", rec, err)
+	}
+}
+
+func TestErrorsCommand(t *testing.T) {
+	fake := newTestBot(t)
+	prevOwner := getOwnerID
+	getOwnerID = func() string { return testUser.ID }
+	t.Cleanup(func() { getOwnerID = prevOwner })
+
+	offerErrorReport(t, fake, fake.Command(pollCmd, nil, inTestGuild()...), testPanic())
+	recs, err := errorRecords(false)
+	if err != nil || len(recs) != 1 {
+		t.Fatalf("expected 1 error, got %+v, %v", recs, err)
+	}
+	id := recs[0].ID
+
+	i := errorsCommand(fake, errorsSubCmdList)
+	bot().routeInteraction(fake, i)
+	resp := mustRespond(t, fake, i)
+	if !isEphemeral(resp) || !strings.Contains(resp.Initial.Data.Embeds[0].Description, id) {
+		t.Errorf("%s missing from error list %+v", id, resp.Initial.Data)
+	}
+
+	i = errorsCommand(fake, errorsSubCmdShow, fakediscord.StringOpt(errorsOptID, id))
+	bot().routeInteraction(fake, i)
+	resp = mustRespond(t, fake, i)
+	if len(resp.Initial.Data.Files) != 1 || !strings.Contains(embedText(resp.Initial.Data.Embeds[0]), pollCmd) {
+		t.Errorf("expected the error with its interaction and stack, got %+v", resp.Initial.Data)
+	}
+
+	i = errorsCommand(fake, errorsSubCmdExport, fakediscord.StringOpt(errorsOptID, id))
+	bot().routeInteraction(fake, i)
+	resp = mustRespond(t, fake, i)
+	if len(resp.Initial.Data.Files) != 1 || resp.Initial.Data.Files[0].Name != "error-"+id+".md" {
+		t.Errorf("expected a Markdown export, got %+v", resp.Initial.Data)
+	}
+	md := errorMarkdown(recs[0])
+	for _, want := range []string{"## panic: kaboom", "kardbot/errorreports_test.go:", "Stack trace"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("%q missing from export:\n%s", want, md)
+		}
+	}
+
+	i = errorsCommand(fake, errorsSubCmdResolve, fakediscord.StringOpt(errorsOptID, id))
+	bot().routeInteraction(fake, i)
+	mustRespond(t, fake, i)
+	if recs, _ = errorRecords(false); len(recs) != 0 {
+		t.Errorf("resolved error is still listed as open: %+v", recs)
+	}
+
+	// The same error happening again reopens it.
+	offerErrorReport(t, fake, fake.Command(pollCmd, nil, inTestGuild()...), testPanic())
+	if rec, err := getErrorRecord(id); err != nil || rec.Resolved {
+		t.Errorf("error was not reopened: %+v, %v", rec, err)
+	}
+
+	i = errorsCommand(fake, errorsSubCmdShow, fakediscord.StringOpt(errorsOptID, "nope"))
+	bot().routeInteraction(fake, i)
+	if resp = mustRespond(t, fake, i); !strings.Contains(resp.Initial.Data.Content, "no error with ID") {
+		t.Errorf("expected an unknown ID to be rejected, got %+v", resp.Initial.Data)
+	}
+}
+
+func TestPruneErrorReports(t *testing.T) {
+	newTestBot(t)
+	old := time.Now().Add(-errorRecordTTL - time.Hour)
+
+	stale := errorRecord{ID: "stale", LastSeen: old}
+	fresh := errorRecord{ID: "fresh", LastSeen: time.Now()}
+	for _, rec := range []errorRecord{stale, fresh} {
+		if err := stateStore().Put(errorRecordsBucket, rec.ID, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expired := errorReport{Created: old}
+	if err := stateStore().Put(errorReportsBucket, "expired", expired); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pruneErrorReports(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getErrorRecord(stale.ID); err == nil {
+		t.Error("stale error was not pruned")
+	}
+	if _, err := getErrorRecord(fresh.ID); err != nil {
+		t.Error(err)
+	}
+	if found, _ := stateStore().Get(errorReportsBucket, "expired", &expired); found {
+		t.Error("expired report was not pruned")
+	}
+}
+
+// testPanic returns a recovered panic, always from the same place.
+func testPanic() (err error) {
+	defer func() { err = newPanicError(recover()) }()
+	panic("kaboom")
+}
+
+func embedText(e *discordgo.MessageEmbed) string {
+	sb := strings.Builder{}
+	sb.WriteString(e.Title + "\n" + e.Description + "\n")
+	for _, f := range e.Fields {
+		sb.WriteString(f.Name + ": " + f.Value + "\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,102 @@
+package kardbot
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/Kardbord/Kard-bot/kardbot/fakediscord"
+	"github.com/Kardbord/Kard-bot/kardbot/store"
+	"github.com/bwmarrin/discordgo"
+)
+
+var _ discordSession = (*fakediscord.Session)(nil)
+var _ discordSession = dgSession{}
+
+const (
+	testGuildID   = "300"
+	testChannelID = "400"
+)
+
+var (
+	testSelf = &discordgo.User{ID: "100", Username: "kard-bot", Bot: true}
+	testUser = &discordgo.User{ID: "200", Username: "someone"}
+)
+
+// newTestBot installs a bot backed by a fake Discord session and a
+// throwaway state store for the duration of the test. The fake knows
+// about testUser and a guild with a single text channel.
+func newTestBot(t *testing.T) *fakediscord.Session {
+	t.Helper()
+
+	fake := fakediscord.New(testSelf)
+	fake.AddUser(testUser)
+	fake.AddGuild(&discordgo.Guild{
+		ID:   testGuildID,
+		Name: "test guild",
+		Channels: []*discordgo.Channel{
+			{ID: testChannelID, Name: "general", Type: discordgo.ChannelTypeGuildText},
+		},
+		Members: []*discordgo.Member{testMember()},
+	})
+
+	st, err := store.Open(store.Config{Backend: store.BackendJSON, Path: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, load := range stateLoaders() {
+		if err := load(st); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	jobs, err := newJobQueue(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resetAlerts(defaultAlertConfig())
+
+	prev := gbot
+	gbot = &kardbot{api: fake, store: st, jobs: jobs, wg: &sync.WaitGroup{}}
+	t.Cleanup(func() {
+		gbot = prev
+		if err := st.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	return fake
+}
+
+func testMember(roles ...string) *discordgo.Member {
+	return &discordgo.Member{User: testUser, GuildID: testGuildID, Roles: roles}
+}
+
+func inTestGuild(roles ...string) []fakediscord.InteractionOption {
+	return []fakediscord.InteractionOption{
+		fakediscord.FromMember(testGuildID, testMember(roles...)),
+		fakediscord.InChannel(testChannelID),
+	}
+}
+
+// mustRespond fails the test if the interaction was not acknowledged.
+func mustRespond(t *testing.T, fake *fakediscord.Session, i *discordgo.InteractionCreate) *fakediscord.Response {
+	t.Helper()
+	resp := fake.Response(i.ID)
+	if resp == nil || resp.Initial == nil {
+		t.Fatalf("no response to interaction %s", i.ID)
+	}
+	return resp
+}
+
+func isEphemeral(resp *fakediscord.Response) bool {
+	if resp.Initial.Data != nil && resp.Initial.Data.Flags&discordgo.MessageFlagsEphemeral != 0 {
+		return true
+	}
+	for _, f := range resp.Followups {
+		if f.Flags&discordgo.MessageFlagsEphemeral != 0 {
+			return true
+		}
+	}
+	return false
+}
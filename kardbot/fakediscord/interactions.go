@@ -0,0 +1,191 @@
+package fakediscord
+
+import (
+	"github.com/bwmarrin/discordgo"
+)
+
+// InteractionOption customizes an interaction built by Command or Component.
+type InteractionOption func(*discordgo.Interaction)
+
+// FromUser marks the interaction as issued by u from a DM.
+func FromUser(u *discordgo.User) InteractionOption {
+	return func(i *discordgo.Interaction) {
+		i.User = u
+		i.Member = nil
+		i.GuildID = ""
+	}
+}
+
+// FromMember marks the interaction as issued by m from within a guild.
+func FromMember(guildID string, m *discordgo.Member) InteractionOption {
+	return func(i *discordgo.Interaction) {
+		i.Member = m
+		i.User = nil
+		i.GuildID = guildID
+	}
+}
+
+// InChannel sets the channel the interaction was issued from.
+func InChannel(channelID string) InteractionOption {
+	return func(i *discordgo.Interaction) { i.ChannelID = channelID }
+}
+
+// WithLocale sets the locale of the user who issued the interaction.
+func WithLocale(locale discordgo.Locale) InteractionOption {
+	return func(i *discordgo.Interaction) { i.Locale = locale }
+}
+
+// OnMessage sets the message a component interaction belongs to.
+func OnMessage(m *discordgo.Message) InteractionOption {
+	return func(i *discordgo.Interaction) {
+		i.Message = m
+		if i.ChannelID == "" {
+			i.ChannelID = m.ChannelID
+		}
+	}
+}
+
+func (s *Session) newInteraction(t discordgo.InteractionType, data discordgo.InteractionData, opts []InteractionOption) *discordgo.InteractionCreate {
+	i := &discordgo.Interaction{
+		ID:      s.NewID(),
+		AppID:   s.self.ID,
+		Type:    t,
+		Data:    data,
+		Token:   "fake-token",
+		Version: 1,
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return &discordgo.InteractionCreate{Interaction: i}
+}
+
+// Command builds a slash command interaction, as it would be delivered by the gateway.
+func (s *Session) Command(name string, options []*discordgo.ApplicationCommandInteractionDataOption, opts ...InteractionOption) *discordgo.InteractionCreate {
+	return s.newInteraction(discordgo.InteractionApplicationCommand, discordgo.ApplicationCommandInteractionData{
+		ID:      s.NewID(),
+		Name:    name,
+		Options: options,
+	}, opts)
+}
+
+// MessageCommand builds a message context menu interaction on target.
+func (s *Session) MessageCommand(name string, target *discordgo.Message, opts ...InteractionOption) *discordgo.InteractionCreate {
+	return s.newInteraction(discordgo.InteractionApplicationCommand, discordgo.ApplicationCommandInteractionData{
+		ID:       s.NewID(),
+		Name:     name,
+		TargetID: target.ID,
+		Resolved: &discordgo.ApplicationCommandInteractionDataResolved{
+			Messages: map[string]*discordgo.Message{target.ID: target},
+		},
+	}, opts)
+}
+
+// UserCommand builds a user context menu interaction on target.
+func (s *Session) UserCommand(name string, target *discordgo.User, opts ...InteractionOption) *discordgo.InteractionCreate {
+	return s.newInteraction(discordgo.InteractionApplicationCommand, discordgo.ApplicationCommandInteractionData{
+		ID:       s.NewID(),
+		Name:     name,
+		TargetID: target.ID,
+		Resolved: &discordgo.ApplicationCommandInteractionDataResolved{
+			Users: map[string]*discordgo.User{target.ID: target},
+		},
+	}, opts)
+}
+
+// Autocomplete builds an autocomplete interaction for a slash command.
+func (s *Session) Autocomplete(name string, options []*discordgo.ApplicationCommandInteractionDataOption, opts ...InteractionOption) *discordgo.InteractionCreate {
+	i := s.Command(name, options, opts...)
+	i.Type = discordgo.InteractionApplicationCommandAutocomplete
+	return i
+}
+
+// Component builds a message component interaction, e.g. a button press
+// or a select menu submission.
+func (s *Session) Component(customID string, componentType discordgo.ComponentType, values []string, opts ...InteractionOption) *discordgo.InteractionCreate {
+	return s.newInteraction(discordgo.InteractionMessageComponent, discordgo.MessageComponentInteractionData{
+		CustomID:      customID,
+		ComponentType: componentType,
+		Values:        values,
+	}, opts)
+}
+
+// Modal builds a modal submission interaction.
+func (s *Session) Modal(customID string, components []discordgo.MessageComponent, opts ...InteractionOption) *discordgo.InteractionCreate {
+	return s.newInteraction(discordgo.InteractionModalSubmit, discordgo.ModalSubmitInteractionData{
+		CustomID:   customID,
+		Components: components,
+	}, opts)
+}
+
+// TextInput builds a filled-in text input for a modal submission, as
+// Discord would deliver it.
+func TextInput(customID, value string) discordgo.MessageComponent {
+	return &discordgo.ActionsRow{
+		Components: []discordgo.MessageComponent{
+			&discordgo.TextInput{CustomID: customID, Value: value},
+		},
+	}
+}
+
+// StringOpt builds a string option as Discord would deliver it.
+func StringOpt(name, value string) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{
+		Name:  name,
+		Type:  discordgo.ApplicationCommandOptionString,
+		Value: value,
+	}
+}
+
+// IntOpt builds an integer option. Discord delivers all numbers as JSON
+// numbers, which decode to float64.
+func IntOpt(name string, value int64) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{
+		Name:  name,
+		Type:  discordgo.ApplicationCommandOptionInteger,
+		Value: float64(value),
+	}
+}
+
+// BoolOpt builds a boolean option.
+func BoolOpt(name string, value bool) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{
+		Name:  name,
+		Type:  discordgo.ApplicationCommandOptionBoolean,
+		Value: value,
+	}
+}
+
+// RoleOpt builds a role option, which Discord delivers as the role's ID.
+func RoleOpt(name, roleID string) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{
+		Name:  name,
+		Type:  discordgo.ApplicationCommandOptionRole,
+		Value: roleID,
+	}
+}
+
+// SubCommand builds a subcommand option wrapping opts.
+func SubCommand(name string, opts ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{
+		Name:    name,
+		Type:    discordgo.ApplicationCommandOptionSubCommand,
+		Options: opts,
+	}
+}
+
+// SubCommandGroup builds a subcommand group option wrapping subcommands.
+func SubCommandGroup(name string, subCmds ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{
+		Name:    name,
+		Type:    discordgo.ApplicationCommandOptionSubCommandGroup,
+		Options: subCmds,
+	}
+}
+
+// Focused builds the string option being typed in during autocomplete.
+func Focused(name, typed string) *discordgo.ApplicationCommandInteractionDataOption {
+	opt := StringOpt(name, typed)
+	opt.Focused = true
+	return opt
+}
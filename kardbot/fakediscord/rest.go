@@ -0,0 +1,530 @@
+package fakediscord
+
+import (
+	"sort"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// The methods in this file mirror their counterparts on *discordgo.Session.
+// Request options are accepted and ignored.
+
+func (s *Session) InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("InteractionRespond"); err != nil {
+		return err
+	}
+
+	r, ok := s.responses[interaction.ID]
+	if ok && r.Initial != nil {
+		return ErrAlreadyAcknowledged
+	}
+	if !ok {
+		r = &Response{}
+		s.responses[interaction.ID] = r
+	}
+	r.Initial = resp
+
+	data := resp.Data
+	if data == nil {
+		data = &discordgo.InteractionResponseData{}
+	}
+	switch resp.Type {
+	case discordgo.InteractionResponseChannelMessageWithSource,
+		discordgo.InteractionResponseDeferredChannelMessageWithSource:
+		m := s.send(interaction.ChannelID, &discordgo.Message{
+			Content:    data.Content,
+			Embeds:     data.Embeds,
+			Components: data.Components,
+			Flags:      data.Flags,
+		})
+		r.messageID, r.channelID = m.ID, m.ChannelID
+	case discordgo.InteractionResponseUpdateMessage,
+		discordgo.InteractionResponseDeferredMessageUpdate:
+		if interaction.Message == nil {
+			break
+		}
+		r.messageID, r.channelID = interaction.Message.ID, interaction.Message.ChannelID
+		if resp.Type == discordgo.InteractionResponseDeferredMessageUpdate {
+			break
+		}
+		if _, m := s.findMessage(r.channelID, r.messageID); m != nil {
+			updated := *m
+			updated.Content = data.Content
+			updated.Embeds = data.Embeds
+			updated.Components = data.Components
+			s.replace(&updated)
+		}
+	}
+	return nil
+}
+
+func (s *Session) InteractionResponse(interaction *discordgo.Interaction, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("InteractionResponse"); err != nil {
+		return nil, err
+	}
+
+	r, ok := s.responses[interaction.ID]
+	if !ok || r.Deleted || r.messageID == "" {
+		return nil, notFound("interaction response", interaction.ID)
+	}
+	_, m := s.findMessage(r.channelID, r.messageID)
+	if m == nil {
+		return nil, notFound("message", r.messageID)
+	}
+	return m, nil
+}
+
+func (s *Session) InteractionResponseEdit(interaction *discordgo.Interaction, newresp *discordgo.WebhookEdit, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("InteractionResponseEdit"); err != nil {
+		return nil, err
+	}
+
+	r, ok := s.responses[interaction.ID]
+	if !ok || r.Initial == nil || r.Deleted {
+		return nil, notFound("interaction response", interaction.ID)
+	}
+	r.Edits = append(r.Edits, newresp)
+
+	_, m := s.findMessage(r.channelID, r.messageID)
+	if m == nil {
+		return nil, notFound("message", r.messageID)
+	}
+	updated := *m
+	if newresp.Content != nil {
+		updated.Content = *newresp.Content
+	}
+	if newresp.Embeds != nil {
+		updated.Embeds = *newresp.Embeds
+	}
+	if newresp.Components != nil {
+		updated.Components = *newresp.Components
+	}
+	return s.replace(&updated), nil
+}
+
+func (s *Session) InteractionResponseDelete(interaction *discordgo.Interaction, options ...discordgo.RequestOption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("InteractionResponseDelete"); err != nil {
+		return err
+	}
+
+	r, ok := s.responses[interaction.ID]
+	if !ok || r.Initial == nil || r.Deleted {
+		return notFound("interaction response", interaction.ID)
+	}
+	r.Deleted = true
+	if idx, _ := s.findMessage(r.channelID, r.messageID); idx >= 0 {
+		msgs := s.messages[r.channelID]
+		s.messages[r.channelID] = append(msgs[:idx:idx], msgs[idx+1:]...)
+	}
+	return nil
+}
+
+func (s *Session) FollowupMessageCreate(interaction *discordgo.Interaction, wait bool, data *discordgo.WebhookParams, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("FollowupMessageCreate"); err != nil {
+		return nil, err
+	}
+
+	r, ok := s.responses[interaction.ID]
+	if !ok || r.Initial == nil {
+		return nil, notFound("interaction response", interaction.ID)
+	}
+	r.Followups = append(r.Followups, data)
+	return s.send(interaction.ChannelID, &discordgo.Message{
+		Content:    data.Content,
+		Embeds:     data.Embeds,
+		Components: data.Components,
+		Flags:      data.Flags,
+	}), nil
+}
+
+func (s *Session) Channel(channelID string, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("Channel"); err != nil {
+		return nil, err
+	}
+
+	c, ok := s.channels[channelID]
+	if !ok {
+		return nil, notFound("channel", channelID)
+	}
+	return c, nil
+}
+
+func (s *Session) ChannelMessage(channelID, messageID string, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("ChannelMessage"); err != nil {
+		return nil, err
+	}
+
+	_, m := s.findMessage(channelID, messageID)
+	if m == nil {
+		return nil, notFound("message", messageID)
+	}
+	return normalize(m), nil
+}
+
+// ChannelMessages returns up to limit of the newest messages in a channel,
+// newest first. Only beforeID is honored.
+func (s *Session) ChannelMessages(channelID string, limit int, beforeID, afterID, aroundID string, options ...discordgo.RequestOption) ([]*discordgo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("ChannelMessages"); err != nil {
+		return nil, err
+	}
+
+	msgs := s.messages[channelID]
+	end := len(msgs)
+	if beforeID != "" {
+		if idx, _ := s.findMessage(channelID, beforeID); idx >= 0 {
+			end = idx
+		}
+	}
+	out := []*discordgo.Message{}
+	for j := end - 1; j >= 0 && (limit <= 0 || len(out) < limit); j-- {
+		out = append(out, msgs[j])
+	}
+	return out, nil
+}
+
+func (s *Session) ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	return s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{Content: content}, options...)
+}
+
+func (s *Session) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("ChannelMessageSendComplex"); err != nil {
+		return nil, err
+	}
+
+	if _, ok := s.channels[channelID]; !ok {
+		return nil, notFound("channel", channelID)
+	}
+	embeds := data.Embeds
+	if data.Embed != nil {
+		embeds = append(embeds, data.Embed)
+	}
+	return s.send(channelID, &discordgo.Message{
+		Content:    data.Content,
+		Embeds:     embeds,
+		Components: data.Components,
+		TTS:        data.TTS,
+	}), nil
+}
+
+func (s *Session) ChannelMessageEditComplex(edit *discordgo.MessageEdit, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("ChannelMessageEditComplex"); err != nil {
+		return nil, err
+	}
+
+	s.messageEdits = append(s.messageEdits, edit)
+	_, m := s.findMessage(edit.Channel, edit.ID)
+	if m == nil {
+		return nil, notFound("message", edit.ID)
+	}
+	updated := *m
+	if edit.Content != nil {
+		updated.Content = *edit.Content
+	}
+	if edit.Embeds != nil {
+		updated.Embeds = edit.Embeds
+	}
+	if edit.Components != nil {
+		updated.Components = edit.Components
+	}
+	return s.replace(&updated), nil
+}
+
+func (s *Session) ChannelMessageDelete(channelID, messageID string, options ...discordgo.RequestOption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("ChannelMessageDelete"); err != nil {
+		return err
+	}
+
+	idx, _ := s.findMessage(channelID, messageID)
+	if idx < 0 {
+		return notFound("message", messageID)
+	}
+	msgs := s.messages[channelID]
+	s.messages[channelID] = append(msgs[:idx:idx], msgs[idx+1:]...)
+	return nil
+}
+
+func (s *Session) User(userID string, options ...discordgo.RequestOption) (*discordgo.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("User"); err != nil {
+		return nil, err
+	}
+
+	u, ok := s.users[userID]
+	if !ok {
+		return nil, notFound("user", userID)
+	}
+	return u, nil
+}
+
+func (s *Session) UserChannelCreate(recipientID string, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("UserChannelCreate"); err != nil {
+		return nil, err
+	}
+
+	u, ok := s.users[recipientID]
+	if !ok {
+		return nil, notFound("user", recipientID)
+	}
+	if id, ok := s.dmChannels[recipientID]; ok {
+		return s.channels[id], nil
+	}
+	c := &discordgo.Channel{
+		ID:         s.newID(),
+		Type:       discordgo.ChannelTypeDM,
+		Recipients: []*discordgo.User{u},
+	}
+	s.channels[c.ID] = c
+	s.dmChannels[recipientID] = c.ID
+	return c, nil
+}
+
+func (s *Session) UserGuilds(limit int, beforeID, afterID string, options ...discordgo.RequestOption) ([]*discordgo.UserGuild, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("UserGuilds"); err != nil {
+		return nil, err
+	}
+
+	// Like Discord, page through guilds in ID order.
+	ids := make([]string, 0, len(s.guilds))
+	for id := range s.guilds {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(a, b int) bool { return idLess(ids[a], ids[b]) })
+
+	out := []*discordgo.UserGuild{}
+	for _, id := range ids {
+		if limit > 0 && len(out) >= limit {
+			break
+		}
+		if (afterID != "" && !idLess(afterID, id)) || (beforeID != "" && !idLess(id, beforeID)) {
+			continue
+		}
+		out = append(out, &discordgo.UserGuild{ID: id, Name: s.guilds[id].Name})
+	}
+	return out, nil
+}
+
+// idLess orders snowflake IDs numerically.
+func idLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// GuildWithCounts is Guild with ApproximateMemberCount filled in
+// from the guild's members.
+func (s *Session) GuildWithCounts(guildID string, options ...discordgo.RequestOption) (*discordgo.Guild, error) {
+	g, err := s.Guild(guildID)
+	if err != nil {
+		return nil, err
+	}
+	counted := *g
+	counted.ApproximateMemberCount = len(g.Members)
+	return &counted, nil
+}
+
+func (s *Session) GuildLeave(guildID string, options ...discordgo.RequestOption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("GuildLeave"); err != nil {
+		return err
+	}
+
+	if _, ok := s.guilds[guildID]; !ok {
+		return notFound("guild", guildID)
+	}
+	delete(s.guilds, guildID)
+	return nil
+}
+
+func (s *Session) Guild(guildID string, options ...discordgo.RequestOption) (*discordgo.Guild, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("Guild"); err != nil {
+		return nil, err
+	}
+
+	g, ok := s.guilds[guildID]
+	if !ok {
+		return nil, notFound("guild", guildID)
+	}
+	return g, nil
+}
+
+func (s *Session) GuildRoles(guildID string, options ...discordgo.RequestOption) ([]*discordgo.Role, error) {
+	g, err := s.Guild(guildID)
+	if err != nil {
+		return nil, err
+	}
+	return g.Roles, nil
+}
+
+func (s *Session) GuildChannels(guildID string, options ...discordgo.RequestOption) ([]*discordgo.Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("GuildChannels"); err != nil {
+		return nil, err
+	}
+
+	if _, ok := s.guilds[guildID]; !ok {
+		return nil, notFound("guild", guildID)
+	}
+	out := []*discordgo.Channel{}
+	for _, c := range s.channels {
+		if c.GuildID == guildID {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func (s *Session) GuildChannelCreateComplex(guildID string, data discordgo.GuildChannelCreateData, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("GuildChannelCreateComplex"); err != nil {
+		return nil, err
+	}
+
+	g, ok := s.guilds[guildID]
+	if !ok {
+		return nil, notFound("guild", guildID)
+	}
+	c := &discordgo.Channel{
+		ID:                   s.newID(),
+		GuildID:              guildID,
+		Name:                 data.Name,
+		Type:                 data.Type,
+		Topic:                data.Topic,
+		NSFW:                 data.NSFW,
+		ParentID:             data.ParentID,
+		PermissionOverwrites: data.PermissionOverwrites,
+	}
+	s.channels[c.ID] = c
+	g.Channels = append(g.Channels, c)
+	return c, nil
+}
+
+func (s *Session) GuildMemberEdit(guildID, userID string, data *discordgo.GuildMemberParams, options ...discordgo.RequestOption) (*discordgo.Member, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("GuildMemberEdit"); err != nil {
+		return nil, err
+	}
+
+	g, ok := s.guilds[guildID]
+	if !ok {
+		return nil, notFound("guild", guildID)
+	}
+	s.memberEdits = append(s.memberEdits, MemberEdit{GuildID: guildID, UserID: userID, Params: *data})
+
+	for _, m := range g.Members {
+		if m.User == nil || m.User.ID != userID {
+			continue
+		}
+		if data.Nick != "" {
+			m.Nick = data.Nick
+		}
+		if data.Roles != nil {
+			m.Roles = append([]string{}, (*data.Roles)...)
+		}
+		return m, nil
+	}
+	return nil, notFound("member", userID)
+}
+
+func (s *Session) ApplicationCommandCreate(appID string, guildID string, cmd *discordgo.ApplicationCommand, options ...discordgo.RequestOption) (*discordgo.ApplicationCommand, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("ApplicationCommandCreate"); err != nil {
+		return nil, err
+	}
+
+	created := normalizeCommand(cmd, appID, guildID)
+	// Like Discord, creating a command with an existing name overwrites it.
+	for idx, existing := range s.commands[guildID] {
+		if existing.Name == created.Name && existing.Type == created.Type {
+			created.ID = existing.ID
+			s.commands[guildID][idx] = created
+			return created, nil
+		}
+	}
+	created.ID = s.newID()
+	s.commands[guildID] = append(s.commands[guildID], created)
+	return created, nil
+}
+
+func (s *Session) ApplicationCommands(appID, guildID string, options ...discordgo.RequestOption) ([]*discordgo.ApplicationCommand, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("ApplicationCommands"); err != nil {
+		return nil, err
+	}
+
+	out := make([]*discordgo.ApplicationCommand, len(s.commands[guildID]))
+	for idx, cmd := range s.commands[guildID] {
+		out[idx] = normalizeCommand(cmd, cmd.ApplicationID, cmd.GuildID)
+		out[idx].ID = cmd.ID
+	}
+	return out, nil
+}
+
+func (s *Session) ApplicationCommandEdit(appID, guildID, cmdID string, cmd *discordgo.ApplicationCommand, options ...discordgo.RequestOption) (*discordgo.ApplicationCommand, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("ApplicationCommandEdit"); err != nil {
+		return nil, err
+	}
+
+	for idx, existing := range s.commands[guildID] {
+		if existing.ID == cmdID {
+			edited := normalizeCommand(cmd, appID, guildID)
+			edited.ID = cmdID
+			s.commands[guildID][idx] = edited
+			return edited, nil
+		}
+	}
+	return nil, notFound("application command", cmdID)
+}
+
+func (s *Session) ApplicationCommandDelete(appID, guildID, cmdID string, options ...discordgo.RequestOption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("ApplicationCommandDelete"); err != nil {
+		return err
+	}
+
+	for idx, existing := range s.commands[guildID] {
+		if existing.ID == cmdID {
+			s.commands[guildID] = append(s.commands[guildID][:idx], s.commands[guildID][idx+1:]...)
+			return nil
+		}
+	}
+	return notFound("application command", cmdID)
+}
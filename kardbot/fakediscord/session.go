@@ -0,0 +1,280 @@
+// Package fakediscord is an in-memory stand-in for the parts of the Discord
+// API used by kardbot. It records interaction responses, message edits and
+// DMs so that command handlers can be tested without a network connection.
+package fakediscord
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ErrNotFound is returned when a request refers to an unknown resource.
+var ErrNotFound = errors.New("fakediscord: not found")
+
+// ErrAlreadyAcknowledged is returned when an interaction is responded to
+// more than once, as Discord would.
+var ErrAlreadyAcknowledged = errors.New("fakediscord: interaction has already been acknowledged")
+
+// Response records everything sent in reply to a single interaction.
+type Response struct {
+	// The initial response, nil if the interaction was never acknowledged.
+	Initial *discordgo.InteractionResponse
+	// Edits made to the initial response, in order.
+	Edits []*discordgo.WebhookEdit
+	// Follow-up messages, in order.
+	Followups []*discordgo.WebhookParams
+	// True if the initial response was deleted.
+	Deleted bool
+
+	// ID of the message created by the initial response, if any.
+	messageID string
+	channelID string
+}
+
+// MemberEdit records a call to GuildMemberEdit.
+type MemberEdit struct {
+	GuildID string
+	UserID  string
+	Params  discordgo.GuildMemberParams
+}
+
+// Session is a fake Discord session. The zero value is not usable;
+// create one with New.
+type Session struct {
+	mu sync.Mutex
+
+	self     *discordgo.User
+	nextID   uint64
+	users    map[string]*discordgo.User
+	guilds   map[string]*discordgo.Guild
+	channels map[string]*discordgo.Channel
+	// Key: channel ID, Val: messages in the order they were sent
+	messages  map[string][]*discordgo.Message
+	responses map[string]*Response
+	// DM channel IDs, Key: user ID
+	dmChannels   map[string]string
+	messageEdits []*discordgo.MessageEdit
+	memberEdits  []MemberEdit
+	// Registered application commands, Key: guild ID ("" for global)
+	commands map[string][]*discordgo.ApplicationCommand
+	failures map[string]error
+}
+
+// New returns an empty Session in which the bot is the given user.
+func New(self *discordgo.User) *Session {
+	s := &Session{
+		self:       self,
+		nextID:     1000,
+		users:      map[string]*discordgo.User{},
+		guilds:     map[string]*discordgo.Guild{},
+		channels:   map[string]*discordgo.Channel{},
+		messages:   map[string][]*discordgo.Message{},
+		responses:  map[string]*Response{},
+		dmChannels: map[string]string{},
+		commands:   map[string][]*discordgo.ApplicationCommand{},
+		failures:   map[string]error{},
+	}
+	s.users[self.ID] = self
+	return s
+}
+
+// NewID returns a snowflake-like ID that is unique within the Session.
+func (s *Session) NewID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.newID()
+}
+
+func (s *Session) newID() string {
+	s.nextID++
+	return strconv.FormatUint(s.nextID, 10)
+}
+
+// FailOn causes the next call to the named method (e.g. "GuildMemberEdit")
+// to return err.
+func (s *Session) FailOn(method string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method] = err
+}
+
+func (s *Session) failure(method string) error {
+	err, ok := s.failures[method]
+	if ok {
+		delete(s.failures, method)
+	}
+	return err
+}
+
+// AddUser makes a user known to the Session.
+func (s *Session) AddUser(u *discordgo.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[u.ID] = u
+}
+
+// AddGuild makes a guild, along with its channels, known to the Session.
+func (s *Session) AddGuild(g *discordgo.Guild) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.guilds[g.ID] = g
+	for _, c := range g.Channels {
+		c.GuildID = g.ID
+		s.channels[c.ID] = c
+	}
+}
+
+// AddChannel makes a channel known to the Session.
+func (s *Session) AddChannel(c *discordgo.Channel) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channels[c.ID] = c
+}
+
+// AddMessage places an existing message in a channel, e.g. one
+// the bot sent before the test began.
+func (s *Session) AddMessage(m *discordgo.Message) *discordgo.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m.ID == "" {
+		m.ID = s.newID()
+	}
+	m = normalize(m)
+	s.messages[m.ChannelID] = append(s.messages[m.ChannelID], m)
+	return m
+}
+
+// Response returns what was sent in reply to the interaction with the given ID.
+func (s *Session) Response(interactionID string) *Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.responses[interactionID]
+}
+
+// Messages returns the messages currently in a channel, oldest first.
+func (s *Session) Messages(channelID string) []*discordgo.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*discordgo.Message{}, s.messages[channelID]...)
+}
+
+// DMs returns the direct messages the bot has sent to a user, oldest first.
+func (s *Session) DMs(userID string) []*discordgo.Message {
+	s.mu.Lock()
+	channelID, ok := s.dmChannels[userID]
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return s.Messages(channelID)
+}
+
+// MessageEdits returns every call made to ChannelMessageEditComplex.
+func (s *Session) MessageEdits() []*discordgo.MessageEdit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*discordgo.MessageEdit{}, s.messageEdits...)
+}
+
+// MemberEdits returns every call made to GuildMemberEdit.
+func (s *Session) MemberEdits() []MemberEdit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]MemberEdit{}, s.memberEdits...)
+}
+
+// Commands returns the application commands registered in a guild,
+// or globally if guildID is empty.
+func (s *Session) Commands(guildID string) []*discordgo.ApplicationCommand {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*discordgo.ApplicationCommand{}, s.commands[guildID]...)
+}
+
+func (s *Session) SelfUser() *discordgo.User {
+	return s.self
+}
+
+// normalize round trips a message through JSON so that it matches what
+// discordgo would hand back from a real request. Most notably, components
+// become pointer types.
+func normalize(m *discordgo.Message) *discordgo.Message {
+	// discordgo doesn't marshal message components, only unmarshals them.
+	buf, err := json.Marshal(struct {
+		*discordgo.Message
+		Components []discordgo.MessageComponent `json:"components"`
+	}{m, m.Components})
+	if err != nil {
+		panic(err)
+	}
+	out := &discordgo.Message{}
+	if err = json.Unmarshal(buf, out); err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// normalizeCommand round trips a command through JSON and fills in the
+// defaults that Discord reports for fields that were left unset.
+func normalizeCommand(cmd *discordgo.ApplicationCommand, appID, guildID string) *discordgo.ApplicationCommand {
+	buf, err := json.Marshal(cmd)
+	if err != nil {
+		panic(err)
+	}
+	out := &discordgo.ApplicationCommand{}
+	if err = json.Unmarshal(buf, out); err != nil {
+		panic(err)
+	}
+	out.ApplicationID = appID
+	out.GuildID = guildID
+	if out.Type == 0 {
+		out.Type = discordgo.ChatApplicationCommand
+	}
+	if out.DMPermission == nil && guildID == "" {
+		dmPermission := true
+		out.DMPermission = &dmPermission
+	}
+	return out
+}
+
+func (s *Session) findMessage(channelID, messageID string) (int, *discordgo.Message) {
+	for idx, m := range s.messages[channelID] {
+		if m.ID == messageID {
+			return idx, m
+		}
+	}
+	return -1, nil
+}
+
+// Must be called with s.mu held.
+func (s *Session) send(channelID string, m *discordgo.Message) *discordgo.Message {
+	m.ID = s.newID()
+	m.ChannelID = channelID
+	m.Author = s.self
+	m.Timestamp = time.Now()
+	if c, ok := s.channels[channelID]; ok {
+		m.GuildID = c.GuildID
+	}
+	m = normalize(m)
+	s.messages[channelID] = append(s.messages[channelID], m)
+	return m
+}
+
+// Must be called with s.mu held.
+func (s *Session) replace(m *discordgo.Message) *discordgo.Message {
+	m = normalize(m)
+	if idx, _ := s.findMessage(m.ChannelID, m.ID); idx >= 0 {
+		s.messages[m.ChannelID][idx] = m
+	}
+	return m
+}
+
+func notFound(kind, id string) error {
+	return fmt.Errorf("%w: %s %s", ErrNotFound, kind, id)
+}
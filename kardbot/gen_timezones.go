@@ -0,0 +1,54 @@
+//go:build ignore
+
+// Generates timezones.go from the tz database shipped with the Go
+// toolchain, which is the same database embedded by time/tzdata.
+// Run with go generate after updating Go.
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+)
+
+func main() {
+	zr, err := zip.OpenReader(filepath.Join(runtime.GOROOT(), "lib", "time", "zoneinfo.zip"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer zr.Close()
+
+	names := []string{}
+	for _, f := range zr.File {
+		// Factory is a placeholder, not a real zone.
+		if f.FileInfo().IsDir() || f.Name == "Factory" {
+			continue
+		}
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "// Code generated by gen_timezones.go from %s; DO NOT EDIT.\n\n", runtime.Version())
+	fmt.Fprint(&buf, "package kardbot\n\n")
+	fmt.Fprint(&buf, "// Every zone name in the IANA tz database.\n")
+	fmt.Fprint(&buf, "var ianaTimezones = []string{\n")
+	for _, name := range names {
+		fmt.Fprintf(&buf, "\t%q,\n", name)
+	}
+	fmt.Fprint(&buf, "}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = os.WriteFile("timezones.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
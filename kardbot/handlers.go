@@ -0,0 +1,177 @@
+package kardbot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Kardbord/Kard-bot/kardbot/config"
+	"github.com/bwmarrin/discordgo"
+)
+
+// handlerConfig bounds how many interactions are handled at once, and
+// how long each handler may take.
+type handlerConfig struct {
+	// Interactions handled at the same time. Any beyond that are turned
+	// away rather than queued, since Discord only waits 3 seconds for an
+	// interaction to be acknowledged.
+	Workers int `json:"workers"`
+	// How long a handler may run before its context is cancelled.
+	TimeoutSeconds float64 `json:"timeout-seconds"`
+	// Limits for individual commands, keyed by command name.
+	Commands map[string]commandLimits `json:"commands"`
+}
+
+// commandLimits caps a single command, including its buttons and forms.
+// Zero leaves the command uncapped, or uses the default timeout.
+type commandLimits struct {
+	MaxConcurrent  int     `json:"max-concurrent"`
+	TimeoutSeconds float64 `json:"timeout-seconds"`
+}
+
+func defaultHandlerConfig() handlerConfig {
+	return handlerConfig{
+		Workers:        64,
+		TimeoutSeconds: 60,
+	}
+}
+
+var handlerCfg hotConfig[handlerConfig]
+
+func init() {
+	handlerCfg.Store(defaultHandlerConfig())
+}
+
+func (c *handlerConfig) validate() error {
+	if c.Workers < 1 {
+		return fmt.Errorf("workers must be at least 1, got %d", c.Workers)
+	}
+	if c.TimeoutSeconds <= 0 {
+		return fmt.Errorf("timeout-seconds must be positive, got %v", c.TimeoutSeconds)
+	}
+	for name, limits := range c.Commands {
+		if limits.MaxConcurrent < 0 {
+			return fmt.Errorf("%s: max-concurrent must not be negative, got %d", name, limits.MaxConcurrent)
+		}
+		if limits.TimeoutSeconds < 0 {
+			return fmt.Errorf("%s: timeout-seconds must not be negative, got %v", name, limits.TimeoutSeconds)
+		}
+	}
+	return nil
+}
+
+// timeout returns how long a handler belonging to cmd may run.
+func (c *handlerConfig) timeout(cmd string) time.Duration {
+	seconds := c.TimeoutSeconds
+	if limits := c.Commands[cmd]; limits.TimeoutSeconds > 0 {
+		seconds = limits.TimeoutSeconds
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func loadHandlerConfig() error {
+	cfg := struct {
+		Handlers handlerConfig `json:"handlers"`
+	}{Handlers: defaultHandlerConfig()}
+
+	jsonCfg, err := config.NewJsonConfig(kardbotConfigFile)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(jsonCfg.Raw, &cfg); err != nil {
+		return err
+	}
+	if err = cfg.Handlers.validate(); err != nil {
+		return fmt.Errorf("handlers: %w", err)
+	}
+	handlerCfg.Store(cfg.Handlers)
+	return nil
+}
+
+// handlerPool runs interactions on a fixed number of workers, so that a
+// burst of interactions can't start an unbounded number of goroutines.
+type handlerPool struct {
+	jobs chan func()
+}
+
+func newHandlerPool(workers int) *handlerPool {
+	p := &handlerPool{jobs: make(chan func())}
+	for n := 0; n < workers; n++ {
+		goSafely("handler-worker", p.work)
+	}
+	return p
+}
+
+func (p *handlerPool) work() {
+	for job := range p.jobs {
+		p.run(job)
+	}
+}
+
+// run runs a single job, so that a panic that escapes it doesn't take
+// the worker down with it.
+func (p *handlerPool) run(job func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			logPanic("handler-worker", nil, newPanicError(r))
+		}
+	}()
+	job()
+}
+
+// submit hands job to an idle worker, or returns false if every worker
+// is busy.
+func (p *handlerPool) submit(job func()) bool {
+	select {
+	case p.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// dispatchInteraction hands an interaction to the pool, turning it away
+// if every worker is busy.
+func (kbot *kardbot) dispatchInteraction(pool *handlerPool, s discordSession, i *discordgo.InteractionCreate) {
+	if pool.submit(func() { kbot.routeInteraction(s, i) }) {
+		return
+	}
+	typ := interactionTypeLabel(i.Type)
+	handlerPoolRejectionsTotal.WithLabelValues(typ).Inc()
+	logFor(i).Warn("Every handler worker is busy, turning interaction away")
+	if i.Type != discordgo.InteractionApplicationCommandAutocomplete {
+		interactionRespondEphemeralError(s, i, false, errors.New(localized(i, msgBusy)))
+	}
+}
+
+// Handlers currently running for each command with a max-concurrent limit.
+var commandSlots = struct {
+	sync.Mutex
+	inUse map[string]int
+}{inUse: map[string]int{}}
+
+// acquireCommandSlot claims one of cmd's concurrent handler slots. If
+// they are all taken, ok is false. Otherwise, release must be called
+// once the handler returns.
+func acquireCommandSlot(cmd string) (release func(), ok bool) {
+	limit := handlerCfg.Load().Commands[cmd].MaxConcurrent
+	if cmd == "" || limit <= 0 {
+		return func() {}, true
+	}
+
+	commandSlots.Lock()
+	defer commandSlots.Unlock()
+	if commandSlots.inUse[cmd] >= limit {
+		return nil, false
+	}
+	commandSlots.inUse[cmd]++
+	return func() {
+		commandSlots.Lock()
+		defer commandSlots.Unlock()
+		if commandSlots.inUse[cmd]--; commandSlots.inUse[cmd] <= 0 {
+			delete(commandSlots.inUse, cmd)
+		}
+	}, true
+}
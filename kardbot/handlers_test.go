@@ -0,0 +1,151 @@
+package kardbot
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func useHandlerConfig(t *testing.T, cmd string, limits commandLimits) {
+	t.Helper()
+	cfg := defaultHandlerConfig()
+	cfg.Commands = map[string]commandLimits{cmd: limits}
+	handlerCfg.Store(cfg)
+	t.Cleanup(func() { handlerCfg.Store(defaultHandlerConfig()) })
+}
+
+func TestHandlerPoolTurnsInteractionsAway(t *testing.T) {
+	fake := newTestBot(t)
+	pool := newHandlerPool(1)
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+
+	for !pool.submit(func() { close(started); <-release }) {
+		time.Sleep(time.Millisecond)
+	}
+	<-started
+
+	i := fake.Command(pollCmd, nil, inTestGuild()...)
+	bot().dispatchInteraction(pool, fake, i)
+	resp := mustRespond(t, fake, i)
+	if !isEphemeral(resp) || !strings.Contains(resp.Initial.Data.Content, "busy") {
+		t.Errorf("expected the interaction to be turned away, got %+v", resp.Initial.Data)
+	}
+}
+
+func TestHandlerPoolSurvivesPanics(t *testing.T) {
+	newTestBot(t)
+	pool := newHandlerPool(1)
+	for !pool.submit(func() { panic("job panicked") }) {
+		time.Sleep(time.Millisecond)
+	}
+	done := make(chan struct{})
+	for !pool.submit(func() { close(done) }) {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker did not run a job after a panic")
+	}
+}
+
+func TestCommandConcurrencyCap(t *testing.T) {
+	fake := newTestBot(t)
+	entered, release := make(chan struct{}, 1), make(chan struct{})
+	cmd := &command{
+		name: "busy-test",
+		handler: func(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
+			entered <- struct{}{}
+			<-release
+			if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+				Type: discordgo.InteractionResponseChannelMessageWithSource,
+				Data: &discordgo.InteractionResponseData{Content: "done"},
+			}); err != nil {
+				t.Error(err)
+			}
+		},
+	}
+	registerTestCommand(t, cmd)
+	useHandlerConfig(t, cmd.Name(), commandLimits{MaxConcurrent: 1})
+
+	first := fake.Command(cmd.Name(), nil, inTestGuild()...)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		bot().routeInteraction(fake, first)
+	}()
+	<-entered
+
+	second := fake.Command(cmd.Name(), nil, inTestGuild()...)
+	bot().routeInteraction(fake, second)
+	resp := mustRespond(t, fake, second)
+	if !isEphemeral(resp) || !strings.Contains(resp.Initial.Data.Content, "busy") {
+		t.Errorf("expected the second use to be turned away, got %+v", resp.Initial.Data)
+	}
+
+	close(release)
+	<-done
+	third := fake.Command(cmd.Name(), nil, inTestGuild()...)
+	bot().routeInteraction(fake, third)
+	if resp = mustRespond(t, fake, third); resp.Initial.Data.Content != "done" {
+		t.Errorf("slot was not released, got %+v", resp.Initial.Data)
+	}
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	fake := newTestBot(t)
+	var ctxErr error
+	cmd := &command{
+		name: "slow-test",
+		handler: func(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
+			<-ctx.Done()
+			ctxErr = ctx.Err()
+			interactionRespondEphemeralError(s, i, true, ctxErr)
+		},
+	}
+	registerTestCommand(t, cmd)
+	useHandlerConfig(t, cmd.Name(), commandLimits{TimeoutSeconds: 0.01})
+
+	i := fake.Command(cmd.Name(), nil, inTestGuild()...)
+	bot().routeInteraction(fake, i)
+	resp := mustRespond(t, fake, i)
+	if !isEphemeral(resp) || !strings.Contains(resp.Initial.Data.Content, "took too long") || len(resp.Initial.Data.Components) != 0 {
+		t.Errorf("expected a timeout message without an error report, got %+v", resp.Initial.Data)
+	}
+	if !errors.Is(ctxErr, context.DeadlineExceeded) {
+		t.Errorf("handler context was not cancelled: %v", ctxErr)
+	}
+}
+
+func TestLoadHandlerConfig(t *testing.T) {
+	t.Cleanup(func() { handlerCfg.Store(defaultHandlerConfig()) })
+
+	cases := map[string]string{
+		"no workers":       `{"handlers": {"workers": 0}}`,
+		"no timeout":       `{"handlers": {"timeout-seconds": 0}}`,
+		"negative cap":     `{"handlers": {"commands": {"render": {"max-concurrent": -1}}}}`,
+		"negative timeout": `{"handlers": {"commands": {"render": {"timeout-seconds": -5}}}}`,
+	}
+	for name, setup := range cases {
+		t.Run(name, func(t *testing.T) {
+			inTempConfigDir(t, map[string]string{kardbotConfigFile: setup})
+			if err := loadHandlerConfig(); err == nil {
+				t.Error("invalid config was accepted")
+			}
+		})
+	}
+
+	inTempConfigDir(t, map[string]string{kardbotConfigFile: `{"handlers": {"commands": {"render": {"timeout-seconds": 300}}}}`})
+	if err := loadHandlerConfig(); err != nil {
+		t.Fatal(err)
+	}
+	cfg := handlerCfg.Load()
+	if cfg.Workers != defaultHandlerConfig().Workers || cfg.timeout(renderCmd).Seconds() != 300 || cfg.timeout(pollCmd).Seconds() != cfg.TimeoutSeconds {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+}
@@ -0,0 +1,173 @@
+package kardbot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// If Discord has not acknowledged a gateway heartbeat in this long, the
+// connection is considered dead even if discordgo has not noticed yet.
+const maxHeartbeatAge = 5 * time.Minute
+
+// Bucket read by the store health check. It never holds anything.
+const healthCheckBucket = "health-check"
+
+type healthCheck struct {
+	name string
+	// Returns details worth reporting, and an error if the check failed.
+	check func(kbot *kardbot) (string, error)
+}
+
+// Returned by a check of something the bot hasn't started yet. Only
+// /readyz fails for it, so that a slow start up, such as a slow gateway
+// connection, doesn't get the bot restarted by its liveness probe.
+var errNotStarted = errors.New("not started yet")
+
+// Any check of whether the bot is working belongs in this list.
+// A failed check fails both /healthz and /readyz, unless it failed with
+// errNotStarted.
+func healthChecks() []healthCheck {
+	return []healthCheck{
+		{"session", checkSession},
+		{"scheduler", checkScheduler},
+		{"store", checkStore},
+	}
+}
+
+// checkSession fails if the gateway has stopped acknowledging heartbeats.
+// A gateway that is reconnecting is reported but does not fail the check,
+// since discordgo reconnects on its own.
+func checkSession(kbot *kardbot) (string, error) {
+	if kbot.Session == nil {
+		return "", errors.New("no session")
+	}
+	kbot.Session.RLock()
+	connected := kbot.Session.DataReady
+	lastSent := kbot.Session.LastHeartbeatSent
+	lastAck := kbot.Session.LastHeartbeatAck
+	kbot.Session.RUnlock()
+
+	if lastAck.IsZero() {
+		if lastSent.IsZero() {
+			return "", fmt.Errorf("gateway: %w", errNotStarted)
+		}
+		if age := time.Since(lastSent); age > maxHeartbeatAge {
+			return "", fmt.Errorf("first heartbeat not acknowledged in %s", age.Round(time.Second))
+		}
+		return "waiting for the first heartbeat to be acknowledged", nil
+	}
+	if age := time.Since(lastAck); age > maxHeartbeatAge {
+		return "", fmt.Errorf("no heartbeat acknowledged in %s", age.Round(time.Second))
+	}
+	if !connected {
+		return "gateway reconnecting", nil
+	}
+	return fmt.Sprintf("gateway connected, heartbeat latency %s", lastAck.Sub(lastSent)), nil
+}
+
+func checkScheduler(kbot *kardbot) (string, error) {
+	if !scheduler().IsRunning() {
+		if !kbot.ready.Load() {
+			return "", fmt.Errorf("scheduler: %w", errNotStarted)
+		}
+		return "", errors.New("scheduler is not running")
+	}
+	return fmt.Sprintf("%d jobs scheduled", scheduler().Len()), nil
+}
+
+func checkStore(kbot *kardbot) (string, error) {
+	if kbot.store == nil {
+		return "", errors.New("store is not open")
+	}
+	if _, err := kbot.store.Get(healthCheckBucket, "ping", &struct{}{}); err != nil {
+		return "", err
+	}
+	return "ok", nil
+}
+
+type healthCheckResult struct {
+	OK      bool   `json:"ok"`
+	Details string `json:"details,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type healthReport struct {
+	OK bool `json:"ok"`
+	// Whether the bot has finished starting up, is not shutting down,
+	// and is connected to the gateway.
+	Ready  bool                         `json:"ready"`
+	Checks map[string]healthCheckResult `json:"checks"`
+}
+
+func (kbot *kardbot) health() healthReport {
+	report := healthReport{
+		OK:     true,
+		Ready:  kbot.ready.Load() && kbot.gatewayConnected(),
+		Checks: map[string]healthCheckResult{},
+	}
+	for _, hc := range healthChecks() {
+		details, err := hc.check(kbot)
+		result := healthCheckResult{OK: err == nil, Details: details}
+		if err != nil {
+			result.Error = err.Error()
+			if errors.Is(err, errNotStarted) {
+				report.Ready = false
+			} else {
+				report.OK = false
+			}
+		}
+		report.Checks[hc.name] = result
+	}
+	return report
+}
+
+// gatewayConnected reports whether the gateway is currently connected.
+func (kbot *kardbot) gatewayConnected() bool {
+	if kbot.Session == nil {
+		return false
+	}
+	kbot.Session.RLock()
+	defer kbot.Session.RUnlock()
+	return kbot.Session.DataReady
+}
+
+// HealthzHandler reports whether the bot is alive. It responds with
+// 503 Service Unavailable if any health check fails.
+func HealthzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := healthReport{Checks: map[string]healthCheckResult{}}
+		if gbot != nil {
+			report = gbot.health()
+		}
+		writeHealthReport(w, report, report.OK)
+	})
+}
+
+// ReadyzHandler reports whether the bot is ready to handle interactions.
+// It responds with 503 Service Unavailable until the bot has finished
+// starting up, while the gateway is disconnected, once shutdown begins,
+// or if any health check fails.
+func ReadyzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := healthReport{Checks: map[string]healthCheckResult{}}
+		if gbot != nil {
+			report = gbot.health()
+		}
+		writeHealthReport(w, report, report.OK && report.Ready)
+	})
+}
+
+func writeHealthReport(w http.ResponseWriter, report healthReport, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if ok {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(report)
+}
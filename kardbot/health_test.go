@@ -0,0 +1,84 @@
+package kardbot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func getHealth(t *testing.T, h http.Handler) (int, healthReport) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	report := healthReport{}
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, report
+}
+
+func TestReadyzWaitsForStartup(t *testing.T) {
+	newTestBot(t)
+	bot().Session = &discordgo.Session{DataReady: true, LastHeartbeatAck: time.Now()}
+
+	code, report := getHealth(t, ReadyzHandler())
+	if code != http.StatusServiceUnavailable || report.Ready {
+		t.Errorf("bot was ready before startup finished: %d %+v", code, report)
+	}
+
+	bot().ready.Store(true)
+	if _, report = getHealth(t, ReadyzHandler()); !report.Ready {
+		t.Errorf("bot was not ready after startup finished: %+v", report)
+	}
+
+	bot().Session.DataReady = false
+	if _, report = getHealth(t, ReadyzHandler()); report.Ready {
+		t.Errorf("bot was ready while the gateway was disconnected: %+v", report)
+	}
+}
+
+func TestHealthChecks(t *testing.T) {
+	newTestBot(t)
+	bot().Session = &discordgo.Session{DataReady: true, LastHeartbeatAck: time.Now()}
+
+	if _, err := checkSession(bot()); err != nil {
+		t.Errorf("healthy session failed its check: %v", err)
+	}
+	bot().Session.LastHeartbeatAck = time.Now().Add(-2 * maxHeartbeatAge)
+	if _, err := checkSession(bot()); err == nil {
+		t.Errorf("session with a stale heartbeat passed its check")
+	}
+
+	if _, err := checkStore(bot()); err != nil {
+		t.Errorf("open store failed its check: %v", err)
+	}
+	bot().store.Close()
+	code, report := getHealth(t, HealthzHandler())
+	if code != http.StatusServiceUnavailable || report.Checks["store"].OK {
+		t.Errorf("closed store passed its check: %d %+v", code, report)
+	}
+}
+
+func TestHealthzPassesWhileStarting(t *testing.T) {
+	newTestBot(t)
+	// Neither the gateway nor the scheduler have been started.
+	bot().Session = &discordgo.Session{}
+
+	code, report := getHealth(t, HealthzHandler())
+	if code != http.StatusOK || !report.OK {
+		t.Errorf("bot that hasn't started yet failed its liveness check: %d %+v", code, report)
+	}
+	if code, report = getHealth(t, ReadyzHandler()); code != http.StatusServiceUnavailable || report.Ready {
+		t.Errorf("bot that hasn't started yet was ready: %d %+v", code, report)
+	}
+
+	// A first heartbeat that is never acknowledged still fails liveness.
+	bot().Session.LastHeartbeatSent = time.Now().Add(-2 * maxHeartbeatAge)
+	if code, _ = getHealth(t, HealthzHandler()); code != http.StatusServiceUnavailable {
+		t.Errorf("unacknowledged first heartbeat passed the liveness check: %d", code)
+	}
+}
@@ -1,20 +1,18 @@
 package kardbot
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"runtime"
+	"time"
 
-	"github.com/Kardbord/Kard-bot/kardbot/dg_helpers"
 	"github.com/bwmarrin/discordgo"
 	"github.com/google/uuid"
-	cmap "github.com/orcaman/concurrent-map/v2"
 	log "github.com/sirupsen/logrus"
 )
 
 const (
-	genericErrorString    = "an error occurred. :'("
 	selectMenuErrorReport = "select_error_report"
 )
 
@@ -37,29 +35,33 @@ func (ers *errReportSelectionValue) UnmarshalFromString(ersStr string) error {
 	return json.Unmarshal([]byte(ersStr), &ers)
 }
 
+// errorReport is an error that a user has been offered to send to the
+// bot owner. Reports are kept in errorReportsBucket, keyed by UUID,
+// until they are sent or expire.
 type errorReport struct {
 	// UUID of this error report
-	UUID uuid.UUID
+	UUID uuid.UUID `json:"uuid"`
 	// The InteractionCreate event that caused the error
-	InteractionCreate discordgo.InteractionCreate
+	InteractionCreate discordgo.InteractionCreate `json:"interaction"`
 	// The error that arose during the InteractionCreate event
-	Err error
+	Error string `json:"error"`
 	// The filename where the error occurred
-	Filename string
+	Filename string `json:"filename"`
 	// The line where the error occurred
-	Line int
+	Line int `json:"line"`
+	// Stack trace, if the error was a panic
+	Stack string `json:"stack,omitempty"`
+	// When the user was offered the report
+	Created time.Time `json:"created"`
 }
 
 var (
-	// Maps UUIDs to errorReports
-	errsToReport = cmap.New[errorReport]()
-
 	errReportMsgComponents = func(errUUID uuid.UUID) []discordgo.MessageComponent {
 		ownerMention := ""
 		if getOwnerID() == "" {
 			ownerMention = "the bot owner"
 		} else {
-			owner, err := bot().Session.User(getOwnerID())
+			owner, err := bot().api.User(getOwnerID())
 			if err != nil {
 				log.Error(err)
 				ownerMention = "the bot owner"
@@ -100,18 +102,27 @@ var (
 	}
 )
 
-func interactionRespondEphemeralError(s *discordgo.Session, i *discordgo.InteractionCreate, notifyOwner bool, errResp error) {
+func init() {
+	registerComponent(interactionRoute{id: selectMenuErrorReport, handler: handleErrorReportSelection})
+}
+
+func interactionRespondEphemeralError(s discordSession, i *discordgo.InteractionCreate, notifyOwner bool, errResp error) {
+	interactionErrorsTotal.Inc()
 	if s == nil {
-		log.Error("nil session")
+		logFor(i).Error("nil session")
 		return
 	}
 	if i == nil {
-		log.Error("nil interaction")
+		logFor(i).Error("nil interaction")
 		return
 	}
 	if errResp == nil {
-		log.Warn("empty errStr, using generic error: ", genericErrorString)
-		errResp = errors.New(genericErrorString)
+		errResp = errors.New(localized(i, msgGenericError))
+		logFor(i).Warn("empty errStr, using generic error: ", errResp)
+	}
+	if errors.Is(errResp, context.DeadlineExceeded) {
+		// A handler that ran out of time isn't a bug worth reporting.
+		errResp, notifyOwner = errors.New(localized(i, msgTimedOut)), false
 	}
 
 	if !notifyOwner {
@@ -123,13 +134,13 @@ func interactionRespondEphemeralError(s *discordgo.Session, i *discordgo.Interac
 			},
 		})
 		if err != nil {
-			log.Error(err)
+			logFor(i).Error(err)
 		}
 		return
 	}
 
 	if getOwnerID() == "" {
-		log.Error("No ownerID provided, cannot send error report")
+		logFor(i).Error("No ownerID provided, cannot send error report")
 		return
 	}
 
@@ -137,47 +148,44 @@ func interactionRespondEphemeralError(s *discordgo.Session, i *discordgo.Interac
 	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content:    "Something went wrong while processing your command. 😔",
+			Content:    localized(i, msgErrorReportPrompt),
 			Flags:      discordgo.MessageFlagsEphemeral,
 			Components: errReportMsgComponents(errUUID),
 		},
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
-	_, filename, line, ok := runtime.Caller(1)
-	if !ok {
-		log.Error("couldn't obtain stack data")
-	}
-	errsToReport.Set(fmt.Sprint(errUUID), errorReport{
-		UUID:              errUUID,
-		Err:               errResp,
-		InteractionCreate: *i,
-		Filename:          filename,
-		Line:              line,
-	})
+	filename, line := errorSite(errResp, 1)
+	logErrorReport(i, errUUID, errResp, filename, line)
+	saveErrorReport(newErrorReport(i, errUUID, errResp, filename, line))
 }
 
 // Assumes that a deferred response has already been sent.
 // Will delete the deferred response and send an ephemeral follow up response.
-func interactionFollowUpEphemeralError(s *discordgo.Session, i *discordgo.InteractionCreate, notifyOwner bool, errResp error) {
+func interactionFollowUpEphemeralError(s discordSession, i *discordgo.InteractionCreate, notifyOwner bool, errResp error) {
+	interactionErrorsTotal.Inc()
 	if s == nil {
-		log.Error("nil session")
+		logFor(i).Error("nil session")
 		return
 	}
 	if i == nil {
-		log.Error("nil interaction")
+		logFor(i).Error("nil interaction")
 		return
 	}
 	if errResp == nil {
-		log.Warn("empty errStr, using generic error: ", genericErrorString)
-		errResp = errors.New(genericErrorString)
+		errResp = errors.New(localized(i, msgGenericError))
+		logFor(i).Warn("empty errStr, using generic error: ", errResp)
+	}
+	if errors.Is(errResp, context.DeadlineExceeded) {
+		// A handler that ran out of time isn't a bug worth reporting.
+		errResp, notifyOwner = errors.New(localized(i, msgTimedOut)), false
 	}
 
 	err := s.InteractionResponseDelete(i.Interaction)
 	if err != nil {
-		log.Warn(err)
+		logFor(i).Warn(err)
 	}
 
 	if !notifyOwner {
@@ -186,61 +194,64 @@ func interactionFollowUpEphemeralError(s *discordgo.Session, i *discordgo.Intera
 			Flags:   discordgo.MessageFlagsEphemeral,
 		})
 		if err != nil {
-			log.Error(err)
+			logFor(i).Error(err)
 		}
 		return
 	}
 
-	_, filename, line, ok := runtime.Caller(1)
-	if !ok {
-		log.Error("couldn't obtain stack data")
-	}
+	filename, line := errorSite(errResp, 1)
 	followupWithError(s, i, errResp, filename, line)
 }
 
-func followupWithError(s *discordgo.Session, i *discordgo.InteractionCreate, errResp error, filename string, line int) {
+func followupWithError(s discordSession, i *discordgo.InteractionCreate, errResp error, filename string, line int) {
 	errUUID := uuid.New()
 	_, err := s.FollowupMessageCreate(i.Interaction, false, &discordgo.WebhookParams{
-		Content:    "Something went wrong while processing your command. 😔",
+		Content:    localized(i, msgErrorReportPrompt),
 		Flags:      discordgo.MessageFlagsEphemeral,
 		Components: errReportMsgComponents(errUUID),
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
-	errsToReport.Set(fmt.Sprint(errUUID), errorReport{
-		UUID:              errUUID,
-		Err:               errResp,
-		InteractionCreate: *i,
-		Filename:          filename,
-		Line:              line,
-	})
+	logErrorReport(i, errUUID, errResp, filename, line)
+	saveErrorReport(newErrorReport(i, errUUID, errResp, filename, line))
+}
+
+// logErrorReport logs an error that the user has been offered to report,
+// tagged with the report's UUID so that the report can be matched to the logs.
+func logErrorReport(i *discordgo.InteractionCreate, errUUID uuid.UUID, errResp error, filename string, line int) {
+	logFor(i).WithField(logFieldErrorReport, errUUID.String()).Errorf("%s:%d %v", filename, line, errResp)
 }
 
-func handleErrorReportSelection(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func handleErrorReportSelection(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	data := i.MessageComponentData()
 	if len(data.Values) == 0 {
-		log.Error("No values returned with component interaction data")
+		logFor(i).Error("No values returned with component interaction data")
 		return
 	}
 
 	selection := errReportSelectionValue{}
 	err := selection.UnmarshalFromString(data.Values[0])
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
 
-	errReport, ok := errsToReport.Get(selection.ErrUUID.String())
+	errReport, ok, err := loadErrorReport(selection.ErrUUID.String())
+	if err != nil {
+		logFor(i).Error(err)
+		return
+	}
 	if !ok {
-		log.Errorf("No error report found with UUID=%s", selection.ErrUUID)
+		logFor(i).Warnf("No error report found with UUID=%s", selection.ErrUUID)
+		interactionRespondEphemeralError(s, i, false, errors.New("this error report has expired"))
 		return
 	}
 
-	err = dmOwnerErrorReport(s, errReport, selection.Anonymous)
+	err = sendErrorReport(errReport, selection.Anonymous)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
 
@@ -279,45 +290,46 @@ func handleErrorReportSelection(s *discordgo.Session, i *discordgo.InteractionCr
 		},
 	})
 	if err != nil {
-		log.Error(err)
-		return
+		logFor(i).Error(err)
+	}
+	if err = markErrorReported(errReport); err != nil {
+		logFor(i).Error(err)
 	}
-	errsToReport.Remove(selection.ErrUUID.String())
 }
 
-func dmOwnerErrorReport(s *discordgo.Session, errReport errorReport, anonymous bool) error {
-	if s == nil {
-		return errors.New("nil session provided")
-	}
+// sendErrorReport alerts whoever runs the bot to an error a user chose to report.
+func sendErrorReport(errReport errorReport, anonymous bool) error {
 	metadata, err := getInteractionMetaData(&errReport.InteractionCreate)
 	if err != nil {
 		return err
 	}
-	uc, err := bot().Session.UserChannelCreate(getOwnerID())
+	cmdJson, err := interactionPayload(&errReport.InteractionCreate)
 	if err != nil {
 		return err
 	}
-	var cmdJson []byte
-	if errReport.InteractionCreate.Type == discordgo.InteractionMessageComponent {
-		cmdJson, err = json.MarshalIndent(errReport.InteractionCreate.MessageComponentData(), "", "  ")
-	} else if errReport.InteractionCreate.Type == discordgo.InteractionApplicationCommand {
-		cmdJson, err = json.MarshalIndent(errReport.InteractionCreate.ApplicationCommandData(), "", "  ")
+	afflicted := metadata.AuthorMention
+	if anonymous {
+		afflicted = "anonymous"
 	}
-	if err != nil {
-		return err
+	errorID := errorSignature(errReport.Filename, errReport.Line, errReport.Error)
+	a := alert{
+		Severity: severityError,
+		// Repeats of the same error are summarized rather than sent one by one.
+		Key:   "error-report " + errorID,
+		Title: "Error Report",
+		Fields: []alertField{
+			{"Afflicted User", afflicted},
+			{"Report ID", errReport.UUID.String()},
+			{"Interaction ID", errReport.InteractionCreate.ID},
+			{"Issued Command", fmt.Sprintf("```json\n%s\n```", cmdJson)},
+			{"Error", fmt.Sprintf("```\n%s:%d %s\n```", errReport.Filename, errReport.Line, errReport.Error)},
+			{"Error ID", fmt.Sprintf("`%s`, see `/%s %s`", errorID, errorsCmd, errorsSubCmdShow)},
+		},
 	}
-	embed := dg_helpers.NewEmbed()
-	if anonymous {
-		embed.AddField("Afflicted User", "anonymous")
-	} else {
-		embed.AddField("Afflicted User", metadata.AuthorMention)
+	if errReport.Stack != "" {
+		// Far too long for an embed field.
+		a.AttachmentName = fmt.Sprintf("stack-%s.txt", errReport.UUID)
+		a.Attachment = errReport.Stack
 	}
-	_, err = s.ChannelMessageSendComplex(uc.ID, &discordgo.MessageSend{
-		Embed: embed.SetTitle("Error Report").
-			AddField("Issued Command", fmt.Sprintf("```json\n%s\n```", cmdJson)).
-			AddField("Error", fmt.Sprintf("```\n%s:%d %s\n```", errReport.Filename, errReport.Line, errReport.Err)).
-			Truncate().
-			MessageEmbed,
-	})
-	return err
+	return deliverAlert(a)
 }
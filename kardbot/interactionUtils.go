@@ -7,7 +7,7 @@ import (
 	"github.com/bwmarrin/discordgo"
 )
 
-func authorIsSelf(s *discordgo.Session, i *discordgo.InteractionCreate) (bool, error) {
+func authorIsSelf(s discordSession, i *discordgo.InteractionCreate) (bool, error) {
 	if s == nil || i == nil {
 		return false, fmt.Errorf("interaction or session is nil")
 	}
@@ -15,7 +15,7 @@ func authorIsSelf(s *discordgo.Session, i *discordgo.InteractionCreate) (bool, e
 	if err != nil {
 		return false, err
 	}
-	return metadata.AuthorID == s.State.User.ID, nil
+	return metadata.AuthorID == s.SelfUser().ID, nil
 }
 
 func authorIsOwner(i *discordgo.InteractionCreate) (bool, error) {
@@ -80,7 +80,6 @@ func getInteractionMetaData(i *discordgo.InteractionCreate) (*interactionMetaDat
 	}
 
 	if i.User != nil {
-		bot()
 		return &interactionMetaData{
 			AuthorID:          i.User.ID,
 			AuthorUsername:    i.User.Username,
@@ -97,7 +96,7 @@ func getInteractionMetaData(i *discordgo.InteractionCreate) (*interactionMetaDat
 	return nil, errors.New("no metadata could be found")
 }
 
-func channelIsNSFW(s *discordgo.Session, i *discordgo.InteractionCreate) (bool, error) {
+func channelIsNSFW(s discordSession, i *discordgo.InteractionCreate) (bool, error) {
 	if s == nil {
 		return false, fmt.Errorf("session is nil")
 	}
@@ -124,3 +123,29 @@ func channelIsNSFW(s *discordgo.Session, i *discordgo.InteractionCreate) (bool,
 func hasPermissions(actual, desired int64) bool {
 	return actual&desired == desired
 }
+
+// targetMessage returns the message a message context menu was used on.
+func targetMessage(i *discordgo.InteractionCreate) (*discordgo.Message, error) {
+	data := i.ApplicationCommandData()
+	if data.Resolved == nil || data.Resolved.Messages[data.TargetID] == nil {
+		return nil, fmt.Errorf("no message resolved for target %s", data.TargetID)
+	}
+	return data.Resolved.Messages[data.TargetID], nil
+}
+
+// targetUser returns the user a user context menu was used on.
+func targetUser(i *discordgo.InteractionCreate) (*discordgo.User, error) {
+	data := i.ApplicationCommandData()
+	if data.Resolved == nil || data.Resolved.Users[data.TargetID] == nil {
+		return nil, fmt.Errorf("no user resolved for target %s", data.TargetID)
+	}
+	return data.Resolved.Users[data.TargetID], nil
+}
+
+// messageLink returns a link that jumps to a message.
+func messageLink(guildID, channelID, messageID string) string {
+	if guildID == "" {
+		guildID = "@me"
+	}
+	return fmt.Sprintf("https://discord.com/channels/%s/%s/%s", guildID, channelID, messageID)
+}
@@ -0,0 +1,360 @@
+// Package jobqueue runs delayed jobs that are persisted to a store.Store,
+// so that work scheduled for later (a DM in a few hours, closing a poll
+// next week) survives a restart of the bot.
+//
+// Jobs are identified by a caller-chosen ID. Scheduling a job with the ID
+// of a pending job replaces it, and cancelling by ID lets callers undo
+// scheduled work, e.g. when a user unsubscribes.
+package jobqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/Kardbord/Kard-bot/kardbot/store"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultMaxAttempts is the number of times a failing job is run
+	// before it is abandoned, unless the Job specifies otherwise.
+	DefaultMaxAttempts = 5
+
+	defaultBaseBackoff = 30 * time.Second
+	defaultMaxBackoff  = time.Hour
+)
+
+// ErrUnknownType is returned when scheduling a job with no registered handler.
+var ErrUnknownType = errors.New("jobqueue: unknown job type")
+
+// Job is a unit of delayed work.
+type Job struct {
+	// Unique ID of the job. Scheduling a job with an existing ID replaces it.
+	ID string `json:"id"`
+	// Selects the Handler that runs the job.
+	Type string `json:"type"`
+	// The job will not run before this time.
+	RunAt time.Time `json:"run-at"`
+	// Handler specific data.
+	Payload json.RawMessage `json:"payload,omitempty"`
+	// Number of times the job has failed so far.
+	Attempts int `json:"attempts,omitempty"`
+	// Number of failures after which the job is abandoned.
+	// Defaults to DefaultMaxAttempts if zero.
+	MaxAttempts int `json:"max-attempts,omitempty"`
+	// The error returned by the most recent failed attempt.
+	LastError string `json:"last-error,omitempty"`
+}
+
+// Handler runs a job. Returning an error causes the job to be retried with
+// exponential backoff. ctx is cancelled if the job is cancelled while
+// running, or if the queue is stopped.
+type Handler func(ctx context.Context, job Job) error
+
+// Queue persists jobs to a store bucket and runs them when they are due.
+type Queue struct {
+	store  store.Store
+	bucket string
+	now    func() time.Time
+
+	// Backoff after the first failure, doubled for each subsequent failure.
+	BaseBackoff time.Duration
+	// Upper bound on the backoff between attempts.
+	MaxBackoff time.Duration
+
+	mutex    sync.Mutex
+	handlers map[string]Handler
+	// Pending jobs, Key: job ID
+	jobs map[string]Job
+	// Cancels running jobs, Key: job ID
+	running map[string]context.CancelFunc
+	wake    chan struct{}
+
+	workers sync.WaitGroup
+	stop    context.CancelFunc
+	stopped chan struct{}
+}
+
+// New returns a Queue that persists jobs in the given bucket, loading any
+// jobs left over from a previous run. The queue does not run jobs until
+// Start is called.
+func New(st store.Store, bucket string) (*Queue, error) {
+	q := &Queue{
+		store:       st,
+		bucket:      bucket,
+		now:         time.Now,
+		BaseBackoff: defaultBaseBackoff,
+		MaxBackoff:  defaultMaxBackoff,
+		handlers:    map[string]Handler{},
+		jobs:        map[string]Job{},
+		running:     map[string]context.CancelFunc{},
+		wake:        make(chan struct{}, 1),
+	}
+
+	err := st.ForEach(bucket, func(id string, raw json.RawMessage) error {
+		job := Job{}
+		if err := json.Unmarshal(raw, &job); err != nil {
+			return fmt.Errorf("job %s: %w", id, err)
+		}
+		q.jobs[id] = job
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Register sets the handler for a job type. Handlers must be registered
+// before Start is called.
+func (q *Queue) Register(jobType string, h Handler) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.handlers[jobType] = h
+}
+
+// Schedule persists a job to run at job.RunAt, replacing any pending
+// job with the same ID. payload is JSON encoded into job.Payload.
+func (q *Queue) Schedule(id, jobType string, runAt time.Time, payload any) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return q.ScheduleJob(Job{ID: id, Type: jobType, RunAt: runAt, Payload: raw})
+}
+
+// ScheduleJob persists a job, replacing any pending job with the same ID.
+func (q *Queue) ScheduleJob(job Job) error {
+	if job.ID == "" {
+		return errors.New("jobqueue: job has no ID")
+	}
+
+	q.mutex.Lock()
+	if _, ok := q.handlers[job.Type]; !ok {
+		q.mutex.Unlock()
+		return fmt.Errorf("%w: %s", ErrUnknownType, job.Type)
+	}
+	if err := q.store.Put(q.bucket, job.ID, job); err != nil {
+		q.mutex.Unlock()
+		return err
+	}
+	q.jobs[job.ID] = job
+	q.mutex.Unlock()
+
+	q.notify()
+	return nil
+}
+
+// Cancel removes a pending job, and cancels it if it is currently running.
+// Cancelling a job that does not exist is not an error.
+func (q *Queue) Cancel(id string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if cancel, ok := q.running[id]; ok {
+		cancel()
+	}
+	if _, ok := q.jobs[id]; !ok {
+		return nil
+	}
+	delete(q.jobs, id)
+	return q.store.Delete(q.bucket, id)
+}
+
+// Pending returns the job with the given ID, if it has not yet completed.
+func (q *Queue) Pending(id string) (Job, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	job, ok := q.jobs[id]
+	return job, ok
+}
+
+// Start runs jobs in the background as they come due, until Stop is called.
+func (q *Queue) Start() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.stop != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q.stop = cancel
+	q.stopped = make(chan struct{})
+	go q.loop(ctx)
+}
+
+// Stop stops running new jobs, cancels running jobs and waits for them
+// to return. Jobs that did not complete remain persisted and will resume
+// the next time the queue is started.
+func (q *Queue) Stop() {
+	q.mutex.Lock()
+	stop, stopped := q.stop, q.stopped
+	q.stop = nil
+	q.mutex.Unlock()
+
+	if stop == nil {
+		return
+	}
+	stop()
+	<-stopped
+	q.workers.Wait()
+}
+
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *Queue) loop(ctx context.Context) {
+	defer close(q.stopped)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		next := q.startDue(ctx)
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if !next.IsZero() {
+			timer.Reset(time.Until(next))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// startDue starts every job that is due and returns when the next
+// pending job comes due, or the zero time if there are none.
+func (q *Queue) startDue(ctx context.Context) time.Time {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	now := q.now()
+	next := time.Time{}
+	for id, job := range q.jobs {
+		if _, ok := q.running[id]; ok {
+			continue
+		}
+		if job.RunAt.After(now) {
+			if next.IsZero() || job.RunAt.Before(next) {
+				next = job.RunAt
+			}
+			continue
+		}
+
+		jobCtx, cancel := context.WithCancel(ctx)
+		q.running[id] = cancel
+		q.workers.Add(1)
+		go func(job Job) {
+			defer q.workers.Done()
+			defer cancel()
+			q.run(jobCtx, job)
+		}(job)
+	}
+	return next
+}
+
+// RunDue synchronously runs every job that is currently due.
+func (q *Queue) RunDue(ctx context.Context) {
+	q.startDue(ctx)
+	q.workers.Wait()
+}
+
+func (q *Queue) run(ctx context.Context, job Job) {
+	// Let the loop recalculate when the next job is due, since this
+	// job may have been retried or replaced while it was running.
+	defer q.notify()
+
+	q.mutex.Lock()
+	h := q.handlers[job.Type]
+	q.mutex.Unlock()
+
+	var err error
+	if h == nil {
+		err = fmt.Errorf("%w: %s", ErrUnknownType, job.Type)
+	} else {
+		err = runHandler(ctx, h, job)
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	delete(q.running, job.ID)
+
+	current, ok := q.jobs[job.ID]
+	if !ok || !current.RunAt.Equal(job.RunAt) || current.Type != job.Type {
+		// Cancelled or rescheduled while running.
+		return
+	}
+	if ctx.Err() != nil && err != nil {
+		// The queue is stopping. Leave the job as is to resume on restart.
+		return
+	}
+
+	if err == nil {
+		delete(q.jobs, job.ID)
+		if err := q.store.Delete(q.bucket, job.ID); err != nil {
+			log.Error(err)
+		}
+		return
+	}
+
+	job.Attempts++
+	job.LastError = err.Error()
+	maxAttempts := job.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	if job.Attempts >= maxAttempts {
+		log.Errorf("Abandoning %s job %s after %d attempts: %v", job.Type, job.ID, job.Attempts, err)
+		delete(q.jobs, job.ID)
+		if err := q.store.Delete(q.bucket, job.ID); err != nil {
+			log.Error(err)
+		}
+		return
+	}
+
+	job.RunAt = q.now().Add(q.backoff(job.Attempts))
+	log.Warnf("%s job %s failed (attempt %d of %d), retrying at %s: %v", job.Type, job.ID, job.Attempts, maxAttempts, job.RunAt.Format(time.RFC3339), err)
+	q.jobs[job.ID] = job
+	if err := q.store.Put(q.bucket, job.ID, job); err != nil {
+		log.Error(err)
+	}
+	q.notify()
+}
+
+// runHandler turns a panicking handler into a failed attempt.
+func runHandler(ctx context.Context, h Handler, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return h(ctx, job)
+}
+
+// backoff returns how long to wait before the next attempt
+// of a job that has failed the given number of times.
+func (q *Queue) backoff(attempts int) time.Duration {
+	d := float64(q.BaseBackoff) * math.Pow(2, float64(attempts-1))
+	if d > float64(q.MaxBackoff) {
+		return q.MaxBackoff
+	}
+	return time.Duration(d)
+}
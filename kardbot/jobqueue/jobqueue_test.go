@@ -0,0 +1,153 @@
+package jobqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Kardbord/Kard-bot/kardbot/store"
+)
+
+const testBucket = "jobs"
+
+func openTestStore(t *testing.T) store.Store {
+	t.Helper()
+	st, err := store.Open(store.Config{Backend: store.BackendJSON, Path: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+// newTestQueue returns a queue whose clock is controlled by the returned pointer.
+func newTestQueue(t *testing.T, st store.Store) (*Queue, *time.Time) {
+	t.Helper()
+	q, err := New(st, testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return now }
+	return q, &now
+}
+
+func TestJobsResumeAfterRestart(t *testing.T) {
+	st := openTestStore(t)
+	q, now := newTestQueue(t, st)
+	q.Register("greet", func(ctx context.Context, job Job) error { return nil })
+	if err := q.Schedule("greet/1", "greet", now.Add(time.Hour), "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted, now := newTestQueue(t, st)
+	ran := ""
+	restarted.Register("greet", func(ctx context.Context, job Job) error {
+		ran = string(job.Payload)
+		return nil
+	})
+
+	restarted.RunDue(context.Background())
+	if ran != "" {
+		t.Fatalf("job ran before it was due")
+	}
+
+	*now = now.Add(time.Hour)
+	restarted.RunDue(context.Background())
+	if ran != `"hello"` {
+		t.Fatalf("persisted job did not run after restart, got payload %q", ran)
+	}
+	if _, ok := restarted.Pending("greet/1"); ok {
+		t.Errorf("completed job is still pending")
+	}
+	if found, _ := st.Get(testBucket, "greet/1", &Job{}); found {
+		t.Errorf("completed job is still persisted")
+	}
+}
+
+func TestCancel(t *testing.T) {
+	st := openTestStore(t)
+	q, now := newTestQueue(t, st)
+	ran := false
+	q.Register("greet", func(ctx context.Context, job Job) error {
+		ran = true
+		return nil
+	})
+	if err := q.Schedule("greet/1", "greet", *now, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := q.Cancel("greet/1"); err != nil {
+		t.Fatal(err)
+	}
+	q.RunDue(context.Background())
+	if ran {
+		t.Errorf("cancelled job ran")
+	}
+	if found, _ := st.Get(testBucket, "greet/1", &Job{}); found {
+		t.Errorf("cancelled job is still persisted")
+	}
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	st := openTestStore(t)
+	q, now := newTestQueue(t, st)
+	attempts := 0
+	q.Register("flaky", func(ctx context.Context, job Job) error {
+		attempts++
+		return errors.New("try again")
+	})
+	if err := q.ScheduleJob(Job{ID: "flaky/1", Type: "flaky", RunAt: *now, MaxAttempts: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	q.RunDue(context.Background())
+	job, ok := q.Pending("flaky/1")
+	if !ok || job.Attempts != 1 || !job.RunAt.Equal(now.Add(q.BaseBackoff)) {
+		t.Fatalf("job was not rescheduled with backoff: %+v", job)
+	}
+
+	*now = job.RunAt
+	q.RunDue(context.Background())
+	job, _ = q.Pending("flaky/1")
+	if !job.RunAt.Equal(now.Add(2 * q.BaseBackoff)) {
+		t.Errorf("backoff did not double: %+v", job)
+	}
+
+	*now = job.RunAt
+	q.RunDue(context.Background())
+	if _, ok := q.Pending("flaky/1"); ok || attempts != 3 {
+		t.Errorf("job was not abandoned after 3 attempts (ran %d times)", attempts)
+	}
+}
+
+func TestScheduleUnknownType(t *testing.T) {
+	q, now := newTestQueue(t, openTestStore(t))
+	if err := q.Schedule("nope/1", "nope", *now, nil); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("got %v, want ErrUnknownType", err)
+	}
+}
+
+func TestStartRunsDueJobs(t *testing.T) {
+	q, err := New(openTestStore(t), testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	q.Register("greet", func(ctx context.Context, job Job) error {
+		close(done)
+		return nil
+	})
+	q.Start()
+	defer q.Stop()
+
+	if err := q.Schedule("greet/1", "greet", time.Now().Add(10*time.Millisecond), nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not run")
+	}
+}
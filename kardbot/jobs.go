@@ -0,0 +1,58 @@
+package kardbot
+
+import (
+	"fmt"
+
+	"github.com/Kardbord/Kard-bot/kardbot/jobqueue"
+	"github.com/Kardbord/Kard-bot/kardbot/store"
+	log "github.com/sirupsen/logrus"
+)
+
+// Types of delayed jobs run by the job queue.
+const (
+	jobClosePoll  = "close-poll"
+	jobCompliment = "compliment"
+	jobCreepyDM   = "creepy-dm"
+)
+
+// Any work that should survive a restart of the bot belongs in this list,
+// keyed by job type.
+func jobHandlers() map[string]jobqueue.Handler {
+	return map[string]jobqueue.Handler{
+		jobClosePoll:  runClosePollJob,
+		jobCompliment: runComplimentJob,
+		jobCreepyDM:   runCreepyDMJob,
+	}
+}
+
+// jobID builds the ID of a job from its type and the thing it acts on,
+// such that there is at most one pending job of each type per key.
+func jobID(jobType, key string) string {
+	return fmt.Sprintf("%s/%s", jobType, key)
+}
+
+// jobQueue is a getter for the bot's delayed job queue.
+func jobQueue() *jobqueue.Queue {
+	return bot().jobs
+}
+
+// newJobQueue opens the job queue and registers every job handler.
+// Jobs do not run until the queue is started.
+func newJobQueue(st store.Store) (*jobqueue.Queue, error) {
+	q, err := jobqueue.New(st, jobsBucket)
+	if err != nil {
+		return nil, err
+	}
+	for jobType, h := range jobHandlers() {
+		q.Register(jobType, meterJob(jobType, h))
+	}
+	return q, nil
+}
+
+// cancelJob cancels a pending job, logging rather than returning any error
+// since callers have no better way to handle it.
+func cancelJob(jobType, key string) {
+	if err := jobQueue().Cancel(jobID(jobType, key)); err != nil {
+		log.Error(err)
+	}
+}
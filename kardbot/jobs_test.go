@@ -0,0 +1,64 @@
+package kardbot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Kardbord/Kard-bot/kardbot/fakediscord"
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestCreepyDMJobCancelledOnOptOut(t *testing.T) {
+	fake := newTestBot(t)
+	prevOdds := creepyDMOdds
+	creepyDMOdds = 1
+	creepyDMSubs[testUser.ID] = true
+	t.Cleanup(func() {
+		creepyDMOdds = prevOdds
+		delete(creepyDMSubs, testUser.ID)
+	})
+
+	scheduleCreepyDMs()
+	id := jobID(jobCreepyDM, testUser.ID)
+	if _, ok := jobQueue().Pending(id); !ok {
+		t.Fatalf("no creepy DM was scheduled")
+	}
+
+	optOut := fake.Command(creepyDMCmd, []*discordgo.ApplicationCommandInteractionDataOption{
+		fakediscord.SubCommand(creepyDMOptOut),
+	}, fakediscord.FromUser(testUser))
+	creepyDMHandler(context.Background(), fake, optOut)
+	mustRespond(t, fake, optOut)
+
+	if _, ok := jobQueue().Pending(id); ok {
+		t.Errorf("creepy DM is still scheduled after opting out")
+	}
+}
+
+func TestClosePollJob(t *testing.T) {
+	fake := newTestBot(t)
+	msg := createTestPoll(t, fake, 1, "Tacos", "Pizza")
+
+	job, ok := jobQueue().Pending(jobID(jobClosePoll, msg.ID))
+	if !ok {
+		t.Fatalf("poll has no close-poll job")
+	}
+	if until := time.Until(job.RunAt); until < 6*24*time.Hour {
+		t.Errorf("poll is scheduled to close too soon: %s", until)
+	}
+
+	if err := runClosePollJob(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+	if polls.Has(msg.ID) {
+		t.Errorf("closed poll is still accepting votes")
+	}
+	closed, err := fake.ChannelMessage(msg.ChannelID, msg.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(closed.Components) != 0 || closed.Embeds[0].Footer == nil {
+		t.Errorf("poll message was not marked closed: %+v", closed)
+	}
+}
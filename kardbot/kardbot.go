@@ -3,20 +3,20 @@ package kardbot
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
-	"os"
-	"os/signal"
-	"runtime/debug"
 	"runtime/trace"
 	"sync"
-	"syscall"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/Kardbord/Kard-bot/kardbot/config"
+	"github.com/Kardbord/Kard-bot/kardbot/jobqueue"
+	"github.com/Kardbord/Kard-bot/kardbot/store"
 	"github.com/bwmarrin/discordgo"
+	"github.com/fsnotify/fsnotify"
 	"go.uber.org/atomic"
 )
 
@@ -33,6 +33,19 @@ type kardbot struct {
 	Session        *discordgo.Session
 	dgLoggingMutex sync.Mutex
 
+	// The Discord API as seen by features. Wraps Session
+	// in production; tests substitute a fake.
+	api discordSession
+
+	// Persistent state (subscriptions, polls, server clocks, etc.)
+	store store.Store
+
+	// Delayed work that must survive a restart, such as scheduled DMs.
+	jobs *jobqueue.Queue
+
+	// Reloads content configuration when it changes on disk.
+	configWatcher *fsnotify.Watcher
+
 	EnableDGLogging            bool `json:"enable-dg-logging"`
 	UnregisterAllCmdsOnStartup bool `json:"unregister-all-cmds-on-startup"`
 
@@ -40,11 +53,24 @@ type kardbot struct {
 	// it is abandoned by the bot.
 	ServerClockFailureThreshold uint32 `json:"server-clock-failure-threshold"`
 
-	// Enable trace regions for profiling
-	TraceEnabled bool
+	// How long a graceful shutdown waits for in-flight work before giving up.
+	ShutdownTimeoutSeconds int `json:"shutdown-timeout-seconds"`
+
+	// Enable trace regions for profiling. Can be toggled at runtime with /admin.
+	traceEnabled atomic.Bool
+
+	// When Run was called.
+	startTime time.Time
+
+	// Set once startup has finished, and cleared when shutdown begins.
+	ready atomic.Bool
+
+	// In-flight interaction and message handlers.
+	activity     activity
+	shutdownOnce sync.Once
 
 	// Initialized in kardbot.Run, used to determine when
-	// kardbot.Stop has been called.
+	// the bot has been shut down.
 	wg *sync.WaitGroup
 
 	lastActive atomic.Time
@@ -77,14 +103,16 @@ func Run(traceEnabled bool) {
 		log.Info("Bot will run with trace regions disabled (this is normal)")
 	}
 
+	loadEnv()
 	log.RegisterExitHandler(Stop)
 
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 	gbot = &kardbot{
-		wg:           &wg,
-		TraceEnabled: traceEnabled,
+		wg:        &wg,
+		startTime: time.Now(),
 	}
+	gbot.traceEnabled.Store(traceEnabled)
 	go handleInterrupt()
 	gbot.initialize()
 	log.Print("Bot is now running. Press CTRL-C to exit.")
@@ -99,60 +127,6 @@ func RunAndBlock(traceEnabled bool) {
 	Block()
 }
 
-// listenForInterrupt blocks the current goroutine until a terminatiing signal is received.
-// When the signal is received, stop and clean up the bot.
-func handleInterrupt() {
-	sc := make(chan os.Signal, 1)
-	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
-	<-sc
-	Stop()
-	os.Exit(1)
-}
-
-// Stop and clean up.
-func Stop() {
-	if err := writeCreepyDmSubscribersToDisk(); err != nil {
-		log.Error(err)
-	}
-
-	if err := writeComplimentSubscribersToDisk(); err != nil {
-		log.Error(err)
-	}
-
-	if err := writeServerClocksToDisk(); err != nil {
-		log.Error(err)
-	}
-
-	if err := purgeFinishedPolls(); err != nil {
-		log.Error(err)
-	}
-
-	if gbot == nil {
-		log.Info("Bot is not running")
-		return
-	}
-
-	defer func() {
-		if gbot.wg == nil {
-			log.Fatal("nil waitgroup, there is a bug. :(")
-		}
-		gbot.wg.Done()
-	}()
-
-	if gbot.Session == nil {
-		log.Info("No session to close")
-		return
-	}
-
-	log.Info("Closing session")
-	err := gbot.Session.Close()
-	if err != nil {
-		log.Errorf("Session closed with error: %v", err)
-	} else {
-		log.Info("Session closed")
-	}
-}
-
 // Initialize the single global bot instance
 func (kbot *kardbot) initialize() {
 	dgs, err := discordgo.New("Bot " + getBotToken())
@@ -164,9 +138,14 @@ func (kbot *kardbot) initialize() {
 	}
 	log.Info("Session created")
 	kbot.Session = dgs
+	kbot.api = dgSession{dgs}
 
 	kbot.configure()
 	log.Info("Configuration read")
+	loadFeatureConfigs()
+	log.Info("Feature configuration loaded")
+	kbot.openStore()
+	log.Info("State loaded")
 	kbot.addOnReadyHandlers()
 	log.Info("OnReady handlers registered")
 	kbot.prepInteractionHandlers()
@@ -178,6 +157,7 @@ func (kbot *kardbot) initialize() {
 	}
 	kbot.lastActive = *atomic.NewTime(time.Now())
 	scheduler().StartAsync()
+	kbot.jobs.Start()
 	kbot.validateInitialization()
 	log.Info("Configuration validated")
 
@@ -185,6 +165,16 @@ func (kbot *kardbot) initialize() {
 	log.Info("OnCreate handlers registered")
 	kbot.addInteractionHandlers(kbot.UnregisterAllCmdsOnStartup)
 	log.Info("Interaction handlers registered")
+
+	kbot.configWatcher, err = kbot.watchContentConfigs()
+	if err != nil {
+		log.Errorf("Config files will not be reloaded automatically: %v", err)
+	} else {
+		log.Info("Watching config files for changes")
+	}
+
+	kbot.ready.Store(true)
+	log.Info("Ready")
 }
 
 const kardbotConfigFile = "config/setup.json"
@@ -194,6 +184,10 @@ func (kbot *kardbot) configure() {
 	kbot.Session.SyncEvents = false
 	kbot.Session.ShouldReconnectOnError = true
 	kbot.Session.StateEnabled = true
+	meterClient(kbot.Session.Client)
+	retryClient(kbot.Session.Client)
+	// Server errors are already retried by the client's transport.
+	kbot.Session.MaxRestRetries = 0
 
 	jsonCfg, err := config.NewJsonConfig(kardbotConfigFile)
 	if err != nil {
@@ -212,6 +206,43 @@ func (kbot *kardbot) configure() {
 	}
 }
 
+// Any configuration a feature reads from disk on startup belongs in this
+// list. These were once init functions; keeping them out of init lets the
+// package load without a config directory. Files that can be reloaded at
+// runtime belong in reloadableConfigs instead.
+func localConfigLoaders() []func() error {
+	return []func() error{
+		loadACL,
+		loadAlertConfig,
+		loadContentConfigs,
+		loadCreepyDMOdds,
+		loadHandlerConfig,
+		loadRateLimits,
+	}
+}
+
+// Any configuration a feature fetches from an external service on
+// startup belongs in this list, so that it can be skipped when
+// validating the configuration offline.
+func remoteConfigLoaders() []func() error {
+	return []func() error{
+		loadMemeTemplates,
+		loadRedditClient,
+	}
+}
+
+func configLoaders() []func() error {
+	return append(localConfigLoaders(), remoteConfigLoaders()...)
+}
+
+func loadFeatureConfigs() {
+	for _, load := range configLoaders() {
+		if err := load(); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
 func (kbot *kardbot) validateInitialization() {
 	// Validate Session
 	if kbot.Session == nil {
@@ -233,234 +264,232 @@ func (kbot *kardbot) validateInitialization() {
 		log.Warn("No intents registered with the discordgo API, which may result in decreased functionality.")
 	}
 
-	if kbot.Session.State.User.ID == getOwnerID() {
-		// Owner has privilege to run any and all bot commands.
+	if isBotAdmin(kbot.Session.State.User.ID) {
+		// Admins have privilege to run any and all bot commands.
 		// Giving a bot the reins to its own destiny is how you get Skynet in the long term.
 		// In the short term, it might lead to weird edge cases I didn't think of, so I'm
 		// disallowing it for now. :)
-		log.Fatal("Bot is listed as its own owner")
+		log.Fatal("Bot is listed as its own owner or admin")
 	}
 }
 
 func (kbot *kardbot) prepInteractionHandlers() {
+	cfg := handlerCfg.Load()
+	pool := newHandlerPool(cfg.Workers)
 	kbot.Session.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-		defer func() {
-			// Attempt to quit gracefully in the event of a panic.
-			// Won't do any good if the panic came from another goroutine.
-			if r := recover(); r != nil {
-				if panicErr, ok := r.(error); ok && i.Type == discordgo.InteractionApplicationCommand {
-					interactionRespondEphemeralError(s, i, true, panicErr)
-				}
-				log.Fatalf("Panicked!\n%v\nStack Trace:%s\n", r, debug.Stack())
-			}
-		}()
-
-		var handler func(*discordgo.Session, *discordgo.InteractionCreate) = nil
-		command := "unknown interaction type"
-		switch i.Type {
-		case discordgo.InteractionApplicationCommand:
-			command = i.ApplicationCommandData().Name
-			if strMatchesMemeCmdPattern(command) {
-				command = memeCommand
-			}
-			if h, ok := getCommandImpls()[command]; ok {
-				handler = h
-			}
-		case discordgo.InteractionMessageComponent:
-			command = i.MessageComponentData().CustomID
-			if roleSelectMenuIDRegex.MatchString(command) {
-				command = roleSelectMenuComponentIDPrefix
-			}
-			if h, ok := getComponentImpls()[command]; ok {
-				handler = h
+		kbot.dispatchInteraction(pool, dgSession{s}, i)
+	})
+}
+
+// routeInteraction dispatches an interaction to the handler registered for it.
+func (kbot *kardbot) routeInteraction(s discordSession, i *discordgo.InteractionCreate) {
+	start := time.Now()
+	typ := interactionTypeLabel(i.Type)
+	command := "unknown interaction type"
+	// The Command the handler belongs to, if any, for its circuit breaker.
+	owner := ""
+	outcome := outcomeOK
+	handled := false
+
+	defer func() {
+		// A panic only fails the interaction that caused it. Panics in
+		// goroutines started by the handler must be recovered there.
+		if r := recover(); r != nil {
+			err := newPanicError(r)
+			observeInteraction(typ, command, outcomePanic, start, handled)
+			logFor(i).Errorf("%s panicked: %v\n%s", command, r, err.stack)
+			if owner != "" && recordCommandPanic(owner, time.Now()) {
+				msg := fmt.Sprintf("/%s panicked %d times within %s and is switched off for %s", owner, breakerMaxPanics, breakerWindow, breakerCooldown)
+				logFor(i).Error(msg)
+				raiseAlert(alert{
+					Severity:       severityError,
+					Title:          "Command switched off",
+					Key:            "circuit-breaker " + owner,
+					Message:        msg + fmt.Sprintf(". Use `/%s %s` to switch it back on early.", adminCmd, adminSubCmdReset),
+					Fields:         []alertField{{"Last Panic", fmt.Sprintf("```\n%s:%d %v\n```", err.file, err.line, err)}},
+					AttachmentName: "stack.txt",
+					Attachment:     err.stack,
+				})
 			}
+			reportInteractionPanic(s, i, err)
+			return
 		}
+		observeInteraction(typ, command, outcome, start, handled)
+	}()
 
+	if !kbot.activity.begin() {
+		outcome = outcomeShuttingDown
+		if i.Type != discordgo.InteractionApplicationCommandAutocomplete {
+			interactionRespondEphemeralError(s, i, false, errors.New(localized(i, msgShuttingDown)))
+		}
+		return
+	}
+	defer kbot.activity.end()
+
+	var handler onInteractionHandler = nil
+	// The Command to charge a cooldown and rate limit tokens to, if any.
+	var charged Command
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		command = i.ApplicationCommandData().Name
+		if cmd, ok := commandFor(command); ok {
+			command = cmd.Name()
+			if err := checkCommandRestrictions(cmd, i); err != nil {
+				logFor(i).Debugf("Rejected %s: %v", command, err)
+				outcome = outcomeRejected
+				interactionRespondEphemeralError(s, i, false, err)
+				return
+			}
+			owner, handler, charged = cmd.Name(), cmd.HandleCommand, cmd
+		}
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		command = i.ApplicationCommandData().Name
+		if cmd, ok := commandFor(command); ok {
+			command = cmd.Name()
+			owner, handler = cmd.Name(), cmd.AutocompleteHandler()
+		}
 		if handler == nil {
-			err := fmt.Errorf("interaction failed: %s", command)
-			log.Error(err)
-			interactionRespondEphemeralError(s, i, true, err)
+			// There is no way to respond to an autocomplete interaction with an error.
+			logFor(i).Errorf("autocomplete interaction failed: %s", command)
+			outcome = outcomeUnhandled
 			return
 		}
-
-		wg := kbot.updateLastActive()
-		defer wg.Wait()
-
-		if kbot.TraceEnabled {
-			ctx, task := trace.NewTask(context.Background(), command)
-			defer task.End()
-			r := trace.StartRegion(ctx, command)
-			handler(s, i)
-			r.End()
-		} else {
-			handler(s, i)
+	case discordgo.InteractionMessageComponent:
+		command = i.MessageComponentData().CustomID
+		if r, ok := componentRouteFor(command); ok {
+			command = r.label()
+			owner, handler = r.owner, r.handler
+		}
+	case discordgo.InteractionModalSubmit:
+		command = i.ModalSubmitData().CustomID
+		if r, ok := modalRouteFor(command); ok {
+			command = r.label()
+			owner, handler = r.owner, r.handler
 		}
-	})
-}
-
-func (kbot *kardbot) addOnReadyHandlers() {
-	for _, h := range onReadyHandlers() {
-		kbot.Session.AddHandler(h)
-	}
-}
-
-func (kbot *kardbot) addOnCreateHandlers() {
-	for _, h := range onCreateHandlers() {
-		kbot.Session.AddHandler(h)
 	}
-}
 
-func (kbot *kardbot) addInteractionHandlers(unregisterAllPrevCmds bool) {
-	if !validateCmdRegex() {
-		log.Fatal("One or more commands is invalid.")
+	if wait := commandTripped(owner, time.Now()); owner != "" && wait > 0 {
+		outcome = outcomeRejected
+		if i.Type != discordgo.InteractionApplicationCommandAutocomplete {
+			interactionRespondEphemeralError(s, i, false, errors.New(localized(i, msgCommandTripped, owner, wait.Round(time.Minute))))
+		}
+		return
 	}
 
-	if unregisterAllPrevCmds {
-		kbot.unregisterAllCommands()
-		kbot.bulkOverwriteAllCommands()
+	if handler == nil {
+		err := fmt.Errorf("interaction failed: %s", command)
+		logFor(i).Error(err)
+		// Unrouted custom IDs could be anything, so keep them out of metric labels.
+		command = "unknown"
+		outcome = outcomeUnhandled
+		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
 
-	kbot.unregisterOldCommands()
-	kbot.bulkOverwriteAllCommands()
-}
-
-func (kbot *kardbot) unregisterOldCommands() {
-	kbot.unregisterOldGlobalCommands()
-	kbot.unregisterOldGuildCommands()
-}
-
-func (kbot *kardbot) unregisterOldGlobalCommands() {
-	cmds, err := kbot.Session.ApplicationCommands(kbot.Session.State.User.ID, "")
-	if err != nil {
-		log.Fatal(err)
+	// Autocomplete is cheap, and shouldn't go quiet while a command is busy.
+	if i.Type != discordgo.InteractionApplicationCommandAutocomplete {
+		release, ok := acquireCommandSlot(owner)
+		if !ok {
+			outcome = outcomeBusy
+			interactionRespondEphemeralError(s, i, false, errors.New(localized(i, msgCommandBusy, owner)))
+			return
+		}
+		defer release()
 	}
-	kbot.unregisterOldCommandsFromList(cmds, "")
-}
 
-func (kbot *kardbot) unregisterOldGuildCommands() {
-	guilds, err := kbot.GetAllGuilds()
-	if err != nil {
-		log.Fatal(err)
+	if charged != nil {
+		if err := chargeCommandUse(charged, i); err != nil {
+			logFor(i).Debugf("Rejected %s: %v", command, err)
+			outcome = outcomeRejected
+			interactionRespondEphemeralError(s, i, false, err)
+			return
+		}
 	}
 
-	for _, g := range guilds {
-		if g.ID == "" {
-			log.Warn("Empty string specified as slash guild implies global command, skipping.")
-			continue
-		}
-		cmds, err := kbot.Session.ApplicationCommands(kbot.Session.State.User.ID, g.ID)
-		if err != nil {
-			log.Fatal(err)
+	wg := kbot.updateLastActive()
+	defer wg.Wait()
+
+	cfg := handlerCfg.Load()
+	timeout := cfg.timeout(owner)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	defer func() {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			outcome = outcomeTimedOut
+			logFor(i).Warnf("%s timed out after %s", command, timeout)
 		}
+	}()
 
-		kbot.unregisterOldCommandsFromList(cmds, g.ID)
+	if kbot.traceEnabled.Load() {
+		var task *trace.Task
+		ctx, task = trace.NewTask(ctx, command)
+		defer task.End()
+		defer trace.StartRegion(ctx, command).End()
 	}
-}
 
-func (kbot *kardbot) unregisterOldCommandsFromList(cmds []*discordgo.ApplicationCommand, guildID string) {
-	for _, cmd := range cmds {
-		cmdname := cmd.Name
-		if strMatchesMemeCmdPattern(cmdname) {
-			cmdname = memeCommand
-		}
-		if _, ok := getCommandImpls()[cmdname]; !ok {
-			if guildID == "" {
-				log.Infof("Unregistering global command %s", cmd.Name)
-			} else {
-				log.Infof("Unregistering cmd '%s' from guild %s", cmd.Name, guildID)
-			}
-			err := kbot.Session.ApplicationCommandDelete(kbot.Session.State.User.ID, guildID, cmd.ID)
-			if err != nil {
-				log.Error(err)
-			}
-		}
-	}
+	handled = true
+	handler(ctx, s, i)
 }
 
-func (kbot *kardbot) bulkOverwriteGlobalCommands() {
-	log.Infof("Bulk overwriting global commands")
-	_, err := kbot.Session.ApplicationCommandBulkOverwrite(kbot.Session.State.User.ID, "", getCommands())
-	if err != nil {
-		log.Fatal(err)
+func (kbot *kardbot) addOnReadyHandlers() {
+	for _, h := range onReadyHandlers() {
+		kbot.Session.AddHandler(h)
 	}
 }
 
-func (kbot *kardbot) unregisterAllGlobalCommands() {
-	// Unregister global commands
-	if cmds, err := kbot.Session.ApplicationCommands(kbot.Session.State.User.ID, ""); err == nil {
-		for _, cmd := range cmds {
-			log.Infof("Unregistering global command: %s", cmd.Name)
-			err = kbot.Session.ApplicationCommandDelete(bot().Session.State.User.ID, "", cmd.ID)
-			if err != nil {
-				log.Error(err)
+func (kbot *kardbot) addOnCreateHandlers() {
+	for _, h := range onCreateHandlers() {
+		kbot.Session.AddHandler(func(s *discordgo.Session, m *discordgo.MessageCreate) {
+			if !kbot.activity.begin() {
+				return
 			}
-		}
-	} else {
-		log.Warn(err)
+			defer kbot.activity.end()
+			defer func() {
+				if r := recover(); r != nil {
+					logPanic("message-create", nil, newPanicError(r))
+				}
+			}()
+			h(s, m)
+		})
 	}
 }
 
-func (kbot *kardbot) bulkOverwriteTestGuildcommands() {
-	if getTestbedGuild() == "" {
-		log.Info("No testbed guild specified")
-		return
-	}
-	log.Info("Bulk overwriting testbed guild commands")
-	_, err := kbot.Session.ApplicationCommandBulkOverwrite(kbot.Session.State.User.ID, getTestbedGuild(), getCommands())
-	if err != nil {
-		log.Fatalf("Failed to register commands in guild %s: %v", getTestbedGuild(), err)
+func (kbot *kardbot) addInteractionHandlers(unregisterAllPrevCmds bool) {
+	if !commandsAreValid() {
+		log.Fatal("One or more commands is invalid.")
 	}
-}
 
-func (kbot *kardbot) bulkOverwriteAllCommands() {
-	log.Info("Registering all commands for current bot instance")
-	kbot.bulkOverwriteGlobalCommands()
-	kbot.bulkOverwriteTestGuildcommands()
-}
-
-func (kbot *kardbot) unregisterAllGuildCommands() {
-	guilds, err := kbot.GetAllGuilds()
-	if err != nil {
-		log.Fatal(err)
+	if unregisterAllPrevCmds {
+		log.Info("Unregistering all commands from previous bot instance")
+		if err := kbot.unregisterAllCommands(); err != nil {
+			fatalWithAlert("Failed to unregister commands", err)
+		}
 	}
 
-	for _, g := range guilds {
-		if g.ID == "" {
-			log.Warn("Empty string specified as slash guild implies global command, skipping.")
-			continue
+	log.Info("Registering all commands for current bot instance")
+	cmds := getCommands()
+	for _, guildID := range commandScopes() {
+		changes, err := syncCommands(kbot.api, guildID, cmds, false)
+		if err != nil {
+			fatalWithAlert("Failed to register commands", err)
 		}
-		if cmds, err := kbot.Session.ApplicationCommands(kbot.Session.State.User.ID, g.ID); err == nil {
-			for _, cmd := range cmds {
-				log.Infof("Unregistering cmd '%s' in guild %s", cmd.Name, g.Name)
-				err = kbot.Session.ApplicationCommandDelete(kbot.Session.State.User.ID, g.ID, cmd.ID)
-				if err != nil {
-					log.Error(err)
-				}
-			}
-		} else {
-			log.Warn(err)
+		if len(changes) == 0 {
+			log.Infof("Commands registered %s are up to date", commandScopeLabel(guildID))
 		}
 	}
 }
 
-func (kbot *kardbot) unregisterAllCommands() {
-	log.Info("Unregistering all commands from previous bot instance")
-	kbot.unregisterAllGlobalCommands()
-	kbot.unregisterAllGuildCommands()
-}
-
 func (kbot *kardbot) GetAllGuilds() ([]*discordgo.UserGuild, error) {
 	botGuilds := []*discordgo.UserGuild{}
 
-	rGuilds, err := kbot.Session.UserGuilds(100, "", "")
+	rGuilds, err := kbot.api.UserGuilds(100, "", "")
 	if err != nil {
 		return nil, err
 	}
 	botGuilds = append(botGuilds, rGuilds...)
 
 	for len(rGuilds) > 0 {
-		rGuilds, err = kbot.Session.UserGuilds(100, "", rGuilds[len(rGuilds)-1].ID)
+		rGuilds, err = kbot.api.UserGuilds(100, "", rGuilds[len(rGuilds)-1].ID)
 		if err != nil {
 			return nil, err
 		}
@@ -477,8 +506,13 @@ func (kbot *kardbot) GetAllGuilds() ([]*discordgo.UserGuild, error) {
 func (kbot *kardbot) updateLastActive() *sync.WaitGroup {
 	wg := sync.WaitGroup{}
 	wg.Add(1)
-	go func() {
+	goSafely("update-last-active", func() {
+		defer wg.Done()
 		kbot.lastActive.Store(time.Now())
+		if kbot.Session == nil {
+			// No gateway connection, e.g. under test.
+			return
+		}
 
 		err := kbot.Session.UpdateListeningStatus("you")
 		if err != nil {
@@ -500,9 +534,7 @@ func (kbot *kardbot) updateLastActive() *sync.WaitGroup {
 		if err != nil {
 			log.Error(err)
 		}
-
-		wg.Done()
-	}()
+	})
 
 	return &wg
 }
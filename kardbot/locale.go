@@ -0,0 +1,293 @@
+package kardbot
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// Directory of message catalogs, one per locale, named after the
+// Discord locale they translate to (e.g. config/locales/es-ES.json).
+const localesDir = "config/locales"
+
+// IDs of translatable response messages.
+const (
+	msgShuttingDown      = "shutting-down"
+	msgGenericError      = "generic-error"
+	msgErrorReportPrompt = "error-report-prompt"
+	msgOwnerOnly         = "owner-only"
+	msgBotAdminOnly      = "bot-admin-only"
+	msgGuildOnly         = "guild-only"
+	msgDMOnly            = "dm-only"
+	msgMissingPerms      = "missing-permissions"
+	msgCommandDisabled   = "command-disabled"
+	msgCooldown          = "cooldown"
+	msgRateLimitUser     = "rate-limit-user"
+	msgRateLimitGuild    = "rate-limit-guild"
+	msgRateLimitGlobal   = "rate-limit-global"
+	msgFormExpired       = "form-expired"
+	msgFormRetry         = "form-retry"
+	msgCommandTripped    = "command-tripped"
+	msgBusy              = "busy"
+	msgCommandBusy       = "command-busy"
+	msgTimedOut          = "timed-out"
+)
+
+// Messages registered by individual features with registerMessages.
+var featureMessages = map[string]string{}
+
+// registerMessages adds a feature's response text to defaultMessages.
+// Features prefix their message IDs with their command name, e.g.
+// "roll.total", and register them from an init function.
+func registerMessages(msgs map[string]string) {
+	for id, english := range msgs {
+		if _, dup := featureMessages[id]; dup {
+			log.Fatalf("Message ID %s registered twice", id)
+		}
+		featureMessages[id] = english
+	}
+}
+
+// Any response text that should be translated belongs in this map,
+// keyed by message ID, either directly for messages shared by many
+// commands, or through registerMessages. These English strings are used
+// whenever a catalog has no translation for the user's locale. Replies
+// to owner and bot admin commands, errors that are reported to the
+// owner, and messages posted for everyone to see are not translated.
+func defaultMessages() map[string]string {
+	msgs := maps.Clone(featureMessages)
+	maps.Copy(msgs, coreMessages())
+	return msgs
+}
+
+func coreMessages() map[string]string {
+	return map[string]string{
+		msgShuttingDown:      "the bot is restarting, please try again in a minute",
+		msgGenericError:      "an error occurred. :'(",
+		msgErrorReportPrompt: "Something went wrong while processing your command. 😔",
+		msgOwnerOnly:         "only the bot owner can use `/%s`. :(",
+		msgBotAdminOnly:      "only bot admins can use `/%s`. :(",
+		msgGuildOnly:         "`/%s` can only be used from within a server",
+		msgDMOnly:            "looks like you tried to use `/%s` outside of our DMs. Run it from there instead! :)",
+		msgMissingPerms:      "you don't have the server permissions needed to use `/%s`",
+		msgCommandDisabled:   "`/%s` has been disabled in this server",
+		msgCooldown:          "slow down! You can use `/%s` again in %s",
+		msgRateLimitUser:     "you're using `/%s` too often, try again in %s",
+		msgRateLimitGuild:    "`/%s` is being used a lot in this server, try again in %s",
+		msgRateLimitGlobal:   "`/%s` is being used a lot right now, try again in %s",
+		msgFormExpired:       "this form has expired, please run `/%s` again",
+		msgFormRetry:         "Edit and resubmit",
+		msgCommandTripped:    "`/%s` is taking a break after failing several times in a row, try again in %s",
+		msgBusy:              "the bot is very busy right now, please try again in a moment",
+		msgCommandBusy:       "`/%s` is busy with other requests right now, please try again in a moment",
+		msgTimedOut:          "that took too long and was cancelled, please try again later",
+	}
+}
+
+// messageCatalog holds the translations for one locale. Keys are either
+// message IDs from defaultMessages, command metadata keys built by
+// commandLocalizationKey, or form text keys built by formLocalizationKey.
+type messageCatalog map[string]string
+
+// Catalogs keyed by locale.
+var messageCatalogs hotConfig[map[discordgo.Locale]messageCatalog]
+
+var fmtVerbRegex = regexp.MustCompile(`%[-+# 0]*[0-9]*(\.[0-9]+)?[a-zA-Z%]`)
+
+// Unlike validCommandRegex, this allows non-ASCII letters, which
+// translated names will often need.
+// See https://discord.com/developers/docs/interactions/application-commands#application-command-object-application-command-naming
+var validLocalizedNameRegex = regexp.MustCompile(`^[-_\p{L}\p{N}\p{Devanagari}\p{Thai}]{1,32}$`)
+
+func parseMessageCatalogs() (func(), error) {
+	entries, err := os.ReadDir(localesDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	defaults := defaultMessages()
+	catalogs := map[discordgo.Locale]messageCatalog{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		locale := discordgo.Locale(strings.TrimSuffix(entry.Name(), ".json"))
+		if _, ok := discordgo.Locales[locale]; !ok {
+			return nil, fmt.Errorf("%s: %s is not a Discord locale", entry.Name(), locale)
+		}
+
+		raw, err := os.ReadFile(filepath.Join(localesDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		catalog := messageCatalog{}
+		if err = json.Unmarshal(raw, &catalog); err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+
+		for key, translation := range catalog {
+			if strings.HasPrefix(key, commandLocalizationPrefix) {
+				if strings.HasSuffix(key, ".name") && (!validLocalizedNameRegex.MatchString(translation) || strings.ToLower(translation) != translation) {
+					return nil, fmt.Errorf("%s: %s: %q does not conform to Discord's command naming requirements", entry.Name(), key, translation)
+				}
+				continue
+			}
+			if strings.HasPrefix(key, formLocalizationPrefix) {
+				limit := maxDiscordTextInputLabel
+				switch {
+				case strings.HasSuffix(key, ".title"):
+					limit = maxDiscordModalTitle
+				case strings.HasSuffix(key, ".placeholder"):
+					limit = maxDiscordTextInputPlaceholder
+				}
+				if n := len([]rune(translation)); n > limit {
+					return nil, fmt.Errorf("%s: %s is %d characters long, the limit is %d", entry.Name(), key, n, limit)
+				}
+				continue
+			}
+			english, ok := defaults[key]
+			if !ok {
+				return nil, fmt.Errorf("%s: unknown message %s", entry.Name(), key)
+			}
+			if want, got := fmtVerbRegex.FindAllString(english, -1), fmtVerbRegex.FindAllString(translation, -1); !slices.Equal(want, got) {
+				return nil, fmt.Errorf("%s: %s must use the format verbs %v, not %v", entry.Name(), key, want, got)
+			}
+		}
+		catalogs[locale] = catalog
+	}
+
+	return func() { messageCatalogs.Store(catalogs) }, nil
+}
+
+// localize formats the message with the given ID in the given locale,
+// falling back to English.
+func localize(locale discordgo.Locale, id string, args ...any) string {
+	format, ok := messageCatalogs.Load()[locale][id]
+	if !ok {
+		if format, ok = featureMessages[id]; !ok {
+			format, ok = coreMessages()[id]
+		}
+		if !ok {
+			log.Errorf("No message with ID %s", id)
+			return id
+		}
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// localized formats the message with the given ID in the locale of
+// the user who issued the interaction.
+func localized(i *discordgo.InteractionCreate, id string, args ...any) string {
+	if i == nil || i.Interaction == nil {
+		return localize("", id, args...)
+	}
+	return localize(i.Locale, id, args...)
+}
+
+// localizedFor picks the translation of a piece of command metadata for
+// locale, falling back to the English text.
+func localizedFor(locale discordgo.Locale, text string, localizations *map[discordgo.Locale]string) string {
+	if localizations != nil {
+		if translated, ok := (*localizations)[locale]; ok && translated != "" {
+			return translated
+		}
+	}
+	return text
+}
+
+const formLocalizationPrefix = "form."
+
+// formLocalizationKey builds the catalog key for the text of a modal
+// form, e.g. form.poll-form.title or form.poll-form.options.label
+func formLocalizationKey(path ...string) string {
+	return formLocalizationPrefix + strings.Join(path, ".")
+}
+
+// translateForm returns the translation of a form's text for locale, or
+// english if there is none. Unlike response messages, form text has no
+// format verbs.
+func translateForm(locale discordgo.Locale, key, english string) string {
+	if translated, ok := messageCatalogs.Load()[locale][key]; ok && translated != "" {
+		return translated
+	}
+	return english
+}
+
+const commandLocalizationPrefix = "command."
+
+// commandLocalizationKey builds the catalog key for a piece of command
+// metadata from the path of names leading to it, e.g.
+// command.render.dalle3.prompt.description
+func commandLocalizationKey(path []string, field string) string {
+	return commandLocalizationPrefix + strings.Join(append(append([]string{}, path...), field), ".")
+}
+
+// localizeCommand returns a copy of cmd with name and description
+// localizations from every catalog. cmd itself is left untouched,
+// since definitions may share options and choices with loaded config.
+func localizeCommand(cmd *discordgo.ApplicationCommand) *discordgo.ApplicationCommand {
+	catalogs := messageCatalogs.Load()
+	if len(catalogs) == 0 {
+		return cmd
+	}
+	lookup := func(path []string, field string) *map[discordgo.Locale]string {
+		key := commandLocalizationKey(path, field)
+		found := map[discordgo.Locale]string{}
+		for locale, catalog := range catalogs {
+			if translation, ok := catalog[key]; ok {
+				found[locale] = translation
+			}
+		}
+		if len(found) == 0 {
+			return nil
+		}
+		return &found
+	}
+
+	out := *cmd
+	path := []string{cmd.Name}
+	out.NameLocalizations = lookup(path, "name")
+	if cmd.Description != "" {
+		out.DescriptionLocalizations = lookup(path, "description")
+	}
+	out.Options = localizeOptions(cmd.Options, path, lookup)
+	return &out
+}
+
+func localizeOptions(opts []*discordgo.ApplicationCommandOption, parent []string, lookup func([]string, string) *map[discordgo.Locale]string) []*discordgo.ApplicationCommandOption {
+	if opts == nil {
+		return nil
+	}
+	out := make([]*discordgo.ApplicationCommandOption, len(opts))
+	for idx, opt := range opts {
+		o := *opt
+		path := append(append([]string{}, parent...), opt.Name)
+		if names := lookup(path, "name"); names != nil {
+			o.NameLocalizations = *names
+		}
+		if descs := lookup(path, "description"); descs != nil {
+			o.DescriptionLocalizations = *descs
+		}
+		if opt.Choices != nil {
+			o.Choices = make([]*discordgo.ApplicationCommandOptionChoice, len(opt.Choices))
+			for cidx, choice := range opt.Choices {
+				c := *choice
+				if names := lookup(append(path, "choice"), choice.Name); names != nil {
+					c.NameLocalizations = *names
+				}
+				o.Choices[cidx] = &c
+			}
+		}
+		o.Options = localizeOptions(opt.Options, path, lookup)
+		out[idx] = &o
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+package kardbot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Kardbord/Kard-bot/kardbot/fakediscord"
+	"github.com/bwmarrin/discordgo"
+)
+
+func loadTestCatalogs(t *testing.T, files map[string]string) error {
+	t.Helper()
+	inTempConfigDir(t, files)
+	prev := messageCatalogs.Load()
+	t.Cleanup(func() { messageCatalogs.Store(prev) })
+
+	commit, err := parseMessageCatalogs()
+	if err == nil {
+		commit()
+	}
+	return err
+}
+
+func TestLocalizedResponses(t *testing.T) {
+	err := loadTestCatalogs(t, map[string]string{
+		localesDir + "/es-ES.json": `{"owner-only": "solo el dueño puede usar /%s"}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := localize(discordgo.SpanishES, msgOwnerOnly, "reload"); got != "solo el dueño puede usar /reload" {
+		t.Errorf("got %q in Spanish", got)
+	}
+	if got := localize(discordgo.French, msgOwnerOnly, "reload"); !strings.HasPrefix(got, "only the bot owner") {
+		t.Errorf("did not fall back to English for an untranslated locale, got %q", got)
+	}
+	if got := localize(discordgo.SpanishES, msgGuildOnly, "poll"); !strings.Contains(got, "within a server") {
+		t.Errorf("did not fall back to English for an untranslated message, got %q", got)
+	}
+
+	fake := newTestBot(t)
+	i := fake.Command(adminCmd, nil, append(inTestGuild(), fakediscord.WithLocale(discordgo.SpanishES))...)
+	bot().routeInteraction(fake, i)
+	if resp := mustRespond(t, fake, i); !strings.Contains(resp.Initial.Data.Content, "solo el dueño") {
+		t.Errorf("rejection was not localized: %q", resp.Initial.Data.Content)
+	}
+}
+
+func TestLocalizedFeatureResponses(t *testing.T) {
+	err := loadTestCatalogs(t, map[string]string{
+		localesDir + "/es-ES.json": `{
+			"roll.rolling": "Tirando %d D%d...",
+			"form.poll-form.title": "Crear una encuesta"
+		}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := newTestBot(t)
+	roll := customRoll(fake, 2, "d6")
+	roll.Locale = discordgo.SpanishES
+	rollCustomDice(fake, roll)
+	if resp := mustRespond(t, fake, roll); !strings.HasPrefix(resp.Initial.Data.Content, "Tirando 2 D6...") || !strings.Contains(resp.Initial.Data.Content, "Total: ") {
+		t.Errorf("roll was not localized with an English fallback: %q", resp.Initial.Data.Content)
+	}
+
+	poll := fake.Command(pollCmd, nil, append(inTestGuild(), fakediscord.WithLocale(discordgo.SpanishES))...)
+	bot().routeInteraction(fake, poll)
+	if resp := mustRespond(t, fake, poll); resp.Initial.Data.Title != "Crear una encuesta" {
+		t.Errorf("form title was not localized: %q", resp.Initial.Data.Title)
+	}
+}
+
+func TestInvalidCatalogsAreRejected(t *testing.T) {
+	cases := map[string]map[string]string{
+		"unknown locale":       {localesDir + "/xx-XX.json": `{}`},
+		"unknown message":      {localesDir + "/fr.json": `{"no-such-message": "non"}`},
+		"mismatched verbs":     {localesDir + "/fr.json": `{"cooldown": "doucement ! /%s"}`},
+		"invalid command name": {localesDir + "/fr.json": `{"command.help.name": "Aide Moi"}`},
+		"form title too long":  {localesDir + "/fr.json": `{"form.poll-form.title": "` + strings.Repeat("x", maxDiscordModalTitle+1) + `"}`},
+	}
+	for name, files := range cases {
+		t.Run(name, func(t *testing.T) {
+			if err := loadTestCatalogs(t, files); err == nil {
+				t.Errorf("catalog was accepted")
+			}
+		})
+	}
+}
+
+func TestLocalizeCommand(t *testing.T) {
+	err := loadTestCatalogs(t, map[string]string{
+		localesDir + "/es-ES.json": `{
+			"command.roll.description": "¡Diversión tirando dados!",
+			"command.roll.custom.dice-count.name": "cantidad-de-dados"
+		}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original := rollCmdDefinition()
+	roll := localizeCommand(original)
+	if roll.DescriptionLocalizations == nil || (*roll.DescriptionLocalizations)[discordgo.SpanishES] != "¡Diversión tirando dados!" {
+		t.Errorf("description was not localized: %+v", roll.DescriptionLocalizations)
+	}
+	if got := roll.Options[1].Options[0].NameLocalizations[discordgo.SpanishES]; got != "cantidad-de-dados" {
+		t.Errorf("nested option name was not localized, got %q", got)
+	}
+	if original.DescriptionLocalizations != nil || original.Options[1].Options[0].NameLocalizations != nil {
+		t.Errorf("original definition was modified")
+	}
+}
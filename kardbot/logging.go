@@ -0,0 +1,57 @@
+package kardbot
+
+import (
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// Fields added to log lines written on behalf of an interaction.
+const (
+	logFieldInteraction = "interaction-id"
+	logFieldCommand     = "command"
+	logFieldGuild       = "guild-id"
+	logFieldChannel     = "channel-id"
+	logFieldUser        = "user-id"
+	logFieldErrorReport = "error-report"
+)
+
+// logFor returns a logger that tags every line with the interaction it
+// was written for, so that lines from concurrent handlers can be told apart.
+// Handlers should log through it rather than through the package-level logger.
+func logFor(i *discordgo.InteractionCreate) *log.Entry {
+	if i == nil || i.Interaction == nil {
+		return log.NewEntry(log.StandardLogger())
+	}
+
+	fields := log.Fields{logFieldInteraction: i.ID}
+	if cmd := interactionName(i); cmd != "" {
+		fields[logFieldCommand] = cmd
+	}
+	if i.GuildID != "" {
+		fields[logFieldGuild] = i.GuildID
+	}
+	if i.ChannelID != "" {
+		fields[logFieldChannel] = i.ChannelID
+	}
+	if i.Member != nil && i.Member.User != nil {
+		fields[logFieldUser] = i.Member.User.ID
+	} else if i.User != nil {
+		fields[logFieldUser] = i.User.ID
+	}
+	return log.WithFields(fields)
+}
+
+// interactionName returns the command name or custom ID that an
+// interaction was issued for.
+func interactionName(i *discordgo.InteractionCreate) string {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand, discordgo.InteractionApplicationCommandAutocomplete:
+		return i.ApplicationCommandData().Name
+	case discordgo.InteractionMessageComponent:
+		return i.MessageComponentData().CustomID
+	case discordgo.InteractionModalSubmit:
+		return i.ModalSubmitData().CustomID
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,47 @@
+package kardbot
+
+import (
+	"errors"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestErrorReportIsLoggedWithInteractionFields(t *testing.T) {
+	fake := newTestBot(t)
+	hook := test.NewLocal(log.StandardLogger())
+	t.Cleanup(hook.Reset)
+	prevOwner := getOwnerID
+	getOwnerID = func() string { return testSelf.ID }
+	t.Cleanup(func() { getOwnerID = prevOwner })
+
+	i := fake.Command(pollCmd, nil, inTestGuild()...)
+	interactionRespondEphemeralError(fake, i, true, errors.New("kaboom"))
+
+	var entry *log.Entry
+	for _, e := range hook.AllEntries() {
+		if _, ok := e.Data[logFieldErrorReport]; ok {
+			entry = e
+		}
+	}
+	if entry == nil {
+		t.Fatal("error report was not logged")
+	}
+
+	want := map[string]string{
+		logFieldInteraction: i.ID,
+		logFieldCommand:     pollCmd,
+		logFieldGuild:       testGuildID,
+		logFieldChannel:     testChannelID,
+		logFieldUser:        testUser.ID,
+	}
+	for field, val := range want {
+		if entry.Data[field] != val {
+			t.Errorf("%s = %v, want %s", field, entry.Data[field], val)
+		}
+	}
+	if _, ok, _ := loadErrorReport(entry.Data[logFieldErrorReport].(string)); !ok {
+		t.Errorf("logged report ID %v does not match any error report", entry.Data[logFieldErrorReport])
+	}
+}
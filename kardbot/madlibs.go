@@ -1,7 +1,9 @@
 package kardbot
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -22,32 +24,65 @@ type madlibConfig struct {
 	ModelMask string `json:"model-mask,omitempty"`
 }
 
-var madlibCfg = madlibConfig{
+var defaultMadlibConfig = madlibConfig{
 	Model:     "roberta-base", // https://huggingface.co/roberta-base
 	ModelMask: "<mask>",
 }
 
+var madlibCfg hotConfig[madlibConfig]
+
 func init() {
+	registerCommand(&command{
+		name:       madlibCmd,
+		definition: madlibCmdDefinition,
+		handler:    handleMadLibCmd,
+	})
+}
+
+func madlibCmdDefinition() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        madlibCmd,
+		Description: "The bot will fill in any blanks indicated with " + madlibBlank,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "prompt",
+				Description: fmt.Sprintf("An input prompt containing blanks. Example: 'The %s jumps over the %s.'", madlibBlank, madlibBlank),
+				Required:    true,
+			},
+		},
+	}
+}
+
+func parseMadlibConfig() (func(), error) {
 	jsonCfg, err := config.NewJsonConfig(madlibConfigFile)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	err = json.Unmarshal(jsonCfg.Raw, &madlibCfg)
+	cfg := defaultMadlibConfig
+	err = json.Unmarshal(jsonCfg.Raw, &cfg)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+
+	if cfg.Model == "" || cfg.ModelMask == "" {
+		return nil, errors.New("madlib model and model mask must not be empty")
 	}
 
-	log.Infof("Madlib using %s with mask=%s", madlibCfg.Model, madlibCfg.ModelMask)
+	return func() {
+		madlibCfg.Store(cfg)
+		log.Infof("Madlib using %s with mask=%s", cfg.Model, cfg.ModelMask)
+	}, nil
 }
 
-func handleMadLibCmd(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func handleMadLibCmd(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	if isSelf, err := authorIsSelf(s, i); err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	} else if isSelf {
-		log.Trace("Ignoring message from self")
+		logFor(i).Trace("Ignoring message from self")
 		return
 	}
 
@@ -66,25 +101,26 @@ func handleMadLibCmd(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
 
-	input := strings.ReplaceAll(i.ApplicationCommandData().Options[0].StringValue(), madlibBlank, madlibCfg.ModelMask)
-	resp, err := hfapigo.SendFillMaskRequest(madlibCfg.Model, &hfapigo.FillMaskRequest{
+	cfg := madlibCfg.Load()
+	input := strings.ReplaceAll(i.ApplicationCommandData().Options[0].StringValue(), madlibBlank, cfg.ModelMask)
+	resp, err := fillMaskRequest(ctx, cfg.Model, &hfapigo.FillMaskRequest{
 		Inputs:  []string{input},
 		Options: *hfapigo.NewOptions().SetWaitForModel(true),
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 		return
 	}
 
 	if len(resp) < strings.Count(i.ApplicationCommandData().Options[0].StringValue(), madlibBlank) {
 		err := fmt.Errorf("too few responses received")
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 		return
 	}
@@ -93,18 +129,18 @@ func handleMadLibCmd(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	for _, mask := range resp {
 		if len(mask.Masks) == 0 {
 			err := fmt.Errorf("received empty response")
-			log.Error(err)
+			logFor(i).Error(err)
 			interactionFollowUpEphemeralError(s, i, true, err)
 			return
 		}
-		output = strings.Replace(output, madlibCfg.ModelMask, strings.TrimSpace(mask.Masks[0].TokenStr), 1)
+		output = strings.Replace(output, cfg.ModelMask, strings.TrimSpace(mask.Masks[0].TokenStr), 1)
 	}
 
 	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
 		Content: &output,
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 	}
 }
@@ -1,15 +1,19 @@
 package kardbot
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/Kardbord/Kard-bot/kardbot/dg_helpers"
 	"github.com/Kardbord/imgflipgo/v2"
 	"github.com/Kardbord/ubiquity/mathutils"
+	"github.com/Kardbord/ubiquity/stringutils"
 	"github.com/bwmarrin/discordgo"
 	log "github.com/sirupsen/logrus"
 )
@@ -37,8 +41,27 @@ const (
 	fontOptIdx  = 4 // as this is not a required opt, this index is only guaranteed when registering the command, not when handling it
 
 	reservedOptCount = 5
+
+	memeMessageMenu = "Make a meme from this"
+
+	memeFormID        = "meme-form"
+	memeFormTemplate  = "template"
+	memeFormTextBoxes = "text-boxes"
 )
 
+// memeForm captions a template with the text of a message, one text box
+// per line.
+var memeForm = &modalForm{
+	id:      memeFormID,
+	title:   "Make a meme",
+	command: memeCommand,
+	fields: []formField{
+		{id: memeFormTemplate, label: "Template", placeholder: "Drake Hotline Bling", required: true, maxLength: maxDiscordSelectMenuOptionChars},
+		{id: memeFormTextBoxes, label: "Text boxes, one per line", paragraph: true, required: true},
+	},
+	submit: submitMemeForm,
+}
+
 var memeCommandRegex = func() *regexp.Regexp { return nil }
 
 func init() {
@@ -51,21 +74,39 @@ func init() {
 	}
 }
 
+func init() {
+	registerCommand(&command{
+		name: memeCommand,
+		// memeCommands is replaced once the templates are fetched,
+		// so it must not be captured here.
+		definitions: func() []*discordgo.ApplicationCommand { return memeCommands() },
+		matches:     strMatchesMemeCmdPattern,
+		handler:     buildAMeme,
+		contextMenus: []contextMenu{
+			{name: memeMessageMenu, target: discordgo.MessageApplicationCommand, handler: memeFromMessage},
+		},
+		components: []interactionRoute{memeFormRetry},
+		modals:     []interactionRoute{memeFormModal},
+	})
+}
+
+var memeFormModal, memeFormRetry = memeForm.routes()
+
 func strMatchesMemeCmdPattern(str string) bool {
 	return memeCommandRegex().MatchString(str)
 }
 
 var (
 	// Meme.ID to Meme mapping
-	memeTemplates func() map[string]imgflipgo.Meme
+	memeTemplates = func() map[string]imgflipgo.Meme { return nil }
 
-	memeCommands func() []*discordgo.ApplicationCommand
+	memeCommands = func() []*discordgo.ApplicationCommand { return nil }
 )
 
-func init() {
+func loadMemeTemplates() error {
 	memes, err := imgflipgo.GetMemes()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	memeMap := make(map[string]imgflipgo.Meme, len(memes))
@@ -89,6 +130,7 @@ func init() {
 	memeCommands = func() []*discordgo.ApplicationCommand {
 		return memecmds
 	}
+	return nil
 }
 
 func buildMemeCommands() []*discordgo.ApplicationCommand {
@@ -204,7 +246,7 @@ func buildMemeCommands() []*discordgo.ApplicationCommand {
 	return allcmds
 }
 
-func buildAMeme(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func buildAMeme(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	var flags discordgo.MessageFlags = 0
 	isPreview := i.ApplicationCommandData().Options[previewOptIdx].BoolValue()
 	if isPreview {
@@ -217,7 +259,7 @@ func buildAMeme(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		},
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
@@ -225,7 +267,7 @@ func buildAMeme(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	template, ok := memeTemplates()[i.ApplicationCommandData().Options[templateOptIdx].StringValue()]
 	if !ok {
 		errmsg := fmt.Sprintf("Error! No template found with name %s", i.ApplicationCommandData().Options[0].Name)
-		log.Error(errmsg)
+		logFor(i).Error(errmsg)
 		interactionFollowUpEphemeralError(s, i, true, errors.New(errmsg))
 		return
 	}
@@ -248,7 +290,7 @@ func buildAMeme(s *discordgo.Session, i *discordgo.InteractionCreate) {
 				tmp := uint(mfs)
 				maxFontSize = &tmp
 			} else {
-				log.Warn("font size cannot be <= 0")
+				logFor(i).Warn("font size cannot be <= 0")
 				maxFontSize = nil
 			}
 		case fontOpt:
@@ -257,12 +299,12 @@ func buildAMeme(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		default:
 			boxIdx, err := strconv.Atoi(arg.Name)
 			if err != nil {
-				log.Error(err)
+				logFor(i).Error(err)
 				interactionFollowUpEphemeralError(s, i, true, err)
 				return
 			}
 			if boxIdx >= len(boxes) {
-				log.Debugf("This template has less than %d boxes, skipping...", boxIdx)
+				logFor(i).Debugf("This template has less than %d boxes, skipping...", boxIdx)
 				continue
 			}
 			boxes[boxIdx].Text = arg.StringValue()
@@ -279,8 +321,73 @@ func buildAMeme(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		}
 	}
 
+	postMeme(s, i, template, boxes, maxFontSize, font)
+}
+
+// memeFromMessage opens memeForm with the text of the message a context
+// menu was used on.
+func memeFromMessage(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
+	msg, err := targetMessage(i)
+	if err != nil {
+		logFor(i).Error(err)
+		interactionRespondEphemeralError(s, i, true, err)
+		return
+	}
+	memeForm.open(s, i, formValues{memeFormTextBoxes: stringutils.FirstN(msg.Content, maxDiscordTextInputLength)})
+}
+
+func submitMemeForm(s discordSession, i *discordgo.InteractionCreate, values formValues, _ *discordgo.InteractionCreate) error {
+	template, err := findMemeTemplate(values[memeFormTemplate])
+	if err != nil {
+		return err
+	}
+	lines := values.lines(memeFormTextBoxes)
+	if uint(len(lines)) > template.BoxCount {
+		return fmt.Errorf("%s has %d text boxes, but you entered %d lines", template.Name, template.BoxCount, len(lines))
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		logFor(i).Error(err)
+		interactionRespondEphemeralError(s, i, true, err)
+		return nil
+	}
+
+	boxes := make([]imgflipgo.TextBox, template.BoxCount)
+	for idx := range boxes {
+		boxes[idx].Text = " "
+		if idx < len(lines) {
+			boxes[idx].Text = lines[idx]
+		}
+	}
+	postMeme(s, i, template, boxes, nil, nil)
+	return nil
+}
+
+// findMemeTemplate returns the template whose name is closest to name.
+func findMemeTemplate(name string) (imgflipgo.Meme, error) {
+	names := make([]string, 0, len(memeTemplates()))
+	byName := make(map[string]imgflipgo.Meme, len(memeTemplates()))
+	for _, template := range memeTemplates() {
+		if strings.EqualFold(template.Name, name) {
+			return template, nil
+		}
+		names = append(names, template.Name)
+		byName[template.Name] = template
+	}
+	sort.Strings(names)
+	if match := fuzzyMatch(name, names, 1); len(match) == 1 {
+		return byName[match[0]], nil
+	}
+	return imgflipgo.Meme{}, fmt.Errorf("no meme template found matching %q", name)
+}
+
+// postMeme captions template and edits the deferred response to i with the result.
+func postMeme(s discordSession, i *discordgo.InteractionCreate, template imgflipgo.Meme, boxes []imgflipgo.TextBox, maxFontSize *uint, font *imgflipgo.Font) {
 	if font != nil {
-		log.Debugf("Using %s", *font)
+		logFor(i).Debugf("Using %s", *font)
 	}
 	resp, err := imgflipgo.CaptionImage(&imgflipgo.CaptionRequest{
 		TemplateID:    template.ID,
@@ -291,7 +398,7 @@ func buildAMeme(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		TextBoxes:     boxes,
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 		return
 	}
@@ -305,7 +412,7 @@ func buildAMeme(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		Embeds: &[]*discordgo.MessageEmbed{embed.MessageEmbed},
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 	}
 }
@@ -0,0 +1,256 @@
+package kardbot
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Kardbord/Kard-bot/kardbot/jobqueue"
+	"github.com/bwmarrin/discordgo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "kardbot"
+
+// Outcomes of an interaction, used to label interaction metrics.
+const (
+	outcomeOK           = "ok"
+	outcomeRejected     = "rejected"
+	outcomeUnhandled    = "unhandled"
+	outcomeShuttingDown = "shutting-down"
+	outcomePanic        = "panic"
+	outcomeBusy         = "busy"
+	outcomeTimedOut     = "timed-out"
+)
+
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	interactionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "interactions_total",
+		Help:      "Interactions received, by type, command, and outcome.",
+	}, []string{"type", "command", "outcome"})
+
+	interactionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "interaction_handler_duration_seconds",
+		Help:      "Time spent in interaction handlers, by type and command.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"type", "command"})
+
+	interactionErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "interaction_error_responses_total",
+		Help:      "Error responses sent to users.",
+	})
+
+	discordRequestFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "discord_rest_failures_total",
+		Help:      `Failed Discord REST requests, by HTTP status code ("error" if no response was received).`,
+	}, []string{"status"})
+
+	cronRunsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cron_job_runs_total",
+		Help:      "Scheduled cron job runs, by job.",
+	}, []string{"job"})
+
+	cronFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cron_job_failures_total",
+		Help:      "Scheduled cron job runs that returned an error, by job.",
+	}, []string{"job"})
+
+	outboundRetriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "outbound_request_retries_total",
+		Help:      `Outbound HTTP requests retried, by host and HTTP status code ("error" if no response was received).`,
+	}, []string{"host", "reason"})
+
+	queuedJobRunsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "queued_job_runs_total",
+		Help:      "Queued job attempts, by job type.",
+	}, []string{"type"})
+
+	queuedJobFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "queued_job_failures_total",
+		Help:      "Queued job attempts that returned an error, by job type.",
+	}, []string{"type"})
+
+	panicsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "background_panics_total",
+		Help:      "Panics recovered in cron jobs and goroutines, by job or goroutine. Interaction panics are counted by interactions_total.",
+	}, []string{"source"})
+
+	circuitBreakerTripsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "circuit_breaker_trips_total",
+		Help:      "Times a command was switched off after panicking repeatedly, by command.",
+	}, []string{"command"})
+
+	handlerPoolRejectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "handler_pool_rejections_total",
+		Help:      "Interactions turned away because every handler worker was busy and the queue was full, by type.",
+	}, []string{"type"})
+
+	alertsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "alerts_total",
+		Help:      `Alerts raised, by severity and outcome ("sent", "failed", "aggregated", "rate-limited", or "below-threshold").`,
+	}, []string{"severity", "outcome"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		interactionsTotal,
+		interactionDuration,
+		interactionErrorsTotal,
+		discordRequestFailuresTotal,
+		outboundRetriesTotal,
+		cronRunsTotal,
+		cronFailuresTotal,
+		queuedJobRunsTotal,
+		queuedJobFailuresTotal,
+		panicsTotal,
+		circuitBreakerTripsTotal,
+		handlerPoolRejectionsTotal,
+		alertsTotal,
+		stateCollector{},
+	)
+}
+
+// MetricsHandler serves the bot's metrics in the Prometheus exposition format.
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// interactionTypeLabel names an interaction type for use as a metric label.
+func interactionTypeLabel(t discordgo.InteractionType) string {
+	switch t {
+	case discordgo.InteractionApplicationCommand:
+		return "command"
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		return "autocomplete"
+	case discordgo.InteractionMessageComponent:
+		return "component"
+	case discordgo.InteractionModalSubmit:
+		return "modal"
+	default:
+		return "unknown"
+	}
+}
+
+// meteredTransport counts failed Discord REST requests.
+type meteredTransport struct {
+	next http.RoundTripper
+}
+
+func (t meteredTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		discordRequestFailuresTotal.WithLabelValues("error").Inc()
+	} else if resp.StatusCode >= http.StatusBadRequest {
+		discordRequestFailuresTotal.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
+	}
+	return resp, err
+}
+
+// meterClient wraps an HTTP client's transport with meteredTransport.
+func meterClient(c *http.Client) {
+	next := c.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	c.Transport = meteredTransport{next: next}
+}
+
+// meterJob wraps a queued job handler so that its attempts are counted.
+func meterJob(jobType string, h jobqueue.Handler) jobqueue.Handler {
+	return func(ctx context.Context, job jobqueue.Job) error {
+		queuedJobRunsTotal.WithLabelValues(jobType).Inc()
+		err := h(ctx, job)
+		if err != nil {
+			queuedJobFailuresTotal.WithLabelValues(jobType).Inc()
+		}
+		return err
+	}
+}
+
+// observeInteraction records the outcome of an interaction and,
+// if a handler ran, how long it took.
+func observeInteraction(typ, command, outcome string, start time.Time, handled bool) {
+	interactionsTotal.WithLabelValues(typ, command, outcome).Inc()
+	if handled {
+		interactionDuration.WithLabelValues(typ, command).Observe(time.Since(start).Seconds())
+	}
+}
+
+var (
+	serverClockErrorsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "server_clock_errors"),
+		"Consecutive failed updates of each server clock.",
+		[]string{"guild_id"}, nil,
+	)
+	activePollsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "active_polls"),
+		"Polls that are still accepting votes.",
+		nil, nil,
+	)
+	subscribersDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "subscribers"),
+		"Users subscribed to each kind of DM.",
+		[]string{"subscription"}, nil,
+	)
+)
+
+// stateCollector reports gauges read from bot state at scrape time.
+type stateCollector struct{}
+
+func (stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- serverClockErrorsDesc
+	ch <- activePollsDesc
+	ch <- subscribersDesc
+}
+
+func (stateCollector) Collect(ch chan<- prometheus.Metric) {
+	serverClocksMapMutex.RLock()
+	for guildID, clock := range serverClocksMap {
+		errCount := atomic.LoadUint32(&clock.ErrCount)
+		ch <- prometheus.MustNewConstMetric(serverClockErrorsDesc, prometheus.GaugeValue, float64(errCount), guildID)
+	}
+	serverClocksMapMutex.RUnlock()
+
+	ch <- prometheus.MustNewConstMetric(activePollsDesc, prometheus.GaugeValue, float64(polls.Count()))
+
+	ch <- prometheus.MustNewConstMetric(subscribersDesc, prometheus.GaugeValue,
+		float64(countSubscribers(&complimentSubsAMMutex, &complimentSubsAM)), "compliments-morning")
+	ch <- prometheus.MustNewConstMetric(subscribersDesc, prometheus.GaugeValue,
+		float64(countSubscribers(&complimentSubsPMMutex, &complimentSubsPM)), "compliments-evening")
+	ch <- prometheus.MustNewConstMetric(subscribersDesc, prometheus.GaugeValue,
+		float64(countSubscribers(&creepyDMSubsMutex, &creepyDMSubs)), "creepy-dms")
+}
+
+func countSubscribers(mutex *sync.RWMutex, subs *map[string]bool) int {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	n := 0
+	for _, subbed := range *subs {
+		if subbed {
+			n++
+		}
+	}
+	return n
+}
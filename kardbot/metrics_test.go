@@ -0,0 +1,39 @@
+package kardbot
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrapeMetrics(t *testing.T) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(rec.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestMetricsCountInteractionOutcomes(t *testing.T) {
+	fake := newTestBot(t)
+
+	i := fake.Command(logLevelCmd, nil, inTestGuild()...)
+	bot().routeInteraction(fake, i)
+	mustRespond(t, fake, i)
+
+	metrics := scrapeMetrics(t)
+	for _, want := range []string{
+		`kardbot_interactions_total{command="loglevel",outcome="rejected",type="command"}`,
+		`kardbot_interaction_error_responses_total`,
+		`kardbot_active_polls`,
+		`kardbot_subscribers{subscription="creepy-dms"}`,
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("metrics are missing %s", want)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package kardbot
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/uuid"
+	cmap "github.com/orcaman/concurrent-map/v2"
+)
+
+// Discord's limits on modals.
+// See https://discord.com/developers/docs/interactions/message-components#text-inputs
+const (
+	maxDiscordModalTitle           = 45
+	maxDiscordModalInputs          = 5
+	maxDiscordTextInputLabel       = 45
+	maxDiscordTextInputPlaceholder = 100
+	maxDiscordTextInputLength      = 4000
+)
+
+// A text input in a modalForm.
+type formField struct {
+	// Also the key of the field in formValues.
+	id          string
+	label       string
+	placeholder string
+	// Multi-line if true.
+	paragraph bool
+	required  bool
+	// Defaults to maxDiscordTextInputLength.
+	maxLength int
+}
+
+// formValues maps the id of each formField to the text that was entered.
+type formValues map[string]string
+
+// lines returns the non-blank lines of a field, with surrounding whitespace removed.
+func (v formValues) lines(id string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(v[id], "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// options converts the non-blank fields to string options, for handlers
+// that were written against slash command options.
+func (v formValues) options() []*discordgo.ApplicationCommandInteractionDataOption {
+	opts := []*discordgo.ApplicationCommandInteractionDataOption{}
+	for id, value := range v {
+		if value = strings.TrimSpace(value); value != "" {
+			opts = append(opts, &discordgo.ApplicationCommandInteractionDataOption{
+				Name:  id,
+				Type:  discordgo.ApplicationCommandOptionString,
+				Value: value,
+			})
+		}
+	}
+	return opts
+}
+
+// modalForm collects input for a command that is too long or too
+// structured for slash command options, such as one poll option per line.
+//
+// A submission that fails validation is answered with the problem and a
+// button that reopens the form with everything the user entered, so
+// nothing has to be typed twice.
+type modalForm struct {
+	// Prefix of the custom IDs of the modal and its retry button.
+	id      string
+	title   string
+	command string
+	fields  []formField
+	// Acts on a submission. origin is the interaction that opened the
+	// form. A non-nil error means the input must be corrected, and must
+	// be returned before submit responds to the interaction; any other
+	// failure should be reported by submit itself.
+	submit func(s discordSession, i *discordgo.InteractionCreate, values formValues, origin *discordgo.InteractionCreate) error
+}
+
+// A form that has been opened but not yet successfully submitted.
+type formSession struct {
+	origin  *discordgo.InteractionCreate
+	values  formValues
+	expires time.Time
+}
+
+// How long an open form is remembered. Discord doesn't tell us when a
+// user dismisses a modal.
+const formSessionTTL = time.Hour
+
+// Open forms.
+// Key: session ID, the suffix of the modal's custom ID
+// Val: formSession
+var formSessions = cmap.New[formSession]()
+
+func sweepFormSessions() {
+	now := time.Now()
+	for key, session := range formSessions.Items() {
+		if now.After(session.expires) {
+			formSessions.Remove(key)
+		}
+	}
+}
+
+func (f *modalForm) has(fieldID string) bool {
+	for _, field := range f.fields {
+		if field.id == fieldID {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *modalForm) modalID(sessionID string) string { return f.id + ":" + sessionID }
+func (f *modalForm) retryID(sessionID string) string { return f.id + "-retry:" + sessionID }
+
+// modal builds the form for a user in locale. Its title, labels, and
+// placeholders are translated by catalog keys built by formLocalizationKey.
+func (f *modalForm) modal(locale discordgo.Locale, sessionID string, values formValues) *discordgo.InteractionResponse {
+	rows := make([]discordgo.MessageComponent, 0, len(f.fields))
+	for _, field := range f.fields {
+		style := discordgo.TextInputShort
+		if field.paragraph {
+			style = discordgo.TextInputParagraph
+		}
+		maxLength := field.maxLength
+		if maxLength == 0 {
+			maxLength = maxDiscordTextInputLength
+		}
+		rows = append(rows, discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.TextInput{
+					CustomID:    field.id,
+					Label:       translateForm(locale, formLocalizationKey(f.id, field.id, "label"), field.label),
+					Style:       style,
+					Placeholder: translateForm(locale, formLocalizationKey(f.id, field.id, "placeholder"), field.placeholder),
+					Value:       values[field.id],
+					Required:    field.required,
+					MaxLength:   maxLength,
+				},
+			},
+		})
+	}
+	return &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID:   f.modalID(sessionID),
+			Title:      translateForm(locale, formLocalizationKey(f.id, "title"), f.title),
+			Components: rows,
+		},
+	}
+}
+
+// open responds to i with the form, filled in with values if any.
+func (f *modalForm) open(s discordSession, i *discordgo.InteractionCreate, values formValues) {
+	sweepFormSessions()
+	sessionID := uuid.NewString()
+	formSessions.Set(sessionID, formSession{origin: i, values: values, expires: time.Now().Add(formSessionTTL)})
+
+	if err := s.InteractionRespond(i.Interaction, f.modal(i.Locale, sessionID, values)); err != nil {
+		formSessions.Remove(sessionID)
+		logFor(i).Error(err)
+		interactionRespondEphemeralError(s, i, true, err)
+	}
+}
+
+// routes returns the routes for the form's modal and retry button. The
+// modal route belongs in a command's modals, the other in its components.
+func (f *modalForm) routes() (modal, retry interactionRoute) {
+	modal = interactionRoute{
+		pattern: regexp.MustCompile("^" + regexp.QuoteMeta(f.id) + ":"),
+		handler: f.handleSubmit,
+	}
+	retry = interactionRoute{
+		pattern: regexp.MustCompile("^" + regexp.QuoteMeta(f.id) + "-retry:"),
+		handler: f.handleRetry,
+	}
+	return modal, retry
+}
+
+// session returns the session ID in a custom ID built by modalID or
+// retryID, and the session if it hasn't expired.
+func (f *modalForm) session(customID string) (string, formSession, bool) {
+	_, sessionID, _ := strings.Cut(customID, ":")
+	session, ok := formSessions.Get(sessionID)
+	if !ok || time.Now().After(session.expires) {
+		return sessionID, formSession{}, false
+	}
+	return sessionID, session, true
+}
+
+func (f *modalForm) handleSubmit(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
+	sessionID, session, ok := f.session(i.ModalSubmitData().CustomID)
+	if !ok {
+		interactionRespondEphemeralError(s, i, false, errors.New(localized(i, msgFormExpired, f.command)))
+		return
+	}
+
+	values := submittedValues(i.ModalSubmitData().Components)
+	err := f.submit(s, i, values, session.origin)
+	if err == nil {
+		formSessions.Remove(sessionID)
+		return
+	}
+
+	session.values = values
+	session.expires = time.Now().Add(formSessionTTL)
+	formSessions.Set(sessionID, session)
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: err.Error(),
+			Flags:   discordgo.MessageFlagsEphemeral,
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.Button{
+							Label:    localized(i, msgFormRetry),
+							Style:    discordgo.PrimaryButton,
+							Emoji:    discordgo.ComponentEmoji{Name: "✏️"},
+							CustomID: f.retryID(sessionID),
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		logFor(i).Error(err)
+	}
+}
+
+// handleRetry reopens the form with the values from the last failed submission.
+func (f *modalForm) handleRetry(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
+	sessionID, session, ok := f.session(i.MessageComponentData().CustomID)
+	if !ok {
+		interactionRespondEphemeralError(s, i, false, errors.New(localized(i, msgFormExpired, f.command)))
+		return
+	}
+	if err := s.InteractionRespond(i.Interaction, f.modal(i.Locale, sessionID, session.values)); err != nil {
+		logFor(i).Error(err)
+		interactionRespondEphemeralError(s, i, true, err)
+	}
+}
+
+// submittedValues collects the text inputs of a modal submission.
+func submittedValues(rows []discordgo.MessageComponent) formValues {
+	values := formValues{}
+	for _, row := range rows {
+		actionsRow, ok := row.(*discordgo.ActionsRow)
+		if !ok {
+			continue
+		}
+		for _, c := range actionsRow.Components {
+			if input, ok := c.(*discordgo.TextInput); ok {
+				values[input.CustomID] = input.Value
+			}
+		}
+	}
+	return values
+}
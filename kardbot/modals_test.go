@@ -0,0 +1,110 @@
+package kardbot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Kardbord/Kard-bot/kardbot/fakediscord"
+	"github.com/bwmarrin/discordgo"
+)
+
+// openedForm returns the custom ID of the modal that i was answered with.
+func openedForm(t *testing.T, fake *fakediscord.Session, i *discordgo.InteractionCreate) string {
+	t.Helper()
+	resp := mustRespond(t, fake, i)
+	if resp.Initial.Type != discordgo.InteractionResponseModal {
+		t.Fatalf("expected a modal, got response type %d", resp.Initial.Type)
+	}
+	return resp.Initial.Data.CustomID
+}
+
+// submitForm routes a submission of the modal with the given custom ID.
+func submitForm(fake *fakediscord.Session, customID string, values map[string]string) *discordgo.InteractionCreate {
+	inputs := []discordgo.MessageComponent{}
+	for id, value := range values {
+		inputs = append(inputs, fakediscord.TextInput(id, value))
+	}
+	i := fake.Modal(customID, inputs, inTestGuild()...)
+	bot().routeInteraction(fake, i)
+	return i
+}
+
+func TestFormsWithinDiscordLimits(t *testing.T) {
+	for _, f := range []*modalForm{pollForm, embedForm, roleSelectMenuForm, memeForm, reportForm} {
+		if len(f.title) > maxDiscordModalTitle {
+			t.Errorf("%s: title is longer than %d characters", f.id, maxDiscordModalTitle)
+		}
+		if len(f.fields) > maxDiscordModalInputs {
+			t.Errorf("%s: has more than %d fields", f.id, maxDiscordModalInputs)
+		}
+		for _, field := range f.fields {
+			if len(field.label) > maxDiscordTextInputLabel {
+				t.Errorf("%s.%s: label %q is longer than %d characters", f.id, field.id, field.label, maxDiscordTextInputLabel)
+			}
+			if field.maxLength > maxDiscordTextInputLength {
+				t.Errorf("%s.%s: max length is over %d", f.id, field.id, maxDiscordTextInputLength)
+			}
+		}
+		if modal, retry := f.routes(); !modal.matches(f.modalID("x")) || !retry.matches(f.retryID("x")) || modal.matches(f.retryID("x")) {
+			t.Errorf("%s: routes don't match the form's custom IDs", f.id)
+		}
+	}
+}
+
+func TestFormRetryKeepsValues(t *testing.T) {
+	fake := newTestBot(t)
+	open := fake.Command(pollCmd, nil, inTestGuild()...)
+	bot().routeInteraction(fake, open)
+	modalID := openedForm(t, fake, open)
+
+	values := map[string]string{
+		pollFormFieldTitle:    "Lunch?",
+		pollFormFieldOptions:  "Tacos\nPizza",
+		pollFormFieldMaxVotes: "lots",
+	}
+	submit := submitForm(fake, modalID, values)
+	resp := mustRespond(t, fake, submit)
+	if !isEphemeral(resp) || !strings.Contains(resp.Initial.Data.Content, "whole number") {
+		t.Fatalf("expected an ephemeral validation error, got %+v", resp.Initial.Data)
+	}
+	if polls.Count() != 0 {
+		t.Fatal("no poll should have been created")
+	}
+
+	button := resp.Initial.Data.Components[0].(discordgo.ActionsRow).Components[0].(discordgo.Button)
+	retry := fake.Component(button.CustomID, discordgo.ButtonComponent, nil, inTestGuild()...)
+	bot().routeInteraction(fake, retry)
+	if id := openedForm(t, fake, retry); id != modalID {
+		t.Errorf("retry opened %s, want %s", id, modalID)
+	}
+	for _, row := range fake.Response(retry.ID).Initial.Data.Components {
+		input := row.(discordgo.ActionsRow).Components[0].(discordgo.TextInput)
+		if input.Value != values[input.CustomID] {
+			t.Errorf("%s was reopened with %q, want %q", input.CustomID, input.Value, values[input.CustomID])
+		}
+	}
+
+	values[pollFormFieldMaxVotes] = "2"
+	submit = submitForm(fake, modalID, values)
+	msg, err := fake.InteractionResponse(submit.Interaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { polls.Remove(msg.ID) })
+	if !polls.Has(msg.ID) {
+		t.Error("the corrected submission did not create a poll")
+	}
+	if formSessions.Has(strings.TrimPrefix(modalID, pollFormID+":")) {
+		t.Error("the form session outlived a successful submission")
+	}
+}
+
+func TestFormExpired(t *testing.T) {
+	fake := newTestBot(t)
+	i := submitForm(fake, pollForm.modalID("gone"), map[string]string{pollFormFieldTitle: "Lunch?"})
+
+	resp := mustRespond(t, fake, i)
+	if !isEphemeral(resp) || !strings.Contains(resp.Initial.Data.Content, "expired") {
+		t.Errorf("expected an ephemeral expiry notice, got %+v", resp.Initial.Data)
+	}
+}
@@ -2,6 +2,7 @@ package kardbot
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
 	"regexp"
@@ -26,13 +27,13 @@ func onCreateHandlers() []onCreateHandler {
 }
 
 var (
-	greetings []string
-	farewells []string
+	greetings hotConfig[[]string]
+	farewells hotConfig[[]string]
 )
 
 const greetingAndFarewellConfigFile = "config/greetings-farewells.json"
 
-func init() {
+func parseGreetingsAndFarewells() (func(), error) {
 	cfg := struct {
 		Greetings []string `json:"greetings"`
 		Farewells []string `json:"farewells"`
@@ -40,24 +41,25 @@ func init() {
 
 	jsonCfg, err := config.NewJsonConfig(greetingAndFarewellConfigFile)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	err = json.Unmarshal(jsonCfg.Raw, &cfg)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	greetings = cfg.Greetings
-	farewells = cfg.Farewells
-
-	if len(greetings) == 0 {
-		log.Fatal("No greetings configured.")
+	if len(cfg.Greetings) == 0 {
+		return nil, errors.New("no greetings configured")
 	}
 
-	if len(farewells) == 0 {
-		log.Fatal("No farewells configured.")
+	if len(cfg.Farewells) == 0 {
+		return nil, errors.New("no farewells configured")
 	}
+	return func() {
+		greetings.Store(cfg.Greetings)
+		farewells.Store(cfg.Farewells)
+	}, nil
 }
 
 func msgIsFromSelf(s *discordgo.Session, m *discordgo.MessageCreate) bool {
@@ -74,7 +76,11 @@ func greeting(s *discordgo.Session, m *discordgo.MessageCreate) {
 		return
 	}
 
-	greetingGroup := regexutils.BuildAltGroup(greetings...)
+	if !featureEnabled(m.GuildID, featureGreetings) {
+		return
+	}
+	greetingList := settingsFor(m.GuildID).greetings()
+	greetingGroup := regexutils.BuildAltGroup(quoteAll(greetingList)...)
 
 	matched, err := regexp.MatchString(
 		fmt.Sprintf("^(?i)%s %s[!.\\s]*$", greetingGroup, buildBotNameRegexp(s.State.User.Username, s.State.User.ID)),
@@ -89,7 +95,7 @@ func greeting(s *discordgo.Session, m *discordgo.MessageCreate) {
 		defer wg.Wait()
 		_, err := s.ChannelMessageSend(
 			m.ChannelID,
-			fmt.Sprintf("%s %s!", randomGreeting(), m.Author.Username),
+			fmt.Sprintf("%s %s!", randomEntry(greetingList), m.Author.Username),
 		)
 		if err != nil {
 			log.Error(err)
@@ -107,7 +113,11 @@ func farewell(s *discordgo.Session, m *discordgo.MessageCreate) {
 		return
 	}
 
-	farewellGroup := regexutils.BuildAltGroup(farewells...)
+	if !featureEnabled(m.GuildID, featureGreetings) {
+		return
+	}
+	farewellList := settingsFor(m.GuildID).farewells()
+	farewellGroup := regexutils.BuildAltGroup(quoteAll(farewellList)...)
 
 	matched, err := regexp.MatchString(
 		fmt.Sprintf("^(?i)%s %s[!.\\s]*$", farewellGroup, buildBotNameRegexp(s.State.User.Username, s.State.User.ID)),
@@ -122,7 +132,7 @@ func farewell(s *discordgo.Session, m *discordgo.MessageCreate) {
 		defer wg.Wait()
 		_, err := s.ChannelMessageSend(
 			m.ChannelID,
-			fmt.Sprintf("%s %s!", randomFarewell(), m.Author.Username),
+			fmt.Sprintf("%s %s!", randomEntry(farewellList), m.Author.Username),
 		)
 		if err != nil {
 			log.Error(err)
@@ -130,10 +140,16 @@ func farewell(s *discordgo.Session, m *discordgo.MessageCreate) {
 	}
 }
 
-func randomGreeting() string {
-	return greetings[rand.Intn(len(greetings))]
+func randomEntry(list []string) string {
+	return list[rand.Intn(len(list))]
 }
 
-func randomFarewell() string {
-	return farewells[rand.Intn(len(farewells))]
+// quoteAll escapes regex metacharacters in each string, since greetings
+// and farewells may be supplied by guild admins.
+func quoteAll(strs []string) []string {
+	quoted := make([]string, len(strs))
+	for idx, str := range strs {
+		quoted[idx] = regexp.QuoteMeta(str)
+	}
+	return quoted
 }
@@ -0,0 +1,249 @@
+package kardbot
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// Tags log lines for panics recovered outside of an interaction with the
+// job or goroutine they came from.
+const logFieldPanicSource = "panic-source"
+
+// panicError is a recovered panic, kept with enough context to be
+// reported like any other error.
+type panicError struct {
+	value any
+	stack string
+	// Where the panic was raised.
+	file string
+	line int
+}
+
+func (e *panicError) Error() string { return fmt.Sprintf("panic: %v", e.value) }
+
+// Lets errors.Is and errors.As see through panic(err).
+func (e *panicError) Unwrap() error {
+	err, _ := e.value.(error)
+	return err
+}
+
+// newPanicError must be called from the deferred function that recovered r,
+// while the panicking stack is still intact.
+func newPanicError(r any) *panicError {
+	e := &panicError{value: r, stack: string(debug.Stack())}
+	e.file, e.line = panicSite()
+	return e
+}
+
+// panicSite finds the first frame outside the runtime below runtime.gopanic.
+func panicSite() (string, int) {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	panicking := false
+	for {
+		frame, more := frames.Next()
+		if panicking && !strings.HasPrefix(frame.Function, "runtime.") {
+			return frame.File, frame.Line
+		}
+		if frame.Function == "runtime.gopanic" {
+			panicking = true
+		}
+		if !more {
+			return "unknown", 0
+		}
+	}
+}
+
+// errorSite returns where err came from: the panic site for a recovered
+// panic, otherwise the caller skip frames above errorSite's caller.
+func errorSite(err error, skip int) (string, int) {
+	var pe *panicError
+	if errors.As(err, &pe) {
+		return pe.file, pe.line
+	}
+	_, file, line, ok := runtime.Caller(skip + 1)
+	if !ok {
+		log.Error("couldn't obtain stack data")
+	}
+	return file, line
+}
+
+// errorStack returns the stack trace of a recovered panic, if err is one.
+func errorStack(err error) string {
+	var pe *panicError
+	if errors.As(err, &pe) {
+		return pe.stack
+	}
+	return ""
+}
+
+// logPanic records a panic recovered outside of an interaction. source
+// labels the panic metric, so it must be one of a fixed set of names.
+// Anything that identifies a particular run, such as a guild ID, belongs
+// in fields instead.
+func logPanic(source string, fields log.Fields, err *panicError) {
+	panicsTotal.WithLabelValues(source).Inc()
+	log.WithFields(fields).WithField(logFieldPanicSource, source).Errorf("%s:%d %v\n%s", err.file, err.line, err, err.stack)
+	where := source
+	if len(fields) > 0 {
+		where = fmt.Sprintf("%s %v", source, fields)
+	}
+	raiseAlert(alert{
+		Severity:       severityError,
+		Title:          "Recovered panic",
+		Key:            "panic " + source,
+		Message:        fmt.Sprintf("`%s` panicked at %s:%d: %v", where, sourcePath(err.file), err.line, err.value),
+		AttachmentName: "stack.txt",
+		Attachment:     err.stack,
+	})
+}
+
+// recoverJob wraps a cron job so that a panic fails that run instead of
+// taking the bot down with it.
+func recoverJob(name string, job func() error) func() error {
+	return func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				pe := newPanicError(r)
+				logPanic(name, nil, pe)
+				err = pe
+			}
+		}()
+		return job()
+	}
+}
+
+// noError adapts a cron job that can't fail for recoverJob.
+func noError(job func()) func() error {
+	return func() error {
+		job()
+		return nil
+	}
+}
+
+// goSafely runs fn in a new goroutine, recovering and logging any panic.
+// Panics in goroutines can't be recovered by whoever started them, so
+// anything started from a handler or job should use this instead of go.
+// source is passed to logPanic.
+func goSafely(source string, fn func()) {
+	goSafelyWith(source, nil, fn)
+}
+
+// goSafelyWith is goSafely for goroutines with fields to log a panic with.
+func goSafelyWith(source string, fields log.Fields, fn func()) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				logPanic(source, fields, newPanicError(r))
+			}
+		}()
+		fn()
+	}()
+}
+
+// reportInteractionPanic offers the user who triggered a panic an error
+// report, whether or not the handler got as far as responding.
+func reportInteractionPanic(s discordSession, i *discordgo.InteractionCreate, err *panicError) {
+	if i.Type == discordgo.InteractionApplicationCommandAutocomplete {
+		// There is no way to respond to an autocomplete interaction with an error.
+		return
+	}
+	if _, respErr := s.InteractionResponse(i.Interaction); respErr == nil {
+		followupWithError(s, i, err, err.file, err.line)
+		return
+	}
+	interactionRespondEphemeralError(s, i, true, err)
+}
+
+// A command is switched off for breakerCooldown once it has panicked
+// breakerMaxPanics times within breakerWindow, so that a broken code
+// path can't be hammered while it is being fixed.
+const (
+	breakerMaxPanics = 3
+	breakerWindow    = 10 * time.Minute
+	breakerCooldown  = 30 * time.Minute
+)
+
+type circuitBreaker struct {
+	// Recent panics, oldest first.
+	panics    []time.Time
+	openUntil time.Time
+}
+
+var (
+	// Key: command name
+	circuitBreakers      = map[string]*circuitBreaker{}
+	circuitBreakersMutex sync.Mutex
+)
+
+// recordCommandPanic counts a panic against a command, and reports
+// whether it tripped the command's circuit breaker.
+func recordCommandPanic(command string, now time.Time) bool {
+	circuitBreakersMutex.Lock()
+	defer circuitBreakersMutex.Unlock()
+
+	b, ok := circuitBreakers[command]
+	if !ok {
+		b = &circuitBreaker{}
+		circuitBreakers[command] = b
+	}
+	recent := b.panics[:0]
+	for _, t := range b.panics {
+		if now.Sub(t) < breakerWindow {
+			recent = append(recent, t)
+		}
+	}
+	b.panics = append(recent, now)
+	if len(b.panics) < breakerMaxPanics {
+		return false
+	}
+	b.panics = nil
+	b.openUntil = now.Add(breakerCooldown)
+	circuitBreakerTripsTotal.WithLabelValues(command).Inc()
+	return true
+}
+
+// commandTripped returns how long a command remains switched off by its
+// circuit breaker, or 0 if it may be used.
+func commandTripped(command string, now time.Time) time.Duration {
+	circuitBreakersMutex.Lock()
+	defer circuitBreakersMutex.Unlock()
+
+	b, ok := circuitBreakers[command]
+	if !ok || !now.Before(b.openUntil) {
+		return 0
+	}
+	return b.openUntil.Sub(now)
+}
+
+// trippedCommands lists the commands currently switched off by their
+// circuit breakers.
+func trippedCommands(now time.Time) []string {
+	circuitBreakersMutex.Lock()
+	defer circuitBreakersMutex.Unlock()
+
+	cmds := []string{}
+	for cmd, b := range circuitBreakers {
+		if now.Before(b.openUntil) {
+			cmds = append(cmds, cmd)
+		}
+	}
+	slices.Sort(cmds)
+	return cmds
+}
+
+// resetCircuitBreaker switches a tripped command back on.
+func resetCircuitBreaker(command string) {
+	circuitBreakersMutex.Lock()
+	defer circuitBreakersMutex.Unlock()
+	delete(circuitBreakers, command)
+}
@@ -0,0 +1,139 @@
+package kardbot
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// registerTestCommand adds cmd to the registry for the duration of the test.
+func registerTestCommand(t *testing.T, cmd Command) {
+	t.Helper()
+	registerCommand(cmd)
+	t.Cleanup(func() {
+		commandRegistry.Lock()
+		defer commandRegistry.Unlock()
+		commandRegistry.commands = slices.DeleteFunc(commandRegistry.commands, func(c Command) bool { return c == cmd })
+		resetCircuitBreaker(cmd.Name())
+	})
+}
+
+func TestRouteInteractionRecoversPanics(t *testing.T) {
+	fake := newTestBot(t)
+	prevOwner := getOwnerID
+	getOwnerID = func() string { return testSelf.ID }
+	t.Cleanup(func() { getOwnerID = prevOwner })
+
+	cmd := &command{
+		name: "panic-test",
+		handler: func(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
+			panic("kaboom")
+		},
+	}
+	registerTestCommand(t, cmd)
+
+	for n := 1; n <= breakerMaxPanics; n++ {
+		i := fake.Command(cmd.Name(), nil, inTestGuild()...)
+		bot().routeInteraction(fake, i)
+		resp := mustRespond(t, fake, i)
+		if !isEphemeral(resp) || !strings.Contains(resp.Initial.Data.Content, "Something went wrong") {
+			t.Fatalf("panic %d: expected an error report prompt, got %+v", n, resp.Initial.Data)
+		}
+	}
+
+	i := fake.Command(cmd.Name(), nil, inTestGuild()...)
+	bot().routeInteraction(fake, i)
+	resp := mustRespond(t, fake, i)
+	if !isEphemeral(resp) || !strings.Contains(resp.Initial.Data.Content, "taking a break") {
+		t.Errorf("expected the command to be switched off, got %+v", resp.Initial.Data)
+	}
+	if got := trippedCommands(time.Now()); !slices.Contains(got, cmd.Name()) {
+		t.Errorf("%s missing from tripped commands %v", cmd.Name(), got)
+	}
+}
+
+func TestRouteInteractionFollowsUpAfterPanic(t *testing.T) {
+	fake := newTestBot(t)
+	prevOwner := getOwnerID
+	getOwnerID = func() string { return testSelf.ID }
+	t.Cleanup(func() { getOwnerID = prevOwner })
+
+	cmd := &command{
+		name: "deferred-panic-test",
+		handler: func(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
+			if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+				Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+			}); err != nil {
+				t.Error(err)
+			}
+			var m map[string]int
+			m["boom"]++
+		},
+	}
+	registerTestCommand(t, cmd)
+
+	i := fake.Command(cmd.Name(), nil, inTestGuild()...)
+	bot().routeInteraction(fake, i)
+	resp := mustRespond(t, fake, i)
+	if len(resp.Followups) != 1 || !strings.Contains(resp.Followups[0].Content, "Something went wrong") {
+		t.Errorf("expected an error report follow up, got %+v", resp.Followups)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	const cmd = "breaker-test"
+	t.Cleanup(func() { resetCircuitBreaker(cmd) })
+	start := time.Now()
+
+	// Panics spread out over more than the window don't trip the breaker.
+	for n := 0; n < breakerMaxPanics*2; n++ {
+		if recordCommandPanic(cmd, start.Add(time.Duration(n)*breakerWindow/2)) {
+			t.Fatalf("breaker tripped by panic %d", n+1)
+		}
+	}
+
+	now := start.Add(time.Hour)
+	for n := 1; n < breakerMaxPanics; n++ {
+		recordCommandPanic(cmd, now)
+	}
+	if !recordCommandPanic(cmd, now) {
+		t.Fatal("breaker did not trip")
+	}
+	if wait := commandTripped(cmd, now); wait != breakerCooldown {
+		t.Errorf("expected to wait %s, got %s", breakerCooldown, wait)
+	}
+	if wait := commandTripped(cmd, now.Add(breakerCooldown)); wait != 0 {
+		t.Errorf("breaker still open after the cooldown: %s", wait)
+	}
+
+	resetCircuitBreaker(cmd)
+	if wait := commandTripped(cmd, now); wait != 0 {
+		t.Errorf("breaker still open after a reset: %s", wait)
+	}
+}
+
+func TestRecoverJob(t *testing.T) {
+	newTestBot(t)
+	sentinel := errors.New("sentinel")
+	err := recoverJob("panic-job", func() error { panic(sentinel) })()
+
+	var pe *panicError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected a panicError, got %v", err)
+	}
+	if !errors.Is(err, sentinel) {
+		t.Errorf("%v does not wrap the value it panicked with", err)
+	}
+	if !strings.HasSuffix(pe.file, "panics_test.go") || pe.stack == "" {
+		t.Errorf("expected the panic site and stack, got %s:%d with stack %q", pe.file, pe.line, pe.stack)
+	}
+
+	if err := recoverJob("ok-job", noError(func() {}))(); err != nil {
+		t.Errorf("job that didn't panic failed: %v", err)
+	}
+}
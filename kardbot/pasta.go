@@ -1,64 +1,129 @@
 package kardbot
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"math/rand"
 	"os"
+	"sort"
 
 	"github.com/Kardbord/Kard-bot/kardbot/config"
 	"github.com/Kardbord/ubiquity/stringutils"
 	"github.com/bwmarrin/discordgo"
 	owoify_go "github.com/deadshot465/owoify-go"
-	log "github.com/sirupsen/logrus"
 )
 
 const (
-	pastaCmd       = "pasta"
-	pastaOptionUwu = "uwu"
-	pastaOptionTTS = "tts"
+	pastaCmd             = "pasta"
+	pastaOptionSelection = "selection"
+	pastaOptionUwu       = "uwu"
+	pastaOptionTTS       = "tts"
 )
 
+type pastaConfig struct {
+	menu  map[string]pasta
+	files []string
+}
+
+var pastaCfg hotConfig[pastaConfig]
+
 // Returns a map of pasta names to pasta objects.
 // Includes the "random" option.
-var pastaMenu func() map[string]pasta
+func pastaMenu() map[string]pasta { return pastaCfg.Load().menu }
 
 // Returns a list of paths to pasta files.
 // Does not include the "random" option
-var pastaList func() []string
+func pastaList() []string { return pastaCfg.Load().files }
 
 const PastaConfigFile = "config/pasta.json"
 
+// IDs of /pasta response messages.
+const (
+	msgPastaUnknown = "pasta.unknown"
+)
+
 func init() {
+	registerMessages(map[string]string{
+		msgPastaUnknown: "There's no pasta called %q, pick one of the suggestions.",
+	})
+	registerCommand(&command{
+		name:       pastaCmd,
+		definition: pastaCmdDefinition,
+		handler:    servePasta,
+		autocomplete: autocompleteOptions(map[string]func(string) []string{
+			pastaOptionSelection: suggestPastas,
+		}),
+	})
+}
+
+func pastaCmdDefinition() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        pastaCmd,
+		Description: "Serves you a delicious pasta!",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         pastaOptionSelection,
+				Description:  "Your choice of delicious pasta!",
+				Required:     true,
+				Autocomplete: true,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+				Name:        pastaOptionTTS,
+				Description: "Read the copy-pasta aloud to everyone viewing the channel using text-to-speech",
+				Required:    false,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        pastaOptionUwu,
+				Description: "Sprinkle a healthy dose of UwU on your pasta!",
+				Required:    false,
+				Choices:     uwuChoices(),
+			},
+		},
+	}
+}
+
+func parsePastas() (func(), error) {
 	cfg := struct {
 		Pastas []pasta `json:"pastas"`
 	}{}
 
 	jsonCfg, err := config.NewJsonConfig(PastaConfigFile)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	err = json.Unmarshal(jsonCfg.Raw, &cfg)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	var pastas = make(map[string]pasta)
 	var pastaFiles = make([]string, len(cfg.Pastas))
 	for i, p := range cfg.Pastas {
+		if p.Name == "" || p.Name == "random" {
+			return nil, fmt.Errorf(`invalid pasta name "%s"`, p.Name)
+		}
+		if _, ok := pastas[p.Name]; ok {
+			return nil, fmt.Errorf("pasta %s is listed more than once", p.Name)
+		}
+		if _, err := os.Stat(p.File); err != nil {
+			return nil, err
+		}
 		pastas[p.Name] = p
 		pastaFiles[i] = p.File
 	}
 	if len(pastas) == 0 {
-		log.Warn("No pastas found in config :(")
+		return nil, errors.New("no pastas found in config :(")
 	}
 	// Random is a special case
 	pastas["random"] = pasta{Name: "random", File: pastaFiles[rand.Intn(len(pastaFiles))]}
-	pastaMenu = func() map[string]pasta { return pastas }
-	pastaList = func() []string { return pastaFiles }
+	return func() { pastaCfg.Store(pastaConfig{menu: pastas, files: pastaFiles}) }, nil
 }
 
 type pasta struct {
@@ -66,19 +131,18 @@ type pasta struct {
 	File string `json:"file"`
 }
 
-func pastaChoices() []*discordgo.ApplicationCommandOptionChoice {
-	options := make([]*discordgo.ApplicationCommandOptionChoice, len(pastaMenu()))
-
-	i := 0
-	for k := range pastaMenu() {
-		options[i] = &discordgo.ApplicationCommandOptionChoice{
-			Name:  k,
-			Value: k,
-		}
-		i++
+// Returns the name of every pasta on the menu, including "random", in order.
+func pastaNames() []string {
+	names := make([]string, 0, len(pastaMenu()))
+	for name := range pastaMenu() {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
+}
 
-	return options
+func suggestPastas(typed string) []string {
+	return fuzzyMatch(typed, pastaNames(), maxDiscordOptionChoices)
 }
 
 // Load and return the copy pasta based on the pasta's member fields
@@ -110,12 +174,12 @@ func (p *pasta) makePasta() (string, error) {
 	}
 }
 
-func servePasta(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func servePasta(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	if isSelf, err := authorIsSelf(s, i); err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	} else if isSelf {
-		log.Trace("Ignoring message from self")
+		logFor(i).Trace("Ignoring message from self")
 		return
 	}
 
@@ -125,14 +189,14 @@ func servePasta(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		var err error
 		content, err = p.makePasta()
 		if err != nil {
-			log.Error(err)
+			logFor(i).Error(err)
 			interactionRespondEphemeralError(s, i, true, err)
 			return
 		}
 	} else {
-		err := fmt.Errorf("invalid selection: %s", selection)
-		log.Error(err)
-		interactionRespondEphemeralError(s, i, true, err)
+		// Selections are typed freely, so an unknown one is the user's mistake.
+		logFor(i).Debugf("Unknown pasta: %s", selection)
+		interactionRespondEphemeralError(s, i, false, errors.New(localized(i, msgPastaUnknown, selection)))
 		return
 	}
 
@@ -167,7 +231,7 @@ func servePasta(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		},
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 	}
 }
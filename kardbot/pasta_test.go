@@ -0,0 +1,42 @@
+package kardbot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Kardbord/Kard-bot/kardbot/fakediscord"
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestUnknownPastaIsUserError(t *testing.T) {
+	fake := newTestBot(t)
+	prev := pastaCfg.Load()
+	t.Cleanup(func() { pastaCfg.Store(prev) })
+	pastaCfg.Store(pastaConfig{menu: map[string]pasta{"random": {Name: "random"}}})
+
+	cases := map[string]*discordgo.InteractionCreate{
+		"pasta": fake.Command(pastaCmd, []*discordgo.ApplicationCommandInteractionDataOption{
+			fakediscord.StringOpt(pastaOptionSelection, "rando"),
+		}, inTestGuild()...),
+		"uwu pasta": fake.Command(uwuCmd, []*discordgo.ApplicationCommandInteractionDataOption{{
+			Name: uwuSubCmdPasta,
+			Type: discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandInteractionDataOption{
+				fakediscord.StringOpt("uwulevel", uwuLevel),
+				fakediscord.StringOpt(uwuSubCmdPasta, "rando"),
+			},
+		}}, inTestGuild()...),
+	}
+	for name, i := range cases {
+		t.Run(name, func(t *testing.T) {
+			bot().routeInteraction(fake, i)
+			resp := mustRespond(t, fake, i)
+			if !isEphemeral(resp) || !strings.Contains(resp.Initial.Data.Content, "pick one of the suggestions") {
+				t.Errorf("expected the user to be told to pick a suggestion, got %+v", resp.Initial.Data)
+			}
+			if len(resp.Initial.Data.Components) != 0 {
+				t.Error("an unknown pasta offered an error report")
+			}
+		})
+	}
+}
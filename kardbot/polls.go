@@ -1,23 +1,24 @@
 package kardbot
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"math"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/Kardbord/Kard-bot/kardbot/config"
 	"github.com/Kardbord/Kard-bot/kardbot/dg_helpers"
+	"github.com/Kardbord/Kard-bot/kardbot/jobqueue"
+	"github.com/Kardbord/Kard-bot/kardbot/store"
 	"github.com/Kardbord/ubiquity/mathutils"
 	"github.com/bwmarrin/discordgo"
 	"github.com/forPelevin/gomoji"
 	cmap "github.com/orcaman/concurrent-map/v2"
-	log "github.com/sirupsen/logrus"
 )
 
 type poll struct {
@@ -39,6 +40,27 @@ type poll struct {
 	Close time.Time
 }
 
+func init() {
+	formRoute, retryRoute := pollForm.routes()
+	registerCommand(&command{
+		name:       pollCmd,
+		definition: pollCmdDefinition,
+		handler:    handlePollCmd,
+		components: []interactionRoute{
+			{id: pollSelectMenuID, handler: handlePollSubmission},
+			retryRoute,
+		},
+		modals: []interactionRoute{formRoute},
+	})
+}
+
+func pollCmdDefinition() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        pollCmd,
+		Description: "Create a poll",
+	}
+}
+
 // Create a new poll which closes one week from when it is opened.
 // TODO: allow a user-specified duration.
 func newPoll(messageID, channelID string) poll {
@@ -56,186 +78,258 @@ func newPoll(messageID, channelID string) poll {
 // Val: poll
 var polls cmap.ConcurrentMap[string, poll] = cmap.New[poll]()
 
-const pollsStorageFilepath = "config/polls.json"
-
-var pollStorageFileMutex sync.RWMutex
-
-func init() {
-	pollStorageFileMutex.RLock()
-	defer pollStorageFileMutex.RUnlock()
-
-	jsonCfg, err := config.NewJsonConfig(pollsStorageFilepath)
-	if err != nil {
-		log.Fatal(err)
-	}
+// The representation of a poll in the state store.
+type pollRecord struct {
+	MessageID string
+	ChannelID string
+	Votes     map[string][]string
+	Open      time.Time
+	Close     time.Time
+}
 
-	type cfg struct {
-		poll
-		Votes map[string][]string // hacky workaround to the ConcurrentMap from JSON
+func (p *poll) record() pollRecord {
+	return pollRecord{
+		MessageID: p.MessageID,
+		ChannelID: p.ChannelID,
+		Votes:     p.Votes.Items(),
+		Open:      p.Open,
+		Close:     p.Close,
 	}
+}
 
-	tmp := make(map[string]cfg)
-
-	if err := json.Unmarshal(jsonCfg.Raw, &tmp); err != nil {
-		log.Fatal(err)
-	}
+// Write the poll, including all votes cast so far, to the state store.
+func (p *poll) persist() error {
+	return stateStore().Put(pollsBucket, p.MessageID, p.record())
+}
 
-	for key, val := range tmp {
+func loadPolls(st store.Store) error {
+	return st.ForEach(pollsBucket, func(key string, raw json.RawMessage) error {
+		rec := pollRecord{}
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			return err
+		}
 		p := poll{
-			MessageID: val.MessageID,
-			ChannelID: val.ChannelID,
+			MessageID: rec.MessageID,
+			ChannelID: rec.ChannelID,
 			Votes:     cmap.New[[]string](),
-			Open:      val.Open,
-			Close:     val.Close,
+			Open:      rec.Open,
+			Close:     rec.Close,
 		}
-		for k, v := range val.Votes {
+		for k, v := range rec.Votes {
 			p.setVotes(k, v...)
 		}
 		polls.Set(key, p)
+		return nil
+	})
+}
+
+// Identifies the poll to close in a close-poll job.
+type closePollPayload struct {
+	MessageID string `json:"message-id"`
+	ChannelID string `json:"channel-id"`
+}
+
+// schedulePollClose schedules a poll to be closed once its voting period is over.
+func schedulePollClose(p poll) error {
+	return jobQueue().Schedule(jobID(jobClosePoll, p.MessageID), jobClosePoll, p.Close,
+		closePollPayload{MessageID: p.MessageID, ChannelID: p.ChannelID})
+}
+
+// schedulePollClosings ensures that every open poll has a pending close-poll
+// job, e.g. polls created before the job queue existed.
+func schedulePollClosings() error {
+	errs := []error{}
+	for _, p := range polls.Items() {
+		if _, ok := jobQueue().Pending(jobID(jobClosePoll, p.MessageID)); ok {
+			continue
+		}
+		if err := schedulePollClose(p); err != nil {
+			errs = append(errs, err)
+		}
 	}
+	return errors.Join(errs...)
 }
 
-func writePollsToDisk() error {
-	fileBytes, err := json.MarshalIndent(polls, "", "  ")
-	if err != nil {
+// runClosePollJob stops accepting votes for a poll and marks its message as closed.
+func runClosePollJob(ctx context.Context, job jobqueue.Job) error {
+	payload := closePollPayload{}
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
 		return err
 	}
 
-	pollStorageFileMutex.Lock()
-	defer pollStorageFileMutex.Unlock()
-	return ioutil.WriteFile(pollsStorageFilepath, fileBytes, 0644)
-}
+	// Stop accepting votes even if the message can't be updated below.
+	polls.Remove(payload.MessageID)
+	if err := stateStore().Delete(pollsBucket, payload.MessageID); err != nil {
+		return err
+	}
 
-func purgeFinishedPolls() error {
-	for key, p := range polls.Items() {
-		if p.Close.Before(time.Now().UTC()) {
-			polls.Remove(key)
-			if message, err := bot().Session.ChannelMessage(p.ChannelID, p.MessageID); err == nil {
-				if len(message.Embeds) > 0 {
-					message.Embeds[0].Footer = &discordgo.MessageEmbedFooter{
-						Text: "This poll is now closed.",
-					}
-				}
-				_, err = bot().Session.ChannelMessageEditComplex(&discordgo.MessageEdit{
-					Content:    &message.Content,
-					Components: []discordgo.MessageComponent{},
-					Embeds:     message.Embeds,
-					AllowedMentions: &discordgo.MessageAllowedMentions{
-						Parse: []discordgo.AllowedMentionType{
-							discordgo.AllowedMentionTypeEveryone,
-							discordgo.AllowedMentionTypeRoles,
-							discordgo.AllowedMentionTypeUsers,
-						},
-					},
-					Flags:   message.Flags,
-					ID:      message.ID,
-					Channel: message.ChannelID,
-				})
-				if err != nil {
-					log.Error(err)
-				}
-			} else {
-				log.Error(err)
-			}
+	message, err := bot().api.ChannelMessage(payload.ChannelID, payload.MessageID)
+	if err != nil {
+		return err
+	}
+	if len(message.Embeds) > 0 {
+		message.Embeds[0].Footer = &discordgo.MessageEmbedFooter{
+			Text: "This poll is now closed.",
 		}
 	}
-
-	return writePollsToDisk()
+	_, err = bot().api.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		Content:    &message.Content,
+		Components: []discordgo.MessageComponent{},
+		Embeds:     message.Embeds,
+		AllowedMentions: &discordgo.MessageAllowedMentions{
+			Parse: []discordgo.AllowedMentionType{
+				discordgo.AllowedMentionTypeEveryone,
+				discordgo.AllowedMentionTypeRoles,
+				discordgo.AllowedMentionTypeUsers,
+			},
+		},
+		Flags:   message.Flags,
+		ID:      message.ID,
+		Channel: message.ChannelID,
+	})
+	return err
 }
 
 const (
-	pollCmd                 = "poll"
-	pollCmdOptMaxSelections = "max-selections"
-	pollCmdOptTitle         = "title"
-	pollCmdOptContext       = "context"
+	pollCmd = "poll"
+
+	pollFormID            = "poll-form"
+	pollFormFieldTitle    = "title"
+	pollFormFieldContext  = "context"
+	pollFormFieldOptions  = "options"
+	pollFormFieldMaxVotes = "max-selections"
 
 	pollSelectMenuID = "poll-menu"
 )
 
-func getPollOpts() []*discordgo.ApplicationCommandOption {
-	opts := []*discordgo.ApplicationCommandOption{
+// The most options a poll can have. Each is both a select menu option and an embed field.
+var maxPollOptions = mathutils.Min(maxDiscordSelectMenuOpts, dg_helpers.EmbedLimitField)
+
+// IDs of /poll response messages.
+const (
+	msgPollBadMaxVotes     = "poll.bad-max-votes"
+	msgPollNoVotes         = "poll.no-votes"
+	msgPollNoOptions       = "poll.no-options"
+	msgPollTooManyOptions  = "poll.too-many-options"
+	msgPollBlankOption     = "poll.blank-option"
+	msgPollOptionTooLong   = "poll.option-too-long"
+	msgPollDuplicateOption = "poll.duplicate-option"
+	msgPollClosed          = "poll.closed"
+	msgPollVoteRecorded    = "poll.vote-recorded"
+)
+
+func init() {
+	registerMessages(map[string]string{
+		msgPollBadMaxVotes:     "votes per person must be a whole number, not %q",
+		msgPollNoVotes:         "you must allow at least 1 vote to be cast per user",
+		msgPollNoOptions:       "you must specify at least one poll option",
+		msgPollTooManyOptions:  "a poll can have at most %d options, you gave %d",
+		msgPollBlankOption:     "options must contain at least one non-whitespace, non-emoji character",
+		msgPollOptionTooLong:   "option %q is longer than %d characters",
+		msgPollDuplicateOption: "option %q is listed more than once",
+		msgPollClosed:          "Sorry, this poll is closed!",
+		msgPollVoteRecorded:    "Your response has been recorded! 🗳️",
+	})
+}
+
+var pollForm = &modalForm{
+	id:      pollFormID,
+	title:   "Create a poll",
+	command: pollCmd,
+	fields: []formField{
 		{
-			Type:        discordgo.ApplicationCommandOptionString,
-			Name:        pollCmdOptTitle,
-			Description: fmt.Sprintf("Title of the poll, maximum %d characters.", maxDiscordSelectMenuPlaceholderChars),
-			Required:    true,
+			id:        pollFormFieldTitle,
+			label:     "Title",
+			required:  true,
+			maxLength: maxDiscordSelectMenuPlaceholderChars,
 		},
 		{
-			Type:        discordgo.ApplicationCommandOptionInteger,
-			Name:        pollCmdOptMaxSelections,
-			Description: "The maximum number of options a user can vote for",
-			Required:    true,
+			id:        pollFormFieldContext,
+			label:     "Context",
+			paragraph: true,
+			maxLength: dg_helpers.EmbedLimitDescription,
 		},
 		{
-			Type:        discordgo.ApplicationCommandOptionString,
-			Name:        pollCmdOptContext,
-			Description: "Additional context for the poll",
-			Required:    false,
+			id:          pollFormFieldOptions,
+			label:       fmt.Sprintf("Options, one per line (up to %d)", maxPollOptions),
+			placeholder: "Tacos 🌮\nPizza 🍕",
+			paragraph:   true,
+			required:    true,
 		},
-	}
-	addnlOpts := make([]*discordgo.ApplicationCommandOption, mathutils.Min(maxDiscordCommandOptions-len(opts), maxDiscordSelectMenuOpts, dg_helpers.EmbedLimitField))
-	for i := range addnlOpts {
-		addnlOpts[i] = &discordgo.ApplicationCommandOption{}
-		opt := addnlOpts[i]
-		opt.Type = discordgo.ApplicationCommandOptionString
-		opt.Name = fmt.Sprintf("option-%d", i)
-		opt.Description = fmt.Sprintf("Poll option %d", 1)
-		opt.Required = false
-	}
-	return append(opts, addnlOpts...)
+		{
+			id:          pollFormFieldMaxVotes,
+			label:       "Votes per person",
+			placeholder: "1",
+			maxLength:   2,
+		},
+	},
+	submit: submitPollForm,
 }
 
-func handlePollCmd(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func handlePollCmd(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	if s == nil || i == nil {
-		log.Error(fmt.Errorf("nil Session pointer (%v) and/or InteractionCreate pointer (%v)", s, i))
+		logFor(i).Error(fmt.Errorf("nil Session pointer (%v) and/or InteractionCreate pointer (%v)", s, i))
 		return
 	}
+	pollForm.open(s, i, nil)
+}
 
-	minSelections := 0
+func submitPollForm(s discordSession, i *discordgo.InteractionCreate, values formValues, _ *discordgo.InteractionCreate) error {
 	maxSelections := 1
-	title := ""
-	context := ""
-	pollOpts := make([]discordgo.SelectMenuOption, 0, len(i.ApplicationCommandData().Options))
-	for _, opt := range i.ApplicationCommandData().Options {
-		switch opt.Name {
-		case pollCmdOptMaxSelections:
-			maxSelections = int(opt.IntValue())
-		case pollCmdOptTitle:
-			title = opt.StringValue()
-		case pollCmdOptContext:
-			context = opt.StringValue()
-		default:
-			emoji, trimmedLabel, err := detectAndScrubDiscordEmojis(opt.StringValue())
-			if err != nil {
-				log.Error(err)
-				interactionRespondEphemeralError(s, i, true, err)
-				return
-			}
-			trimmedLabel = strings.TrimSpace(gomoji.RemoveEmojis(trimmedLabel))
-			if len(trimmedLabel) == 0 {
-				interactionRespondEphemeralError(s, i, false, fmt.Errorf("options must contain at least one non-whitespace, non-emoji character"))
-				return
-			}
-			pollOpts = append(pollOpts, discordgo.SelectMenuOption{
-				// We'll trim off any emojis in the label after we've used
-				// it to build our Embed.
-				Label: opt.StringValue(),
-				Value: trimmedLabel,
-				Emoji: emoji,
-			})
+	if v := strings.TrimSpace(values[pollFormFieldMaxVotes]); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return errors.New(localized(i, msgPollBadMaxVotes, v))
 		}
+		maxSelections = n
 	}
-
 	if maxSelections < 1 {
-		interactionRespondEphemeralError(s, i, false, fmt.Errorf("you must allow at least 1 vote to be cast per user"))
-		return
+		return errors.New(localized(i, msgPollNoVotes))
 	}
 
-	if len(pollOpts) == 0 {
-		interactionRespondEphemeralError(s, i, false, fmt.Errorf("you must specify at least one poll option"))
-		return
+	lines := values.lines(pollFormFieldOptions)
+	if len(lines) == 0 {
+		return errors.New(localized(i, msgPollNoOptions))
+	}
+	if len(lines) > maxPollOptions {
+		return errors.New(localized(i, msgPollTooManyOptions, maxPollOptions, len(lines)))
+	}
+
+	pollOpts := make([]discordgo.SelectMenuOption, 0, len(lines))
+	seen := map[string]bool{}
+	for _, line := range lines {
+		emoji, trimmedLabel, err := detectAndScrubDiscordEmojis(line)
+		if err != nil {
+			return err
+		}
+		trimmedLabel = strings.TrimSpace(gomoji.RemoveEmojis(trimmedLabel))
+		if len(trimmedLabel) == 0 {
+			return errors.New(localized(i, msgPollBlankOption))
+		}
+		if len(trimmedLabel) > maxDiscordSelectMenuOptionChars {
+			return errors.New(localized(i, msgPollOptionTooLong, trimmedLabel, maxDiscordSelectMenuOptionChars))
+		}
+		// Select menu option values must be unique.
+		if seen[trimmedLabel] {
+			return errors.New(localized(i, msgPollDuplicateOption, trimmedLabel))
+		}
+		seen[trimmedLabel] = true
+		pollOpts = append(pollOpts, discordgo.SelectMenuOption{
+			// We'll trim off any emojis in the label after we've used
+			// it to build our Embed.
+			Label: line,
+			Value: trimmedLabel,
+			Emoji: emoji,
+		})
 	}
 
+	postPoll(s, i, strings.TrimSpace(values[pollFormFieldTitle]), strings.TrimSpace(values[pollFormFieldContext]), maxSelections, pollOpts)
+	return nil
+}
+
+// postPoll responds to i with a new poll and starts tracking it.
+func postPoll(s discordSession, i *discordgo.InteractionCreate, title, context string, maxSelections int, pollOpts []discordgo.SelectMenuOption) {
+	minSelections := 0
 	maxSelections = mathutils.Min(len(pollOpts), maxSelections)
 
 	color, _ := fastHappyColorInt64()
@@ -277,7 +371,7 @@ func handlePollCmd(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		},
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 	}
 
@@ -285,7 +379,7 @@ func handlePollCmd(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	if err != nil {
 		_, filename, line, ok := runtime.Caller(1)
 		if !ok {
-			log.Error("couldn't obtain stack data")
+			logFor(i).Error("couldn't obtain stack data")
 		}
 		followupWithError(s, i, err, filename, line)
 		return
@@ -294,19 +388,22 @@ func handlePollCmd(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	p := newPoll(resp.ID, resp.ChannelID)
 	polls.Set(resp.ID, p)
 
-	if err = writePollsToDisk(); err != nil {
-		log.Error(err)
+	if err = p.persist(); err != nil {
+		logFor(i).Error(err)
+	}
+	if err = schedulePollClose(p); err != nil {
+		logFor(i).Error(err)
 	}
 }
 
-func handlePollSubmission(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func handlePollSubmission(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	if s == nil || i == nil {
-		log.Error(fmt.Errorf("nil Session pointer (%v) and/or InteractionCreate pointer (%v)", s, i))
+		logFor(i).Error(fmt.Errorf("nil Session pointer (%v) and/or InteractionCreate pointer (%v)", s, i))
 		return
 	}
 	mdata, err := getInteractionMetaData(i)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 		return
 	}
@@ -315,12 +412,12 @@ func handlePollSubmission(s *discordgo.Session, i *discordgo.InteractionCreate)
 		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
-				Content: "Sorry, this poll is closed!",
+				Content: localized(i, msgPollClosed),
 				Flags:   discordgo.MessageFlagsEphemeral,
 			},
 		})
 		if err != nil {
-			log.Error(err)
+			logFor(i).Error(err)
 			interactionFollowUpEphemeralError(s, i, true, err)
 		}
 		return
@@ -333,28 +430,32 @@ func handlePollSubmission(s *discordgo.Session, i *discordgo.InteractionCreate)
 		},
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
 
 	p, _ := polls.Get(mdata.MessageID)
 	p.setVotes(mdata.AuthorID, i.MessageComponentData().Values...)
+	if err = p.persist(); err != nil {
+		logFor(i).Error(err)
+		interactionFollowUpEphemeralError(s, i, true, err)
+		return
+	}
 	if err = p.updateMessage(s); err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 		return
 	}
 
-	responseRecordedMsg := "Your response has been recorded! 🗳️"
+	responseRecordedMsg := localized(i, msgPollVoteRecorded)
 	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
 		Content: &responseRecordedMsg,
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 	}
-	writePollsToDisk()
 }
 
 func (p *poll) setVotes(userID string, votes ...string) {
@@ -362,7 +463,7 @@ func (p *poll) setVotes(userID string, votes ...string) {
 }
 
 // Tablulates poll results and updates the discord message
-func (p *poll) updateMessage(s *discordgo.Session) error {
+func (p *poll) updateMessage(s discordSession) error {
 
 	// TODO: This function can probably be a lot cleaner.
 	//       I should know better than to try and bang out
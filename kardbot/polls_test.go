@@ -0,0 +1,126 @@
+package kardbot
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Kardbord/Kard-bot/kardbot/fakediscord"
+	"github.com/bwmarrin/discordgo"
+)
+
+func createTestPoll(t *testing.T, fake *fakediscord.Session, maxSelections int, options ...string) *discordgo.Message {
+	t.Helper()
+	open := fake.Command(pollCmd, nil, inTestGuild()...)
+	handlePollCmd(context.Background(), fake, open)
+
+	i := submitForm(fake, openedForm(t, fake, open), map[string]string{
+		pollFormFieldTitle:    "Lunch?",
+		pollFormFieldOptions:  strings.Join(options, "\n"),
+		pollFormFieldMaxVotes: strconv.Itoa(maxSelections),
+	})
+
+	msg, err := fake.InteractionResponse(i.Interaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { polls.Remove(msg.ID) })
+	return msg
+}
+
+func TestHandlePollCmd(t *testing.T) {
+	fake := newTestBot(t)
+	msg := createTestPoll(t, fake, 5, "Tacos 🌮", "", "Pizza")
+
+	if !polls.Has(msg.ID) {
+		t.Fatalf("poll %s is not being tracked", msg.ID)
+	}
+	rec := pollRecord{}
+	if found, err := stateStore().Get(pollsBucket, msg.ID, &rec); err != nil || !found {
+		t.Fatalf("poll was not persisted; found=%v, err=%v", found, err)
+	}
+
+	if len(msg.Embeds) != 1 || len(msg.Embeds[0].Fields) != 2 {
+		t.Fatalf("expected an embed with 2 fields, got %+v", msg.Embeds)
+	}
+	menu := msg.Components[0].(*discordgo.ActionsRow).Components[0].(*discordgo.SelectMenu)
+	if menu.CustomID != pollSelectMenuID {
+		t.Errorf("unexpected custom ID %s", menu.CustomID)
+	}
+	// Max selections are capped at the number of options
+	if menu.MaxValues != 2 {
+		t.Errorf("got MaxValues=%d, want 2", menu.MaxValues)
+	}
+	if menu.Options[0].Value != "Tacos" {
+		t.Errorf("emojis were not scrubbed from option value %q", menu.Options[0].Value)
+	}
+}
+
+func TestSubmitPollFormValidation(t *testing.T) {
+	cases := map[string]string{
+		"no options":        " \n ",
+		"duplicate options": "Tacos 🌮\nTacos",
+		"emoji only":        "Tacos\n🍕",
+		"too many options":  strings.Repeat("x\n", maxPollOptions) + "y",
+	}
+	for name, options := range cases {
+		t.Run(name, func(t *testing.T) {
+			fake := newTestBot(t)
+			i := fake.Modal(pollForm.modalID("test"), nil, inTestGuild()...)
+
+			err := submitPollForm(fake, i, formValues{pollFormFieldTitle: "Lunch?", pollFormFieldOptions: options}, nil)
+			if err == nil {
+				t.Fatal("expected a validation error")
+			}
+			if fake.Response(i.ID) != nil {
+				t.Error("the form responded before its input was validated")
+			}
+		})
+	}
+}
+
+func TestHandlePollSubmission(t *testing.T) {
+	fake := newTestBot(t)
+	msg := createTestPoll(t, fake, 1, "Tacos", "Pizza")
+
+	vote := fake.Component(pollSelectMenuID, discordgo.SelectMenuComponent, []string{"Pizza"},
+		append(inTestGuild(), fakediscord.OnMessage(msg))...)
+	handlePollSubmission(context.Background(), fake, vote)
+
+	resp := mustRespond(t, fake, vote)
+	if len(resp.Edits) != 1 || !strings.Contains(*resp.Edits[0].Content, "recorded") {
+		t.Errorf("voter was not told their vote was recorded: %+v", resp.Edits)
+	}
+
+	updated, err := fake.ChannelMessage(msg.ChannelID, msg.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := updated.Embeds[0].Fields
+	if fields[0].Name != "Pizza" || !strings.HasPrefix(fields[0].Value, "👍 1 votes, 📈 100%") {
+		t.Errorf("unexpected results %q: %q", fields[0].Name, fields[0].Value)
+	}
+
+	rec := pollRecord{}
+	if _, err := stateStore().Get(pollsBucket, msg.ID, &rec); err != nil {
+		t.Fatal(err)
+	}
+	if votes := rec.Votes[testUser.ID]; len(votes) != 1 || votes[0] != "Pizza" {
+		t.Errorf("vote was not persisted: %v", rec.Votes)
+	}
+}
+
+func TestHandlePollSubmissionClosedPoll(t *testing.T) {
+	fake := newTestBot(t)
+	msg := fake.AddMessage(&discordgo.Message{ChannelID: testChannelID, Author: testSelf})
+
+	vote := fake.Component(pollSelectMenuID, discordgo.SelectMenuComponent, []string{"Pizza"},
+		append(inTestGuild(), fakediscord.OnMessage(msg))...)
+	handlePollSubmission(context.Background(), fake, vote)
+
+	resp := mustRespond(t, fake, vote)
+	if !isEphemeral(resp) || !strings.Contains(resp.Initial.Data.Content, "closed") {
+		t.Errorf("expected to be told the poll is closed, got %+v", resp.Initial.Data)
+	}
+}
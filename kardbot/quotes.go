@@ -0,0 +1,210 @@
+package kardbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/Kardbord/Kard-bot/kardbot/dg_helpers"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	quoteCmd         = "quote"
+	quoteOptUser     = "user"
+	quoteMessageMenu = "Save quote"
+)
+
+// IDs of /quote response messages.
+const (
+	msgQuoteNoText       = "quote.no-text"
+	msgQuoteAlreadySaved = "quote.already-saved"
+	msgQuoteSaved        = "quote.saved"
+	msgQuoteNoneSaved    = "quote.none-saved"
+	msgQuoteAnyone       = "quote.anyone"
+)
+
+func init() {
+	registerMessages(map[string]string{
+		msgQuoteNoText:       "only messages with text can be saved as quotes",
+		msgQuoteAlreadySaved: "that message has already been saved as a quote",
+		msgQuoteSaved:        "Saved! Use `/%s` to bring it back. 📜",
+		msgQuoteNoneSaved:    "no quotes from %s have been saved yet; right-click a message and pick Apps → %s",
+		msgQuoteAnyone:       "anyone",
+	})
+	registerCommand(&command{
+		name:       quoteCmd,
+		definition: quoteCmdDefinition,
+		handler:    handleQuoteCmd,
+		metadata: CommandMetadata{
+			GuildOnly: true,
+		},
+		contextMenus: []contextMenu{
+			{name: quoteMessageMenu, target: discordgo.MessageApplicationCommand, handler: saveQuote},
+		},
+	})
+}
+
+func quoteCmdDefinition() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        quoteCmd,
+		Description: "Post a random quote saved in this server.",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionUser,
+				Name:        quoteOptUser,
+				Description: "Only pick from this user's quotes",
+			},
+		},
+	}
+}
+
+// A message saved with the "Save quote" context menu.
+type quoteRecord struct {
+	GuildID    string    `json:"guild-id"`
+	ChannelID  string    `json:"channel-id"`
+	MessageID  string    `json:"message-id"`
+	AuthorID   string    `json:"author-id"`
+	AuthorName string    `json:"author-name"`
+	Content    string    `json:"content"`
+	SavedBy    string    `json:"saved-by"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// Quotes are keyed by guild, so a guild's quotes can be found by prefix.
+func quoteKey(guildID, messageID string) string {
+	return guildID + "/" + messageID
+}
+
+func saveQuote(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
+	mdata, err := getInteractionMetaData(i)
+	if err != nil {
+		logFor(i).Error(err)
+		interactionRespondEphemeralError(s, i, true, err)
+		return
+	}
+	msg, err := targetMessage(i)
+	if err != nil {
+		logFor(i).Error(err)
+		interactionRespondEphemeralError(s, i, true, err)
+		return
+	}
+	if strings.TrimSpace(msg.Content) == "" {
+		interactionRespondEphemeralError(s, i, false, errors.New(localized(i, msgQuoteNoText)))
+		return
+	}
+
+	key := quoteKey(mdata.GuildID, msg.ID)
+	exists, err := stateStore().Get(quotesBucket, key, &quoteRecord{})
+	if err != nil {
+		logFor(i).Error(err)
+		interactionRespondEphemeralError(s, i, true, err)
+		return
+	}
+	if exists {
+		interactionRespondEphemeralError(s, i, false, errors.New(localized(i, msgQuoteAlreadySaved)))
+		return
+	}
+
+	record := quoteRecord{
+		GuildID:   mdata.GuildID,
+		ChannelID: msg.ChannelID,
+		MessageID: msg.ID,
+		Content:   msg.Content,
+		SavedBy:   mdata.AuthorID,
+		Timestamp: msg.Timestamp,
+	}
+	if msg.Author != nil {
+		record.AuthorID = msg.Author.ID
+		record.AuthorName = msg.Author.Username
+	}
+	if record.ChannelID == "" {
+		record.ChannelID = i.ChannelID
+	}
+	if err = stateStore().Put(quotesBucket, key, record); err != nil {
+		logFor(i).Error(err)
+		interactionRespondEphemeralError(s, i, true, err)
+		return
+	}
+	logFor(i).Infof("%s saved message %s as a quote", mdata.AuthorUsername, msg.ID)
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: localized(i, msgQuoteSaved, quoteCmd),
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		logFor(i).Error(err)
+	}
+}
+
+// guildQuotes returns the quotes saved in a guild, optionally only those
+// written by authorID.
+func guildQuotes(guildID, authorID string) ([]quoteRecord, error) {
+	quotes := []quoteRecord{}
+	err := stateStore().ForEach(quotesBucket, func(key string, raw json.RawMessage) error {
+		if !strings.HasPrefix(key, guildID+"/") {
+			return nil
+		}
+		q := quoteRecord{}
+		if err := json.Unmarshal(raw, &q); err != nil {
+			return err
+		}
+		if authorID == "" || q.AuthorID == authorID {
+			quotes = append(quotes, q)
+		}
+		return nil
+	})
+	return quotes, err
+}
+
+func handleQuoteCmd(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
+	authorID := ""
+	if opts := i.ApplicationCommandData().Options; len(opts) > 0 {
+		authorID = opts[0].UserValue(nil).ID
+	}
+
+	quotes, err := guildQuotes(i.GuildID, authorID)
+	if err != nil {
+		logFor(i).Error(err)
+		interactionRespondEphemeralError(s, i, true, err)
+		return
+	}
+	if len(quotes) == 0 {
+		whose := localized(i, msgQuoteAnyone)
+		if authorID != "" {
+			whose = fmt.Sprintf("<@%s>", authorID)
+		}
+		interactionRespondEphemeralError(s, i, false, errors.New(localized(i, msgQuoteNoneSaved, whose, quoteMessageMenu)))
+		return
+	}
+
+	q := quotes[rand.Intn(len(quotes))]
+	color, _ := fastHappyColorInt64()
+	embed := dg_helpers.NewEmbed().
+		SetColor(int(color)).
+		SetAuthor(q.AuthorName).
+		SetDescription(q.Content).
+		AddField("Source", fmt.Sprintf("[Jump to message](%s)", messageLink(q.GuildID, q.ChannelID, q.MessageID))).
+		Truncate()
+	if !q.Timestamp.IsZero() {
+		embed.Timestamp = q.Timestamp.Format(time.RFC3339)
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{embed.MessageEmbed},
+		},
+	})
+	if err != nil {
+		logFor(i).Error(err)
+		interactionRespondEphemeralError(s, i, true, err)
+	}
+}
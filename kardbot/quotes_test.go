@@ -0,0 +1,55 @@
+package kardbot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Kardbord/Kard-bot/kardbot/fakediscord"
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestSaveAndPostQuote(t *testing.T) {
+	fake := newTestBot(t)
+	target := &discordgo.Message{ID: fake.NewID(), ChannelID: testChannelID, Content: "I'll be back", Author: testSelf}
+
+	save := fake.MessageCommand(quoteMessageMenu, target, inTestGuild()...)
+	bot().routeInteraction(fake, save)
+	if resp := mustRespond(t, fake, save); !isEphemeral(resp) || !strings.Contains(resp.Initial.Data.Content, "Saved") {
+		t.Fatalf("expected an ephemeral confirmation, got %+v", resp.Initial.Data)
+	}
+
+	again := fake.MessageCommand(quoteMessageMenu, target, inTestGuild()...)
+	bot().routeInteraction(fake, again)
+	if resp := mustRespond(t, fake, again); !strings.Contains(resp.Initial.Data.Content, "already") {
+		t.Errorf("saving a quote twice was not rejected: %+v", resp.Initial.Data)
+	}
+
+	post := fake.Command(quoteCmd, nil, inTestGuild()...)
+	bot().routeInteraction(fake, post)
+	resp := mustRespond(t, fake, post)
+	if len(resp.Initial.Data.Embeds) != 1 {
+		t.Fatalf("expected a quote embed, got %+v", resp.Initial.Data)
+	}
+	embed := resp.Initial.Data.Embeds[0]
+	if embed.Description != target.Content || embed.Author.Name != testSelf.Username {
+		t.Errorf("posted the wrong quote: %+v", embed)
+	}
+	if !strings.Contains(embed.Fields[0].Value, messageLink(testGuildID, testChannelID, target.ID)) {
+		t.Errorf("quote does not link back to the message: %+v", embed.Fields)
+	}
+
+	byOther := fake.Command(quoteCmd, []*discordgo.ApplicationCommandInteractionDataOption{
+		{Name: quoteOptUser, Type: discordgo.ApplicationCommandOptionUser, Value: testUser.ID},
+	}, inTestGuild()...)
+	bot().routeInteraction(fake, byOther)
+	if resp := mustRespond(t, fake, byOther); !isEphemeral(resp) || !strings.Contains(resp.Initial.Data.Content, "no quotes") {
+		t.Errorf("expected no quotes from %s, got %+v", testUser.Username, resp.Initial.Data)
+	}
+
+	other := fakediscord.FromMember("301", &discordgo.Member{User: testUser, GuildID: "301"})
+	elsewhere := fake.Command(quoteCmd, nil, other, fakediscord.InChannel(testChannelID))
+	bot().routeInteraction(fake, elsewhere)
+	if resp := mustRespond(t, fake, elsewhere); len(resp.Initial.Data.Embeds) != 0 {
+		t.Errorf("a quote leaked into another guild: %+v", resp.Initial.Data)
+	}
+}
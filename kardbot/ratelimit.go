@@ -0,0 +1,223 @@
+package kardbot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Kardbord/Kard-bot/kardbot/config"
+	"github.com/bwmarrin/discordgo"
+)
+
+// bucketConfig describes a token bucket. A bucket holds up to Burst
+// tokens, each use of a command takes one, and one token is returned
+// every RefillSeconds.
+type bucketConfig struct {
+	Burst         int     `json:"burst"`
+	RefillSeconds float64 `json:"refill-seconds"`
+}
+
+func (c *bucketConfig) refill() time.Duration {
+	return time.Duration(c.RefillSeconds * float64(time.Second))
+}
+
+func (c *bucketConfig) validate() error {
+	if c.Burst < 1 {
+		return fmt.Errorf("burst must be at least 1, got %d", c.Burst)
+	}
+	if c.RefillSeconds <= 0 {
+		return fmt.Errorf("refill-seconds must be positive, got %v", c.RefillSeconds)
+	}
+	return nil
+}
+
+// rateLimitConfig limits a command per user, per guild, and across
+// the whole bot. Any scope left out is not limited.
+type rateLimitConfig struct {
+	User   *bucketConfig `json:"user,omitempty"`
+	Guild  *bucketConfig `json:"guild,omitempty"`
+	Global *bucketConfig `json:"global,omitempty"`
+}
+
+// Rate limits keyed by command name, or by command and subcommand
+// separated by a space (e.g. "render dalle3"). When both are
+// configured, both apply.
+var rateLimits = map[string]rateLimitConfig{}
+
+func loadRateLimits() error {
+	cfg := struct {
+		RateLimits map[string]rateLimitConfig `json:"rate-limits"`
+	}{}
+
+	jsonCfg, err := config.NewJsonConfig(kardbotConfigFile)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(jsonCfg.Raw, &cfg); err != nil {
+		return err
+	}
+
+	for key, limit := range cfg.RateLimits {
+		for scope, bucket := range limit.scopes() {
+			if err := bucket.validate(); err != nil {
+				return fmt.Errorf("rate-limits: %s %s: %w", key, scope, err)
+			}
+		}
+	}
+	if cfg.RateLimits != nil {
+		rateLimits = cfg.RateLimits
+	}
+	return nil
+}
+
+// Scopes a rate limit can apply to.
+const (
+	rateLimitScopeUser   = "user"
+	rateLimitScopeGuild  = "guild"
+	rateLimitScopeGlobal = "global"
+)
+
+func (c rateLimitConfig) scopes() map[string]*bucketConfig {
+	scopes := map[string]*bucketConfig{}
+	if c.User != nil {
+		scopes[rateLimitScopeUser] = c.User
+	}
+	if c.Guild != nil {
+		scopes[rateLimitScopeGuild] = c.Guild
+	}
+	if c.Global != nil {
+		scopes[rateLimitScopeGlobal] = c.Global
+	}
+	return scopes
+}
+
+type tokenBucket struct {
+	cfg    *bucketConfig
+	tokens float64
+	last   time.Time
+}
+
+// refill tops the bucket up with any tokens returned since it was last used.
+func (b *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last)
+	if elapsed <= 0 {
+		return
+	}
+	b.tokens = math.Min(float64(b.cfg.Burst), b.tokens+float64(elapsed)/float64(b.cfg.refill()))
+	b.last = now
+}
+
+// wait returns how long until the bucket has a token to give.
+func (b *tokenBucket) wait() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) * float64(b.cfg.refill()))
+}
+
+func (b *tokenBucket) full() bool {
+	return b.tokens >= float64(b.cfg.Burst)
+}
+
+// Token buckets for every command, scope, and user or guild that has
+// used a rate limited command recently.
+var (
+	rateLimitBuckets      = map[string]*tokenBucket{}
+	rateLimitBucketsMutex sync.Mutex
+)
+
+// rateLimitKeys returns the keys in rateLimits that apply to an
+// interaction, most general first.
+func rateLimitKeys(cmd Command, i *discordgo.InteractionCreate) []string {
+	keys := []string{cmd.Name()}
+	opts := i.ApplicationCommandData().Options
+	if len(opts) > 0 && (opts[0].Type == discordgo.ApplicationCommandOptionSubCommand ||
+		opts[0].Type == discordgo.ApplicationCommandOptionSubCommandGroup) {
+		keys = append(keys, cmd.Name()+" "+opts[0].Name)
+	}
+	return keys
+}
+
+// takeRateLimitTokens takes a token from every bucket that applies to
+// the interaction. If any of them is empty, no tokens are taken and an
+// error saying how long to wait is returned.
+func takeRateLimitTokens(cmd Command, i *discordgo.InteractionCreate, authorID string, now time.Time) error {
+	type claim struct {
+		key, scope string
+		bucket     *tokenBucket
+	}
+	claims := []claim{}
+
+	rateLimitBucketsMutex.Lock()
+	defer rateLimitBucketsMutex.Unlock()
+
+	for _, key := range rateLimitKeys(cmd, i) {
+		limit, ok := rateLimits[key]
+		if !ok {
+			continue
+		}
+		for scope, cfg := range limit.scopes() {
+			id := ""
+			switch scope {
+			case rateLimitScopeUser:
+				id = authorID
+			case rateLimitScopeGuild:
+				if i.GuildID == "" {
+					continue
+				}
+				id = i.GuildID
+			}
+			bucketKey := fmt.Sprintf("%s/%s/%s", key, scope, id)
+			b, ok := rateLimitBuckets[bucketKey]
+			if !ok || *b.cfg != *cfg {
+				b = &tokenBucket{cfg: cfg, tokens: float64(cfg.Burst), last: now}
+				rateLimitBuckets[bucketKey] = b
+			}
+			b.refill(now)
+			claims = append(claims, claim{key, scope, b})
+		}
+	}
+
+	var blocked *claim
+	wait := time.Duration(0)
+	for idx := range claims {
+		if w := claims[idx].bucket.wait(); w > wait {
+			blocked, wait = &claims[idx], w
+		}
+	}
+	if blocked != nil {
+		// Round up so users are never told to retry before they actually can.
+		wait = time.Duration(math.Ceil(wait.Seconds())) * time.Second
+		logFor(i).Debugf("%s rate limit hit for /%s by %s in %s", blocked.scope, blocked.key, authorID, i.GuildID)
+		switch blocked.scope {
+		case rateLimitScopeGuild:
+			return errors.New(localized(i, msgRateLimitGuild, blocked.key, wait))
+		case rateLimitScopeGlobal:
+			return errors.New(localized(i, msgRateLimitGlobal, blocked.key, wait))
+		default:
+			return errors.New(localized(i, msgRateLimitUser, blocked.key, wait))
+		}
+	}
+
+	for _, c := range claims {
+		c.bucket.tokens--
+	}
+	return nil
+}
+
+// pruneRateLimitBuckets forgets buckets that have refilled completely,
+// since a new bucket starts out full anyway.
+func pruneRateLimitBuckets() {
+	now := time.Now()
+	rateLimitBucketsMutex.Lock()
+	defer rateLimitBucketsMutex.Unlock()
+	for key, b := range rateLimitBuckets {
+		b.refill(now)
+		if b.full() {
+			delete(rateLimitBuckets, key)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package kardbot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kardbord/Kard-bot/kardbot/fakediscord"
+	"github.com/bwmarrin/discordgo"
+)
+
+func withRateLimits(t *testing.T, limits map[string]rateLimitConfig) {
+	t.Helper()
+	prev := rateLimits
+	rateLimits = limits
+	t.Cleanup(func() {
+		rateLimits = prev
+		rateLimitBucketsMutex.Lock()
+		rateLimitBuckets = map[string]*tokenBucket{}
+		rateLimitBucketsMutex.Unlock()
+	})
+}
+
+func TestRateLimitPerUser(t *testing.T) {
+	fake := newTestBot(t)
+	withRateLimits(t, map[string]rateLimitConfig{
+		"rate-test": {User: &bucketConfig{Burst: 2, RefillSeconds: 10}},
+	})
+	cmd := &command{name: "rate-test"}
+	now := time.Now()
+
+	for n := 0; n < 2; n++ {
+		i := fake.Command(cmd.Name(), nil, inTestGuild()...)
+		if err := takeRateLimitTokens(cmd, i, testUser.ID, now); err != nil {
+			t.Fatalf("use %d was rejected: %v", n+1, err)
+		}
+	}
+
+	i := fake.Command(cmd.Name(), nil, inTestGuild()...)
+	err := takeRateLimitTokens(cmd, i, testUser.ID, now.Add(4*time.Second))
+	if err == nil || !strings.Contains(err.Error(), "try again in 6s") {
+		t.Fatalf("third use was not rejected with the right wait: %v", err)
+	}
+	if err := takeRateLimitTokens(cmd, i, "someone-else", now); err != nil {
+		t.Errorf("another user was limited: %v", err)
+	}
+	if err := takeRateLimitTokens(cmd, i, testUser.ID, now.Add(10*time.Second)); err != nil {
+		t.Errorf("bucket did not refill: %v", err)
+	}
+}
+
+func TestRateLimitGuildBlocksWithoutSpendingUserTokens(t *testing.T) {
+	fake := newTestBot(t)
+	withRateLimits(t, map[string]rateLimitConfig{
+		"rate-test":      {User: &bucketConfig{Burst: 1, RefillSeconds: 60}},
+		"rate-test slow": {Guild: &bucketConfig{Burst: 1, RefillSeconds: 60}},
+	})
+	cmd := &command{name: "rate-test"}
+	slow := func() *discordgo.InteractionCreate {
+		return fake.Command(cmd.Name(), []*discordgo.ApplicationCommandInteractionDataOption{
+			fakediscord.SubCommand("slow"),
+		}, inTestGuild()...)
+	}
+	now := time.Now()
+
+	if err := takeRateLimitTokens(cmd, slow(), "someone-else", now); err != nil {
+		t.Fatal(err)
+	}
+	err := takeRateLimitTokens(cmd, slow(), testUser.ID, now)
+	if err == nil || !strings.Contains(err.Error(), "in this server") {
+		t.Fatalf("guild limit was not enforced: %v", err)
+	}
+
+	// The rejected use above must not have cost the user their own token.
+	if err := takeRateLimitTokens(cmd, fake.Command(cmd.Name(), nil, inTestGuild()...), testUser.ID, now); err != nil {
+		t.Errorf("user was charged for a rejected use: %v", err)
+	}
+}
+
+func TestRateLimitOwnerExempt(t *testing.T) {
+	fake := newTestBot(t)
+	withRateLimits(t, map[string]rateLimitConfig{
+		"rate-test": {User: &bucketConfig{Burst: 1, RefillSeconds: 60}},
+	})
+	prevOwner := getOwnerID
+	getOwnerID = func() string { return testUser.ID }
+	t.Cleanup(func() { getOwnerID = prevOwner })
+	cmd := &command{name: "rate-test"}
+
+	for n := 0; n < 3; n++ {
+		if err := chargeCommandUse(cmd, fake.Command(cmd.Name(), nil, inTestGuild()...)); err != nil {
+			t.Fatalf("owner was rate limited: %v", err)
+		}
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"net/http"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/Kardbord/Kard-bot/kardbot/dg_helpers"
 	"github.com/Kardbord/ubiquity/httputils"
@@ -15,10 +17,7 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-var (
-	redditClient = func() *reddit.Client { return nil }
-	redditCtx    = func() context.Context { return context.Background() }
-)
+var redditClient = func() *reddit.Client { return nil }
 
 const (
 	redditRouletteCmd string = "reddit-roulette"
@@ -27,25 +26,99 @@ const (
 	redditRouletteSubCmdNSFW string = "nsfw"
 	redditRouletteSubCmdAny  string = "any"
 
+	redditSubredditsOpt string = "subreddits"
+
 	// reddit API returns a max of 100 posts at a time
 	redditMaxPostsPerRequest int = 100
 )
 
 func init() {
-	client, err := reddit.NewReadonlyClient()
+	registerCommand(&command{
+		name:       redditRouletteCmd,
+		definition: redditRouletteCmdDefinition,
+		handler:    redditRoulette,
+		autocomplete: autocompleteOptions(map[string]func(string) []string{
+			redditSubredditsOpt: completeLastField(suggestSubreddits),
+		}),
+	})
+}
+
+// Subreddits that recent SFW posts came from. NSFW subreddits are never
+// recorded, so suggestions are safe to show in any channel.
+var recentSubreddits = newRecentValues(100)
+
+func suggestSubreddits(typed string) []string {
+	return fuzzyMatch(typed, append(recentSubreddits.list(), "all"), maxDiscordOptionChoices)
+}
+
+func redditRouletteCmdDefinition() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        redditRouletteCmd,
+		Description: "Retrieve a random reddit post",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        redditRouletteSubCmdAny,
+				Description: "Retrieve a random reddit post. May be NSFW.",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         redditSubredditsOpt,
+						Description:  "Subreddits from which you want the random post to be retrieved, separated by spaces",
+						Required:     false,
+						Autocomplete: true,
+					},
+				},
+			},
+			{
+				Name:        redditRouletteSubCmdSFW,
+				Description: "Retrieve a random reddit post that is not marked as NSFW",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         redditSubredditsOpt,
+						Description:  "Subreddits from which you want the random post to be retrieved, separated by spaces",
+						Required:     false,
+						Autocomplete: true,
+					},
+				},
+			},
+			{
+				Name:        redditRouletteSubCmdNSFW,
+				Description: "Retrieve a random reddit post that is marked as NSFW.",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         redditSubredditsOpt,
+						Description:  "Subreddits from which you want the random post to be retrieved, separated by spaces",
+						Required:     false,
+						Autocomplete: true,
+					},
+				},
+			},
+		},
+	}
+}
+
+func loadRedditClient() error {
+	httpClient := &http.Client{Timeout: 30 * time.Second, Transport: newRetryTransport(nil)}
+	client, err := reddit.NewReadonlyClient(reddit.WithHTTPClient(httpClient))
 	if err != nil {
-		log.Fatal("Could not initialize reddit client")
+		return fmt.Errorf("could not initialize reddit client: %w", err)
 	}
 	redditClient = func() *reddit.Client { return client }
+	return nil
 }
 
-func redditRoulette(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func redditRoulette(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	if isSelf, err := authorIsSelf(s, i); err != nil {
 		interactionRespondEphemeralError(s, i, true, err)
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	} else if isSelf {
-		log.Trace("Ignoring message from self")
+		logFor(i).Trace("Ignoring message from self")
 		return
 	}
 
@@ -53,7 +126,7 @@ func redditRoulette(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
@@ -70,7 +143,7 @@ func redditRoulette(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	if err != nil {
 		// Log the error but continue on with nsfw=false
 		nsfw = false
-		log.Error(err)
+		logFor(i).Error(err)
 	}
 
 	var post *reddit.Post
@@ -78,21 +151,21 @@ func redditRoulette(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	case redditRouletteSubCmdAny:
 		if nsfw {
 			// channel is nsfw, so grab any random reddit post
-			post, err = getRandomRedditPost(nil, subreddits...)
+			post, err = getRandomRedditPost(ctx, nil, subreddits...)
 		} else {
 			// channel is not nsfw, so get a SFW post
-			post, err = getRandomRedditPost(&nsfw, subreddits...)
+			post, err = getRandomRedditPost(ctx, &nsfw, subreddits...)
 		}
 	case redditRouletteSubCmdSFW:
 		tmp := false
-		post, err = getRandomRedditPost(&tmp, subreddits...)
+		post, err = getRandomRedditPost(ctx, &tmp, subreddits...)
 	case redditRouletteSubCmdNSFW:
 		if nsfw {
-			post, err = getRandomRedditPost(&nsfw, subreddits...)
+			post, err = getRandomRedditPost(ctx, &nsfw, subreddits...)
 		} else {
 			metadata, err := getInteractionMetaData(i)
 			if err != nil {
-				log.Error(err)
+				logFor(i).Error(err)
 				interactionFollowUpEphemeralError(s, i, true, err)
 				return
 			}
@@ -101,38 +174,42 @@ func redditRoulette(s *discordgo.Session, i *discordgo.InteractionCreate) {
 				Content: &content,
 			})
 			if err != nil {
-				log.Error(err)
+				logFor(i).Error(err)
 				interactionFollowUpEphemeralError(s, i, true, err)
 			}
 			return
 		}
 	default:
 		err = fmt.Errorf("reached unreachable case")
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 		return
 	}
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 		return
 	}
 	if post == nil {
 		err = fmt.Errorf("post is nil")
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 		return
 	}
 
+	if !post.NSFW && post.SubredditName != "" {
+		recentSubreddits.add(post.SubredditName)
+	}
+
 	embed, err := buildRedditPostEmbed(post)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 		return
 	}
 	if embed == nil {
 		err = fmt.Errorf("embed is nil")
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 		return
 	}
@@ -141,7 +218,7 @@ func redditRoulette(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		Embeds: &[]*discordgo.MessageEmbed{embed},
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 	}
 }
@@ -219,31 +296,31 @@ func embedRedditMedia(post *reddit.Post, embed *dg_helpers.Embed) {
 	}
 }
 
-func getRandomSubredditSFW() (*reddit.Subreddit, error) {
-	sub, _, err := redditClient().Subreddit.Random(redditCtx())
+func getRandomSubredditSFW(ctx context.Context) (*reddit.Subreddit, error) {
+	sub, _, err := redditClient().Subreddit.Random(ctx)
 	return sub, err
 }
 
-func getRandomSubredditNSFW() (*reddit.Subreddit, error) {
-	sub, _, err := redditClient().Subreddit.RandomNSFW(redditCtx())
+func getRandomSubredditNSFW(ctx context.Context) (*reddit.Subreddit, error) {
+	sub, _, err := redditClient().Subreddit.RandomNSFW(ctx)
 	return sub, err
 }
 
-func getRandomSubredditFromList(subreddits ...string) (*reddit.Subreddit, error) {
+func getRandomSubredditFromList(ctx context.Context, subreddits ...string) (*reddit.Subreddit, error) {
 	if len(subreddits) == 0 {
 		return nil, fmt.Errorf("empty subreddit list provided")
 	}
 	srStr := subreddits[rand.Intn(len(subreddits))]
-	sr, _, err := redditClient().Subreddit.Get(redditCtx(), srStr)
+	sr, _, err := redditClient().Subreddit.Get(ctx, srStr)
 	return sr, err
 }
 
-func getTopPosts(count int, subreddit string) ([]*reddit.Post, error) {
+func getTopPosts(ctx context.Context, count int, subreddit string) ([]*reddit.Post, error) {
 	if count > redditMaxPostsPerRequest {
 		log.Warnf("Request for %d exceeds max posts per request, retrieving only %d", count, redditMaxPostsPerRequest)
 		count = redditMaxPostsPerRequest
 	}
-	posts, _, err := redditClient().Subreddit.TopPosts(redditCtx(), subreddit, &reddit.ListPostOptions{
+	posts, _, err := redditClient().Subreddit.TopPosts(ctx, subreddit, &reddit.ListPostOptions{
 		ListOptions: reddit.ListOptions{
 			Limit: count,
 		},
@@ -255,12 +332,12 @@ func getTopPosts(count int, subreddit string) ([]*reddit.Post, error) {
 // Ensures post is marked sfw or nsfw based on
 // the 'nsfw' parameter. If the 'nsfw' parameter
 // is nil, no check is done.
-func getRandomRedditPost(nsfw *bool, subreddits ...string) (*reddit.Post, error) {
+func getRandomRedditPost(ctx context.Context, nsfw *bool, subreddits ...string) (*reddit.Post, error) {
 	if len(subreddits) == 0 {
 		return nil, fmt.Errorf(`at least one subreddit, or "all" must be provided`)
 	}
 	if nsfw == nil {
-		post, _, err := redditClient().Post.RandomFromSubreddits(redditCtx(), subreddits...)
+		post, _, err := redditClient().Post.RandomFromSubreddits(ctx, subreddits...)
 		if err != nil {
 			return nil, err
 		}
@@ -283,11 +360,11 @@ func getRandomRedditPost(nsfw *bool, subreddits ...string) (*reddit.Post, error)
 	var sub *reddit.Subreddit
 	var err error
 	if !allSubsEligible {
-		sub, err = getRandomSubredditFromList(subreddits...)
+		sub, err = getRandomSubredditFromList(ctx, subreddits...)
 	} else if *nsfw {
-		sub, err = getRandomSubredditNSFW()
+		sub, err = getRandomSubredditNSFW(ctx)
 	} else {
-		sub, err = getRandomSubredditSFW()
+		sub, err = getRandomSubredditSFW(ctx)
 	}
 	if err != nil {
 		return nil, err
@@ -296,7 +373,7 @@ func getRandomRedditPost(nsfw *bool, subreddits ...string) (*reddit.Post, error)
 		return nil, fmt.Errorf("nil subreddit retrieved")
 	}
 
-	posts, err := getTopPosts(redditMaxPostsPerRequest, sub.Name)
+	posts, err := getTopPosts(ctx, redditMaxPostsPerRequest, sub.Name)
 	if err != nil {
 		return nil, err
 	}
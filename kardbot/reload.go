@@ -0,0 +1,310 @@
+package kardbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+	"go.uber.org/atomic"
+)
+
+const (
+	reloadCmd = "reload"
+
+	// How long to wait for a burst of file events to settle before reloading.
+	// Editors often write a file in several steps.
+	configWatchDebounce = time.Second
+)
+
+// hotConfig holds a value parsed from a content configuration file.
+// The value is swapped out wholesale on reload, so readers never
+// observe a partially applied configuration.
+type hotConfig[T any] struct {
+	p atomic.Pointer[T]
+}
+
+// Load returns the current value, or the zero value if nothing has been stored.
+func (h *hotConfig[T]) Load() T {
+	if p := h.p.Load(); p != nil {
+		return *p
+	}
+	var zero T
+	return zero
+}
+
+func (h *hotConfig[T]) Store(v T) {
+	h.p.Store(&v)
+}
+
+// A content configuration file that can be re-read while the bot is running.
+type reloadableConfig struct {
+	file string
+	// Parses and validates the file. Nothing may be modified until the
+	// returned commit function is called.
+	parse func() (commit func(), err error)
+}
+
+// Any configuration file that can safely be reloaded at runtime belongs in this list.
+func reloadableConfigs() []reloadableConfig {
+	return []reloadableConfig{
+		{complimentListFilepath, parseCompliments},
+		{creepyDmListFilepath, parseCreepyDMs},
+		{greetingAndFarewellConfigFile, parseGreetingsAndFarewells},
+		{hfModelsFilepath, parseHFModels},
+		{localesDir, parseMessageCatalogs},
+		{madlibConfigFile, parseMadlibConfig},
+		{PastaConfigFile, parsePastas},
+		{StoryTimeConfigFile, parseStoryTimeConfig},
+	}
+}
+
+// Serializes reloads triggered by the file watcher and /reload.
+var reloadMutex sync.Mutex
+
+// parseContentConfigs parses every reloadable config file. If any file
+// fails to parse or validate, all errors are returned and nothing is committed.
+func parseContentConfigs() ([]func(), error) {
+	commits := []func(){}
+	errs := []error{}
+	for _, rc := range reloadableConfigs() {
+		commit, err := rc.parse()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", rc.file, err))
+			continue
+		}
+		commits = append(commits, commit)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return commits, nil
+}
+
+func loadContentConfigs() error {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	commits, err := parseContentConfigs()
+	if err != nil {
+		return err
+	}
+	for _, commit := range commits {
+		commit()
+	}
+	return nil
+}
+
+// reloadContentConfigs re-reads every reloadable config file and swaps in the
+// results. If any command definitions changed as a result (e.g. new choices),
+// the registered commands are synced with Discord, and the names of the
+// changed commands are returned.
+func reloadContentConfigs(s discordSession) ([]string, error) {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	commits, err := parseContentConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	before := commandDefinitionsByName()
+	for _, commit := range commits {
+		commit()
+	}
+	log.Infof("Reloaded %d config files", len(commits))
+
+	changed := []*discordgo.ApplicationCommand{}
+	for _, def := range getCommands() {
+		if before[def.Name] != string(mustMarshal(def)) {
+			changed = append(changed, def)
+		}
+	}
+
+	names := make([]string, len(changed))
+	for idx, def := range changed {
+		names[idx] = def.Name
+	}
+	if len(changed) == 0 {
+		return names, nil
+	}
+	_, err = syncAllCommands(s)
+	return names, err
+}
+
+// commandDefinitionsByName maps each application command name to its serialized definition.
+func commandDefinitionsByName() map[string]string {
+	defs := map[string]string{}
+	for _, def := range getCommands() {
+		defs[def.Name] = string(mustMarshal(def))
+	}
+	return defs
+}
+
+func mustMarshal(v any) []byte {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return buf
+}
+
+// syncAllCommands syncs the registered commands with getCommands
+// everywhere the bot registers commands on startup. Only the commands
+// that differ are created, edited, or deleted.
+func syncAllCommands(s discordSession) ([]commandChange, error) {
+	cmds := getCommands()
+	changes := []commandChange{}
+	errs := []error{}
+	for _, guildID := range commandScopes() {
+		c, err := syncCommands(s, guildID, cmds, false)
+		changes = append(changes, c...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	err := errors.Join(errs...)
+	if err != nil {
+		raiseAlert(alert{
+			Severity: severityError,
+			Title:    "Command registration failed",
+			Message:  err.Error(),
+		})
+	}
+	return changes, err
+}
+
+// watchContentConfigs reloads the content configuration whenever one of
+// its files changes on disk. The returned watcher must be closed to stop watching.
+func (kbot *kardbot) watchContentConfigs() (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	// Watch directories rather than files, since many editors save
+	// by replacing the file, which would silently end a file watch.
+	// Some configs are directories of files, any of which may change.
+	files := map[string]bool{}
+	dirs := map[string]bool{}
+	configDirs := map[string]bool{}
+	for _, rc := range reloadableConfigs() {
+		if info, err := os.Stat(rc.file); err == nil && info.IsDir() {
+			configDirs[filepath.Clean(rc.file)] = true
+			dirs[filepath.Clean(rc.file)] = true
+			continue
+		}
+		files[filepath.Clean(rc.file)] = true
+		dirs[filepath.Dir(rc.file)] = true
+	}
+	for dir := range dirs {
+		if err = watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+
+	goSafely("config-watcher", func() {
+		var timer *time.Timer
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				changed := filepath.Clean(event.Name)
+				if !files[changed] && !configDirs[filepath.Dir(changed)] || event.Has(fsnotify.Chmod) {
+					continue
+				}
+				log.Debugf("Config file changed: %s", event)
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(configWatchDebounce, func() {
+					defer func() {
+						if r := recover(); r != nil {
+							logPanic("config-reload", nil, newPanicError(r))
+						}
+					}()
+					cmds, err := reloadContentConfigs(kbot.api)
+					if err != nil {
+						log.Errorf("Failed to reload config: %v", err)
+						raiseAlert(alert{
+							Severity: severityWarning,
+							Title:    "Config reload failed",
+							Message:  fmt.Sprintf("The previous config is still in use.\n```\n%v\n```", err),
+						})
+						return
+					}
+					if len(cmds) > 0 {
+						log.Infof("Synced commands after config reload: %s", strings.Join(cmds, ", "))
+					}
+				})
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Error(err)
+			}
+		}
+	})
+
+	return watcher, nil
+}
+
+func init() {
+	registerCommand(&command{
+		name:       reloadCmd,
+		definition: reloadCmdDefinition,
+		handler:    handleReloadCmd,
+		metadata:   CommandMetadata{Privilege: privilegeBotAdmin},
+	})
+}
+
+func reloadCmdDefinition() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        reloadCmd,
+		Description: "Reload the bot's content configuration from disk. Only works for bot admins.",
+	}
+}
+
+func handleReloadCmd(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
+	// Reloading may involve network requests to validate models,
+	// so defer the response in case it takes a while.
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+	})
+	if err != nil {
+		logFor(i).Error(err)
+		interactionRespondEphemeralError(s, i, false, err)
+		return
+	}
+
+	cmds, err := reloadContentConfigs(s)
+	if err != nil {
+		logFor(i).Error(err)
+		interactionFollowUpEphemeralError(s, i, false, err)
+		return
+	}
+
+	content := "Configuration reloaded."
+	if len(cmds) > 0 {
+		content += fmt.Sprintf(" Synced `/%s`.", strings.Join(cmds, "`, `/"))
+	}
+	_, err = s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+		Content: content,
+		Flags:   discordgo.MessageFlagsEphemeral,
+	})
+	if err != nil {
+		logFor(i).Error(err)
+	}
+}
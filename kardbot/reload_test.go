@@ -0,0 +1,100 @@
+package kardbot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// inTempConfigDir runs the test from a temporary directory containing the
+// given files, so that relative config paths resolve to them.
+func inTempConfigDir(t *testing.T, files map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestParsePastasValidates(t *testing.T) {
+	prev := pastaCfg.Load()
+	t.Cleanup(func() { pastaCfg.Store(prev) })
+
+	cases := map[string]string{
+		"missing file":   `{"pastas": [{"name": "a", "file": "assets/missing.txt"}]}`,
+		"duplicate name": `{"pastas": [{"name": "a", "file": "assets/a.txt"}, {"name": "a", "file": "assets/a.txt"}]}`,
+		"no pastas":      `{"pastas": []}`,
+		"bad json":       `{"pastas": [`,
+	}
+	for name, cfg := range cases {
+		t.Run(name, func(t *testing.T) {
+			inTempConfigDir(t, map[string]string{PastaConfigFile: cfg, "assets/a.txt": "pasta"})
+			if _, err := parsePastas(); err == nil {
+				t.Errorf("invalid config was accepted")
+			}
+		})
+	}
+
+	inTempConfigDir(t, map[string]string{
+		PastaConfigFile: `{"pastas": [{"name": "b", "file": "assets/b.txt"}, {"name": "a", "file": "assets/a.txt"}]}`,
+		"assets/a.txt":  "pasta",
+		"assets/b.txt":  "pasta",
+	})
+	commit, err := parsePastas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := pastaMenu()["b"]; ok {
+		t.Errorf("config was modified before commit")
+	}
+	commit()
+
+	names := pastaNames()
+	if len(names) != 3 || names[0] != "a" || names[1] != "b" || names[2] != "random" {
+		t.Errorf("unexpected names %v", names)
+	}
+}
+
+func TestSyncAllCommands(t *testing.T) {
+	fake := newTestBot(t)
+	stale := &discordgo.ApplicationCommand{Name: "test-cmd", Description: "stale"}
+	if _, err := fake.ApplicationCommandCreate(fake.SelfUser().ID, "", stale); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := syncAllCommands(fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := len(getCommands()) + 1; len(changes) != want {
+		t.Errorf("expected %d changes, got %d", want, len(changes))
+	}
+	if cmds := fake.Commands(""); len(cmds) != len(getCommands()) {
+		t.Errorf("expected only the bot's commands to be registered, got %d", len(cmds))
+	}
+
+	if changes, err = syncAllCommands(fake); err != nil || len(changes) != 0 {
+		t.Errorf("commands in sync were changed again: %v, %v", changes, err)
+	}
+}
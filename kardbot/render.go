@@ -2,6 +2,7 @@ package kardbot
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -10,6 +11,7 @@ import (
 	"image/png"
 	"math/rand"
 	"mime"
+	"sort"
 	"strings"
 
 	"github.com/Kardbord/Kard-bot/kardbot/config"
@@ -46,36 +48,94 @@ const (
 	dalle3OptStyle   = "style"
 )
 
-func handleRenderCmd(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func init() {
+	registerCommand(&command{
+		name:       renderCmd,
+		definition: renderCmdDefinition,
+		handler:    handleRenderCmd,
+		autocomplete: autocompleteOptions(map[string]func(string) []string{
+			hfModelOptCustom: suggestHFModels,
+		}),
+	})
+}
+
+func renderCmdDefinition() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        renderCmd,
+		Description: "Ask an AI to generate an image from a prompt.",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        dalle2SubCmd,
+				Description: "Ask Open AI's DALL·E 2 model to generate an image from a prompt.",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options:     dalle2Opts(),
+			},
+			{
+				Name:        dalle3SubCmd,
+				Description: "Ask Open AI's DALL·E 3 model to generate an image from a prompt.",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options:     dalle3Opts(),
+			},
+			{
+				Name:        hfSubCmd,
+				Description: "Ask a HuggingFace model to generate an image from a prompt.",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options:     hfOpts(),
+			},
+		},
+	}
+}
+
+func handleRenderCmd(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
 
 	switch i.ApplicationCommandData().Options[0].Name {
 	case hfSubCmd:
-		handleHfSubCmd(s, i, i.ApplicationCommandData().Options[0].Options)
+		handleHfSubCmd(ctx, s, i, i.ApplicationCommandData().Options[0].Options)
 	case dalle2SubCmd:
-		handleDalle2SubCmd(s, i, i.ApplicationCommandData().Options[0].Options)
+		handleDalle2SubCmd(ctx, s, i, i.ApplicationCommandData().Options[0].Options)
 	case dalle3SubCmd:
-		handleDalle3SubCmd(s, i, i.ApplicationCommandData().Options[0].Options)
+		handleDalle3SubCmd(ctx, s, i, i.ApplicationCommandData().Options[0].Options)
 	default:
 		err = fmt.Errorf("reached unreachable case")
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 	}
 }
 
-var hfModels = func() []*discordgo.ApplicationCommandOptionChoice { return nil }
+type hfModelConfig struct {
+	choices []*discordgo.ApplicationCommandOptionChoice
+	// A mapping of model names to keywords for that model
+	keyWords map[string][]string
+}
+
+var hfModelCfg hotConfig[hfModelConfig]
+
+func hfModels() []*discordgo.ApplicationCommandOptionChoice { return hfModelCfg.Load().choices }
 
 // A mapping of model names to keywords for that model
-var hfModelKeyWords = func() map[string][]string { return nil }
+func hfModelKeyWords() map[string][]string { return hfModelCfg.Load().keyWords }
+
+// suggestHFModels suggests configured models for the custom model option.
+// Any other model on huggingface.co can still be typed in full.
+func suggestHFModels(typed string) []string {
+	models := make([]string, 0, len(hfModels()))
+	for _, choice := range hfModels() {
+		if choice.Name != hfModelOptCustom {
+			models = append(models, choice.Name)
+		}
+	}
+	return fuzzyMatch(typed, models, maxDiscordOptionChoices)
+}
 
-func init() {
+func parseHFModels() (func(), error) {
 	cfg := struct {
 		// A map of model names to activation words for the model
 		Models map[string][]string `json:"models"`
@@ -83,12 +143,12 @@ func init() {
 
 	jsonCfg, err := config.NewJsonConfig(hfModelsFilepath)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	err = json.Unmarshal(jsonCfg.Raw, &cfg)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	modelChoices := []*discordgo.ApplicationCommandOptionChoice{}
@@ -102,14 +162,18 @@ func init() {
 			Value: model,
 		})
 	}
+	// Keep the order stable so that reloads can tell whether the choices changed.
+	sort.Slice(modelChoices, func(i, j int) bool { return modelChoices[i].Name < modelChoices[j].Name })
 
-	modelChoices[len(modelChoices)-1] = &discordgo.ApplicationCommandOptionChoice{
+	modelChoices = append(modelChoices, &discordgo.ApplicationCommandOptionChoice{
 		Name:  hfModelOptCustom,
 		Value: hfModelOptCustom,
+	})
+	if len(modelChoices) > maxDiscordOptionChoices {
+		return nil, fmt.Errorf("%d models (including %s) exceeds the maximum of %d", len(modelChoices), hfModelOptCustom, maxDiscordOptionChoices)
 	}
 
-	hfModels = func() []*discordgo.ApplicationCommandOptionChoice { return modelChoices }
-	hfModelKeyWords = func() map[string][]string { return cfg.Models }
+	return func() { hfModelCfg.Store(hfModelConfig{choices: modelChoices, keyWords: cfg.Models}) }, nil
 }
 
 func hfOpts() []*discordgo.ApplicationCommandOption {
@@ -128,10 +192,11 @@ func hfOpts() []*discordgo.ApplicationCommandOption {
 			Required:    true,
 		},
 		{
-			Type:        discordgo.ApplicationCommandOptionString,
-			Name:        hfModelOptCustom,
-			Description: "Any text-to-image model from huggingface.co",
-			Required:    false,
+			Type:         discordgo.ApplicationCommandOptionString,
+			Name:         hfModelOptCustom,
+			Description:  "Any text-to-image model from huggingface.co",
+			Required:     false,
+			Autocomplete: true,
 		},
 		{
 			Type:        discordgo.ApplicationCommandOptionString,
@@ -166,7 +231,7 @@ func hfOpts() []*discordgo.ApplicationCommandOption {
 	}
 }
 
-func handleHfSubCmd(s *discordgo.Session, i *discordgo.InteractionCreate, opts []*discordgo.ApplicationCommandInteractionDataOption) {
+func handleHfSubCmd(ctx context.Context, s discordSession, i *discordgo.InteractionCreate, opts []*discordgo.ApplicationCommandInteractionDataOption) {
 	t2imgRequest := hfapigo.TextToImageRequest{}
 	t2imgRequest.Options = *hfapigo.NewOptions().SetUseCache(false).SetWaitForModel(true)
 	model := ""
@@ -190,7 +255,7 @@ func handleHfSubCmd(s *discordgo.Session, i *discordgo.InteractionCreate, opts [
 		case hfModelOptCustom:
 			customModel = opt.StringValue()
 		default:
-			log.Warn("Unknown option:", opt.Name)
+			logFor(i).Warn("Unknown option:", opt.Name)
 		}
 	}
 
@@ -208,9 +273,9 @@ func handleHfSubCmd(s *discordgo.Session, i *discordgo.InteractionCreate, opts [
 	unalteredInput := t2imgRequest.Inputs
 	t2imgRequest.Inputs = fmt.Sprintf("%s%s", modelKeyWords[rand.Intn(len(modelKeyWords))], t2imgRequest.Inputs)
 
-	img, imgFmt, err := hfapigo.SendTextToImageRequest(model, &t2imgRequest)
+	img, imgFmt, err := textToImageRequest(ctx, model, &t2imgRequest)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, false, err)
 		return
 	}
@@ -228,7 +293,7 @@ func handleHfSubCmd(s *discordgo.Session, i *discordgo.InteractionCreate, opts [
 		err = fmt.Errorf("unsupported image type (%s) returned", imgFmt)
 	}
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 		return
 	}
@@ -245,7 +310,7 @@ func handleHfSubCmd(s *discordgo.Session, i *discordgo.InteractionCreate, opts [
 		},
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 	}
 }
@@ -281,10 +346,10 @@ func dalle2Opts() []*discordgo.ApplicationCommandOption {
 	}
 }
 
-func handleDalle2SubCmd(s *discordgo.Session, i *discordgo.InteractionCreate, opts []*discordgo.ApplicationCommandInteractionDataOption) {
+func handleDalle2SubCmd(ctx context.Context, s discordSession, i *discordgo.InteractionCreate, opts []*discordgo.ApplicationCommandInteractionDataOption) {
 	mdata, err := getInteractionMetaData(i)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 		return
 	}
@@ -292,27 +357,27 @@ func handleDalle2SubCmd(s *discordgo.Session, i *discordgo.InteractionCreate, op
 	prompt := opts[0].StringValue()
 	size := opts[1].StringValue()
 	imageCount := uint64(1)
-	resp, modr, err := images.MakeModeratedCreationRequest(&images.CreationRequest{
+	resp, modr, err := moderatedImageRequest(ctx, &images.CreationRequest{
 		Model:          images.ModelDalle2,
 		Prompt:         prompt,
 		N:              &imageCount,
 		Size:           size,
 		ResponseFormat: images.ResponseFormatB64JSON,
 		User:           mdata.AuthorID,
-	}, nil)
+	})
 	if err != nil {
 		targetErr := moderations.NewModerationFlagError()
 		if errors.As(err, &targetErr) {
 			contentFlags, err := json.MarshalIndent(modr.Results[0].Categories, "", "  ")
 			if err != nil {
-				log.Error(err)
+				logFor(i).Error(err)
 				contentFlags = []byte("Whoops, couldn't retrieve the details of your violation.")
 			}
 			interactionFollowUpEphemeralError(s, i, false, fmt.Errorf("sorry! Your prompt does not appear to conform to [Open AI's Usage Policies](<https://beta.openai.com/docs/usage-policies>)\n```JSON\n%s\n```", contentFlags))
 		} else if strings.Contains(err.Error(), "safety system") {
 			interactionFollowUpEphemeralError(s, i, false, err)
 		} else {
-			log.Error(err)
+			logFor(i).Error(err)
 			interactionFollowUpEphemeralError(s, i, true, err)
 		}
 		return
@@ -320,7 +385,7 @@ func handleDalle2SubCmd(s *discordgo.Session, i *discordgo.InteractionCreate, op
 
 	unbased, err := base64.StdEncoding.DecodeString(resp.Data[0].B64JSON)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 		return
 	}
@@ -340,7 +405,7 @@ func handleDalle2SubCmd(s *discordgo.Session, i *discordgo.InteractionCreate, op
 		},
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 	}
 }
@@ -408,10 +473,10 @@ func dalle3Opts() []*discordgo.ApplicationCommandOption {
 	}
 }
 
-func handleDalle3SubCmd(s *discordgo.Session, i *discordgo.InteractionCreate, opts []*discordgo.ApplicationCommandInteractionDataOption) {
+func handleDalle3SubCmd(ctx context.Context, s discordSession, i *discordgo.InteractionCreate, opts []*discordgo.ApplicationCommandInteractionDataOption) {
 	mdata, err := getInteractionMetaData(i)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 		return
 	}
@@ -434,24 +499,24 @@ func handleDalle3SubCmd(s *discordgo.Session, i *discordgo.InteractionCreate, op
 		case dalle3OptStyle:
 			request.Style = opt.StringValue()
 		default:
-			log.Warn("Unknown option:", opt.Name)
+			logFor(i).Warn("Unknown option:", opt.Name)
 		}
 	}
 
-	resp, modr, err := images.MakeModeratedCreationRequest(request, nil)
+	resp, modr, err := moderatedImageRequest(ctx, request)
 	if err != nil {
 		targetErr := moderations.NewModerationFlagError()
 		if errors.As(err, &targetErr) {
 			contentFlags, err := json.MarshalIndent(modr.Results[0].Categories, "", "  ")
 			if err != nil {
-				log.Error(err)
+				logFor(i).Error(err)
 				contentFlags = []byte("Whoops, couldn't retrieve the details of your violation.")
 			}
 			interactionFollowUpEphemeralError(s, i, false, fmt.Errorf("sorry! Your prompt does not appear to conform to [Open AI's Usage Policies](<https://beta.openai.com/docs/usage-policies>)\n```JSON\n%s\n```", contentFlags))
 		} else if strings.Contains(err.Error(), "safety system") {
 			interactionFollowUpEphemeralError(s, i, false, err)
 		} else {
-			log.Error(err)
+			logFor(i).Error(err)
 			interactionFollowUpEphemeralError(s, i, true, err)
 		}
 		return
@@ -459,7 +524,7 @@ func handleDalle3SubCmd(s *discordgo.Session, i *discordgo.InteractionCreate, op
 
 	unbased, err := base64.StdEncoding.DecodeString(resp.Data[0].B64JSON)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 		return
 	}
@@ -479,7 +544,7 @@ func handleDalle3SubCmd(s *discordgo.Session, i *discordgo.InteractionCreate, op
 		},
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 	}
 }
@@ -0,0 +1,145 @@
+package kardbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Kardbord/Kard-bot/kardbot/dg_helpers"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	reportCmd         = "report"
+	reportMessageMenu = "Report to mods"
+
+	reportFormID     = "report-form"
+	reportFormReason = "reason"
+)
+
+// reportForm asks why a message is being reported before it is sent to
+// the guild's report channel.
+var reportForm = &modalForm{
+	id:      reportFormID,
+	title:   "Report to mods",
+	command: reportCmd,
+	fields: []formField{
+		{id: reportFormReason, label: "What's wrong with this message?", paragraph: true, required: true, maxLength: 1000},
+	},
+	submit: submitReportForm,
+}
+
+var reportFormModal, reportFormRetry = reportForm.routes()
+
+// IDs of /report response messages.
+const (
+	msgReportNotSetUp     = "report.not-set-up"
+	msgReportNoReason     = "report.no-reason"
+	msgReportTurnedOff    = "report.turned-off"
+	msgReportNotDelivered = "report.not-delivered"
+	msgReportSent         = "report.sent"
+)
+
+func init() {
+	registerMessages(map[string]string{
+		msgReportNotSetUp:     "this server hasn't set up reports yet; a moderator can turn them on with `/%s`",
+		msgReportNoReason:     "please say why you're reporting this message",
+		msgReportTurnedOff:    "reports have been turned off in this server",
+		msgReportNotDelivered: "your report could not be delivered, please let a moderator know directly",
+		msgReportSent:         "Thanks, the moderators have been notified. 🛡️",
+	})
+	registerCommand(&command{
+		name: reportCmd,
+		metadata: CommandMetadata{
+			GuildOnly: true,
+		},
+		contextMenus: []contextMenu{
+			{name: reportMessageMenu, target: discordgo.MessageApplicationCommand, handler: reportMessage},
+		},
+		components: []interactionRoute{reportFormRetry},
+		modals:     []interactionRoute{reportFormModal},
+	})
+}
+
+func reportMessage(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
+	if settingsFor(i.GuildID).ReportChannelID == "" {
+		interactionRespondEphemeralError(s, i, false, errors.New(localized(i, msgReportNotSetUp, settingsCmd+" "+settingsSubCmdReports)))
+		return
+	}
+	reportForm.open(s, i, nil)
+}
+
+func submitReportForm(s discordSession, i *discordgo.InteractionCreate, values formValues, origin *discordgo.InteractionCreate) error {
+	reason := strings.TrimSpace(values[reportFormReason])
+	if reason == "" {
+		return errors.New(localized(i, msgReportNoReason))
+	}
+
+	mdata, err := getInteractionMetaData(i)
+	if err != nil {
+		logFor(i).Error(err)
+		interactionRespondEphemeralError(s, i, true, err)
+		return nil
+	}
+	msg, err := targetMessage(origin)
+	if err != nil {
+		logFor(i).Error(err)
+		interactionRespondEphemeralError(s, i, true, err)
+		return nil
+	}
+	// Reports may have been turned off while the form was open.
+	reportChannelID := settingsFor(mdata.GuildID).ReportChannelID
+	if reportChannelID == "" {
+		interactionRespondEphemeralError(s, i, false, errors.New(localized(i, msgReportTurnedOff)))
+		return nil
+	}
+
+	channelID := msg.ChannelID
+	if channelID == "" {
+		channelID = origin.ChannelID
+	}
+	author := "Unknown"
+	if msg.Author != nil {
+		author = fmt.Sprintf("<@%s> (%s)", msg.Author.ID, msg.Author.Username)
+	}
+	content := msg.Content
+	if strings.TrimSpace(content) == "" {
+		content = "*No text*"
+	}
+
+	color, _ := fastHappyColorInt64()
+	embed := dg_helpers.NewEmbed().
+		SetTitle("🚩 Message reported").
+		SetColor(int(color)).
+		SetDescription(content).
+		AddField("Author", author).
+		AddField("Channel", fmt.Sprintf("<#%s>", channelID)).
+		AddField("Reported by", fmt.Sprintf("<@%s>", mdata.AuthorID)).
+		AddField("Reason", reason).
+		AddField("Message", fmt.Sprintf("[Jump to message](%s)", messageLink(mdata.GuildID, channelID, msg.ID))).
+		SetTimestamp().
+		Truncate()
+
+	_, err = s.ChannelMessageSendComplex(reportChannelID, &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{embed.MessageEmbed},
+	})
+	if err != nil {
+		logFor(i).Errorf("Could not post report to channel %s: %v", reportChannelID, err)
+		interactionRespondEphemeralError(s, i, false, errors.New(localized(i, msgReportNotDelivered)))
+		return nil
+	}
+	logFor(i).Infof("%s reported message %s", mdata.AuthorUsername, msg.ID)
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: localized(i, msgReportSent),
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		logFor(i).Error(err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package kardbot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestReportMessage(t *testing.T) {
+	fake := newTestBot(t)
+	target := &discordgo.Message{ID: fake.NewID(), ChannelID: testChannelID, Content: "something rude", Author: testSelf}
+
+	i := fake.MessageCommand(reportMessageMenu, target, inTestGuild()...)
+	bot().routeInteraction(fake, i)
+	if resp := mustRespond(t, fake, i); !isEphemeral(resp) || !strings.Contains(resp.Initial.Data.Content, settingsSubCmdReports) {
+		t.Fatalf("expected reports to be disabled, got %+v", resp.Initial.Data)
+	}
+
+	modsChannel := &discordgo.Channel{ID: fake.NewID(), GuildID: testGuildID, Name: "mods", Type: discordgo.ChannelTypeGuildText}
+	fake.AddChannel(modsChannel)
+	if _, err := updateSettings(testGuildID, func(gs *guildSettings) { gs.ReportChannelID = modsChannel.ID }); err != nil {
+		t.Fatal(err)
+	}
+
+	i = fake.MessageCommand(reportMessageMenu, target, inTestGuild()...)
+	bot().routeInteraction(fake, i)
+	submit := submitForm(fake, openedForm(t, fake, i), map[string]string{reportFormReason: "it was rude"})
+	if resp := mustRespond(t, fake, submit); !isEphemeral(resp) || !strings.Contains(resp.Initial.Data.Content, "Thanks") {
+		t.Errorf("expected an ephemeral thank you, got %+v", resp.Initial.Data)
+	}
+
+	reports := fake.Messages(modsChannel.ID)
+	if len(reports) != 1 || len(reports[0].Embeds) != 1 {
+		t.Fatalf("expected one report in the report channel, got %+v", reports)
+	}
+	embed := reports[0].Embeds[0]
+	if embed.Description != target.Content {
+		t.Errorf("report is missing the message: %+v", embed)
+	}
+	fields := ""
+	for _, f := range embed.Fields {
+		fields += f.Value + "\n"
+	}
+	for _, want := range []string{"it was rude", testUser.ID, messageLink(testGuildID, testChannelID, target.ID)} {
+		if !strings.Contains(fields, want) {
+			t.Errorf("report is missing %q: %s", want, fields)
+		}
+	}
+}
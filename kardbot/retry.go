@@ -0,0 +1,167 @@
+package kardbot
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// retryPolicy is how many times, and how patiently, a failed request is
+// retried. The delay doubles after each attempt, up to MaxDelay.
+type retryPolicy struct {
+	// Attempts in total, including the first.
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+var defaultRetryPolicy = retryPolicy{
+	Attempts:  4,
+	BaseDelay: 250 * time.Millisecond,
+	MaxDelay:  5 * time.Second,
+}
+
+// backoff returns how long to wait after the given failed attempt,
+// counting from 1. Half of the delay is random, so that requests that
+// failed together aren't all retried together.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	d := math.Min(float64(p.BaseDelay)*math.Pow(2, float64(attempt-1)), float64(p.MaxDelay))
+	return time.Duration(d/2 + rand.Float64()*d/2)
+}
+
+// retryTransport retries requests that failed in a way that is likely to
+// be temporary, such as being rate limited, a server error, or a dropped
+// connection. Requests are only repeated if doing so can't act on them
+// twice, unless their context was made with withRetry.
+type retryTransport struct {
+	next   http.RoundTripper
+	policy retryPolicy
+}
+
+func newRetryTransport(next http.RoundTripper) retryTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return retryTransport{next: next, policy: defaultRetryPolicy}
+}
+
+// retryClient wraps an HTTP client's transport with retryTransport. c
+// must belong to the bot, rather than being shared like http.DefaultClient.
+func retryClient(c *http.Client) {
+	c.Transport = newRetryTransport(c.Transport)
+}
+
+type retryAnyMethodKey struct{}
+
+// withRetry marks requests made with ctx as safe to repeat after a server
+// error or a dropped connection, whatever their method. Use it for requests
+// that do no harm if acted on twice, such as an edit that sets a message to
+// the same thing again.
+func withRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryAnyMethodKey{}, true)
+}
+
+// safeToRepeat reports whether req can be sent again even though it may
+// already have been acted on.
+func safeToRepeat(req *http.Request) bool {
+	return idempotent(req.Method) || req.Context().Value(retryAnyMethodKey{}) != nil
+}
+
+func (t retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		wait, retry := retryable(req, resp, err)
+		if !retry || attempt >= t.policy.Attempts || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+		if wait == 0 {
+			wait = t.policy.backoff(attempt)
+		} else if wait > t.policy.MaxDelay {
+			// Leave long waits to the caller, which may know better.
+			return resp, err
+		}
+
+		reason := "error"
+		if resp != nil {
+			reason = strconv.Itoa(resp.StatusCode)
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		outboundRetriesTotal.WithLabelValues(req.URL.Host, reason).Inc()
+		// The path is left out, since webhook and interaction URLs hold tokens.
+		log.Debugf("Retrying %s %s in %s after %s (attempt %d of %d)", req.Method, req.URL.Host, wait.Round(time.Millisecond), reason, attempt+1, t.policy.Attempts)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// retryable reports whether a request that got resp or err is worth
+// retrying, and how long the server asked to wait first, if it did.
+func retryable(req *http.Request, resp *http.Response, err error) (time.Duration, bool) {
+	if err != nil {
+		if req.Context().Err() != nil {
+			return 0, false
+		}
+		// A request that never got through can always be sent again.
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return 0, true
+		}
+		return 0, safeToRepeat(req)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		// The request was turned away before it was acted on.
+		return retryAfter(resp.Header), true
+	}
+	return 0, resp.StatusCode >= http.StatusInternalServerError && safeToRepeat(req)
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryAfter parses a Retry-After header, given in either seconds or as
+// a date. Discord sends fractional seconds.
+func retryAfter(h http.Header) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(v, 64); err == nil {
+		return time.Duration(math.Max(seconds, 0) * float64(time.Second))
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
@@ -0,0 +1,165 @@
+package kardbot
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyServer fails the first failures requests it gets with status,
+// and records the bodies of every request.
+type flakyServer struct {
+	*httptest.Server
+	mutex  sync.Mutex
+	bodies []string
+}
+
+func newFlakyServer(t *testing.T, failures, status int, retryAfter string) *flakyServer {
+	t.Helper()
+	srv := &flakyServer{}
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		srv.mutex.Lock()
+		srv.bodies = append(srv.bodies, string(body))
+		attempt := len(srv.bodies)
+		srv.mutex.Unlock()
+		if attempt <= failures {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(status)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func (srv *flakyServer) attempts() []string {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	return srv.bodies
+}
+
+func testRetryClient() *http.Client {
+	return &http.Client{Transport: retryTransport{
+		next:   http.DefaultTransport,
+		policy: retryPolicy{Attempts: 4, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond},
+	}}
+}
+
+func TestRetryTransportRetriesTemporaryFailures(t *testing.T) {
+	srv := newFlakyServer(t, 2, http.StatusServiceUnavailable, "")
+	resp, err := testRetryClient().Post(srv.URL, "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the request to succeed eventually, got %d", resp.StatusCode)
+	}
+	if got := srv.attempts(); len(got) != 3 || got[2] != "hello" {
+		t.Errorf("expected 3 attempts with the same body, got %q", got)
+	}
+}
+
+func TestRetryTransportOnlyRepeatsSafeRequests(t *testing.T) {
+	srv := newFlakyServer(t, 10, http.StatusInternalServerError, "")
+	client := testRetryClient()
+
+	resp, err := client.Post(srv.URL, "text/plain", strings.NewReader("once"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := srv.attempts(); len(got) != 1 {
+		t.Fatalf("a POST that may have been acted on was repeated: %q", got)
+	}
+
+	resp, err = client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := srv.attempts(); len(got) != 5 || resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected a GET to be tried 4 times before failing, got %d attempts and %d", len(got)-1, resp.StatusCode)
+	}
+}
+
+func TestRetryTransportRepeatsOptedInRequests(t *testing.T) {
+	srv := newFlakyServer(t, 1, http.StatusInternalServerError, "")
+	req, err := http.NewRequestWithContext(withRetry(context.Background()), http.MethodPatch, srv.URL, strings.NewReader("edit"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := testRetryClient().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := srv.attempts(); resp.StatusCode != http.StatusOK || len(got) != 2 || got[1] != "edit" {
+		t.Errorf("expected the PATCH to be repeated, got %d after %q", resp.StatusCode, got)
+	}
+}
+
+func TestRetryTransportRespectsRetryAfter(t *testing.T) {
+	srv := newFlakyServer(t, 1, http.StatusTooManyRequests, "0.005")
+	resp, err := testRetryClient().Post(srv.URL, "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(srv.attempts()) != 2 {
+		t.Errorf("expected the rate limited request to be retried, got %d after %d attempts", resp.StatusCode, len(srv.attempts()))
+	}
+
+	// Waits longer than the policy allows are left to the caller.
+	srv = newFlakyServer(t, 1, http.StatusTooManyRequests, "3600")
+	resp, err = testRetryClient().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || len(srv.attempts()) != 1 {
+		t.Errorf("expected the rate limit to be returned, got %d after %d attempts", resp.StatusCode, len(srv.attempts()))
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	cases := map[string]time.Duration{
+		"":        0,
+		"2":       2 * time.Second,
+		"0.25":    250 * time.Millisecond,
+		"-1":      0,
+		"garbage": 0,
+	}
+	for header, want := range cases {
+		h := http.Header{}
+		h.Set("Retry-After", header)
+		if got := retryAfter(h); got != want {
+			t.Errorf("Retry-After %q: expected %s, got %s", header, want, got)
+		}
+	}
+
+	h := http.Header{}
+	h.Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	if got := retryAfter(h); got <= 58*time.Second || got > time.Minute {
+		t.Errorf("expected about a minute, got %s", got)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := retryPolicy{Attempts: 10, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	for attempt, full := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		for n := 0; n < 20; n++ {
+			if d := p.backoff(attempt + 1); d < full/2 || d > full {
+				t.Fatalf("attempt %d: backoff %s outside [%s, %s]", attempt+1, d, full/2, full)
+			}
+		}
+	}
+}
@@ -1,11 +1,15 @@
 package kardbot
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math"
 	"regexp"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/Kardbord/Kard-bot/kardbot/dg_helpers"
 	"github.com/Kardbord/ubiquity/httputils"
@@ -24,12 +28,6 @@ const (
 const (
 	roleSelectMenuSubCmdCreate = "create"
 
-	roleSelectMenuCreateOptTitle        = "title"
-	roleSelectMenuCreateOptReqTitle     = true
-	roleSelectMenuCreateOptRoles        = "roles"
-	roleSelectMenuCreateOptReqRoles     = true
-	roleSelectMenuCreateOptDesc         = "description"
-	roleSelectMenuCreateOptReqDesc      = false
 	roleSelectMenuCreateOptURL          = "url"
 	roleSelectMenuCreateOptReqURL       = false
 	roleSelectMenuCreateOptImage        = "image-url"
@@ -40,14 +38,18 @@ const (
 	roleSelectMenuCreateOptReqColor     = false
 )
 const (
-	roleSelectMenuCreateOptIdxTitle = iota
-	roleSelectMenuCreateOptIdxRoles
-	roleSelectMenuCreateOptIdxDesc      // index only valid when registering the command, since this is an optional argument.
-	roleSelectMenuCreateOptIdxURL       // index only valid when registering the command, since this is an optional argument.
-	roleSelectMenuCreateOptIdxImage     // index only valid when registering the command, since this is an optional argument.
-	roleSelectMenuCreateOptIdxThumbnail // index only valid when registering the command, since this is an optional argument.
-	roleSelectMenuCreateOptIdxColor     // index only valid when registering the command, since this is an optional argument.
-	roleSelectMenuSubCmdCreateOptCount  // This MUST be the last constant defined in this block
+	roleSelectMenuCreateOptIdxURL       = iota // index only valid when registering the command, since this is an optional argument.
+	roleSelectMenuCreateOptIdxImage            // index only valid when registering the command, since this is an optional argument.
+	roleSelectMenuCreateOptIdxThumbnail        // index only valid when registering the command, since this is an optional argument.
+	roleSelectMenuCreateOptIdxColor            // index only valid when registering the command, since this is an optional argument.
+	roleSelectMenuSubCmdCreateOptCount         // This MUST be the last constant defined in this block
+)
+
+const (
+	roleSelectMenuFormID         = "role-select-form"
+	roleSelectMenuFormFieldTitle = "title"
+	roleSelectMenuFormFieldDesc  = "description"
+	roleSelectMenuFormFieldRoles = "roles"
 )
 
 const (
@@ -81,31 +83,109 @@ const (
 
 var roleSelectMenuIDRegex = regexp.MustCompile(fmt.Sprintf(`\b%s(?i)[0-9a-f]{8}\b-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-\b[0-9a-f]{12}\b`, roleSelectMenuComponentIDPrefix))
 
+// Collects the text of a new role select menu. The rest comes from the
+// options of the create subcommand.
+var roleSelectMenuForm = &modalForm{
+	id:      roleSelectMenuFormID,
+	title:   "Create a role selection menu",
+	command: roleSelectMenuCommand,
+	fields: []formField{
+		{
+			id:        roleSelectMenuFormFieldTitle,
+			label:     "Title",
+			required:  true,
+			maxLength: dg_helpers.EmbedLimitTitle,
+		},
+		{
+			id:        roleSelectMenuFormFieldDesc,
+			label:     "Description",
+			paragraph: true,
+			maxLength: dg_helpers.EmbedLimitDescription,
+		},
+		{
+			id:          roleSelectMenuFormFieldRoles,
+			label:       fmt.Sprintf("Roles, one per line (up to %d)", maxDiscordSelectMenuOpts*maxRoleSelectMenus),
+			placeholder: "Gamer 🎮 pinged for game nights\n@Artist share your art",
+			paragraph:   true,
+			required:    true,
+		},
+	},
+	submit: submitRoleSelectMenuForm,
+}
+
+// IDs of /role-select-menu response messages.
+const (
+	msgRoleSelectNoRoles        = "role-select.no-roles"
+	msgRoleSelectTooManyRoles   = "role-select.too-many-roles"
+	msgRoleSelectNoRoleFound    = "role-select.no-role-found"
+	msgRoleSelectDuplicateRole  = "role-select.duplicate-role"
+	msgRoleSelectContextTooLong = "role-select.context-too-long"
+	msgRoleSelectBadURL         = "role-select.bad-url"
+	msgRoleSelectBadThumbnail   = "role-select.bad-thumbnail"
+	msgRoleSelectNoMessage      = "role-select.no-message"
+	msgRoleSelectNotAMenu       = "role-select.not-a-menu"
+	msgRoleSelectOptionUpdated  = "role-select.option-updated"
+	msgRoleSelectOptionAdded    = "role-select.option-added"
+	msgRoleSelectMenuFull       = "role-select.menu-full"
+	msgRoleSelectNotInMenu      = "role-select.not-in-menu"
+	msgRoleSelectOptionRemoved  = "role-select.option-removed"
+	msgRoleSelectRolesUpdated   = "role-select.roles-updated"
+	msgRoleSelectRolesAdded     = "role-select.roles-added"
+	msgRoleSelectRolesRemoved   = "role-select.roles-removed"
+	msgRoleSelectNothingRemoved = "role-select.nothing-removed"
+)
+
+func init() {
+	registerMessages(map[string]string{
+		msgRoleSelectNoRoles:        "you must specify at least one role",
+		msgRoleSelectTooManyRoles:   "you may only specify up to %d roles",
+		msgRoleSelectNoRoleFound:    "no role found at the start of %q",
+		msgRoleSelectDuplicateRole:  "%s is listed more than once",
+		msgRoleSelectContextTooLong: "the context for %s is longer than %d characters",
+		msgRoleSelectBadURL:         "unreachable URL provided: %s",
+		msgRoleSelectBadThumbnail:   "unreachable thumbnail URL provided: %s",
+		msgRoleSelectNoMessage:      "could not find any message in this channel with ID: `%s`",
+		msgRoleSelectNotAMenu:       "provided message ID does not appear to contain a role select menu",
+		msgRoleSelectOptionUpdated:  "Updated existing menu option for %s",
+		msgRoleSelectOptionAdded:    "Added %s option to the menu",
+		msgRoleSelectMenuFull:       "You've reached the max number of buttons (%d) a Discord message can hold. You'll have to remove a menu option first or add a new role-select-menu.",
+		msgRoleSelectNotInMenu:      "%s is not present in the menu, nothing to do.",
+		msgRoleSelectOptionRemoved:  "%s was removed from the menu",
+		msgRoleSelectRolesUpdated:   "Your Roles Have Been Updated 🎭",
+		msgRoleSelectRolesAdded:     "Added Roles ✅",
+		msgRoleSelectRolesRemoved:   "Removed Roles ❌",
+		msgRoleSelectNothingRemoved: "No roles to remove",
+	})
+	formRoute, retryRoute := roleSelectMenuForm.routes()
+	registerCommand(&command{
+		name:       roleSelectMenuCommand,
+		definition: roleSelectMenuCmdDefinition,
+		handler:    handleRoleSelectMenuCommand,
+		metadata: CommandMetadata{
+			GuildOnly:   true,
+			Permissions: discordgo.PermissionManageRoles,
+		},
+		components: []interactionRoute{
+			{pattern: roleSelectMenuIDRegex, handler: handleRoleSelection},
+			{id: roleSelectResetButtonID, handler: handleRoleSelectReset},
+			retryRoute,
+		},
+		modals: []interactionRoute{formRoute},
+	})
+}
+
+func roleSelectMenuCmdDefinition() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        roleSelectMenuCommand,
+		Description: "Allow users to select roles for themselves",
+		Options:     roleSelectCmdOpts(),
+	}
+}
+
 func roleSelectMenuSubCmdCreateOpts() []*discordgo.ApplicationCommandOption {
 	opts := make([]*discordgo.ApplicationCommandOption, roleSelectMenuSubCmdCreateOptCount)
 	for i := range opts {
 		switch i {
-		case roleSelectMenuCreateOptIdxTitle:
-			opts[i] = &discordgo.ApplicationCommandOption{
-				Type:        discordgo.ApplicationCommandOptionString,
-				Name:        roleSelectMenuCreateOptTitle,
-				Description: "Title describing this selection of roles",
-				Required:    roleSelectMenuCreateOptReqTitle,
-			}
-		case roleSelectMenuCreateOptIdxRoles:
-			opts[i] = &discordgo.ApplicationCommandOption{
-				Type:        discordgo.ApplicationCommandOptionString,
-				Name:        roleSelectMenuCreateOptRoles,
-				Description: fmt.Sprintf("Roles (up to %d) and their context. Ex: @SomeRole context 😺 @NextRole next role context", maxDiscordSelectMenuOpts*maxRoleSelectMenus),
-				Required:    roleSelectMenuCreateOptReqRoles,
-			}
-		case roleSelectMenuCreateOptIdxDesc:
-			opts[i] = &discordgo.ApplicationCommandOption{
-				Type:        discordgo.ApplicationCommandOptionString,
-				Name:        roleSelectMenuCreateOptDesc,
-				Description: "Description of this selection of roles",
-				Required:    roleSelectMenuCreateOptReqDesc,
-			}
 		case roleSelectMenuCreateOptIdxURL:
 			opts[i] = &discordgo.ApplicationCommandOption{
 				Type:        discordgo.ApplicationCommandOptionString,
@@ -245,19 +325,7 @@ func roleSelectCmdOpts() []*discordgo.ApplicationCommandOption {
 	}
 }
 
-func handleRoleSelectMenuCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	mdata, err := getInteractionMetaData(i)
-	if err != nil {
-		log.Error(err)
-		interactionRespondEphemeralError(s, i, true, err)
-		return
-	}
-
-	if !hasPermissions(mdata.AuthorPermissions, discordgo.PermissionManageRoles) {
-		interactionRespondEphemeralError(s, i, false, fmt.Errorf("you must run this command from a server you administer"))
-		return
-	}
-
+func handleRoleSelectMenuCommand(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	switch i.ApplicationCommandData().Options[0].Name {
 	case roleSelectMenuSubCmdCreate:
 		handleRoleSelectMenuCreate(s, i)
@@ -265,13 +333,13 @@ func handleRoleSelectMenuCommand(s *discordgo.Session, i *discordgo.InteractionC
 		handleRoleSelectMenuUpdate(s, i)
 	default:
 		err := fmt.Errorf(`unknown command: "%s"`, i.ApplicationCommandData().Options[0].Name)
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 	}
 }
 
 // Given a discordgo Session and guildID, returns a map of roleID's to Roles for that guild
-func guildRoleMap(s *discordgo.Session, guildID string) (map[string]*discordgo.Role, error) {
+func guildRoleMap(s discordSession, guildID string) (map[string]*discordgo.Role, error) {
 	if s == nil {
 		return nil, fmt.Errorf("nil session provided")
 	}
@@ -304,42 +372,85 @@ func init() {
 
 const roleMentionDelimiter = "<@&"
 
-func parseRoles(rolesOpt string) ([]string, error) {
-	if !strings.HasPrefix(rolesOpt, roleMentionDelimiter) {
-		return nil, fmt.Errorf("the first argument to `%s` must be a role mention", roleSelectMenuCreateOptRoles)
-	}
+// A role offered by a role select menu.
+type roleChoice struct {
+	role        *discordgo.Role
+	emoji       discordgo.ComponentEmoji
+	description string
+}
 
-	rolesAndCtx := strings.Split(rolesOpt, roleMentionDelimiter)[1:]
-	if len(rolesAndCtx) > maxDiscordSelectMenuOpts*maxRoleSelectMenus {
-		return nil, fmt.Errorf("you may only specify up to %d roles", maxDiscordSelectMenuOpts*maxRoleSelectMenus)
+// parseRoleLines parses one role per line. Each line starts with a role,
+// given as a mention, an ID, or its name, followed by any context and
+// emoji to show with it. E.g. "Gamer 🎮 pinged for game nights".
+func parseRoleLines(locale discordgo.Locale, lines []string, roles map[string]*discordgo.Role) ([]roleChoice, error) {
+	maxRoles := maxDiscordSelectMenuOpts * maxRoleSelectMenus
+	if len(lines) == 0 {
+		return nil, errors.New(localize(locale, msgRoleSelectNoRoles))
 	}
-
-	if len(rolesAndCtx) == 0 {
-		return nil, fmt.Errorf("you must specify at least one role")
+	if len(lines) > maxRoles {
+		return nil, errors.New(localize(locale, msgRoleSelectTooManyRoles, maxRoles))
 	}
 
-	// remove any duplicate roles
-	roleSet := map[string]bool{}
-	for _, r := range rolesAndCtx {
-		roleSet[r] = true // this value is just to ensure the role key exists in the set
-	}
+	choices := make([]roleChoice, 0, len(lines))
+	seen := map[string]bool{}
+	for _, line := range lines {
+		role, context := findLeadingRole(line, roles)
+		if role == nil {
+			return nil, errors.New(localize(locale, msgRoleSelectNoRoleFound, line))
+		}
+		if seen[role.ID] {
+			return nil, errors.New(localize(locale, msgRoleSelectDuplicateRole, role.Name))
+		}
+		seen[role.ID] = true
 
-	filteredRolesAndCtx := make([]string, len(roleSet))
-	idx := 0
-	for roleAndCtx := range roleSet {
-		filteredRolesAndCtx[idx] = roleAndCtx
-		idx++
+		emoji, scrubbedCtx, err := detectAndScrubDiscordEmojis(context)
+		if err != nil {
+			return nil, err
+		}
+		description := strings.TrimSpace(roleRegex().ReplaceAllString(scrubbedCtx, ""))
+		if len(description) > maxDiscordSelectMenuOptionChars {
+			return nil, errors.New(localize(locale, msgRoleSelectContextTooLong, role.Name, maxDiscordSelectMenuOptionChars))
+		}
+		choices = append(choices, roleChoice{role: role, emoji: emoji, description: description})
 	}
-
-	return filteredRolesAndCtx, nil
+	return choices, nil
 }
 
-func buildRoleSelectMenus(s *discordgo.Session, metadata interactionMetaData, rolesAndCtx []string) ([]discordgo.SelectMenu, error) {
-	if s == nil {
-		return nil, fmt.Errorf("nil session (%v)", s)
+// findLeadingRole returns the role that line starts with, and the rest of
+// the line. Names are matched case-insensitively with an optional leading
+// "@", and the longest matching name wins, so "Gamer Dads" beats "Gamer".
+func findLeadingRole(line string, roles map[string]*discordgo.Role) (*discordgo.Role, string) {
+	if loc := roleRegex().FindStringIndex(line); loc != nil && loc[0] == 0 {
+		roleID := strings.TrimSuffix(strings.TrimPrefix(line[:loc[1]], roleMentionDelimiter), ">")
+		return roles[roleID], strings.TrimSpace(line[loc[1]:])
+	}
+	if first, rest, _ := strings.Cut(line, " "); roles[first] != nil {
+		return roles[first], strings.TrimSpace(rest)
+	}
+
+	name := strings.TrimPrefix(line, "@")
+	var found *discordgo.Role
+	for _, role := range roles {
+		n := len(role.Name)
+		if n == 0 || n > len(name) || !strings.EqualFold(name[:n], role.Name) {
+			continue
+		}
+		// Don't match "Art" in "Artist".
+		if next, _ := utf8.DecodeRuneInString(name[n:]); n < len(name) && (unicode.IsLetter(next) || unicode.IsDigit(next)) {
+			continue
+		}
+		if found == nil || n > len(found.Name) {
+			found = role
+		}
 	}
+	if found == nil {
+		return nil, ""
+	}
+	return found, strings.TrimSpace(name[len(found.Name):])
+}
 
-	sMenus := make([]discordgo.SelectMenu, int(math.Ceil(float64(len(rolesAndCtx))/float64(maxDiscordSelectMenuOpts))))
+func buildRoleSelectMenus(choices []roleChoice) ([]discordgo.SelectMenu, error) {
+	sMenus := make([]discordgo.SelectMenu, int(math.Ceil(float64(len(choices))/float64(maxDiscordSelectMenuOpts))))
 	for i := range sMenus {
 		uid, err := uuid.NewUUID()
 		if err != nil {
@@ -351,31 +462,13 @@ func buildRoleSelectMenus(s *discordgo.Session, metadata interactionMetaData, ro
 		}
 	}
 
-	roleMap, err := guildRoleMap(s, metadata.GuildID)
-	if err != nil {
-		return nil, err
-	}
-
-	for idx := range rolesAndCtx {
-		rolesAndCtx[idx] = roleMentionDelimiter + rolesAndCtx[idx]
-		roleID := strings.Replace(strings.Replace(roleRegex().FindString(rolesAndCtx[idx]), roleMentionDelimiter, "", 1), ">", "", 1)
-		role, ok := roleMap[roleID]
-		if !ok {
-			return nil, fmt.Errorf("no role found for ID: %s", roleID)
-		}
-
-		emojiComp, scrubbedRoleAndCtx, err := detectAndScrubDiscordEmojis(rolesAndCtx[idx])
-		if err != nil {
-			return nil, err
-		}
-
-		smIdx := idx / 25
+	for idx, choice := range choices {
+		smIdx := idx / maxDiscordSelectMenuOpts
 		sMenus[smIdx].Options = append(sMenus[smIdx].Options, discordgo.SelectMenuOption{
-			Label: role.Name,
-			Value: role.ID,
-			// Description is whatever is left over after scrubbing Discord emojis and role mentions
-			Description: roleRegex().ReplaceAllString(scrubbedRoleAndCtx, ""),
-			Emoji:       emojiComp,
+			Label:       choice.role.Name,
+			Value:       choice.role.ID,
+			Description: choice.description,
+			Emoji:       choice.emoji,
 		})
 	}
 
@@ -420,9 +513,9 @@ func buildRoleSelectMenuEmbed(opts []*discordgo.ApplicationCommandInteractionDat
 
 	for _, opt := range opts {
 		switch opt.Name {
-		case roleSelectMenuCreateOptTitle:
+		case roleSelectMenuFormFieldTitle:
 			embed.SetTitle(opt.StringValue())
-		case roleSelectMenuCreateOptDesc:
+		case roleSelectMenuFormFieldDesc:
 			embed.SetDescription(opt.StringValue())
 		case roleSelectMenuCreateOptImage:
 			embed.SetImage(opt.StringValue())
@@ -439,19 +532,19 @@ func buildRoleSelectMenuEmbed(opts []*discordgo.ApplicationCommandInteractionDat
 	return embed
 }
 
-func validateRoleSelectEmbedURLs(e *dg_helpers.Embed) error {
+func validateRoleSelectEmbedURLs(locale discordgo.Locale, e *dg_helpers.Embed) error {
 	if e.URL != "" && !httputils.IsReachableURL(e.URL) {
-		return fmt.Errorf("unreachable URL provided: %s", e.URL)
+		return errors.New(localize(locale, msgRoleSelectBadURL, e.URL))
 	}
 	if e.Thumbnail != nil && e.Thumbnail.URL != "" && !httputils.IsReachableURL(e.Thumbnail.URL) {
-		return fmt.Errorf("unreachable thumbnail URL provided: %s", e.Thumbnail.URL)
+		return errors.New(localize(locale, msgRoleSelectBadThumbnail, e.Thumbnail.URL))
 	}
 	return nil
 }
 
-func handleRoleSelectMenuUpdate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func handleRoleSelectMenuUpdate(s discordSession, i *discordgo.InteractionCreate) {
 	if s == nil || i == nil {
-		log.Errorf("nil Session pointer (%v) and/or InteractionCreate pointer (%v)", s, i)
+		logFor(i).Errorf("nil Session pointer (%v) and/or InteractionCreate pointer (%v)", s, i)
 		return
 	}
 
@@ -463,14 +556,14 @@ func handleRoleSelectMenuUpdate(s *discordgo.Session, i *discordgo.InteractionCr
 	})
 	if err != nil {
 		interactionRespondEphemeralError(s, i, true, err)
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
 
 	metadata, err := getInteractionMetaData(i)
 	if err != nil {
 		interactionFollowUpEphemeralError(s, i, true, err)
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
 
@@ -478,15 +571,15 @@ func handleRoleSelectMenuUpdate(s *discordgo.Session, i *discordgo.InteractionCr
 	msgToEditID := optData[roleSelectMenuUpdateOptIdxMsgID].StringValue()
 	msg, err := s.ChannelMessage(metadata.ChannelID, msgToEditID)
 	if err != nil || msg == nil {
-		log.Warn(err)
-		interactionFollowUpEphemeralError(s, i, false, fmt.Errorf("could not find any message in this channel with ID: `%s`", msgToEditID))
+		logFor(i).Warn(err)
+		interactionFollowUpEphemeralError(s, i, false, errors.New(localized(i, msgRoleSelectNoMessage, msgToEditID)))
 		return
 	}
 
 	err = isMessageARoleSelectMenu(s, msg)
 	if err != nil {
-		log.Warn(err)
-		interactionFollowUpEphemeralError(s, i, false, fmt.Errorf("provided message ID does not appear to contain a role select menu:\n\t%v", err))
+		logFor(i).Warn(err)
+		interactionFollowUpEphemeralError(s, i, false, errors.New(localized(i, msgRoleSelectNotAMenu)))
 		return
 	}
 
@@ -498,18 +591,18 @@ func handleRoleSelectMenuUpdate(s *discordgo.Session, i *discordgo.InteractionCr
 	default:
 		err := fmt.Errorf("unknown update choice: %s", choice)
 		interactionFollowUpEphemeralError(s, i, true, err)
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
 }
 
-func handleRoleSelectMenuUpdateAdd(s *discordgo.Session, i *discordgo.InteractionCreate, msgToEdit discordgo.Message) {
+func handleRoleSelectMenuUpdateAdd(s discordSession, i *discordgo.InteractionCreate, msgToEdit discordgo.Message) {
 	optData := i.ApplicationCommandData().Options[0].Options
 
 	metadata, err := getInteractionMetaData(i)
 	if err != nil {
 		interactionFollowUpEphemeralError(s, i, true, err)
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
 
@@ -518,7 +611,7 @@ func handleRoleSelectMenuUpdateAdd(s *discordgo.Session, i *discordgo.Interactio
 	for _, opt := range optData {
 		switch opt.Name {
 		case roleSelectMenuUpdateOptRole:
-			roleToAdd = opt.RoleValue(s, metadata.GuildID)
+			roleToAdd = roleValue(s, opt, metadata.GuildID)
 		case roleSelectMenuUpdateOptCtx:
 			roleContext = opt.StringValue()
 		}
@@ -527,7 +620,7 @@ func handleRoleSelectMenuUpdateAdd(s *discordgo.Session, i *discordgo.Interactio
 	if roleToAdd == nil || roleToAdd.Name == "" {
 		err = fmt.Errorf("could not retreive role name from user args")
 		interactionFollowUpEphemeralError(s, i, true, err)
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
 
@@ -550,42 +643,42 @@ func handleRoleSelectMenuUpdateAdd(s *discordgo.Session, i *discordgo.Interactio
 	content := ""
 	if ok, err := isRoleInSelectMenuMsg(roleToAdd.ID, s, &msgToEdit); err != nil {
 		interactionFollowUpEphemeralError(s, i, true, err)
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	} else if ok {
 		msgEdit.Components, err = updateExistingRoleSelectMenuOption(s, roleToAdd, roleContext, msgToEdit)
 		if err != nil {
 			interactionFollowUpEphemeralError(s, i, true, err)
-			log.Error(err)
+			logFor(i).Error(err)
 			return
 		}
-		content = fmt.Sprintf("Updated existing menu option for %s", roleToAdd.Mention())
+		content = localized(i, msgRoleSelectOptionUpdated, roleToAdd.Mention())
 	} else {
 		var newOptAdded bool
 		msgEdit.Components, newOptAdded, err = addRoleSelectMenuOption(s, roleToAdd, roleContext, msgToEdit)
 		if err != nil {
 			interactionFollowUpEphemeralError(s, i, true, err)
-			log.Error(err)
+			logFor(i).Error(err)
 			return
 		}
 		if !newOptAdded {
-			content := fmt.Sprintf("You've reached the max number of buttons (%d) a Discord message can hold. You'll have to remove a menu option first or add a new role-select-menu.", maxDiscordActionRows)
+			content := localized(i, msgRoleSelectMenuFull, maxDiscordActionRows)
 			_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
 				Content: &content,
 			})
 			if err != nil {
 				interactionFollowUpEphemeralError(s, i, true, err)
-				log.Error(err)
+				logFor(i).Error(err)
 			}
 			return
 		}
-		content = fmt.Sprintf("Added %s option to the menu", roleToAdd.Mention())
+		content = localized(i, msgRoleSelectOptionAdded, roleToAdd.Mention())
 	}
 
 	_, err = s.ChannelMessageEditComplex(msgEdit)
 	if err != nil {
 		interactionFollowUpEphemeralError(s, i, true, err)
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
 
@@ -597,17 +690,17 @@ func handleRoleSelectMenuUpdateAdd(s *discordgo.Session, i *discordgo.Interactio
 	})
 	if err != nil {
 		interactionFollowUpEphemeralError(s, i, true, err)
-		log.Error(err)
+		logFor(i).Error(err)
 	}
 }
 
-func handleRoleSelectMenuUpdateDel(s *discordgo.Session, i *discordgo.InteractionCreate, msgToEdit *discordgo.Message) {
+func handleRoleSelectMenuUpdateDel(s discordSession, i *discordgo.InteractionCreate, msgToEdit *discordgo.Message) {
 	optData := i.ApplicationCommandData().Options[0].Options
 
 	metadata, err := getInteractionMetaData(i)
 	if err != nil {
 		interactionFollowUpEphemeralError(s, i, true, err)
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
 
@@ -615,29 +708,29 @@ func handleRoleSelectMenuUpdateDel(s *discordgo.Session, i *discordgo.Interactio
 	for _, opt := range optData {
 		switch opt.Name {
 		case roleSelectMenuUpdateOptRole:
-			roleToDel = opt.RoleValue(s, metadata.GuildID)
+			roleToDel = roleValue(s, opt, metadata.GuildID)
 		}
 	}
 
 	if roleToDel == nil {
 		err = fmt.Errorf("could not retreive role name from user args")
 		interactionFollowUpEphemeralError(s, i, true, err)
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
 
 	if ok, err := isRoleInSelectMenuMsg(roleToDel.ID, s, msgToEdit); err != nil {
-		log.Warn(err)
-		interactionFollowUpEphemeralError(s, i, false, fmt.Errorf("provided message ID does not appear to contain a role select menu:\n\t%v", err))
+		logFor(i).Warn(err)
+		interactionFollowUpEphemeralError(s, i, false, errors.New(localized(i, msgRoleSelectNotAMenu)))
 		return
 	} else if !ok {
-		content := fmt.Sprintf("%s is not present in the menu, nothing to do.", roleToDel.Mention())
+		content := localized(i, msgRoleSelectNotInMenu, roleToDel.Mention())
 		_, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
 			Content: &content,
 		})
 		if err != nil {
 			interactionFollowUpEphemeralError(s, i, true, err)
-			log.Error(err)
+			logFor(i).Error(err)
 		}
 		return
 	}
@@ -665,7 +758,7 @@ func handleRoleSelectMenuUpdateDel(s *discordgo.Session, i *discordgo.Interactio
 		actionsRow, ok := ar.(*discordgo.ActionsRow)
 		if !ok {
 			err = fmt.Errorf("bad cast to actions row, this should never happen")
-			log.Error(err)
+			logFor(i).Error(err)
 			interactionFollowUpEphemeralError(s, i, true, err)
 			return
 		}
@@ -676,7 +769,7 @@ func handleRoleSelectMenuUpdateDel(s *discordgo.Session, i *discordgo.Interactio
 			selectMenu, ok := c.(*discordgo.SelectMenu)
 			if !ok {
 				err = fmt.Errorf("bad cast to select menu, this should never happen")
-				log.Error(err)
+				logFor(i).Error(err)
 				interactionFollowUpEphemeralError(s, i, true, err)
 				return
 			}
@@ -704,7 +797,7 @@ func handleRoleSelectMenuUpdateDel(s *discordgo.Session, i *discordgo.Interactio
 	if arIdxToDel >= len(msgEdit.Components) {
 		err := fmt.Errorf("there is a bug in this code, arIdxToDel should never be out of range")
 		interactionFollowUpEphemeralError(s, i, true, err)
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
 	if arIdxToDel > -1 {
@@ -720,21 +813,21 @@ func handleRoleSelectMenuUpdateDel(s *discordgo.Session, i *discordgo.Interactio
 	_, err = s.ChannelMessageEditComplex(msgEdit)
 	if err != nil {
 		interactionFollowUpEphemeralError(s, i, true, err)
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
 
-	content := fmt.Sprintf("%s was removed from the menu", roleToDel.Mention())
+	content := localized(i, msgRoleSelectOptionRemoved, roleToDel.Mention())
 	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
 		Content: &content,
 	})
 	if err != nil {
 		interactionFollowUpEphemeralError(s, i, true, err)
-		log.Error(err)
+		logFor(i).Error(err)
 	}
 }
 
-func isRoleInSelectMenuMsg(roleID string, s *discordgo.Session, msgToEdit *discordgo.Message) (bool, error) {
+func isRoleInSelectMenuMsg(roleID string, s discordSession, msgToEdit *discordgo.Message) (bool, error) {
 	if err := isMessageARoleSelectMenu(s, msgToEdit); err != nil {
 		return false, fmt.Errorf("message is not a role select menu, this should never happen. err: %v", err)
 	}
@@ -766,7 +859,7 @@ func isRoleInSelectMenuMsg(roleID string, s *discordgo.Session, msgToEdit *disco
 }
 
 // Returns the updated message components, a bool indicating whether or not there was room for the new option, and an error indicating if something went wrong.
-func addRoleSelectMenuOption(s *discordgo.Session, roleToAdd *discordgo.Role, roleCtx string, msgToEdit discordgo.Message) ([]discordgo.MessageComponent, bool, error) {
+func addRoleSelectMenuOption(s discordSession, roleToAdd *discordgo.Role, roleCtx string, msgToEdit discordgo.Message) ([]discordgo.MessageComponent, bool, error) {
 	if err := isMessageARoleSelectMenu(s, &msgToEdit); err != nil {
 		return msgToEdit.Components, false, fmt.Errorf("message is not a role select menu, this should never happen. err: %v", err)
 	}
@@ -840,7 +933,7 @@ func addRoleSelectMenuOption(s *discordgo.Session, roleToAdd *discordgo.Role, ro
 }
 
 // Returns the updated message components and an error indicating success or failure
-func updateExistingRoleSelectMenuOption(s *discordgo.Session, roleToAdd *discordgo.Role, roleCtx string, msgToEdit discordgo.Message) ([]discordgo.MessageComponent, error) {
+func updateExistingRoleSelectMenuOption(s discordSession, roleToAdd *discordgo.Role, roleCtx string, msgToEdit discordgo.Message) ([]discordgo.MessageComponent, error) {
 	if err := isMessageARoleSelectMenu(s, &msgToEdit); err != nil {
 		return msgToEdit.Components, fmt.Errorf("message is not a role select menu, this should never happen. err: %v", err)
 	}
@@ -875,19 +968,19 @@ func updateExistingRoleSelectMenuOption(s *discordgo.Session, roleToAdd *discord
 	return msgToEdit.Components, fmt.Errorf("did not find existing role to update")
 }
 
-func isMessageARoleSelectMenu(s *discordgo.Session, m *discordgo.Message) error {
+func isMessageARoleSelectMenu(s discordSession, m *discordgo.Message) error {
 	if m == nil {
 		return fmt.Errorf("message is nil")
 	}
 
 	if (m.Author == nil && m.Member == nil) || (m.Author == nil && m.Member.User == nil) {
-		return fmt.Errorf("cannot verify message author is %s", s.State.User.Mention())
+		return fmt.Errorf("cannot verify message author is %s", s.SelfUser().Mention())
 	}
-	if m.Author != nil && m.Author.ID != s.State.User.ID {
-		return fmt.Errorf("message not authored by %s", s.State.User.Mention())
+	if m.Author != nil && m.Author.ID != s.SelfUser().ID {
+		return fmt.Errorf("message not authored by %s", s.SelfUser().Mention())
 	}
-	if m.Member != nil && m.Member.User != nil && m.Member.User.ID != s.State.User.ID {
-		return fmt.Errorf("message not authored by %s", s.State.User.Mention())
+	if m.Member != nil && m.Member.User != nil && m.Member.User.ID != s.SelfUser().ID {
+		return fmt.Errorf("message not authored by %s", s.SelfUser().Mention())
 	}
 
 	if len(m.Components) < roleSelectMenuMsgMinComponentCount {
@@ -935,26 +1028,30 @@ func isMessageARoleSelectMenu(s *discordgo.Session, m *discordgo.Message) error
 	return nil
 }
 
-func handleRoleSelectMenuCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func handleRoleSelectMenuCreate(s discordSession, i *discordgo.InteractionCreate) {
 	if s == nil || i == nil {
-		log.Errorf("nil Session pointer (%v) and/or InteractionCreate pointer (%v)", s, i)
+		logFor(i).Errorf("nil Session pointer (%v) and/or InteractionCreate pointer (%v)", s, i)
 		return
 	}
+	roleSelectMenuForm.open(s, i, nil)
+}
 
-	rolesAndCtx, err := parseRoles(i.ApplicationCommandData().Options[0].Options[roleSelectMenuCreateOptIdxRoles].StringValue())
+func submitRoleSelectMenuForm(s discordSession, i *discordgo.InteractionCreate, values formValues, origin *discordgo.InteractionCreate) error {
+	roleMap, err := guildRoleMap(s, i.GuildID)
 	if err != nil {
-		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: fmt.Sprint(err),
-				Flags:   discordgo.MessageFlagsEphemeral,
-			},
-		})
-		if err != nil {
-			interactionFollowUpEphemeralError(s, i, false, err)
-			log.Error(err)
-		}
-		return
+		logFor(i).Error(err)
+		interactionRespondEphemeralError(s, i, true, err)
+		return nil
+	}
+	choices, err := parseRoleLines(i.Locale, values.lines(roleSelectMenuFormFieldRoles), roleMap)
+	if err != nil {
+		return err
+	}
+
+	e := buildRoleSelectMenuEmbed(append(values.options(), origin.ApplicationCommandData().Options[0].Options...))
+	err = validateRoleSelectEmbedURLs(i.Locale, e)
+	if err != nil {
+		return err
 	}
 
 	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
@@ -962,27 +1059,14 @@ func handleRoleSelectMenuCreate(s *discordgo.Session, i *discordgo.InteractionCr
 	})
 	if err != nil {
 		interactionRespondEphemeralError(s, i, true, err)
-		log.Error(err)
-		return
+		logFor(i).Error(err)
+		return nil
 	}
 
-	metadata, err := getInteractionMetaData(i)
-	if err != nil {
-		interactionFollowUpEphemeralError(s, i, true, err)
-		log.Error(err)
-		return
-	}
-	sMenus, err := buildRoleSelectMenus(s, *metadata, rolesAndCtx)
+	sMenus, err := buildRoleSelectMenus(choices)
 	if err != nil {
 		interactionFollowUpEphemeralError(s, i, true, err)
-		return
-	}
-
-	e := buildRoleSelectMenuEmbed(i.ApplicationCommandData().Options[0].Options)
-	err = validateRoleSelectEmbedURLs(e)
-	if err != nil {
-		interactionFollowUpEphemeralError(s, i, false, err)
-		return
+		return nil
 	}
 
 	iEdit := &discordgo.WebhookEdit{
@@ -1020,9 +1104,9 @@ func handleRoleSelectMenuCreate(s *discordgo.Session, i *discordgo.InteractionCr
 	_, err = s.InteractionResponseEdit(i.Interaction, iEdit)
 	if err != nil {
 		interactionFollowUpEphemeralError(s, i, true, err)
-		log.Error(err)
-		return
+		logFor(i).Error(err)
 	}
+	return nil
 }
 
 // Retrieves the selection options from a roleSelectMenu. If a buttonID is provided,
@@ -1081,9 +1165,9 @@ func getPossibleRoleIDs(i *discordgo.InteractionCreate, buttonID string) (map[st
 	return possibleRoleIDsMap, possibleRoleIDs, nil
 }
 
-func handleRoleSelection(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func handleRoleSelection(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	if s == nil || i == nil {
-		log.Errorf("nil Session pointer (%v) and/or InteractionCreate pointer (%v)", s, i)
+		logFor(i).Errorf("nil Session pointer (%v) and/or InteractionCreate pointer (%v)", s, i)
 		return
 	}
 
@@ -1098,7 +1182,7 @@ func handleRoleSelection(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	if err != nil {
 		time.Sleep(time.Millisecond * 200) // wait a bit for the deferred response to be received
 		interactionFollowUpEphemeralError(s, i, true, err)
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
 	for _, roleID := range i.MessageComponentData().Values {
@@ -1110,7 +1194,7 @@ func handleRoleSelection(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	metadata, err := getInteractionMetaData(i)
 	if err != nil {
 		interactionFollowUpEphemeralError(s, i, true, err)
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
 
@@ -1148,22 +1232,22 @@ func handleRoleSelection(s *discordgo.Session, i *discordgo.InteractionCreate) {
 
 	if err != nil {
 		interactionFollowUpEphemeralError(s, i, true, err)
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
 
 	embedColor, err := fastHappyColorInt64()
 	if err != nil {
-		log.Warn(err)
+		logFor(i).Warn(err)
 		embedColor = 0
 	}
 
-	embed := dg_helpers.NewEmbed().SetTitle("Your Roles Have Been Updated 🎭").SetColor(int(embedColor))
+	embed := dg_helpers.NewEmbed().SetTitle(localized(i, msgRoleSelectRolesUpdated)).SetColor(int(embedColor))
 	if len(addedRoles) != 0 {
-		embed.AddField("Added Roles ✅", "<@&"+strings.Join(addedRoles, ">\n<@&")+">")
+		embed.AddField(localized(i, msgRoleSelectRolesAdded), "<@&"+strings.Join(addedRoles, ">\n<@&")+">")
 	}
 	if len(rolesToRemove) != 0 {
-		embed.AddField("Removed Roles ❌", "<@&"+strings.Join(rolesToRemove, ">\n<@&")+">")
+		embed.AddField(localized(i, msgRoleSelectRolesRemoved), "<@&"+strings.Join(rolesToRemove, ">\n<@&")+">")
 	}
 	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
 		Embeds: &[]*discordgo.MessageEmbed{embed.Truncate().MessageEmbed},
@@ -1173,14 +1257,14 @@ func handleRoleSelection(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	})
 	if err != nil {
 		interactionFollowUpEphemeralError(s, i, true, err)
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
 }
 
-func handleRoleSelectReset(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func handleRoleSelectReset(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	if s == nil || i == nil {
-		log.Errorf("nil Session pointer (%v) and/or InteractionCreate pointer (%v)", s, i)
+		logFor(i).Errorf("nil Session pointer (%v) and/or InteractionCreate pointer (%v)", s, i)
 		return
 	}
 
@@ -1195,14 +1279,14 @@ func handleRoleSelectReset(s *discordgo.Session, i *discordgo.InteractionCreate)
 	if err != nil {
 		time.Sleep(time.Millisecond * 200)
 		interactionFollowUpEphemeralError(s, i, true, err)
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
 
 	metadata, err := getInteractionMetaData(i)
 	if err != nil {
 		interactionFollowUpEphemeralError(s, i, true, err)
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
 
@@ -1221,21 +1305,21 @@ func handleRoleSelectReset(s *discordgo.Session, i *discordgo.InteractionCreate)
 	}, func(cfg *discordgo.RequestConfig) { cfg.ShouldRetryOnRateLimit = true })
 	if err != nil {
 		interactionFollowUpEphemeralError(s, i, true, err)
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
 
 	embedColor, err := fastHappyColorInt64()
 	if err != nil {
-		log.Warn(err)
+		logFor(i).Warn(err)
 		embedColor = 0
 	}
 
-	embed := dg_helpers.NewEmbed().SetTitle("Your Roles Have Been Updated 🎭").SetColor(int(embedColor))
+	embed := dg_helpers.NewEmbed().SetTitle(localized(i, msgRoleSelectRolesUpdated)).SetColor(int(embedColor))
 	if len(rolesToRemove) != 0 {
-		embed.AddField("Removed Roles ❌", "<@&"+strings.Join(rolesToRemove, ">\n<@&")+">")
+		embed.AddField(localized(i, msgRoleSelectRolesRemoved), "<@&"+strings.Join(rolesToRemove, ">\n<@&")+">")
 	} else {
-		embed.AddField("Removed Roles ❌", "No roles to remove")
+		embed.AddField(localized(i, msgRoleSelectRolesRemoved), localized(i, msgRoleSelectNothingRemoved))
 	}
 
 	s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
@@ -0,0 +1,159 @@
+package kardbot
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Kardbord/Kard-bot/kardbot/fakediscord"
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/uuid"
+)
+
+const (
+	roleA     = "501"
+	roleB     = "502"
+	roleOther = "509"
+)
+
+// addTestRoleSelectMenu places a role select menu offering roleA and roleB in the test channel.
+func addTestRoleSelectMenu(fake *fakediscord.Session) (*discordgo.Message, string) {
+	menuID := roleSelectMenuComponentIDPrefix + uuid.NewString()
+	msg := fake.AddMessage(&discordgo.Message{
+		ChannelID: testChannelID,
+		Author:    testSelf,
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{
+					CustomID: menuID,
+					Options: []discordgo.SelectMenuOption{
+						{Label: "A", Value: roleA},
+						{Label: "B", Value: roleB},
+					},
+				},
+			}},
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.Button{CustomID: roleSelectResetButtonID, Label: roleSelectResetButtonLabel},
+			}},
+		},
+	})
+	return msg, menuID
+}
+
+func TestHandleRoleSelection(t *testing.T) {
+	fake := newTestBot(t)
+	msg, menuID := addTestRoleSelectMenu(fake)
+
+	opts := []fakediscord.InteractionOption{
+		fakediscord.FromMember(testGuildID, testMember(roleA, roleOther)),
+		fakediscord.OnMessage(msg),
+	}
+	i := fake.Component(menuID, discordgo.SelectMenuComponent, []string{roleB}, opts...)
+
+	if h, ok := componentHandlerFor(menuID); !ok || h == nil {
+		t.Fatalf("no handler routed for %s", menuID)
+	}
+	handleRoleSelection(context.Background(), fake, i)
+
+	edits := fake.MemberEdits()
+	if len(edits) != 1 {
+		t.Fatalf("expected one member edit, got %d", len(edits))
+	}
+	if got, want := *edits[0].Params.Roles, []string{roleOther, roleB}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got roles %v, want %v", got, want)
+	}
+
+	resp := mustRespond(t, fake, i)
+	if !isEphemeral(resp) || len(resp.Edits) != 1 {
+		t.Fatalf("expected a single ephemeral summary, got %+v", resp)
+	}
+	fields := (*resp.Edits[0].Embeds)[0].Fields
+	if len(fields) != 2 ||
+		!strings.Contains(fields[0].Value, roleB) ||
+		!strings.Contains(fields[1].Value, roleA) {
+		t.Errorf("unexpected summary %+v", fields)
+	}
+}
+
+func TestHandleRoleSelectionEditFails(t *testing.T) {
+	fake := newTestBot(t)
+	msg, menuID := addTestRoleSelectMenu(fake)
+	fake.FailOn("GuildMemberEdit", fakediscord.ErrNotFound)
+
+	i := fake.Component(menuID, discordgo.SelectMenuComponent, []string{roleA},
+		append(inTestGuild(), fakediscord.OnMessage(msg))...)
+	handleRoleSelection(context.Background(), fake, i)
+
+	resp := mustRespond(t, fake, i)
+	if !resp.Deleted || len(resp.Edits) != 0 {
+		t.Errorf("expected the deferred response to be replaced with an error, got %+v", resp)
+	}
+}
+
+func TestParseRoleLines(t *testing.T) {
+	roles := map[string]*discordgo.Role{
+		roleA:     {ID: roleA, Name: "Gamer"},
+		roleB:     {ID: roleB, Name: "Gamer Dads"},
+		roleOther: {ID: roleOther, Name: "Art"},
+	}
+
+	choices, err := parseRoleLines("", []string{
+		"<@&" + roleOther + "> drawings <:paint:123456789012345678>",
+		"@gamer dads 🎮 for dads",
+		roleA + " everyone else",
+	}, roles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, c := range choices {
+		got = append(got, c.role.ID+"|"+c.description+"|"+c.emoji.Name)
+	}
+	want := []string{roleOther + "|drawings|paint", roleB + "|🎮 for dads|🎮", roleA + "|everyone else|"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, bad := range [][]string{
+		{"Artist"},
+		{"Gamer", "gamer"},
+		{"<@&999> nope"},
+		{"Gamer " + strings.Repeat("x", maxDiscordSelectMenuOptionChars+1)},
+	} {
+		if _, err := parseRoleLines("", bad, roles); err == nil {
+			t.Errorf("%q was accepted", bad)
+		}
+	}
+}
+
+func TestRoleSelectMenuForm(t *testing.T) {
+	fake := newTestBot(t)
+	g, err := fake.Guild(testGuildID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Roles = []*discordgo.Role{{ID: roleA, Name: "Gamer"}, {ID: roleB, Name: "Artist"}}
+
+	open := fake.Command(roleSelectMenuCommand, []*discordgo.ApplicationCommandInteractionDataOption{
+		fakediscord.SubCommand(roleSelectMenuSubCmdCreate, fakediscord.IntOpt(roleSelectMenuCreateOptColor, 0xFF0000)),
+	}, inTestGuild()...)
+	handleRoleSelectMenuCommand(context.Background(), fake, open)
+
+	i := submitForm(fake, openedForm(t, fake, open), map[string]string{
+		roleSelectMenuFormFieldTitle: "Pick your roles",
+		roleSelectMenuFormFieldRoles: "Gamer 🎮\n\n@artist share your art",
+	})
+
+	msg, err := fake.InteractionResponse(i.Interaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Embeds) != 1 || msg.Embeds[0].Title != "Pick your roles" || msg.Embeds[0].Color != 0xFF0000 {
+		t.Errorf("embed does not combine the form and the command options: %+v", msg.Embeds)
+	}
+	menu := msg.Components[0].(*discordgo.ActionsRow).Components[0].(*discordgo.SelectMenu)
+	if len(menu.Options) != 2 || menu.Options[1].Value != roleB || menu.Options[1].Description != "share your art" {
+		t.Errorf("unexpected menu options %+v", menu.Options)
+	}
+}
@@ -0,0 +1,81 @@
+package kardbot
+
+import (
+	"github.com/bwmarrin/discordgo"
+)
+
+// discordSession is the subset of the Discord API used by the bot's
+// features. Handlers are written against it rather than against
+// *discordgo.Session so that they can be exercised with a fake
+// (see the fakediscord package).
+type discordSession interface {
+	// SelfUser returns the bot's own user.
+	SelfUser() *discordgo.User
+
+	InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error
+	InteractionResponse(interaction *discordgo.Interaction, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	InteractionResponseEdit(interaction *discordgo.Interaction, newresp *discordgo.WebhookEdit, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	InteractionResponseDelete(interaction *discordgo.Interaction, options ...discordgo.RequestOption) error
+	FollowupMessageCreate(interaction *discordgo.Interaction, wait bool, data *discordgo.WebhookParams, options ...discordgo.RequestOption) (*discordgo.Message, error)
+
+	Channel(channelID string, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+	ChannelMessage(channelID, messageID string, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessages(channelID string, limit int, beforeID, afterID, aroundID string, options ...discordgo.RequestOption) ([]*discordgo.Message, error)
+	ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageEditComplex(m *discordgo.MessageEdit, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageDelete(channelID, messageID string, options ...discordgo.RequestOption) error
+
+	User(userID string, options ...discordgo.RequestOption) (*discordgo.User, error)
+	UserChannelCreate(recipientID string, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+	UserGuilds(limit int, beforeID, afterID string, options ...discordgo.RequestOption) ([]*discordgo.UserGuild, error)
+
+	Guild(guildID string, options ...discordgo.RequestOption) (*discordgo.Guild, error)
+	GuildWithCounts(guildID string, options ...discordgo.RequestOption) (*discordgo.Guild, error)
+	GuildLeave(guildID string, options ...discordgo.RequestOption) error
+	GuildRoles(guildID string, options ...discordgo.RequestOption) ([]*discordgo.Role, error)
+	GuildChannels(guildID string, options ...discordgo.RequestOption) ([]*discordgo.Channel, error)
+	GuildChannelCreateComplex(guildID string, data discordgo.GuildChannelCreateData, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+	GuildMemberEdit(guildID, userID string, data *discordgo.GuildMemberParams, options ...discordgo.RequestOption) (*discordgo.Member, error)
+
+	ApplicationCommandCreate(appID string, guildID string, cmd *discordgo.ApplicationCommand, options ...discordgo.RequestOption) (*discordgo.ApplicationCommand, error)
+	ApplicationCommands(appID, guildID string, options ...discordgo.RequestOption) ([]*discordgo.ApplicationCommand, error)
+	ApplicationCommandEdit(appID, guildID, cmdID string, cmd *discordgo.ApplicationCommand, options ...discordgo.RequestOption) (*discordgo.ApplicationCommand, error)
+	ApplicationCommandDelete(appID, guildID, cmdID string, options ...discordgo.RequestOption) error
+}
+
+// dgSession adapts a live *discordgo.Session to discordSession.
+type dgSession struct {
+	*discordgo.Session
+}
+
+func (s dgSession) SelfUser() *discordgo.User {
+	if s.Session == nil || s.State == nil {
+		return nil
+	}
+	return s.State.User
+}
+
+// roleValue is ApplicationCommandInteractionDataOption.RoleValue for a
+// discordSession. Falls back to a Role with only the ID populated if the
+// role cannot be found.
+func roleValue(s discordSession, opt *discordgo.ApplicationCommandInteractionDataOption, guildID string) *discordgo.Role {
+	if dgs, ok := s.(dgSession); ok {
+		return opt.RoleValue(dgs.Session, guildID)
+	}
+
+	role := opt.RoleValue(nil, "")
+	if s == nil || guildID == "" {
+		return role
+	}
+	roles, err := s.GuildRoles(guildID)
+	if err != nil {
+		return role
+	}
+	for _, r := range roles {
+		if r.ID == role.ID {
+			return r
+		}
+	}
+	return role
+}
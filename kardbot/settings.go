@@ -0,0 +1,568 @@
+package kardbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Kardbord/Kard-bot/kardbot/dg_helpers"
+	"github.com/Kardbord/Kard-bot/kardbot/store"
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	settingsCmd = "settings"
+
+	settingsSubCmdView           = "view"
+	settingsSubCmdAnnouncements  = "announcement-channel"
+	settingsSubCmdFeature        = "feature"
+	settingsSubCmdTimezone       = "timezone"
+	settingsSubCmdGreetings      = "greetings"
+	settingsSubCmdFarewells      = "farewells"
+	settingsSubCmdClockThreshold = "server-clock-threshold"
+	settingsSubCmdManagerRole    = "bot-manager-role"
+	settingsSubCmdReports        = "report-channel"
+
+	settingsOptChannel   = "channel"
+	settingsOptFeature   = "feature"
+	settingsOptEnabled   = "enabled"
+	settingsOptTimezone  = "timezone"
+	settingsOptList      = "list"
+	settingsOptThreshold = "threshold"
+	settingsOptRole      = "role"
+
+	// Separates entries when setting a greeting or farewell list.
+	settingsListSeparator = "|"
+)
+
+// Features that run outside of a slash command but can still be
+// toggled per guild. Slash commands are toggled by command name.
+const (
+	featureWednesday   = "wednesday"
+	featureGreetings   = "greetings"
+	featureServerClock = "server-clocks"
+)
+
+// Per-guild settings. The zero value enables every feature and
+// falls back to the bot-wide defaults for everything else.
+type guildSettings struct {
+	// Channel for scheduled posts, such as the Wednesday post.
+	// If empty, the first text channel named "general" is used.
+	AnnouncementChannelID string `json:"announcement-channel-id,omitempty"`
+
+	// Features that have been turned off in the guild.
+	// Key: feature or command name
+	DisabledFeatures map[string]bool `json:"disabled-features,omitempty"`
+
+	// IANA timezone the guild's scheduled posts are timed in.
+	// If empty, the bot's timezone is used.
+	Timezone string `json:"timezone,omitempty"`
+
+	// Overrides for greetings-farewells.json
+	Greetings []string `json:"greetings,omitempty"`
+	Farewells []string `json:"farewells,omitempty"`
+
+	// Overrides the server-clock-failure-threshold in setup.json
+	ServerClockFailureThreshold uint32 `json:"server-clock-failure-threshold,omitempty"`
+
+	// Members with any of these roles may use the bot's commands as if
+	// they held whatever server permissions the commands require.
+	BotManagerRoleIDs []string `json:"bot-manager-role-ids,omitempty"`
+
+	// Channel that messages reported to the mods are posted in.
+	// If empty, reporting is disabled.
+	ReportChannelID string `json:"report-channel-id,omitempty"`
+}
+
+func (gs guildSettings) clone() guildSettings {
+	c := gs
+	c.DisabledFeatures = make(map[string]bool, len(gs.DisabledFeatures))
+	for k, v := range gs.DisabledFeatures {
+		c.DisabledFeatures[k] = v
+	}
+	c.Greetings = append([]string(nil), gs.Greetings...)
+	c.Farewells = append([]string(nil), gs.Farewells...)
+	c.BotManagerRoleIDs = append([]string(nil), gs.BotManagerRoleIDs...)
+	return c
+}
+
+func (gs guildSettings) featureEnabled(feature string) bool {
+	return !gs.DisabledFeatures[feature]
+}
+
+func (gs guildSettings) location() *time.Location {
+	if gs.Timezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(gs.Timezone)
+	if err != nil {
+		log.Error(err)
+		return time.Local
+	}
+	return loc
+}
+
+func (gs guildSettings) greetings() []string {
+	if len(gs.Greetings) > 0 {
+		return gs.Greetings
+	}
+	return greetings.Load()
+}
+
+func (gs guildSettings) farewells() []string {
+	if len(gs.Farewells) > 0 {
+		return gs.Farewells
+	}
+	return farewells.Load()
+}
+
+func (gs guildSettings) serverClockFailureThreshold() uint32 {
+	if gs.ServerClockFailureThreshold > 0 {
+		return gs.ServerClockFailureThreshold
+	}
+	return bot().ServerClockFailureThreshold
+}
+
+var (
+	// Key: guild ID
+	guildSettingsMap      = map[string]guildSettings{}
+	guildSettingsMapMutex sync.RWMutex
+)
+
+func loadGuildSettings(st store.Store) error {
+	guildSettingsMapMutex.Lock()
+	defer guildSettingsMapMutex.Unlock()
+
+	guildSettingsMap = map[string]guildSettings{}
+	return st.ForEach(guildSettingsBucket, func(guildID string, raw json.RawMessage) error {
+		gs := guildSettings{}
+		if err := json.Unmarshal(raw, &gs); err != nil {
+			return err
+		}
+		guildSettingsMap[guildID] = gs
+		return nil
+	})
+}
+
+// settingsFor returns a copy of a guild's settings.
+func settingsFor(guildID string) guildSettings {
+	guildSettingsMapMutex.RLock()
+	defer guildSettingsMapMutex.RUnlock()
+	return guildSettingsMap[guildID].clone()
+}
+
+// updateSettings applies update to a guild's settings and writes the result
+// through to the state store.
+func updateSettings(guildID string, update func(*guildSettings)) (guildSettings, error) {
+	guildSettingsMapMutex.Lock()
+	defer guildSettingsMapMutex.Unlock()
+
+	gs := guildSettingsMap[guildID].clone()
+	update(&gs)
+	if err := stateStore().Put(guildSettingsBucket, guildID, gs); err != nil {
+		return guildSettingsMap[guildID].clone(), err
+	}
+	guildSettingsMap[guildID] = gs
+	return gs.clone(), nil
+}
+
+// featureEnabled reports whether a feature or command is enabled in a guild.
+// Everything is enabled outside of guilds.
+func featureEnabled(guildID, feature string) bool {
+	if guildID == "" {
+		return true
+	}
+	return settingsFor(guildID).featureEnabled(feature)
+}
+
+// toggleableFeatures lists everything that /settings can turn on or off.
+func toggleableFeatures() []string {
+	features := []string{featureGreetings, featureServerClock, featureWednesday}
+	for _, cmd := range registeredCommands() {
+		switch cmd.Name() {
+		case settingsCmd, helpCmd:
+			// Disabling these would leave no way to undo it.
+			continue
+		}
+		if cmd.Metadata().DMOnly || cmd.Metadata().Privilege != privilegeNone {
+			continue
+		}
+		features = append(features, cmd.Name())
+	}
+	sort.Strings(features)
+	return features
+}
+
+// IDs of /settings response messages.
+const (
+	msgSettingsNotAFeature    = "settings.not-a-feature"
+	msgSettingsInvalidTZ      = "settings.invalid-timezone"
+	msgSettingsEmptyList      = "settings.empty-list"
+	msgSettingsThreshold      = "settings.threshold"
+	msgSettingsManagerRole    = "settings.manager-role"
+	msgSettingsTitle          = "settings.title"
+	msgSettingsAnnouncements  = "settings.announcements"
+	msgSettingsTimezone       = "settings.timezone"
+	msgSettingsGreetings      = "settings.greetings"
+	msgSettingsFarewells      = "settings.farewells"
+	msgSettingsClockThreshold = "settings.clock-threshold"
+	msgSettingsManagers       = "settings.managers"
+	msgSettingsReports        = "settings.reports"
+	msgSettingsFeatures       = "settings.features"
+	msgSettingsDisabled       = "settings.disabled"
+	msgSettingsNone           = "settings.none"
+)
+
+func init() {
+	registerMessages(map[string]string{
+		msgSettingsNotAFeature:    "%s is not a feature that can be toggled",
+		msgSettingsInvalidTZ:      `"%s" is not a valid IANA timezone`,
+		msgSettingsEmptyList:      "the list must contain at least one non-empty entry",
+		msgSettingsThreshold:      "the threshold must be at least 1",
+		msgSettingsManagerRole:    "only members with the Manage Server permission can change bot manager roles",
+		msgSettingsTitle:          "Server Settings ⚙️",
+		msgSettingsAnnouncements:  "Announcement Channel",
+		msgSettingsTimezone:       "Timezone",
+		msgSettingsGreetings:      "Greetings",
+		msgSettingsFarewells:      "Farewells",
+		msgSettingsClockThreshold: "Server Clock Failure Threshold",
+		msgSettingsManagers:       "Bot Manager Roles",
+		msgSettingsReports:        "Report Channel",
+		msgSettingsFeatures:       "Features",
+		msgSettingsDisabled:       "Disabled",
+		msgSettingsNone:           "None",
+	})
+	registerCommand(&command{
+		name:       settingsCmd,
+		definition: settingsCmdDefinition,
+		handler:    handleSettingsCmd,
+		metadata: CommandMetadata{
+			GuildOnly:   true,
+			Permissions: discordgo.PermissionManageServer,
+		},
+	})
+}
+
+func settingsCmdDefinition() *discordgo.ApplicationCommand {
+	features := toggleableFeatures()
+	if len(features) > maxDiscordOptionChoices {
+		log.Warnf("%d toggleable features exceeds the maximum of %d choices, some will be omitted", len(features), maxDiscordOptionChoices)
+		features = features[:maxDiscordOptionChoices]
+	}
+	featureChoices := make([]*discordgo.ApplicationCommandOptionChoice, len(features))
+	for idx, f := range features {
+		featureChoices[idx] = &discordgo.ApplicationCommandOptionChoice{Name: f, Value: f}
+	}
+
+	return &discordgo.ApplicationCommand{
+		Name:        settingsCmd,
+		Description: "Configure the bot for this server.",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        settingsSubCmdView,
+				Description: "Show this server's settings.",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        settingsSubCmdAnnouncements,
+				Description: "Set the channel for scheduled posts. Omit the channel to use #general.",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionChannel,
+						Name:         settingsOptChannel,
+						Description:  "The channel to post in",
+						ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        settingsSubCmdFeature,
+				Description: "Enable or disable a feature in this server.",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        settingsOptFeature,
+						Description: "The feature or command to toggle",
+						Required:    true,
+						Choices:     featureChoices,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionBoolean,
+						Name:        settingsOptEnabled,
+						Description: "Should the feature be enabled?",
+						Required:    true,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        settingsSubCmdTimezone,
+				Description: "Set the timezone scheduled posts are timed in. Omit to use the bot's timezone.",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        settingsOptTimezone,
+						Description: "An IANA timezone, such as America/Denver",
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        settingsSubCmdGreetings,
+				Description: "Set the greetings the bot responds to. Omit the list to use the defaults.",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        settingsOptList,
+						Description: fmt.Sprintf("Greetings separated by '%s', e.g. Hello%sHowdy", settingsListSeparator, settingsListSeparator),
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        settingsSubCmdFarewells,
+				Description: "Set the farewells the bot responds to. Omit the list to use the defaults.",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        settingsOptList,
+						Description: fmt.Sprintf("Farewells separated by '%s', e.g. Goodbye%sLater", settingsListSeparator, settingsListSeparator),
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        settingsSubCmdClockThreshold,
+				Description: "Set how many times the server clock may fail before it is abandoned. Omit to use the default.",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Name:        settingsOptThreshold,
+						Description: "Number of consecutive failures",
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        settingsSubCmdManagerRole,
+				Description: "Let a role use the bot's commands as if it had the server permissions they require.",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionRole,
+						Name:        settingsOptRole,
+						Description: "The role",
+						Required:    true,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionBoolean,
+						Name:        settingsOptEnabled,
+						Description: "Should the role be a bot manager role?",
+						Required:    true,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        settingsSubCmdReports,
+				Description: "Set the channel that reported messages are sent to. Omit the channel to disable reports.",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionChannel,
+						Name:         settingsOptChannel,
+						Description:  "The channel for your moderators",
+						ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+					},
+				},
+			},
+		},
+	}
+}
+
+func handleSettingsCmd(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
+	mdata, err := getInteractionMetaData(i)
+	if err != nil {
+		logFor(i).Error(err)
+		interactionRespondEphemeralError(s, i, true, err)
+		return
+	}
+
+	subCmd := i.ApplicationCommandData().Options[0]
+	opts := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(subCmd.Options))
+	for _, opt := range subCmd.Options {
+		opts[opt.Name] = opt
+	}
+
+	var update func(*guildSettings)
+	switch subCmd.Name {
+	case settingsSubCmdView:
+		// Nothing to change, just display the settings below.
+	case settingsSubCmdAnnouncements:
+		channelID := ""
+		if opt, ok := opts[settingsOptChannel]; ok {
+			channelID = opt.ChannelValue(nil).ID
+		}
+		update = func(gs *guildSettings) { gs.AnnouncementChannelID = channelID }
+	case settingsSubCmdReports:
+		channelID := ""
+		if opt, ok := opts[settingsOptChannel]; ok {
+			channelID = opt.ChannelValue(nil).ID
+		}
+		update = func(gs *guildSettings) { gs.ReportChannelID = channelID }
+	case settingsSubCmdFeature:
+		feature := opts[settingsOptFeature].StringValue()
+		enabled := opts[settingsOptEnabled].BoolValue()
+		if !slices.Contains(toggleableFeatures(), feature) {
+			interactionRespondEphemeralError(s, i, false, errors.New(localized(i, msgSettingsNotAFeature, feature)))
+			return
+		}
+		update = func(gs *guildSettings) {
+			if enabled {
+				delete(gs.DisabledFeatures, feature)
+			} else {
+				gs.DisabledFeatures[feature] = true
+			}
+		}
+	case settingsSubCmdTimezone:
+		tz := ""
+		if opt, ok := opts[settingsOptTimezone]; ok {
+			tz = strings.TrimSpace(opt.StringValue())
+		}
+		if tz != "" {
+			if _, err := time.LoadLocation(tz); err != nil || strings.ToLower(tz) == "local" {
+				interactionRespondEphemeralError(s, i, false, errors.New(localized(i, msgSettingsInvalidTZ, tz)))
+				return
+			}
+		}
+		update = func(gs *guildSettings) { gs.Timezone = tz }
+	case settingsSubCmdGreetings, settingsSubCmdFarewells:
+		list := []string{}
+		if opt, ok := opts[settingsOptList]; ok {
+			list = parseSettingsList(opt.StringValue())
+			if len(list) == 0 {
+				interactionRespondEphemeralError(s, i, false, errors.New(localized(i, msgSettingsEmptyList)))
+				return
+			}
+		}
+		if subCmd.Name == settingsSubCmdGreetings {
+			update = func(gs *guildSettings) { gs.Greetings = list }
+		} else {
+			update = func(gs *guildSettings) { gs.Farewells = list }
+		}
+	case settingsSubCmdClockThreshold:
+		threshold := int64(0)
+		if opt, ok := opts[settingsOptThreshold]; ok {
+			threshold = opt.IntValue()
+			if threshold < 1 {
+				interactionRespondEphemeralError(s, i, false, errors.New(localized(i, msgSettingsThreshold)))
+				return
+			}
+		}
+		update = func(gs *guildSettings) { gs.ServerClockFailureThreshold = uint32(threshold) }
+	case settingsSubCmdManagerRole:
+		// Otherwise bot managers could hand the role out themselves.
+		if !hasPermissions(mdata.AuthorPermissions, discordgo.PermissionManageServer) && !isBotAdmin(mdata.AuthorID) {
+			interactionRespondEphemeralError(s, i, false, errors.New(localized(i, msgSettingsManagerRole)))
+			return
+		}
+		roleID := opts[settingsOptRole].RoleValue(nil, "").ID
+		enabled := opts[settingsOptEnabled].BoolValue()
+		update = func(gs *guildSettings) {
+			gs.BotManagerRoleIDs = slices.DeleteFunc(gs.BotManagerRoleIDs, func(id string) bool { return id == roleID })
+			if enabled {
+				gs.BotManagerRoleIDs = append(gs.BotManagerRoleIDs, roleID)
+			}
+		}
+	default:
+		err = fmt.Errorf("unknown subcommand: %s", subCmd.Name)
+		logFor(i).Error(err)
+		interactionRespondEphemeralError(s, i, true, err)
+		return
+	}
+
+	gs := settingsFor(mdata.GuildID)
+	if update != nil {
+		gs, err = updateSettings(mdata.GuildID, update)
+		if err != nil {
+			logFor(i).Error(err)
+			interactionRespondEphemeralError(s, i, true, err)
+			return
+		}
+		logFor(i).Infof("%s (%s) updated the %s setting for guild %s", mdata.AuthorUsername, mdata.AuthorID, subCmd.Name, mdata.GuildID)
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags:  discordgo.MessageFlagsEphemeral,
+			Embeds: []*discordgo.MessageEmbed{buildSettingsEmbed(i.Locale, gs).Truncate().MessageEmbed},
+		},
+	})
+	if err != nil {
+		logFor(i).Error(err)
+		interactionRespondEphemeralError(s, i, true, err)
+	}
+}
+
+func buildSettingsEmbed(locale discordgo.Locale, gs guildSettings) *dg_helpers.Embed {
+	color, _ := fastHappyColorInt64()
+
+	announcements := "#general"
+	if gs.AnnouncementChannelID != "" {
+		announcements = fmt.Sprintf("<#%s>", gs.AnnouncementChannelID)
+	}
+
+	reports := localize(locale, msgSettingsDisabled)
+	if gs.ReportChannelID != "" {
+		reports = fmt.Sprintf("<#%s>", gs.ReportChannelID)
+	}
+
+	managers := localize(locale, msgSettingsNone)
+	if len(gs.BotManagerRoleIDs) > 0 {
+		mentions := make([]string, len(gs.BotManagerRoleIDs))
+		for idx, roleID := range gs.BotManagerRoleIDs {
+			mentions[idx] = fmt.Sprintf("<@&%s>", roleID)
+		}
+		managers = strings.Join(mentions, ", ")
+	}
+
+	features := toggleableFeatures()
+	status := make([]string, len(features))
+	for idx, f := range features {
+		mark := "✅"
+		if !gs.featureEnabled(f) {
+			mark = "❌"
+		}
+		status[idx] = fmt.Sprintf("%s %s", mark, f)
+	}
+
+	return dg_helpers.NewEmbed().
+		SetTitle(localize(locale, msgSettingsTitle)).
+		SetColor(int(color)).
+		AddField(localize(locale, msgSettingsAnnouncements), announcements).
+		AddField(localize(locale, msgSettingsTimezone), gs.location().String()).
+		AddField(localize(locale, msgSettingsGreetings), strings.Join(gs.greetings(), ", ")).
+		AddField(localize(locale, msgSettingsFarewells), strings.Join(gs.farewells(), ", ")).
+		AddField(localize(locale, msgSettingsClockThreshold), fmt.Sprint(gs.serverClockFailureThreshold())).
+		AddField(localize(locale, msgSettingsManagers), managers).
+		AddField(localize(locale, msgSettingsReports), reports).
+		AddField(localize(locale, msgSettingsFeatures), strings.Join(status, "\n"))
+}
+
+func parseSettingsList(raw string) []string {
+	list := []string{}
+	for _, entry := range strings.Split(raw, settingsListSeparator) {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
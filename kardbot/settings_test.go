@@ -0,0 +1,113 @@
+package kardbot
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kardbord/Kard-bot/kardbot/fakediscord"
+	"github.com/bwmarrin/discordgo"
+)
+
+func inTestGuildAsAdmin() []fakediscord.InteractionOption {
+	admin := testMember()
+	admin.Permissions = discordgo.PermissionManageServer
+	return []fakediscord.InteractionOption{
+		fakediscord.FromMember(testGuildID, admin),
+		fakediscord.InChannel(testChannelID),
+	}
+}
+
+func TestSettingsToggleFeature(t *testing.T) {
+	fake := newTestBot(t)
+
+	disable := fake.Command(settingsCmd, []*discordgo.ApplicationCommandInteractionDataOption{
+		fakediscord.SubCommand(settingsSubCmdFeature,
+			fakediscord.StringOpt(settingsOptFeature, pollCmd),
+			fakediscord.BoolOpt(settingsOptEnabled, false),
+		),
+	}, inTestGuildAsAdmin()...)
+	bot().routeInteraction(fake, disable)
+	mustRespond(t, fake, disable)
+
+	gs := guildSettings{}
+	if found, err := stateStore().Get(guildSettingsBucket, testGuildID, &gs); err != nil || !found {
+		t.Fatalf("settings were not persisted; found=%v, err=%v", found, err)
+	}
+	if gs.featureEnabled(pollCmd) {
+		t.Fatalf("%s was not disabled: %+v", pollCmd, gs)
+	}
+
+	poll := fake.Command(pollCmd, nil, inTestGuild()...)
+	bot().routeInteraction(fake, poll)
+	if resp := mustRespond(t, fake, poll); !strings.Contains(resp.Initial.Data.Content, "disabled") {
+		t.Errorf("disabled command was not rejected: %+v", resp.Initial.Data)
+	}
+
+	if !featureEnabled("", pollCmd) {
+		t.Errorf("features should always be enabled outside of guilds")
+	}
+}
+
+func TestSettingsRequiresManageServer(t *testing.T) {
+	fake := newTestBot(t)
+	i := fake.Command(settingsCmd, []*discordgo.ApplicationCommandInteractionDataOption{
+		fakediscord.SubCommand(settingsSubCmdTimezone, fakediscord.StringOpt(settingsOptTimezone, "Europe/Berlin")),
+	}, inTestGuild()...)
+
+	bot().routeInteraction(fake, i)
+
+	if resp := mustRespond(t, fake, i); !isEphemeral(resp) || !strings.Contains(resp.Initial.Data.Content, "permissions") {
+		t.Errorf("expected a permissions error, got %+v", resp.Initial.Data)
+	}
+	if settingsFor(testGuildID).Timezone != "" {
+		t.Errorf("timezone should not have been changed")
+	}
+}
+
+func TestSettingsTimezone(t *testing.T) {
+	fake := newTestBot(t)
+
+	bad := fake.Command(settingsCmd, []*discordgo.ApplicationCommandInteractionDataOption{
+		fakediscord.SubCommand(settingsSubCmdTimezone, fakediscord.StringOpt(settingsOptTimezone, "Mars/Olympus_Mons")),
+	}, inTestGuildAsAdmin()...)
+	handleSettingsCmd(context.Background(), fake, bad)
+	if resp := mustRespond(t, fake, bad); !isEphemeral(resp) || settingsFor(testGuildID).Timezone != "" {
+		t.Errorf("invalid timezone was accepted")
+	}
+
+	good := fake.Command(settingsCmd, []*discordgo.ApplicationCommandInteractionDataOption{
+		fakediscord.SubCommand(settingsSubCmdTimezone, fakediscord.StringOpt(settingsOptTimezone, "Asia/Tokyo")),
+	}, inTestGuildAsAdmin()...)
+	handleSettingsCmd(context.Background(), fake, good)
+	mustRespond(t, fake, good)
+
+	loc := settingsFor(testGuildID).location()
+	if loc.String() != "Asia/Tokyo" {
+		t.Fatalf("got location %s, want Asia/Tokyo", loc)
+	}
+
+	// 9am Wednesday in Tokyo is midnight in UTC
+	utc := time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC)
+	if !isWednesdayMorning(utc, loc) || isWednesdayMorning(utc, time.UTC) {
+		t.Errorf("Wednesday post was not timed in the guild's timezone")
+	}
+}
+
+func TestSettingsGreetingsAreEscaped(t *testing.T) {
+	fake := newTestBot(t)
+	i := fake.Command(settingsCmd, []*discordgo.ApplicationCommandInteractionDataOption{
+		fakediscord.SubCommand(settingsSubCmdGreetings, fakediscord.StringOpt(settingsOptList, " Hi (there | Yo? ||")),
+	}, inTestGuildAsAdmin()...)
+	handleSettingsCmd(context.Background(), fake, i)
+	mustRespond(t, fake, i)
+
+	got := settingsFor(testGuildID).greetings()
+	if len(got) != 2 || got[0] != "Hi (there" || got[1] != "Yo?" {
+		t.Fatalf("unexpected greetings %q", got)
+	}
+	if q := quoteAll(got); q[0] != `Hi \(there` || q[1] != `Yo\?` {
+		t.Errorf("greetings were not escaped: %q", q)
+	}
+}
@@ -0,0 +1,188 @@
+package kardbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Used if setup.json does not specify a shutdown-timeout-seconds.
+const defaultShutdownTimeout = 60 * time.Second
+
+// activity tracks in-flight work so that shutdown can stop new work
+// from starting, then wait for the work that already started.
+type activity struct {
+	mutex  sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// begin reports whether new work may start. If it returns true,
+// end must be called once the work is done.
+func (a *activity) begin() bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.closed {
+		return false
+	}
+	a.wg.Add(1)
+	return true
+}
+
+func (a *activity) end() {
+	a.wg.Done()
+}
+
+// close prevents new work from starting.
+func (a *activity) close() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.closed = true
+}
+
+// wait blocks until all work has ended or ctx is done.
+func (a *activity) wait(ctx context.Context) error {
+	return waitFor(ctx, "in-flight handlers", a.wg.Wait)
+}
+
+// waitFor runs fn and waits for it to return or for ctx to be done,
+// whichever comes first. fn keeps running in the background if ctx
+// is done first.
+func waitFor(ctx context.Context, what string, fn func()) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("gave up waiting for %s: %w", what, ctx.Err())
+	}
+}
+
+func (kbot *kardbot) shutdownTimeout() time.Duration {
+	if kbot.ShutdownTimeoutSeconds <= 0 {
+		return defaultShutdownTimeout
+	}
+	return time.Duration(kbot.ShutdownTimeoutSeconds) * time.Second
+}
+
+// handleInterrupt blocks the current goroutine until a terminating signal is received.
+// When the signal is received, the bot is shut down gracefully and the process exits,
+// with status 0 if everything finished before the shutdown timeout. A second signal
+// exits immediately.
+func handleInterrupt() {
+	sc := make(chan os.Signal, 2)
+	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+	sig := <-sc
+	log.Infof("Received %s, shutting down", sig)
+
+	go func() {
+		<-sc
+		log.Warn("Received a second signal, exiting immediately")
+		os.Exit(1)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), bot().shutdownTimeout())
+	defer cancel()
+	if err := Shutdown(ctx); err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// Shutdown gracefully stops the bot. New interactions are turned away,
+// then Shutdown waits for in-flight handlers, scheduled cron jobs, and
+// queued jobs to finish before closing the Discord session and the state
+// store. If ctx is done before everything finishes, the session and store
+// are closed anyway and an error is returned.
+func Shutdown(ctx context.Context) error {
+	if gbot == nil {
+		log.Info("Bot is not running")
+		return nil
+	}
+
+	err := errors.New("shutdown already in progress")
+	gbot.shutdownOnce.Do(func() {
+		err = gbot.shutdown(ctx)
+	})
+	return err
+}
+
+// Stop shuts the bot down without waiting for in-flight work to finish.
+// State is still flushed to the store.
+func Stop() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Shutdown(ctx); err != nil {
+		log.Warn(err)
+	}
+}
+
+func (kbot *kardbot) shutdown(ctx context.Context) error {
+	defer func() {
+		if kbot.wg == nil {
+			log.Fatal("nil waitgroup, there is a bug. :(")
+		}
+		kbot.wg.Done()
+	}()
+
+	errs := []error{}
+
+	kbot.ready.Store(false)
+	log.Info("No longer accepting interactions")
+	kbot.activity.close()
+
+	if kbot.configWatcher != nil {
+		if err := kbot.configWatcher.Close(); err != nil {
+			log.Error(err)
+		}
+	}
+
+	log.Info("Waiting for scheduled tasks")
+	errs = append(errs, waitFor(ctx, "scheduled tasks", scheduler().Stop))
+
+	// Pending jobs remain in the store and resume on the next start.
+	if kbot.jobs != nil {
+		log.Info("Stopping job queue")
+		errs = append(errs, waitFor(ctx, "queued jobs", kbot.jobs.Stop))
+	}
+
+	log.Info("Waiting for in-flight handlers")
+	errs = append(errs, kbot.activity.wait(ctx))
+
+	if kbot.Session != nil {
+		log.Info("Closing session")
+		if err := kbot.Session.Close(); err != nil {
+			log.Errorf("Session closed with error: %v", err)
+		} else {
+			log.Info("Session closed")
+		}
+	}
+
+	// State is written through to the store as it changes,
+	// so all that is left to do here is flush and release it.
+	if kbot.store != nil {
+		log.Info("Closing store")
+		if err := kbot.store.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("store closed with error: %w", err))
+		}
+	}
+
+	err := errors.Join(errs...)
+	if err == nil {
+		log.Info("Shutdown complete")
+	}
+	return err
+}
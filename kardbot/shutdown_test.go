@@ -0,0 +1,72 @@
+package kardbot
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kardbord/Kard-bot/kardbot/store"
+)
+
+func TestShutdownWaitsForInFlightHandlers(t *testing.T) {
+	newTestBot(t)
+	bot().wg.Add(1)
+
+	if !bot().activity.begin() {
+		t.Fatal("activity was closed before shutdown")
+	}
+	finished := make(chan struct{})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		// Handlers must still be able to write state while shutdown waits on them.
+		if err := stateStore().Put(pollsBucket, "in-flight", true); err != nil {
+			t.Error(err)
+		}
+		close(finished)
+		bot().activity.end()
+	}()
+
+	if err := Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-finished:
+	default:
+		t.Fatal("shutdown returned before the in-flight handler finished")
+	}
+	if err := stateStore().Put(pollsBucket, "late", true); !errors.Is(err, store.ErrClosed) {
+		t.Errorf("store was not closed: %v", err)
+	}
+}
+
+func TestShutdownRejectsNewInteractions(t *testing.T) {
+	fake := newTestBot(t)
+	bot().wg.Add(1)
+	if err := Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	i := fake.Command(pollCmd, nil, inTestGuild()...)
+	bot().routeInteraction(fake, i)
+
+	resp := mustRespond(t, fake, i)
+	if !isEphemeral(resp) || !strings.Contains(resp.Initial.Data.Content, "restarting") {
+		t.Errorf("expected an ephemeral restart notice, got %+v", resp.Initial.Data)
+	}
+}
+
+func TestShutdownTimesOut(t *testing.T) {
+	newTestBot(t)
+	bot().wg.Add(1)
+
+	bot().activity.begin()
+	defer bot().activity.end()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want a deadline exceeded error", err)
+	}
+}
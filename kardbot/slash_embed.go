@@ -1,6 +1,8 @@
 package kardbot
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
@@ -8,7 +10,6 @@ import (
 	"github.com/Kardbord/Kard-bot/kardbot/dg_helpers"
 	"github.com/Kardbord/ubiquity/httputils"
 	"github.com/bwmarrin/discordgo"
-	log "github.com/sirupsen/logrus"
 )
 
 const (
@@ -38,17 +39,102 @@ const (
 
 const authorIDFieldTitle = "Embed Author"
 
+const embedFormID = "embed-form"
+
+// Collects the text of a new embed. Its fields share their IDs with
+// the matching slash command options, so the two can be handled together.
+var embedForm = &modalForm{
+	id:      embedFormID,
+	title:   "Create an embed",
+	command: embedCmd,
+	fields: []formField{
+		{
+			id:        embedSubCmdOptTitle,
+			label:     "Title",
+			maxLength: dg_helpers.EmbedLimitTitle,
+		},
+		{
+			id:          embedSubCmdOptURL,
+			label:       "Title link",
+			placeholder: "https://",
+		},
+		{
+			id:        embedSubCmdOptDesc,
+			label:     "Description",
+			paragraph: true,
+			maxLength: dg_helpers.EmbedLimitDescription,
+		},
+		{
+			id:        embedSubCmdOptFooter,
+			label:     "Footer",
+			paragraph: true,
+			maxLength: dg_helpers.EmbedLimitFooter,
+		},
+		{
+			id:          embedSubCmdOptImageURL,
+			label:       "Image URL",
+			placeholder: "https://",
+		},
+	},
+	submit: submitEmbedForm,
+}
+
+// IDs of /embed response messages.
+const (
+	msgEmbedInvalidURL     = "embed.invalid-url"
+	msgEmbedEmpty          = "embed.empty"
+	msgEmbedUpdated        = "embed.updated"
+	msgEmbedNoFieldTitle   = "embed.no-field-title"
+	msgEmbedNoFieldContent = "embed.no-field-content"
+	msgEmbedAuthorField    = "embed.author-field"
+	msgEmbedNegativeIndex  = "embed.negative-index"
+	msgEmbedIndexTooLarge  = "embed.index-too-large"
+	msgEmbedNotBots        = "embed.not-bots"
+	msgEmbedNotSingle      = "embed.not-single"
+	msgEmbedNotUpdateable  = "embed.not-updateable"
+	msgEmbedNotAuthor      = "embed.not-author"
+)
+
+func init() {
+	registerMessages(map[string]string{
+		msgEmbedInvalidURL:     "invalid URL: %s",
+		msgEmbedEmpty:          "cannot create an empty embed",
+		msgEmbedUpdated:        "The embed was successfully updated!",
+		msgEmbedNoFieldTitle:   "you must provide a title for the field",
+		msgEmbedNoFieldContent: "you must provide content for the field",
+		msgEmbedAuthorField:    `cannot remove the "%s" field`,
+		msgEmbedNegativeIndex:  "invalid field index (%d), must be a non-negative integer",
+		msgEmbedIndexTooLarge:  "invalid field index (%d), must not be greater than %d for this message",
+		msgEmbedNotBots:        "that message is not an updateable embed, it was not posted by %s",
+		msgEmbedNotSingle:      "that message is not an updateable embed, it has %d embeds instead of 1",
+		msgEmbedNotUpdateable:  "that message is not an updateable embed",
+		msgEmbedNotAuthor:      "you do not appear to be the author of the embed you wish to edit",
+	})
+	formRoute, retryRoute := embedForm.routes()
+	registerCommand(&command{
+		name:       embedCmd,
+		definition: embedCmdDefinition,
+		handler:    handleEmbedCmd,
+		components: []interactionRoute{retryRoute},
+		modals:     []interactionRoute{formRoute},
+	})
+}
+
+func embedCmdDefinition() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        embedCmd,
+		Description: "Build a custom embed",
+		Options:     embedCmdOpts(),
+	}
+}
+
 func embedCmdOpts() []*discordgo.ApplicationCommandOption {
 	return []*discordgo.ApplicationCommandOption{
 		{
 			Type:        discordgo.ApplicationCommandOptionSubCommand,
 			Name:        embedSubCmdCreate,
 			Description: "Create a new embed",
-			Options: append(embedCmdSubCmdOpts(), &discordgo.ApplicationCommandOption{
-				Type:        discordgo.ApplicationCommandOptionBoolean,
-				Name:        embedSubCmdCreateOptPreview,
-				Description: "If true, the bot will respone ephemerally",
-			}),
+			Options:     embedSubCmdCreateOpts(),
 		},
 		{
 			Type:        discordgo.ApplicationCommandOptionSubCommand,
@@ -108,6 +194,21 @@ func embedCmdOpts() []*discordgo.ApplicationCommandOption {
 	}
 }
 
+// The options of embedCmdSubCmdOpts that aren't entered in embedForm.
+func embedSubCmdCreateOpts() []*discordgo.ApplicationCommandOption {
+	opts := []*discordgo.ApplicationCommandOption{}
+	for _, opt := range embedCmdSubCmdOpts() {
+		if !embedForm.has(opt.Name) {
+			opts = append(opts, opt)
+		}
+	}
+	return append(opts, &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionBoolean,
+		Name:        embedSubCmdCreateOptPreview,
+		Description: "If true, the bot will respone ephemerally",
+	})
+}
+
 func embedCmdSubCmdOpts() []*discordgo.ApplicationCommandOption {
 	return []*discordgo.ApplicationCommandOption{
 		{
@@ -186,9 +287,9 @@ func embedCmdSubCmdOpts() []*discordgo.ApplicationCommandOption {
 	}
 }
 
-func handleEmbedCmd(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func handleEmbedCmd(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	if s == nil || i == nil {
-		log.Errorf("nil Session pointer (%v) and/or InteractionCreate pointer (%v)", s, i)
+		logFor(i).Errorf("nil Session pointer (%v) and/or InteractionCreate pointer (%v)", s, i)
 		return
 	}
 
@@ -199,7 +300,8 @@ func handleEmbedCmd(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	)
 	switch i.ApplicationCommandData().Options[0].Name {
 	case embedSubCmdCreate:
-		resp, reportableErr, err = handleEmbedSubCmdCreate(s, i)
+		embedForm.open(s, i, nil)
+		return
 	case embedSubCmdUpdate:
 		resp, reportableErr, err = handleEmbedSubCmdUpdate(s, i)
 	case embedSubCmdAddField:
@@ -217,22 +319,41 @@ func handleEmbedCmd(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	}
 	if resp == nil {
 		interactionRespondEphemeralError(s, i, true, fmt.Errorf("nil response returned"))
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
 
 	err = s.InteractionRespond(i.Interaction, resp)
 	if err != nil {
 		interactionRespondEphemeralError(s, i, true, err)
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
 }
 
-func handleEmbedSubCmdCreate(s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, bool, error) {
+func submitEmbedForm(s discordSession, i *discordgo.InteractionCreate, values formValues, origin *discordgo.InteractionCreate) error {
+	opts := origin.ApplicationCommandData().Options[0].Options
+	resp, reportableErr, err := handleEmbedSubCmdCreate(i, append(values.options(), opts...))
+	if err != nil {
+		if !reportableErr {
+			return err
+		}
+		interactionRespondEphemeralError(s, i, true, err)
+		return nil
+	}
+
+	err = s.InteractionRespond(i.Interaction, resp)
+	if err != nil {
+		interactionRespondEphemeralError(s, i, true, err)
+		logFor(i).Error(err)
+	}
+	return nil
+}
+
+func handleEmbedSubCmdCreate(i *discordgo.InteractionCreate, opts []*discordgo.ApplicationCommandInteractionDataOption) (*discordgo.InteractionResponse, bool, error) {
 	e := dg_helpers.NewEmbed()
 	var flags discordgo.MessageFlags = 0
-	for _, opt := range i.ApplicationCommandData().Options[0].Options {
+	for _, opt := range opts {
 		switch opt.Name {
 		case embedSubCmdCreateOptPreview:
 			if opt.BoolValue() {
@@ -241,7 +362,7 @@ func handleEmbedSubCmdCreate(s *discordgo.Session, i *discordgo.InteractionCreat
 		case embedSubCmdOptURL:
 			e.SetURL(opt.StringValue())
 			if !httputils.IsReachableURL(opt.StringValue()) {
-				return nil, false, fmt.Errorf("invalid URL: %s", opt.StringValue())
+				return nil, false, errors.New(localized(i, msgEmbedInvalidURL, opt.StringValue()))
 			}
 			// Doesn't count as a non-empty embed on its own
 		case embedSubCmdOptTitle:
@@ -256,15 +377,15 @@ func handleEmbedSubCmdCreate(s *discordgo.Session, i *discordgo.InteractionCreat
 		case embedSubCmdOptImageURL:
 			e.SetImage(opt.StringValue())
 			if !httputils.IsReachableURL(opt.StringValue()) {
-				return nil, false, fmt.Errorf("invalid URL: %s", opt.StringValue())
+				return nil, false, errors.New(localized(i, msgEmbedInvalidURL, opt.StringValue()))
 			}
 		case embedSubCmdOptThumbnailURL:
 			e.SetThumbnail(opt.StringValue())
 			if !httputils.IsReachableURL(opt.StringValue()) {
-				return nil, false, fmt.Errorf("invalid URL: %s", opt.StringValue())
+				return nil, false, errors.New(localized(i, msgEmbedInvalidURL, opt.StringValue()))
 			}
 		default:
-			log.Warn("Unknown option: ", opt.Name)
+			logFor(i).Warn("Unknown option: ", opt.Name)
 		}
 	}
 
@@ -278,7 +399,7 @@ func handleEmbedSubCmdCreate(s *discordgo.Session, i *discordgo.InteractionCreat
 	}}, e.Fields...)
 
 	if e.IsEmpty() {
-		return nil, false, fmt.Errorf("cannot create an empty embed")
+		return nil, false, errors.New(localized(i, msgEmbedEmpty))
 	}
 
 	embeds := []*discordgo.MessageEmbed{e.Truncate().SetType(discordgo.EmbedTypeRich).MessageEmbed}
@@ -298,7 +419,7 @@ func handleEmbedSubCmdCreate(s *discordgo.Session, i *discordgo.InteractionCreat
 	}, false, nil
 }
 
-func handleEmbedSubCmdUpdate(s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, bool, error) {
+func handleEmbedSubCmdUpdate(s discordSession, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, bool, error) {
 	e := dg_helpers.NewEmbed()
 
 	metadata, err := getInteractionMetaData(i)
@@ -306,7 +427,7 @@ func handleEmbedSubCmdUpdate(s *discordgo.Session, i *discordgo.InteractionCreat
 		return nil, true, err
 	}
 
-	msgToUpdate, reportableErr, err := getUpdateableEmbed(metadata.ChannelID, i.ApplicationCommandData().Options[0].Options[0].StringValue(), metadata.AuthorMention, s)
+	msgToUpdate, reportableErr, err := getUpdateableEmbed(metadata.ChannelID, i.ApplicationCommandData().Options[0].Options[0].StringValue(), metadata.AuthorMention, s, i)
 	if err != nil {
 		return nil, reportableErr, err
 	}
@@ -321,7 +442,7 @@ func handleEmbedSubCmdUpdate(s *discordgo.Session, i *discordgo.InteractionCreat
 		case embedSubCmdOptURL:
 			e.SetURL(opt.StringValue())
 			if !httputils.IsReachableURL(opt.StringValue()) {
-				return nil, false, fmt.Errorf("invalid URL: %s", opt.StringValue())
+				return nil, false, errors.New(localized(i, msgEmbedInvalidURL, opt.StringValue()))
 			}
 			// Doesn't count as a non-empty embed on its own
 		case embedSubCmdOptTitle:
@@ -336,20 +457,20 @@ func handleEmbedSubCmdUpdate(s *discordgo.Session, i *discordgo.InteractionCreat
 		case embedSubCmdOptImageURL:
 			e.SetImage(opt.StringValue())
 			if !httputils.IsReachableURL(opt.StringValue()) {
-				return nil, false, fmt.Errorf("invalid URL: %s", opt.StringValue())
+				return nil, false, errors.New(localized(i, msgEmbedInvalidURL, opt.StringValue()))
 			}
 		case embedSubCmdOptThumbnailURL:
 			e.SetThumbnail(opt.StringValue())
 			if !httputils.IsReachableURL(opt.StringValue()) {
-				return nil, false, fmt.Errorf("invalid URL: %s", opt.StringValue())
+				return nil, false, errors.New(localized(i, msgEmbedInvalidURL, opt.StringValue()))
 			}
 		default:
-			log.Warn("Unknown option: ", opt.Name)
+			logFor(i).Warn("Unknown option: ", opt.Name)
 		}
 	}
 
 	if e.IsEmpty() {
-		return nil, false, fmt.Errorf("cannot create an empty embed")
+		return nil, false, errors.New(localized(i, msgEmbedEmpty))
 	}
 
 	_, err = s.ChannelMessageEditComplex(&discordgo.MessageEdit{
@@ -375,12 +496,12 @@ func handleEmbedSubCmdUpdate(s *discordgo.Session, i *discordgo.InteractionCreat
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
 			Flags:   discordgo.MessageFlagsEphemeral,
-			Content: "The embed was successfully updated!",
+			Content: localized(i, msgEmbedUpdated),
 		},
 	}, false, nil
 }
 
-func handleEmbedSubCmdAddField(s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, bool, error) {
+func handleEmbedSubCmdAddField(s discordSession, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, bool, error) {
 	e := dg_helpers.NewEmbed()
 
 	metadata, err := getInteractionMetaData(i)
@@ -388,7 +509,7 @@ func handleEmbedSubCmdAddField(s *discordgo.Session, i *discordgo.InteractionCre
 		return nil, true, err
 	}
 
-	msgToUpdate, reportableErr, err := getUpdateableEmbed(metadata.ChannelID, i.ApplicationCommandData().Options[0].Options[0].StringValue(), metadata.AuthorMention, s)
+	msgToUpdate, reportableErr, err := getUpdateableEmbed(metadata.ChannelID, i.ApplicationCommandData().Options[0].Options[0].StringValue(), metadata.AuthorMention, s, i)
 	if err != nil {
 		return nil, reportableErr, err
 	}
@@ -408,15 +529,15 @@ func handleEmbedSubCmdAddField(s *discordgo.Session, i *discordgo.InteractionCre
 		case embedSubCmdOptFieldValue:
 			value = opt.StringValue()
 		default:
-			log.Warn("Unknown option: ", opt.Name)
+			logFor(i).Warn("Unknown option: ", opt.Name)
 		}
 	}
 
 	if title == "" {
-		return nil, false, fmt.Errorf("you must provide a title for the field")
+		return nil, false, errors.New(localized(i, msgEmbedNoFieldTitle))
 	}
 	if value == "" {
-		return nil, false, fmt.Errorf("you must provide content for the field")
+		return nil, false, errors.New(localized(i, msgEmbedNoFieldContent))
 	}
 
 	e.AddField(title, value)
@@ -444,12 +565,12 @@ func handleEmbedSubCmdAddField(s *discordgo.Session, i *discordgo.InteractionCre
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
 			Flags:   discordgo.MessageFlagsEphemeral,
-			Content: "The embed was successfully updated!",
+			Content: localized(i, msgEmbedUpdated),
 		},
 	}, false, nil
 }
 
-func handleEmbedSubCmdDelField(s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, bool, error) {
+func handleEmbedSubCmdDelField(s discordSession, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, bool, error) {
 	e := dg_helpers.NewEmbed()
 
 	metadata, err := getInteractionMetaData(i)
@@ -457,7 +578,7 @@ func handleEmbedSubCmdDelField(s *discordgo.Session, i *discordgo.InteractionCre
 		return nil, true, err
 	}
 
-	msgToUpdate, reportableErr, err := getUpdateableEmbed(metadata.ChannelID, i.ApplicationCommandData().Options[0].Options[0].StringValue(), metadata.AuthorMention, s)
+	msgToUpdate, reportableErr, err := getUpdateableEmbed(metadata.ChannelID, i.ApplicationCommandData().Options[0].Options[0].StringValue(), metadata.AuthorMention, s, i)
 	if err != nil {
 		return nil, reportableErr, err
 	}
@@ -467,13 +588,13 @@ func handleEmbedSubCmdDelField(s *discordgo.Session, i *discordgo.InteractionCre
 	idxToDel := i.ApplicationCommandData().Options[0].Options[1].IntValue()
 
 	if idxToDel == 0 {
-		return nil, false, fmt.Errorf(`cannot remove the "%s" field`, authorIDFieldTitle)
+		return nil, false, errors.New(localized(i, msgEmbedAuthorField, authorIDFieldTitle))
 	}
 	if idxToDel < 0 {
-		return nil, false, fmt.Errorf("invalid field index (%d), must be a non-negative integer", idxToDel)
+		return nil, false, errors.New(localized(i, msgEmbedNegativeIndex, idxToDel))
 	}
 	if idxToDel > int64(len(e.Fields)-1) {
-		return nil, false, fmt.Errorf("invalid field index (%d), must not be greater than %d for this message", idxToDel, len(e.Fields)-1)
+		return nil, false, errors.New(localized(i, msgEmbedIndexTooLarge, idxToDel, len(e.Fields)-1))
 	}
 
 	e.Fields = append(e.Fields[:idxToDel], e.Fields[idxToDel+1:]...)
@@ -501,7 +622,7 @@ func handleEmbedSubCmdDelField(s *discordgo.Session, i *discordgo.InteractionCre
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
 			Flags:   discordgo.MessageFlagsEphemeral,
-			Content: "The embed was successfully updated!",
+			Content: localized(i, msgEmbedUpdated),
 		},
 	}, false, nil
 }
@@ -510,28 +631,24 @@ var embedAuthorMentionRegex = regexp.MustCompile(`^<@\d+>$`)
 
 // Checks that the provided MessageID refers to a message that was authored by the bot,
 // contains a single embed, and that the embed was created by the specified authorID
-func getUpdateableEmbed(channelID, messageID, authorMention string, s *discordgo.Session) (*discordgo.Message, bool, error) {
+func getUpdateableEmbed(channelID, messageID, authorMention string, s discordSession, i *discordgo.InteractionCreate) (*discordgo.Message, bool, error) {
 	msgToUpdate, err := s.ChannelMessage(channelID, messageID)
 	if err != nil {
 		return nil, true, err
 	}
 
-	const notUpdateableMsg = "Message does not appear to be an updateable embed: "
-	if s.State.User.ID != msgToUpdate.Author.ID {
-		return nil, false, fmt.Errorf("%snot authored by %s", notUpdateableMsg, s.State.User.Mention())
+	if s.SelfUser().ID != msgToUpdate.Author.ID {
+		return nil, false, errors.New(localized(i, msgEmbedNotBots, s.SelfUser().Mention()))
 	}
 
 	if len(msgToUpdate.Embeds) != 1 {
-		return nil, false, fmt.Errorf("%sexpected only 1 embed, got %d", notUpdateableMsg, len(msgToUpdate.Embeds))
-	}
-
-	// First field should always be the author of the embed
-	if len(msgToUpdate.Embeds[0].Fields) < 1 {
-		return nil, false, fmt.Errorf("%sexpected at least one field", notUpdateableMsg)
+		return nil, false, errors.New(localized(i, msgEmbedNotSingle, len(msgToUpdate.Embeds)))
 	}
 
-	if msgToUpdate.Embeds[0].Fields[0].Name != authorIDFieldTitle {
-		return nil, false, fmt.Errorf("%scould not determine embed author, embed has unexpected format", notUpdateableMsg)
+	// First field should always be the author of the embed, without
+	// which the embed has an unexpected format
+	if len(msgToUpdate.Embeds[0].Fields) < 1 || msgToUpdate.Embeds[0].Fields[0].Name != authorIDFieldTitle {
+		return nil, false, errors.New(localized(i, msgEmbedNotUpdateable))
 	}
 
 	var authorIDField string = ""
@@ -548,7 +665,7 @@ func getUpdateableEmbed(channelID, messageID, authorMention string, s *discordgo
 	}
 
 	if !strings.Contains(authorIDField, authorMention) {
-		return nil, false, fmt.Errorf("%syou do not appear to be the author of the embed you wish to edit", notUpdateableMsg)
+		return nil, false, errors.New(localized(i, msgEmbedNotAuthor))
 	}
 
 	return msgToUpdate, false, nil
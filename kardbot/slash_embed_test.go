@@ -0,0 +1,42 @@
+package kardbot
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Kardbord/Kard-bot/kardbot/fakediscord"
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestEmbedCreateForm(t *testing.T) {
+	fake := newTestBot(t)
+	open := fake.Command(embedCmd, []*discordgo.ApplicationCommandInteractionDataOption{
+		fakediscord.SubCommand(embedSubCmdCreate,
+			fakediscord.IntOpt(embedSubCmdOptColor, 0x008000),
+			fakediscord.BoolOpt(embedSubCmdCreateOptPreview, true),
+		),
+	}, inTestGuild()...)
+	handleEmbedCmd(context.Background(), fake, open)
+
+	i := submitForm(fake, openedForm(t, fake, open), map[string]string{
+		embedSubCmdOptTitle: "Rules",
+		embedSubCmdOptDesc:  "Be nice.\nNo spam.",
+	})
+
+	resp := mustRespond(t, fake, i)
+	if !isEphemeral(resp) {
+		t.Error("preview was not honored")
+	}
+	e := resp.Initial.Data.Embeds
+	if len(e) != 1 || e[0].Title != "Rules" || e[0].Description != "Be nice.\nNo spam." || e[0].Color != 0x008000 {
+		t.Errorf("embed does not combine the form and the command options: %+v", e)
+	}
+}
+
+func TestEmbedCreateOptsLeaveOutFormFields(t *testing.T) {
+	for _, opt := range embedSubCmdCreateOpts() {
+		if embedForm.has(opt.Name) {
+			t.Errorf("%s is both a form field and an option", opt.Name)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package kardbot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Kardbord/Kard-bot/kardbot/config"
+	"github.com/Kardbord/Kard-bot/kardbot/store"
+	log "github.com/sirupsen/logrus"
+)
+
+// Buckets used to persist bot state.
+const (
+	complimentSubsAMBucket = "compliment-subscribers-morning"
+	complimentSubsPMBucket = "compliment-subscribers-evening"
+	creepyDMSubsBucket     = "creepy-dm-subscribers"
+	errorRecordsBucket     = "errors"
+	errorReportsBucket     = "error-reports"
+	guildSettingsBucket    = "guild-settings"
+	jobsBucket             = "jobs"
+	pollsBucket            = "polls"
+	quotesBucket           = "quotes"
+	serverClocksBucket     = "server-clocks"
+	userTimezonesBucket    = "user-timezones"
+)
+
+var defaultStorageConfig = store.Config{
+	Backend: store.BackendBolt,
+	Path:    "config/state.db",
+}
+
+// stateStore is a getter for the bot's persistent state store.
+func stateStore() store.Store {
+	return bot().store
+}
+
+// readStorageConfig reads the state store configuration from setup.json.
+func readStorageConfig() (store.Config, error) {
+	cfg := struct {
+		Storage store.Config `json:"storage"`
+	}{defaultStorageConfig}
+
+	jsonCfg, err := config.NewJsonConfig(kardbotConfigFile)
+	if err != nil {
+		return cfg.Storage, err
+	}
+	err = json.Unmarshal(jsonCfg.Raw, &cfg)
+	return cfg.Storage, err
+}
+
+// openStateStore opens the configured state store and brings it up to
+// the current schema version.
+func openStateStore() (store.Store, error) {
+	cfg, err := readStorageConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := store.Open(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s store at %s: %w", cfg.Backend, cfg.Path, err)
+	}
+	log.Infof("Opened %s store at %s", cfg.Backend, cfg.Path)
+
+	if err = store.Migrate(st, storageMigrations()); err != nil {
+		st.Close()
+		return nil, err
+	}
+	if v, err := store.SchemaVersion(st); err == nil {
+		log.Infof("Store is at schema version %d", v)
+	}
+	return st, nil
+}
+
+func (kbot *kardbot) openStore() {
+	st, err := openStateStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+	kbot.store = st
+
+	for _, load := range stateLoaders() {
+		if err = load(st); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	kbot.jobs, err = newJobQueue(st)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = schedulePollClosings(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Any state that must be read from the store on startup belongs in this list.
+func stateLoaders() []func(store.Store) error {
+	return []func(store.Store) error{
+		loadComplimentSubscribers,
+		loadCreepyDMSubscribers,
+		loadGuildSettings,
+		loadPolls,
+		loadServerClocks,
+		loadUserTimezones,
+	}
+}
+
+// Any bucket holding state that should move with the bot to a new
+// deployment belongs in this list. See ExportState.
+func stateBuckets() []string {
+	return []string{
+		complimentSubsAMBucket,
+		complimentSubsPMBucket,
+		creepyDMSubsBucket,
+		errorRecordsBucket,
+		guildSettingsBucket,
+		jobsBucket,
+		pollsBucket,
+		quotesBucket,
+		serverClocksBucket,
+		userTimezonesBucket,
+	}
+}
+
+// stateDump is the format written by ExportState and read by ImportState.
+// Records are kept in their stored JSON form, so the dump is the same
+// regardless of the backend it came from.
+type stateDump struct {
+	SchemaVersion uint                                  `json:"schema-version"`
+	Buckets       map[string]map[string]json.RawMessage `json:"buckets"`
+}
+
+func exportState(st store.Store, w io.Writer) error {
+	version, err := store.SchemaVersion(st)
+	if err != nil {
+		return err
+	}
+
+	dump := stateDump{SchemaVersion: version, Buckets: map[string]map[string]json.RawMessage{}}
+	for _, bucket := range stateBuckets() {
+		records := map[string]json.RawMessage{}
+		err = st.ForEach(bucket, func(key string, raw json.RawMessage) error {
+			records[key] = raw
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", bucket, err)
+		}
+		dump.Buckets[bucket] = records
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(dump)
+}
+
+// importState writes every record in a dump to st, replacing any record
+// with the same key. Nothing is written unless the whole dump is usable.
+func importState(st store.Store, r io.Reader) (int, error) {
+	dump := stateDump{}
+	if err := json.NewDecoder(r).Decode(&dump); err != nil {
+		return 0, fmt.Errorf("could not read state dump: %w", err)
+	}
+
+	version, err := store.SchemaVersion(st)
+	if err != nil {
+		return 0, err
+	}
+	if dump.SchemaVersion != version {
+		return 0, fmt.Errorf("state dump is at schema version %d, but the store is at version %d", dump.SchemaVersion, version)
+	}
+
+	known := map[string]bool{}
+	for _, bucket := range stateBuckets() {
+		known[bucket] = true
+	}
+	for bucket := range dump.Buckets {
+		if !known[bucket] {
+			return 0, fmt.Errorf(`state dump contains unknown bucket "%s"`, bucket)
+		}
+	}
+
+	count := 0
+	for _, bucket := range stateBuckets() {
+		for key, raw := range dump.Buckets[bucket] {
+			if err := st.Put(bucket, key, raw); err != nil {
+				return count, fmt.Errorf("%s/%s: %w", bucket, key, err)
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ExportState writes every record in the state store to w as JSON.
+// The bot must not be running, since the store may be locked.
+func ExportState(w io.Writer) error {
+	st, err := openStateStore()
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	return exportState(st, w)
+}
+
+// ImportState reads a dump written by ExportState into the state store,
+// replacing any existing records with the same keys. The bot must not
+// be running, since the store may be locked.
+func ImportState(r io.Reader) error {
+	st, err := openStateStore()
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	count, err := importState(st, r)
+	if err != nil {
+		return err
+	}
+	log.Infof("Imported %d records", count)
+	return nil
+}
+
+// Schema migrations for the state store. Never edit or reorder a migration
+// once it has shipped; add a new one instead.
+func storageMigrations() []store.Migration {
+	return []store.Migration{
+		{
+			Version: 1,
+			Name:    "import legacy JSON state files",
+			Up:      importLegacyStateFiles,
+		},
+	}
+}
+
+// Prior to the state store, each feature rewrote its own JSON file in the
+// config directory. Import whatever those files contain so that existing
+// subscriptions, polls and clocks survive the upgrade.
+func importLegacyStateFiles(st store.Store) error {
+	readLegacy := func(path string, v any) (bool, error) {
+		jsonCfg, err := config.NewJsonConfig(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return true, json.Unmarshal(jsonCfg.Raw, v)
+	}
+
+	compliments := struct {
+		SubsAM map[string]bool `json:"compliment-subscribers-morning"`
+		SubsPM map[string]bool `json:"compliment-subscribers-evening"`
+	}{}
+	if found, err := readLegacy("config/compliment-subscribers.json", &compliments); err != nil {
+		return err
+	} else if found {
+		for id, subbed := range compliments.SubsAM {
+			if err := st.Put(complimentSubsAMBucket, id, subbed); err != nil {
+				return err
+			}
+		}
+		for id, subbed := range compliments.SubsPM {
+			if err := st.Put(complimentSubsPMBucket, id, subbed); err != nil {
+				return err
+			}
+		}
+		log.Infof("Imported %d morning and %d evening compliment subscribers", len(compliments.SubsAM), len(compliments.SubsPM))
+	}
+
+	creepy := struct {
+		Subs map[string]bool `json:"creepy-dm-subscribers"`
+	}{}
+	if found, err := readLegacy(creepyDmSubscribersFilepath, &creepy); err != nil {
+		return err
+	} else if found {
+		for id, subbed := range creepy.Subs {
+			if err := st.Put(creepyDMSubsBucket, id, subbed); err != nil {
+				return err
+			}
+		}
+		log.Infof("Imported %d creepy DM subscribers", len(creepy.Subs))
+	}
+
+	polls := map[string]pollRecord{}
+	if found, err := readLegacy("config/polls.json", &polls); err != nil {
+		return err
+	} else if found {
+		for id, p := range polls {
+			if err := st.Put(pollsBucket, id, p); err != nil {
+				return err
+			}
+		}
+		log.Infof("Imported %d polls", len(polls))
+	}
+
+	clocks := map[string]*serverClock{}
+	if found, err := readLegacy("config/server-clocks.json", &clocks); err != nil {
+		return err
+	} else if found {
+		for guildID, clock := range clocks {
+			if err := st.Put(serverClocksBucket, guildID, clock); err != nil {
+				return err
+			}
+		}
+		log.Infof("Imported %d server clocks", len(clocks))
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package kardbot
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Kardbord/Kard-bot/kardbot/store"
+)
+
+func migratedTestStore(t *testing.T) store.Store {
+	t.Helper()
+	st, err := store.Open(store.Config{Backend: store.BackendJSON, Path: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	if err = store.Migrate(st, storageMigrations()); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func TestExportImportState(t *testing.T) {
+	src := migratedTestStore(t)
+	if err := src.Put(creepyDMSubsBucket, testUser.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Put(serverClocksBucket, testGuildID, serverClock{ChannelID: testChannelID}); err != nil {
+		t.Fatal(err)
+	}
+
+	dump := bytes.Buffer{}
+	if err := exportState(src, &dump); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := migratedTestStore(t)
+	count, err := importState(dst, bytes.NewReader(dump.Bytes()))
+	if err != nil || count != 2 {
+		t.Fatalf("imported %d records: %v", count, err)
+	}
+	subbed, clock := false, serverClock{}
+	if found, err := dst.Get(creepyDMSubsBucket, testUser.ID, &subbed); !found || err != nil || !subbed {
+		t.Errorf("subscription was not imported: %v %v", found, err)
+	}
+	if found, err := dst.Get(serverClocksBucket, testGuildID, &clock); !found || err != nil || clock.ChannelID != testChannelID {
+		t.Errorf("server clock was not imported: %v", err)
+	}
+}
+
+func TestImportStateRejectsBadDumps(t *testing.T) {
+	cases := map[string]string{
+		"schema version": `{"schema-version": 0, "buckets": {"polls": {"1": {}}}}`,
+		"unknown bucket": `{"schema-version": 1, "buckets": {"polls": {"1": {}}, "pols": {"2": {}}}}`,
+		"bad json":       `{"schema-version": 1,`,
+	}
+	for name, dump := range cases {
+		t.Run(name, func(t *testing.T) {
+			st := migratedTestStore(t)
+			if _, err := importState(st, strings.NewReader(dump)); err == nil {
+				t.Fatal("expected an error")
+			}
+			if found, _ := st.Get(pollsBucket, "1", &struct{}{}); found {
+				t.Error("records were imported from a rejected dump")
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type boltStore struct {
+	db *bolt.DB
+}
+
+func openBolt(path string) (*boltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	// Don't hang forever if another instance of the bot holds the file lock.
+	db, err := bolt.Open(path, 0664, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+func (b *boltStore) Get(bucket, key string, v any) (bool, error) {
+	var raw []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(bucket))
+		if bkt == nil {
+			return nil
+		}
+		if val := bkt.Get([]byte(key)); val != nil {
+			// Values are only valid for the life of the transaction.
+			raw = append([]byte{}, val...)
+		}
+		return nil
+	})
+	if err != nil || raw == nil {
+		return false, err
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+func (b *boltStore) Put(bucket, key string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return bkt.Put([]byte(key), raw)
+	})
+}
+
+func (b *boltStore) Delete(bucket, key string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(bucket))
+		if bkt == nil {
+			return nil
+		}
+		return bkt.Delete([]byte(key))
+	})
+}
+
+func (b *boltStore) ForEach(bucket string, fn func(key string, raw json.RawMessage) error) error {
+	// Copy the bucket so fn is free to call back into the store. A write
+	// from inside a read transaction would otherwise deadlock.
+	type entry struct {
+		key string
+		raw json.RawMessage
+	}
+	snapshot := []entry{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(bucket))
+		if bkt == nil {
+			return nil
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			snapshot = append(snapshot, entry{string(k), append(json.RawMessage{}, v...)})
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range snapshot {
+		if err := fn(e.key, e.raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *boltStore) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// jsonStore keeps each bucket in <dir>/<bucket>.json. Buckets are cached
+// in memory and rewritten atomically (write to a temp file, then rename)
+// on every change, so a crash never leaves a half-written file behind.
+type jsonStore struct {
+	dir     string
+	mutex   sync.Mutex
+	buckets map[string]map[string]json.RawMessage
+	closed  bool
+}
+
+func openJSON(dir string) (*jsonStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &jsonStore{
+		dir:     dir,
+		buckets: map[string]map[string]json.RawMessage{},
+	}, nil
+}
+
+func (j *jsonStore) bucketPath(bucket string) string {
+	return filepath.Join(j.dir, bucket+".json")
+}
+
+// Assumes j.mutex is held.
+func (j *jsonStore) loadBucket(bucket string) (map[string]json.RawMessage, error) {
+	if j.closed {
+		return nil, ErrClosed
+	}
+	if bkt, ok := j.buckets[bucket]; ok {
+		return bkt, nil
+	}
+
+	bkt := map[string]json.RawMessage{}
+	raw, err := os.ReadFile(j.bucketPath(bucket))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if len(raw) > 0 {
+		if err = json.Unmarshal(raw, &bkt); err != nil {
+			return nil, err
+		}
+	}
+	j.buckets[bucket] = bkt
+	return bkt, nil
+}
+
+// Assumes j.mutex is held.
+func (j *jsonStore) writeBucket(bucket string, bkt map[string]json.RawMessage) error {
+	fileBytes, err := json.MarshalIndent(bkt, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(j.dir, bucket+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(fileBytes); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), j.bucketPath(bucket))
+}
+
+func (j *jsonStore) Get(bucket, key string, v any) (bool, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	bkt, err := j.loadBucket(bucket)
+	if err != nil {
+		return false, err
+	}
+	raw, ok := bkt[key]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+func (j *jsonStore) Put(bucket, key string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	bkt, err := j.loadBucket(bucket)
+	if err != nil {
+		return err
+	}
+	prev, existed := bkt[key]
+	bkt[key] = raw
+	if err = j.writeBucket(bucket, bkt); err != nil {
+		// Keep the cache consistent with what is on disk.
+		if existed {
+			bkt[key] = prev
+		} else {
+			delete(bkt, key)
+		}
+		return err
+	}
+	return nil
+}
+
+func (j *jsonStore) Delete(bucket, key string) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	bkt, err := j.loadBucket(bucket)
+	if err != nil {
+		return err
+	}
+	prev, existed := bkt[key]
+	if !existed {
+		return nil
+	}
+	delete(bkt, key)
+	if err = j.writeBucket(bucket, bkt); err != nil {
+		bkt[key] = prev
+		return err
+	}
+	return nil
+}
+
+func (j *jsonStore) ForEach(bucket string, fn func(key string, raw json.RawMessage) error) error {
+	// Copy the bucket so fn is free to call back into the store.
+	j.mutex.Lock()
+	bkt, err := j.loadBucket(bucket)
+	if err != nil {
+		j.mutex.Unlock()
+		return err
+	}
+	keys := make([]string, 0, len(bkt))
+	snapshot := make(map[string]json.RawMessage, len(bkt))
+	for k, v := range bkt {
+		keys = append(keys, k)
+		snapshot[k] = v
+	}
+	j.mutex.Unlock()
+
+	// Iterate in a stable order to match the bolt backend.
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := fn(k, snapshot[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *jsonStore) Close() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.closed = true
+	j.buckets = nil
+	return nil
+}
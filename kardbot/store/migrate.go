@@ -0,0 +1,78 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	metaBucket       = "meta"
+	schemaVersionKey = "schema-version"
+)
+
+// Migration is a single, versioned change to the stored data.
+// Versions must be unique and greater than zero.
+type Migration struct {
+	Version uint
+	Name    string
+	Up      func(Store) error
+}
+
+type schemaVersion struct {
+	Version   uint      `json:"version"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"applied-at"`
+}
+
+// SchemaVersion returns the version of the last migration applied to s,
+// or zero if no migrations have been applied.
+func SchemaVersion(s Store) (uint, error) {
+	v := schemaVersion{}
+	if _, err := s.Get(metaBucket, schemaVersionKey, &v); err != nil {
+		return 0, err
+	}
+	return v.Version, nil
+}
+
+// Migrate applies, in order, every migration newer than the current
+// schema version of s. The schema version is recorded after each
+// migration, so a failure part way through resumes at the failed step.
+func Migrate(s Store, migrations []Migration) error {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	for i := range sorted {
+		if sorted[i].Version == 0 {
+			return fmt.Errorf("migration %s has invalid version 0", sorted[i].Name)
+		}
+		if i > 0 && sorted[i].Version == sorted[i-1].Version {
+			return fmt.Errorf("migrations %s and %s share version %d", sorted[i-1].Name, sorted[i].Name, sorted[i].Version)
+		}
+	}
+
+	current, err := SchemaVersion(s)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range sorted {
+		if m.Version <= current {
+			continue
+		}
+		if err := m.Up(s); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		err = s.Put(metaBucket, schemaVersionKey, schemaVersion{
+			Version:   m.Version,
+			Name:      m.Name,
+			AppliedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			return err
+		}
+		current = m.Version
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+// Package store provides a small bucketed key-value store used to persist
+// bot state (subscriptions, polls, server clocks, etc.) across restarts.
+//
+// Values are JSON encoded regardless of backend, so records can be moved
+// between backends without conversion.
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	// BackendBolt persists all buckets in a single embedded bbolt database file.
+	BackendBolt = "bolt"
+	// BackendJSON persists each bucket as a human readable JSON file in a directory.
+	BackendJSON = "json"
+)
+
+// ErrClosed is returned by any operation on a Store that has been closed.
+var ErrClosed = errors.New("store is closed")
+
+// Store is a bucketed key-value store. Every write is durable once the
+// call returns, so callers should write through on each change rather
+// than batching writes until shutdown.
+type Store interface {
+	// Get decodes the value stored at bucket/key into v.
+	// Returns false if no such value exists.
+	Get(bucket, key string, v any) (bool, error)
+
+	// Put encodes v and stores it at bucket/key, replacing any existing value.
+	Put(bucket, key string, v any) error
+
+	// Delete removes bucket/key. Deleting a missing key is not an error.
+	Delete(bucket, key string) error
+
+	// ForEach calls fn for every key in bucket, in key order. Iteration
+	// stops at the first error returned by fn. Iterating a missing bucket
+	// is a no-op. fn sees the bucket as it was when ForEach was called,
+	// and may call back into the store, e.g. to delete the current key.
+	ForEach(bucket string, fn func(key string, raw json.RawMessage) error) error
+
+	// Close flushes and releases any resources held by the store.
+	Close() error
+}
+
+// Config selects and configures a Store backend.
+type Config struct {
+	Backend string `json:"backend"`
+	Path    string `json:"path"`
+}
+
+// Validate reports whether cfg names a known backend and a path,
+// without opening anything.
+func (cfg Config) Validate() error {
+	if cfg.Path == "" {
+		return errors.New("no storage path configured")
+	}
+	switch cfg.Backend {
+	case BackendBolt, BackendJSON:
+		return nil
+	default:
+		return fmt.Errorf(`unknown storage backend "%s"`, cfg.Backend)
+	}
+}
+
+// Open creates a Store for the given configuration.
+func Open(cfg Config) (Store, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.Backend == BackendJSON {
+		return openJSON(cfg.Path)
+	}
+	return openBolt(cfg.Path)
+}
@@ -0,0 +1,177 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+type record struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// forEachBackend runs test against a fresh store of every backend.
+func forEachBackend(t *testing.T, test func(t *testing.T, cfg Config, st Store)) {
+	backends := map[string]string{
+		BackendBolt: "state.db",
+		BackendJSON: "state",
+	}
+	for backend, name := range backends {
+		t.Run(backend, func(t *testing.T) {
+			cfg := Config{Backend: backend, Path: filepath.Join(t.TempDir(), name)}
+			st, err := Open(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { st.Close() })
+			test(t, cfg, st)
+		})
+	}
+}
+
+func TestGetPutDelete(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, cfg Config, st Store) {
+		got := record{}
+		if found, err := st.Get("things", "a", &got); found || err != nil {
+			t.Fatalf("missing key was found: %v, %v", found, err)
+		}
+
+		want := record{Name: "a", Count: 1}
+		if err := st.Put("things", "a", want); err != nil {
+			t.Fatal(err)
+		}
+		if found, err := st.Get("things", "a", &got); !found || err != nil || got != want {
+			t.Fatalf("expected %+v, got %+v, %v, %v", want, got, found, err)
+		}
+
+		want.Count = 2
+		if err := st.Put("things", "a", want); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := st.Get("things", "a", &got); err != nil || got != want {
+			t.Errorf("value was not replaced: %+v, %v", got, err)
+		}
+
+		if err := st.Delete("things", "a"); err != nil {
+			t.Fatal(err)
+		}
+		if found, _ := st.Get("things", "a", &got); found {
+			t.Error("deleted key was found")
+		}
+		if err := st.Delete("things", "a"); err != nil {
+			t.Errorf("deleting a missing key failed: %v", err)
+		}
+		if err := st.Delete("nothing", "a"); err != nil {
+			t.Errorf("deleting from a missing bucket failed: %v", err)
+		}
+	})
+}
+
+func TestWritesAreDurable(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, cfg Config, st Store) {
+		if err := st.Put("things", "a", record{Name: "a"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := st.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		reopened, err := Open(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reopened.Close()
+		got := record{}
+		if found, err := reopened.Get("things", "a", &got); !found || err != nil || got.Name != "a" {
+			t.Errorf("value did not survive a restart: %+v, %v, %v", got, found, err)
+		}
+	})
+}
+
+func TestForEach(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, cfg Config, st Store) {
+		if err := st.ForEach("nothing", func(string, json.RawMessage) error { return errors.New("called") }); err != nil {
+			t.Errorf("iterating a missing bucket failed: %v", err)
+		}
+
+		for _, key := range []string{"c", "a", "b"} {
+			if err := st.Put("things", key, record{Name: key}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		keys := []string{}
+		err := st.ForEach("things", func(key string, raw json.RawMessage) error {
+			rec := record{}
+			if err := json.Unmarshal(raw, &rec); err != nil || rec.Name != key {
+				t.Errorf("%s: unexpected value %s", key, raw)
+			}
+			keys = append(keys, key)
+			// Calling back into the store must not deadlock.
+			return st.Delete("things", key)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(keys, []string{"a", "b", "c"}) {
+			t.Errorf("expected keys in order, got %v", keys)
+		}
+		if found, _ := st.Get("things", "b", &record{}); found {
+			t.Error("key deleted during iteration was found")
+		}
+
+		if err := st.Put("things", "a", record{}); err != nil {
+			t.Fatal(err)
+		}
+		stop := errors.New("stop")
+		if err := st.ForEach("things", func(string, json.RawMessage) error { return stop }); !errors.Is(err, stop) {
+			t.Errorf("expected the error from fn, got %v", err)
+		}
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, cfg Config, st Store) {
+		if v, err := SchemaVersion(st); v != 0 || err != nil {
+			t.Fatalf("expected a new store to be at version 0, got %d, %v", v, err)
+		}
+
+		applied := []uint{}
+		step := func(v uint) Migration {
+			return Migration{Version: v, Name: "step", Up: func(s Store) error {
+				applied = append(applied, v)
+				return s.Put("things", "version", v)
+			}}
+		}
+		if err := Migrate(st, []Migration{step(2), step(1)}); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(applied, []uint{1, 2}) {
+			t.Errorf("expected migrations in version order, got %v", applied)
+		}
+
+		// Applied migrations are skipped, and a failure records progress so far.
+		failing := Migration{Version: 4, Name: "broken", Up: func(Store) error { return errors.New("broken") }}
+		if err := Migrate(st, []Migration{step(1), step(2), step(3), failing}); err == nil {
+			t.Fatal("failed migration was not reported")
+		}
+		if !slices.Equal(applied, []uint{1, 2, 3}) {
+			t.Errorf("expected only migration 3 to run again, got %v", applied)
+		}
+		if v, _ := SchemaVersion(st); v != 3 {
+			t.Errorf("expected version 3 after the failure, got %d", v)
+		}
+
+		for name, migrations := range map[string][]Migration{
+			"zero version":      {step(0)},
+			"duplicate version": {step(5), step(5)},
+		} {
+			if err := Migrate(st, migrations); err == nil {
+				t.Errorf("%s was accepted", name)
+			}
+		}
+	})
+}
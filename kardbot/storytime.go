@@ -1,7 +1,9 @@
 package kardbot
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,7 +13,6 @@ import (
 	"github.com/Kardbord/hfapigo/v3"
 	"github.com/Kardbord/ubiquity/stringutils"
 	"github.com/bwmarrin/discordgo"
-	log "github.com/sirupsen/logrus"
 )
 
 const (
@@ -31,90 +32,142 @@ type storyTimeConfig struct {
 	MaxTime           *float64 `json:"story-time-max-time-s,omitempty"`
 }
 
-var storyTimeCfg func() storyTimeConfig
+var storyTimeCfgs hotConfig[storyTimeConfig]
+
+// Returns a copy of the current story time config.
+func storyTimeCfg() storyTimeConfig { return storyTimeCfgs.Load().clone() }
 
 func init() {
+	registerCommand(&command{
+		name:       storyTimeCmd,
+		definition: storyTimeCmdDefinition,
+		handler:    storyTime,
+		autocomplete: autocompleteOptions(map[string]func(string) []string{
+			storyTimeModelOpt: suggestStoryTimeModels,
+		}),
+	})
+}
+
+func storyTimeCmdDefinition() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        storyTimeCmd,
+		Description: "The bot will tell you a short story (but not a good or sensical one) based on a given prompt.",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        storyTimePromptOpt,
+				Description: "A prompt to generate a story from.",
+				Required:    false,
+			},
+			{
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         storyTimeModelOpt,
+				Description:  "The text generation AI model to use. For example, gpt2 or EleutherAI/gpt-neo-125M.",
+				Required:     false,
+				Autocomplete: true,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+				Name:        storyTimeHelpOpt,
+				Description: "Print a helpful message about how to use this command.",
+				Required:    false,
+			},
+		},
+	}
+}
+
+func parseStoryTimeConfig() (func(), error) {
 	cfg := storyTimeConfig{}
 	jsonCfg, err := config.NewJsonConfig(StoryTimeConfigFile)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	err = json.Unmarshal(jsonCfg.Raw, &cfg)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	if cfg.TextGenModel == "" {
-		log.Fatal("No story time text generation model specified")
+		return nil, errors.New("no story time text generation model specified")
 	}
 
-	err = validateStoryTimeModel(cfg.TextGenModel)
+	err = validateStoryTimeModel(context.Background(), cfg.TextGenModel)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	storyTimeCfg = func() storyTimeConfig {
-		var (
-			topK       *int     = nil
-			topP       *float64 = nil
-			temp       *float64 = nil
-			repPen     *float64 = nil
-			maxNewToks *int     = nil
-			maxTime    *float64 = nil
-		)
-
-		// Make copies of pointer values so that they can't be accidentally modified
-		if cfg.TopK != nil {
-			tmpTopK := *cfg.TopK
-			topK = &tmpTopK
-		}
-		if cfg.TopP != nil {
-			tmpTopP := *cfg.TopP
-			topP = &tmpTopP
-		}
-		if cfg.Temperature != nil {
-			tmpTemp := *cfg.Temperature
-			temp = &tmpTemp
-		}
-		if cfg.RepetitionPenalty != nil {
-			tmpRepPen := *cfg.RepetitionPenalty
-			repPen = &tmpRepPen
-		}
-		if cfg.MaxNewTokens != nil {
-			tmpMaxNewToks := *cfg.MaxNewTokens
-			maxNewToks = &tmpMaxNewToks
-		}
-		if cfg.MaxTime != nil {
-			tmpMaxTime := *cfg.MaxTime
-			maxTime = &tmpMaxTime
-		}
+	return func() { storyTimeCfgs.Store(cfg) }, nil
+}
 
-		return storyTimeConfig{
-			TextGenModel:      cfg.TextGenModel,
-			TopK:              topK,
-			TopP:              topP,
-			Temperature:       temp,
-			RepetitionPenalty: repPen,
-			MaxNewTokens:      maxNewToks,
-			MaxTime:           maxTime,
-		}
+func (cfg storyTimeConfig) clone() storyTimeConfig {
+	var (
+		topK       *int     = nil
+		topP       *float64 = nil
+		temp       *float64 = nil
+		repPen     *float64 = nil
+		maxNewToks *int     = nil
+		maxTime    *float64 = nil
+	)
+
+	// Make copies of pointer values so that they can't be accidentally modified
+	if cfg.TopK != nil {
+		tmpTopK := *cfg.TopK
+		topK = &tmpTopK
+	}
+	if cfg.TopP != nil {
+		tmpTopP := *cfg.TopP
+		topP = &tmpTopP
+	}
+	if cfg.Temperature != nil {
+		tmpTemp := *cfg.Temperature
+		temp = &tmpTemp
+	}
+	if cfg.RepetitionPenalty != nil {
+		tmpRepPen := *cfg.RepetitionPenalty
+		repPen = &tmpRepPen
+	}
+	if cfg.MaxNewTokens != nil {
+		tmpMaxNewToks := *cfg.MaxNewTokens
+		maxNewToks = &tmpMaxNewToks
+	}
+	if cfg.MaxTime != nil {
+		tmpMaxTime := *cfg.MaxTime
+		maxTime = &tmpMaxTime
+	}
+
+	return storyTimeConfig{
+		TextGenModel:      cfg.TextGenModel,
+		TopK:              topK,
+		TopP:              topP,
+		Temperature:       temp,
+		RepetitionPenalty: repPen,
+		MaxNewTokens:      maxNewToks,
+		MaxTime:           maxTime,
 	}
 }
 
+// Models that have passed validateStoryTimeModel, suggested alongside the configured one.
+var recentStoryTimeModels = newRecentValues(maxDiscordOptionChoices)
+
+func suggestStoryTimeModels(typed string) []string {
+	models := append([]string{storyTimeCfg().TextGenModel}, recentStoryTimeModels.list()...)
+	return fuzzyMatch(typed, models, maxDiscordOptionChoices)
+}
+
 const (
 	storyTimePromptOpt = "prompt"
 	storyTimeModelOpt  = "model"
 	storyTimeHelpOpt   = "help"
 )
 
-func storyTime(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func storyTime(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	if isSelf, err := authorIsSelf(s, i); err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	} else if isSelf {
-		log.Trace("Ignoring message from self")
+		logFor(i).Trace("Ignoring message from self")
 		return
 	}
 
@@ -139,17 +192,20 @@ func storyTime(s *discordgo.Session, i *discordgo.InteractionCreate) {
 				},
 			})
 			if err != nil {
-				log.Error(err)
+				logFor(i).Error(err)
 				interactionRespondEphemeralError(s, i, true, err)
 			}
 			return
 		default:
-			log.Warn("Unknown option: ", opt.Name)
+			logFor(i).Warn("Unknown option: ", opt.Name)
 		}
 	}
 
-	err := validateStoryTimeModel(model)
-	if err != nil {
+	err := validateStoryTimeModel(ctx, model)
+	if errors.Is(err, context.DeadlineExceeded) {
+		interactionRespondEphemeralError(s, i, false, err)
+		return
+	} else if err != nil {
 		err2 := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
@@ -158,22 +214,23 @@ func storyTime(s *discordgo.Session, i *discordgo.InteractionCreate) {
 			},
 		})
 		if err2 != nil {
-			log.Error(err)
+			logFor(i).Error(err)
 			interactionRespondEphemeralError(s, i, true, err2)
 		}
 		return
 	}
+	recentStoryTimeModels.add(model)
 
 	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	}
 
-	textResps, err := hfapigo.SendTextGenerationRequest(model, &hfapigo.TextGenerationRequest{
+	textResps, err := textGenerationRequest(ctx, model, &hfapigo.TextGenerationRequest{
 		Input:   input,
 		Options: *hfapigo.NewOptions().SetWaitForModel(true).SetUseCache(false),
 		Parameters: *(&hfapigo.TextGenerationParameters{
@@ -185,13 +242,13 @@ func storyTime(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		}).SetReturnFullText(true),
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 		return
 	}
 	if len(textResps) == 0 || len(textResps[0].GeneratedText) == 0 || textResps[0].GeneratedText == "" {
 		err = fmt.Errorf("received no text generation responses")
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 		return
 	}
@@ -208,13 +265,20 @@ func storyTime(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		},
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionFollowUpEphemeralError(s, i, true, err)
 	}
 }
 
-func validateStoryTimeModel(model string) error {
-	resp, err := http.Get(hfapigo.APIBaseURL + model)
+func validateStoryTimeModel(ctx context.Context, model string) error {
+	if offline {
+		return nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, hfAPIBaseURL+model, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := apiHTTPClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -1,16 +1,17 @@
 package kardbot
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/Kardbord/Kard-bot/kardbot/config"
 	"github.com/Kardbord/Kard-bot/kardbot/dg_helpers"
+	"github.com/Kardbord/Kard-bot/kardbot/store"
 	"github.com/Kardbord/ubiquity/sliceutils"
 	"github.com/bwmarrin/discordgo"
 	log "github.com/sirupsen/logrus"
@@ -39,8 +40,114 @@ const (
 	tzSubCmdServerClock              = "server-clock"
 	tzSubCmdServerClockTZOpt         = "timezones"
 	tzSubCmdServerClockCustomNameOpt = "clock-name"
+
+	// Sub command
+	tzSubCmdMine = "mine"
+	// Shares its name with tzSubCmdInfoTZOpt, and so its autocompletion.
+	tzSubCmdMineTZOpt = tzSubCmdInfoTZOpt
+
+	timeUserMenu = "Show local time"
+
+	// How to refer to tzSubCmdMine in replies.
+	timeMineCmd = timeCmd + " " + timeSubCmdGroupTZ + " " + tzSubCmdMine
 )
 
+// IDs of /time response messages.
+const (
+	msgTimeHelpTitle       = "time.help-title"
+	msgTimeHelp            = "time.help"
+	msgTimeHelpHelp        = "time.help-help"
+	msgTimeHelpInfo        = "time.help-info"
+	msgTimeHelpServerClock = "time.help-server-clock"
+	msgTimeHelpMine        = "time.help-mine"
+	msgTimeLocal           = "time.local"
+	msgTimeInvalidTZ       = "time.invalid-timezone"
+	msgTimeAbbreviation    = "time.abbreviation"
+	msgTimeDST             = "time.dst"
+	msgTimeDSTYes          = "time.dst-yes"
+	msgTimeDSTNo           = "time.dst-no"
+	msgTimeOffset          = "time.offset"
+	msgTimeForgotten       = "time.forgotten"
+	msgTimeShared          = "time.shared"
+	msgTimeNotShared       = "time.not-shared"
+	msgTimeLocalTime       = "time.local-time"
+	msgTimeClockNoPerms    = "time.clock-no-permission"
+	msgTimeClockDisabled   = "time.clock-disabled"
+	msgTimeClockExists     = "time.clock-exists"
+	msgTimeClockInvalidTZs = "time.clock-invalid-timezones"
+	msgTimeClockPersistErr = "time.clock-persist-error"
+	msgTimeClockCreated    = "time.clock-created"
+)
+
+func init() {
+	registerMessages(map[string]string{
+		msgTimeHelpTitle: "Timezones",
+		msgTimeHelp: "This bot supports [Internet Assigned Numbers Authority (IANA)](https://www.iana.org/time-zones) governed timezones. " +
+			"A convenient list of valid timezones can be found on [Wikipedia](https://en.wikipedia.org/wiki/List_of_tz_database_time_zones#List). " +
+			"See the _TZ database name_ or _Time zone abbreviation_ column. Note that inputs are case-sensitive.\n" +
+			"\n*Valid Timezone Input Examples*\n" +
+			"- America/Boise\n" +
+			"- Asia/Hong_Kong\n" +
+			"- Europe/Berlin\n" +
+			"- EET\n" +
+			"- MST\n" +
+			"- MDT\n" +
+			"\nSubcommands and their usage are documented below.\n",
+		msgTimeHelpHelp: "Prints this help message. Response is optionally ephemeral.",
+		msgTimeHelpInfo: "Provides general information about a given timezone. " +
+			"Requires an [IANA timezone database name or abbreviation](https://en.wikipedia.org/wiki/List_of_tz_database_time_zones#List) as input. " +
+			"Optionally takes a date format in which the provided timezone should be displayed. " +
+			"Response is optionally ephemeral.",
+		msgTimeHelpServerClock: "Creates a server clock channel that displays the current date and time for specified timezones. " +
+			"Also creates an averaged \"Server Time\".",
+		msgTimeHelpMine: "Shares your timezone, so that others can see your local time by right-clicking you and picking Apps → %s. " +
+			"Run it without a timezone to have the bot forget yours.",
+		msgTimeLocal:           "For privacy reasons, this bot only knows the timezones users choose to share with `/%s`. Please specify a specific IANA timezone rather than \"%s\".",
+		msgTimeInvalidTZ:       `"%s" is not a valid [IANA Timezone](https://en.wikipedia.org/wiki/List_of_tz_database_time_zones).`,
+		msgTimeAbbreviation:    "Abbreviation",
+		msgTimeDST:             "Daylight Savings Time in Effect?",
+		msgTimeDSTYes:          "true",
+		msgTimeDSTNo:           "false",
+		msgTimeOffset:          "UTC/GMT Offset (hh:mm)",
+		msgTimeForgotten:       "Your timezone has been forgotten.",
+		msgTimeShared:          "Your timezone is now %s. Others can see your local time with Apps → %s.",
+		msgTimeNotShared:       "%s hasn't shared their timezone. They can share it with `/%s`.",
+		msgTimeLocalTime:       "It's %s for %s.",
+		msgTimeClockNoPerms:    "You must run this command from a server where you have the Manage Channels permission.",
+		msgTimeClockDisabled:   "Server clocks have been disabled in this server. A server admin can enable them with `/%s`.",
+		msgTimeClockExists:     "This server already has a clock. To replace it, delete the <#%s> channel and re-issue this command.",
+		msgTimeClockInvalidTZs: "The following time zones are not valid: `%v`",
+		msgTimeClockPersistErr: "There was an error persisting your server clock. Please delete the %s channel if it was created, and reissue the command.",
+		msgTimeClockCreated:    "Your server clock has been created! Check it out at %s. You may want to pin the clock message in that channel, or make it read-only.",
+	})
+	registerCommand(&command{
+		name:       timeCmd,
+		definition: timeCmdDefinition,
+		handler:    handleTimeCmd,
+		autocomplete: autocompleteOptions(map[string]func(string) []string{
+			tzSubCmdInfoTZOpt:        suggestTimezones,
+			tzSubCmdServerClockTZOpt: completeLastField(suggestTimezones),
+		}),
+		contextMenus: []contextMenu{
+			{name: timeUserMenu, target: discordgo.UserApplicationCommand, handler: showLocalTime},
+		},
+	})
+}
+
+//go:generate go run gen_timezones.go
+
+func suggestTimezones(typed string) []string {
+	return fuzzyMatch(typed, ianaTimezones, maxDiscordOptionChoices)
+}
+
+func timeCmdDefinition() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        timeCmd,
+		Description: "Time related commands",
+		Options:     timeCmdOpts(),
+	}
+}
+
 func tzFormatOpts() []*discordgo.ApplicationCommandOptionChoice {
 	return []*discordgo.ApplicationCommandOptionChoice{
 		{
@@ -139,10 +246,11 @@ func timeCmdOpts() []*discordgo.ApplicationCommandOption {
 					Description: "Get information about a given timezone",
 					Options: []*discordgo.ApplicationCommandOption{
 						{
-							Type:        discordgo.ApplicationCommandOptionString,
-							Name:        tzSubCmdInfoTZOpt,
-							Description: "The IANA timezone to get information for.",
-							Required:    true,
+							Type:         discordgo.ApplicationCommandOptionString,
+							Name:         tzSubCmdInfoTZOpt,
+							Description:  "The IANA timezone to get information for.",
+							Required:     true,
+							Autocomplete: true,
 						},
 						{
 							Type:        discordgo.ApplicationCommandOptionString,
@@ -163,10 +271,11 @@ func timeCmdOpts() []*discordgo.ApplicationCommandOption {
 					Description: "As an admin, create a custom clock for your server.",
 					Options: []*discordgo.ApplicationCommandOption{
 						{
-							Type:        discordgo.ApplicationCommandOptionString,
-							Name:        tzSubCmdServerClockTZOpt,
-							Description: "Space-separated list of IANA timezones to use in creating the server clock.",
-							Required:    true,
+							Type:         discordgo.ApplicationCommandOptionString,
+							Name:         tzSubCmdServerClockTZOpt,
+							Description:  "Space-separated list of IANA timezones to use in creating the server clock.",
+							Required:     true,
+							Autocomplete: true,
 						},
 						{
 							Type:        discordgo.ApplicationCommandOptionString,
@@ -182,16 +291,29 @@ func timeCmdOpts() []*discordgo.ApplicationCommandOption {
 						},
 					},
 				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        tzSubCmdMine,
+					Description: "Share your timezone so others can see your local time. Omit the timezone to forget it.",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:         discordgo.ApplicationCommandOptionString,
+							Name:         tzSubCmdMineTZOpt,
+							Description:  "Your IANA timezone, such as America/Denver",
+							Autocomplete: true,
+						},
+					},
+				},
 			},
 		},
 	}
 }
 
-func handleTimeCmd(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func handleTimeCmd(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	if s == nil || i == nil {
 		err := fmt.Errorf("nil Session pointer (%v) and/or InteractionCreate pointer (%v)", s, i)
 		interactionRespondEphemeralError(s, i, true, err)
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
 
@@ -215,19 +337,19 @@ func handleTimeCmd(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	}
 	if resp == nil {
 		interactionRespondEphemeralError(s, i, true, fmt.Errorf("nil response returned"))
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
 
 	err = s.InteractionRespond(i.Interaction, resp)
 	if err != nil {
 		interactionRespondEphemeralError(s, i, true, err)
-		log.Error(err)
+		logFor(i).Error(err)
 		return
 	}
 }
 
-func handleTZSubCmd(s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, bool, error) {
+func handleTZSubCmd(s discordSession, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, bool, error) {
 	subCmdName := i.ApplicationCommandData().Options[0].Options[0].Name
 	switch subCmdName {
 	case tzSubCmdHelp:
@@ -236,12 +358,14 @@ func handleTZSubCmd(s *discordgo.Session, i *discordgo.InteractionCreate) (*disc
 		return handleTZSubCmdInfo(s, i)
 	case tzSubCmdServerClock:
 		return handleTZSubCmdServerClock(s, i)
+	case tzSubCmdMine:
+		return handleTZSubCmdMine(s, i)
 	default:
 		return nil, true, fmt.Errorf("unknown %s sub command: %s", timeSubCmdGroupTZ, subCmdName)
 	}
 }
 
-func handleTZSubCmdHelp(s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, bool, error) {
+func handleTZSubCmdHelp(s discordSession, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, bool, error) {
 	flags := discordgo.MessageFlagsEphemeral
 	for _, opt := range i.ApplicationCommandData().Options[0].Options[0].Options {
 		switch opt.Name {
@@ -250,33 +374,20 @@ func handleTZSubCmdHelp(s *discordgo.Session, i *discordgo.InteractionCreate) (*
 				flags = 0
 			}
 		default:
-			log.Warn("Unknown option: ", opt.Name)
+			logFor(i).Warn("Unknown option: ", opt.Name)
 		}
 	}
 
 	c, _ := fastHappyColorInt64()
 	e := dg_helpers.NewEmbed()
-	e.SetTitle("Timezones").
+	e.SetTitle(localized(i, msgTimeHelpTitle)).
 		SetURL("https://en.wikipedia.org/wiki/List_of_tz_database_time_zones").
 		SetColor(int(c)).
-		SetDescription("This bot supports [Internet Assigned Numbers Authority (IANA)](https://www.iana.org/time-zones) governed timezones. "+
-			"A convenient list of valid timezones can be found on [Wikipedia](https://en.wikipedia.org/wiki/List_of_tz_database_time_zones#List). "+
-			"See the _TZ database name_ or _Time zone abbreviation_ column. Note that inputs are case-sensitive.\n"+
-			"\n*Valid Timezone Input Examples*\n"+
-			"- America/Boise\n"+
-			"- Asia/Hong_Kong\n"+
-			"- Europe/Berlin\n"+
-			"- EET\n"+
-			"- MST\n"+
-			"- MDT\n"+
-			"\nSubcommands and their usage are documented below.\n").
-		AddField(tzSubCmdHelp, "Prints this help message. Response is optionally ephemeral.").
-		AddField(tzSubCmdInfo, "Provides general information about a given timezone. "+
-			"Requires an [IANA timezone database name or abbreviation](https://en.wikipedia.org/wiki/List_of_tz_database_time_zones#List) as input. "+
-			"Optionally takes a date format in which the provided timezone should be displayed. "+
-			"Response is optionally ephemeral.").
-		AddField(tzSubCmdServerClock, "Creates a server clock channel that displays the current date and time for specified timezones. "+
-			"Also creates an averaged \"Server Time\".")
+		SetDescription(localized(i, msgTimeHelp)).
+		AddField(tzSubCmdHelp, localized(i, msgTimeHelpHelp)).
+		AddField(tzSubCmdInfo, localized(i, msgTimeHelpInfo)).
+		AddField(tzSubCmdServerClock, localized(i, msgTimeHelpServerClock)).
+		AddField(tzSubCmdMine, localized(i, msgTimeHelpMine, timeUserMenu))
 
 	return &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
@@ -287,7 +398,7 @@ func handleTZSubCmdHelp(s *discordgo.Session, i *discordgo.InteractionCreate) (*
 	}, false, nil
 }
 
-func handleTZSubCmdInfo(s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, bool, error) {
+func handleTZSubCmdInfo(s discordSession, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, bool, error) {
 	flags := discordgo.MessageFlagsEphemeral
 	tz := ""
 	format := tzSubCmdFmtDflt
@@ -302,7 +413,7 @@ func handleTZSubCmdInfo(s *discordgo.Session, i *discordgo.InteractionCreate) (*
 		case tzSubCmdFmtOpt:
 			format = opt.StringValue()
 		default:
-			log.Warn("Unknown option: ", opt.Name)
+			logFor(i).Warn("Unknown option: ", opt.Name)
 		}
 	}
 
@@ -312,7 +423,7 @@ func handleTZSubCmdInfo(s *discordgo.Session, i *discordgo.InteractionCreate) (*
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
 				Flags:   discordgo.MessageFlagsEphemeral,
-				Content: fmt.Sprintf(`For privacy reasons, this bot does not track user timezones. Please specify a specific IANA timezone rather than "%s".`, tz),
+				Content: localized(i, msgTimeLocal, timeMineCmd, tz),
 			},
 		}, false, nil
 	}
@@ -323,7 +434,7 @@ func handleTZSubCmdInfo(s *discordgo.Session, i *discordgo.InteractionCreate) (*
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
 				Flags:   discordgo.MessageFlagsEphemeral,
-				Content: fmt.Sprintf(`"%s" is not a valid [IANA Timezone](https://en.wikipedia.org/wiki/List_of_tz_database_time_zones).`, tz),
+				Content: localized(i, msgTimeInvalidTZ, tz),
 			},
 		}, false, nil
 	}
@@ -332,12 +443,16 @@ func handleTZSubCmdInfo(s *discordgo.Session, i *discordgo.InteractionCreate) (*
 	e := dg_helpers.NewEmbed()
 	t := time.Now().In(loc)
 	abbrev, offset := t.Zone()
+	dst := msgTimeDSTNo
+	if t.IsDST() {
+		dst = msgTimeDSTYes
+	}
 	e.SetTitle(loc.String()).
 		SetDescription(t.Format(format)).
 		SetColor(int(c)).
-		AddField("Abbreviation", abbrev).
-		AddField("Daylight Savings Time in Effect?", fmt.Sprintf("%t", t.IsDST())).
-		AddField("UTC/GMT Offset (hh:mm)", fmt.Sprintf(`%+03d:%02d`, offset/3600, func() int {
+		AddField(localized(i, msgTimeAbbreviation), abbrev).
+		AddField(localized(i, msgTimeDST), localized(i, dst)).
+		AddField(localized(i, msgTimeOffset), fmt.Sprintf(`%+03d:%02d`, offset/3600, func() int {
 			seconds := (offset % 3600) / 60
 			if seconds < 0 {
 				return seconds * -1
@@ -354,6 +469,118 @@ func handleTZSubCmdInfo(s *discordgo.Session, i *discordgo.InteractionCreate) (*
 	}, false, nil
 }
 
+var (
+	// Timezones users have shared with tzSubCmdMine.
+	// Key: user ID
+	// Val: IANA timezone
+	userTimezones      = map[string]string{}
+	userTimezonesMutex sync.RWMutex
+)
+
+func loadUserTimezones(st store.Store) error {
+	userTimezonesMutex.Lock()
+	defer userTimezonesMutex.Unlock()
+
+	userTimezones = map[string]string{}
+	return st.ForEach(userTimezonesBucket, func(userID string, raw json.RawMessage) error {
+		tz := ""
+		if err := json.Unmarshal(raw, &tz); err != nil {
+			return err
+		}
+		userTimezones[userID] = tz
+		return nil
+	})
+}
+
+func userTimezone(userID string) (string, bool) {
+	userTimezonesMutex.RLock()
+	defer userTimezonesMutex.RUnlock()
+	tz, ok := userTimezones[userID]
+	return tz, ok
+}
+
+func handleTZSubCmdMine(s discordSession, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, bool, error) {
+	mdata, err := getInteractionMetaData(i)
+	if err != nil {
+		logFor(i).Error(err)
+		return nil, true, err
+	}
+
+	tz := ""
+	for _, opt := range i.ApplicationCommandData().Options[0].Options[0].Options {
+		if opt.Name == tzSubCmdMineTZOpt {
+			tz = strings.TrimSpace(opt.StringValue())
+		}
+	}
+	if tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil || strings.ToLower(tz) == "local" {
+			return nil, false, errors.New(localized(i, msgTimeInvalidTZ, tz))
+		}
+	}
+
+	userTimezonesMutex.Lock()
+	defer userTimezonesMutex.Unlock()
+	content := ""
+	if tz == "" {
+		err = stateStore().Delete(userTimezonesBucket, mdata.AuthorID)
+		if err == nil {
+			delete(userTimezones, mdata.AuthorID)
+			content = localized(i, msgTimeForgotten)
+		}
+	} else {
+		err = stateStore().Put(userTimezonesBucket, mdata.AuthorID, tz)
+		if err == nil {
+			userTimezones[mdata.AuthorID] = tz
+			content = localized(i, msgTimeShared, tz, timeUserMenu)
+		}
+	}
+	if err != nil {
+		logFor(i).Error(err)
+		return nil, true, err
+	}
+
+	return &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags:   discordgo.MessageFlagsEphemeral,
+			Content: content,
+		},
+	}, false, nil
+}
+
+// showLocalTime tells the invoking user the current time where the user
+// a context menu was used on is, if they have shared their timezone.
+func showLocalTime(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
+	target, err := targetUser(i)
+	if err != nil {
+		logFor(i).Error(err)
+		interactionRespondEphemeralError(s, i, true, err)
+		return
+	}
+
+	content := localized(i, msgTimeNotShared, target.Username, timeMineCmd)
+	if tz, ok := userTimezone(target.ID); ok {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			logFor(i).Error(err)
+			interactionRespondEphemeralError(s, i, true, err)
+			return
+		}
+		content = localized(i, msgTimeLocalTime, time.Now().In(loc).Format(tzSubCmdFmtDflt), target.Username)
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags:   discordgo.MessageFlagsEphemeral,
+			Content: content,
+		},
+	})
+	if err != nil {
+		logFor(i).Error(err)
+	}
+}
+
 type serverClock struct {
 	// Guild owning the server clock.
 	// Required.
@@ -387,64 +614,56 @@ type serverClock struct {
 	mutex sync.RWMutex
 }
 
-const serverClockConfigFilepath = "config/server-clocks.json"
-
-var serverClockConfigFilepathMutex sync.RWMutex
-
 var (
 	// Map of Guild IDs to serverClock objects
 	serverClocksMap      map[string]*serverClock
 	serverClocksMapMutex sync.RWMutex
 )
 
-func init() {
-	serverClockConfigFilepathMutex.RLock()
-	defer serverClockConfigFilepathMutex.RUnlock()
+func loadServerClocks(st store.Store) error {
 	serverClocksMapMutex.Lock()
 	defer serverClocksMapMutex.Unlock()
 
-	jsonCfg, err := config.NewJsonConfig(serverClockConfigFilepath)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	err = json.Unmarshal(jsonCfg.Raw, &serverClocksMap)
-	if err != nil {
-		log.Fatal(err)
-	}
+	serverClocksMap = map[string]*serverClock{}
+	return st.ForEach(serverClocksBucket, func(guildID string, raw json.RawMessage) error {
+		clock := &serverClock{}
+		if err := json.Unmarshal(raw, clock); err != nil {
+			return err
+		}
+		serverClocksMap[guildID] = clock
+		return nil
+	})
 }
 
-func writeServerClocksToDisk() error {
-	serverClockConfigFilepathMutex.Lock()
-	defer serverClockConfigFilepathMutex.Unlock()
-	serverClocksMapMutex.RLock()
-	defer serverClocksMapMutex.RUnlock()
-	for _, clock := range serverClocksMap {
-		clock.mutex.RLock()
-		defer clock.mutex.RUnlock()
-	}
-
-	fileBytes, err := json.MarshalIndent(serverClocksMap, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	return ioutil.WriteFile(serverClockConfigFilepath, fileBytes, 0664)
+// Write the clock to the state store.
+// Assumes the caller holds at least a read lock on clock.mutex.
+func (clock *serverClock) persist() error {
+	return stateStore().Put(serverClocksBucket, clock.GuildID, clock)
 }
 
-func handleTZSubCmdServerClock(s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, bool, error) {
+func handleTZSubCmdServerClock(s discordSession, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, bool, error) {
 	mdata, err := getInteractionMetaData(i)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		return nil, true, err
 	}
 
-	if !hasPermissions(mdata.AuthorPermissions, discordgo.PermissionManageChannels) {
+	if !hasGuildPrivilege(mdata, discordgo.PermissionManageChannels) {
+		return &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Flags:   discordgo.MessageFlagsEphemeral,
+				Content: localized(i, msgTimeClockNoPerms),
+			},
+		}, false, nil
+	}
+
+	if !featureEnabled(mdata.GuildID, featureServerClock) {
 		return &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
 				Flags:   discordgo.MessageFlagsEphemeral,
-				Content: "You must run this command from a server where you have the Manage Channels permission.",
+				Content: localized(i, msgTimeClockDisabled, settingsCmd+" "+settingsSubCmdFeature),
 			},
 		}, false, nil
 	}
@@ -460,7 +679,7 @@ func handleTZSubCmdServerClock(s *discordgo.Session, i *discordgo.InteractionCre
 				Type: discordgo.InteractionResponseChannelMessageWithSource,
 				Data: &discordgo.InteractionResponseData{
 					Flags:   discordgo.MessageFlagsEphemeral,
-					Content: fmt.Sprintf("This server already has a clock. To replace it, delete the <#%s> channel and re-issue this command.", clock.ChannelID),
+					Content: localized(i, msgTimeClockExists, clock.ChannelID),
 				},
 			}, false, nil
 		}
@@ -477,7 +696,7 @@ func handleTZSubCmdServerClock(s *discordgo.Session, i *discordgo.InteractionCre
 		case tzSubCmdServerClockCustomNameOpt:
 			clockname = opt.StringValue()
 		default:
-			log.Warn("Unknown option: ", opt.Name)
+			logFor(i).Warn("Unknown option: ", opt.Name)
 		}
 	}
 
@@ -492,25 +711,25 @@ func handleTZSubCmdServerClock(s *discordgo.Session, i *discordgo.InteractionCre
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
 				Flags:   discordgo.MessageFlagsEphemeral,
-				Content: fmt.Sprintf("The following time zones are not valid: `%v`", invalidTZs),
+				Content: localized(i, msgTimeClockInvalidTZs, invalidTZs),
 			},
 		}, false, nil
 	}
 
 	g, err := s.Guild(mdata.GuildID)
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		return nil, true, err
 	}
 
 	tzChan, err := s.GuildChannelCreateComplex(g.ID, discordgo.GuildChannelCreateData{
 		Name:                 clockname,
 		Type:                 discordgo.ChannelTypeGuildText,
-		Topic:                fmt.Sprintf("Server clock provided by %s.", s.State.User.Mention()),
+		Topic:                fmt.Sprintf("Server clock provided by %s.", s.SelfUser().Mention()),
 		PermissionOverwrites: []*discordgo.PermissionOverwrite{}, // TODO: restrict channel so it is read-only?
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		return nil, true, err
 	}
 
@@ -527,12 +746,16 @@ func handleTZSubCmdServerClock(s *discordgo.Session, i *discordgo.InteractionCre
 	serverClocksMapMutex.Unlock()
 	newClock.update()
 
-	if err := writeServerClocksToDisk(); err != nil {
+	newClock.mutex.RLock()
+	err = newClock.persist()
+	newClock.mutex.RUnlock()
+	if err != nil {
+		logFor(i).Error(err)
 		return &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
 				Flags:   discordgo.MessageFlagsEphemeral,
-				Content: fmt.Sprintf("There was an error persisting your server clock. Please delete the %s channel if it was created, and reissue the command.", tzChan.Name),
+				Content: localized(i, msgTimeClockPersistErr, tzChan.Name),
 			},
 		}, false, nil
 	}
@@ -541,7 +764,7 @@ func handleTZSubCmdServerClock(s *discordgo.Session, i *discordgo.InteractionCre
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
 			Flags:   discordgo.MessageFlagsEphemeral,
-			Content: fmt.Sprintf("Your server clock has been created! Check it out at %s. You may want to pin the clock message in that channel, or make it read-only.", tzChan.Mention()),
+			Content: localized(i, msgTimeClockCreated, tzChan.Mention()),
 		},
 	}, false, nil
 }
@@ -585,15 +808,16 @@ func (clock *serverClock) update() {
 	var err error
 	if clock.MessageID != "" {
 		log.Trace("Creating new server clock message")
-		_, err = bot().Session.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		// Setting the clock to the same time twice does no harm.
+		_, err = bot().api.ChannelMessageEditComplex(&discordgo.MessageEdit{
 			Embeds:  []*discordgo.MessageEmbed{e.Truncate().MessageEmbed},
 			ID:      clock.MessageID,
 			Channel: clock.ChannelID,
-		})
+		}, discordgo.WithContext(withRetry(context.Background())))
 	} else {
 		log.Trace("Updating existing server clock message")
 		var m *discordgo.Message = nil
-		m, err = bot().Session.ChannelMessageSendComplex(clock.ChannelID, &discordgo.MessageSend{
+		m, err = bot().api.ChannelMessageSendComplex(clock.ChannelID, &discordgo.MessageSend{
 			Embeds: []*discordgo.MessageEmbed{e.Truncate().MessageEmbed},
 		})
 		if err == nil {
@@ -602,15 +826,25 @@ func (clock *serverClock) update() {
 			clock.MessageID = m.ID
 			clock.mutex.Unlock()
 			clock.mutex.RLock()
+			if err := clock.persist(); err != nil {
+				log.Error(err)
+			}
 		}
 	}
 
 	if err != nil {
 		log.Error(err)
 		atomic.AddUint32(&clock.ErrCount, 1)
+		if err := clock.persist(); err != nil {
+			log.Error(err)
+		}
 		return
 	}
-	atomic.StoreUint32(&clock.ErrCount, 0)
+	if atomic.SwapUint32(&clock.ErrCount, 0) != 0 {
+		if err := clock.persist(); err != nil {
+			log.Error(err)
+		}
+	}
 	log.Trace("Done with clock update.")
 }
 
@@ -623,22 +857,41 @@ func updateServerClocks() {
 	log.Trace("Starting clock updates")
 	for _, clock := range serverClocksMap {
 		wg.Add(1)
-		go func(c *serverClock) {
-			if atomic.LoadUint32(&c.ErrCount) < bot().ServerClockFailureThreshold {
+		c := clock
+		goSafelyWith("server-clock", log.Fields{"guild-id": c.GuildID}, func() {
+			defer wg.Done()
+			c.mutex.RLock()
+			gs := settingsFor(c.GuildID)
+			c.mutex.RUnlock()
+			if !gs.featureEnabled(featureServerClock) {
+				return
+			}
+
+			threshold := gs.serverClockFailureThreshold()
+			if atomic.LoadUint32(&c.ErrCount) < threshold {
 				c.update()
-			} else if atomic.LoadUint32(&c.ErrCount) == bot().ServerClockFailureThreshold {
+			} else if atomic.LoadUint32(&c.ErrCount) == threshold {
 				c.mutex.RLock()
 				log.Warnf("Won't update defunct server clock for %s, it has failed to update %d times previously.", c.GuildName, c.ErrCount)
-				bot().Session.ChannelMessageSend(c.ChannelID, fmt.Sprintf(
+				raiseAlert(alert{
+					Severity: severityWarning,
+					Title:    "Server clock defunct",
+					Message:  fmt.Sprintf("The server clock in %s (%s) has failed to update %d times in a row and will no longer be updated.", c.GuildName, c.GuildID, c.ErrCount),
+				})
+				bot().api.ChannelMessageSend(c.ChannelID, fmt.Sprintf(
 					"This clock has failed to update %d consecutive times, and is now considered defunct. Ensure that Kard-bot has appropriate permissions, then delete this channel and reissue the `/%s %s %s` command.",
 					c.ErrCount, timeCmd, timeSubCmdGroupTZ, tzSubCmdServerClock,
 				))
 				c.mutex.RUnlock()
 				// Only report defunct once.
 				atomic.AddUint32(&c.ErrCount, 1)
+				c.mutex.RLock()
+				if err := c.persist(); err != nil {
+					log.Error(err)
+				}
+				c.mutex.RUnlock()
 			}
-			wg.Done()
-		}(clock)
+		})
 	}
 	log.Trace("Waiting for clock updates to complete.")
 	wg.Wait()
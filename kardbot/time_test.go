@@ -0,0 +1,56 @@
+package kardbot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Kardbord/Kard-bot/kardbot/fakediscord"
+	"github.com/bwmarrin/discordgo"
+)
+
+func shareTimezone(t *testing.T, fake *fakediscord.Session, tz string) *fakediscord.Response {
+	t.Helper()
+	opts := []*discordgo.ApplicationCommandInteractionDataOption{}
+	if tz != "" {
+		opts = append(opts, fakediscord.StringOpt(tzSubCmdMineTZOpt, tz))
+	}
+	i := fake.Command(timeCmd, []*discordgo.ApplicationCommandInteractionDataOption{
+		fakediscord.SubCommandGroup(timeSubCmdGroupTZ, fakediscord.SubCommand(tzSubCmdMine, opts...)),
+	}, inTestGuild()...)
+	bot().routeInteraction(fake, i)
+	return mustRespond(t, fake, i)
+}
+
+func TestShowLocalTime(t *testing.T) {
+	fake := newTestBot(t)
+	showTime := func() string {
+		i := fake.UserCommand(timeUserMenu, testUser, inTestGuild()...)
+		bot().routeInteraction(fake, i)
+		resp := mustRespond(t, fake, i)
+		if !isEphemeral(resp) {
+			t.Errorf("local time should be shown ephemerally")
+		}
+		return resp.Initial.Data.Content
+	}
+
+	if got := showTime(); !strings.Contains(got, "hasn't shared") {
+		t.Errorf("expected no timezone to be known, got %q", got)
+	}
+
+	if resp := shareTimezone(t, fake, "Not/AZone"); !strings.Contains(resp.Initial.Data.Content, "not a valid") {
+		t.Errorf("an invalid timezone was accepted: %+v", resp.Initial.Data)
+	}
+	shareTimezone(t, fake, "Asia/Tokyo")
+	tz := ""
+	if found, err := stateStore().Get(userTimezonesBucket, testUser.ID, &tz); err != nil || !found || tz != "Asia/Tokyo" {
+		t.Errorf("the timezone was not persisted; found=%v, tz=%q, err=%v", found, tz, err)
+	}
+	if got := showTime(); !strings.Contains(got, "JST") {
+		t.Errorf("expected the time in Tokyo, got %q", got)
+	}
+
+	shareTimezone(t, fake, "")
+	if got := showTime(); !strings.Contains(got, "hasn't shared") {
+		t.Errorf("the timezone was not forgotten, got %q", got)
+	}
+}
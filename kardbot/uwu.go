@@ -1,15 +1,19 @@
 package kardbot
 
 import (
+	"context"
+	"errors"
+	"strings"
+
 	"github.com/bwmarrin/discordgo"
 
 	"github.com/Kardbord/ubiquity/stringutils"
 	owoify_go "github.com/deadshot465/owoify-go"
-	log "github.com/sirupsen/logrus"
 )
 
 const (
 	uwuCmd          = "uwu"
+	uwuMessageMenu  = "UwU-ify"
 	uwuSubCmdCustom = "custom"
 	uwuSubCmdPasta  = pastaCmd
 
@@ -20,6 +24,90 @@ const (
 
 var uwuChoices func() []*discordgo.ApplicationCommandOptionChoice
 
+// IDs of /uwu response messages.
+const (
+	msgUwUNoText = "uwu.no-text"
+)
+
+func init() {
+	registerMessages(map[string]string{
+		msgUwUNoText: "that message has no text to UwU-ify",
+	})
+	registerCommand(&command{
+		name:       uwuCmd,
+		definition: uwuCmdDefinition,
+		handler:    uwuify,
+		autocomplete: autocompleteOptions(map[string]func(string) []string{
+			uwuSubCmdPasta: suggestPastas,
+		}),
+		contextMenus: []contextMenu{
+			{name: uwuMessageMenu, target: discordgo.MessageApplicationCommand, handler: uwuifyMessage},
+		},
+	})
+}
+
+func uwuCmdDefinition() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        uwuCmd,
+		Description: "UwU-ifies messages, because why wouldn't it?",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "custom",
+				Description: "UwU-ify your own custom message!",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "uwulevel",
+						Description: "How badly should your message be uwu-ed?",
+						Required:    true,
+						Choices:     uwuChoices(),
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "message",
+						Description: "Your message, soon to be uwuified!",
+						Required:    true,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionBoolean,
+						Name:        "tts",
+						Description: "Read the uwuified copy-pasta aloud to everyone viewing the channel using text-to-speech",
+						Required:    false,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        uwuSubCmdPasta,
+				Description: "UwU-ify a copy-pasta!",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "uwulevel",
+						Description: "How badly should your message be uwu-ed?",
+						Required:    true,
+						Choices:     uwuChoices(),
+					},
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         uwuSubCmdPasta,
+						Description:  "A pasta, but served with a healthy topping of UwU!",
+						Required:     true,
+						Autocomplete: true,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionBoolean,
+						Name:        "tts",
+						Description: "Read the uwuified copy-pasta aloud to everyone viewing the channel using text-to-speech",
+						Required:    false,
+					},
+				},
+			},
+		},
+	}
+}
+
 func init() {
 	uwulevels := []string{
 		owoLevel,
@@ -46,13 +134,13 @@ func init() {
 	}
 }
 
-func uwuify(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func uwuify(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	if isSelf, err := authorIsSelf(s, i); err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 		return
 	} else if isSelf {
-		log.Trace("Ignoring message from self")
+		logFor(i).Trace("Ignoring message from self")
 		return
 	}
 
@@ -62,19 +150,18 @@ func uwuify(s *discordgo.Session, i *discordgo.InteractionCreate) {
 			var err error
 			content, err = p.makePasta()
 			if err != nil {
-				log.Error(err)
+				logFor(i).Error(err)
 				interactionRespondEphemeralError(s, i, true, err)
 				return
 			}
+		} else {
+			logFor(i).Debugf("Unknown pasta: %s", content)
+			interactionRespondEphemeralError(s, i, false, errors.New(localized(i, msgPastaUnknown, content)))
+			return
 		}
 	}
 
 	uwulvl := i.ApplicationCommandData().Options[0].Options[0].StringValue()
-	content = owoify_go.Owoify(content, uwulvl)
-
-	if len(content) > int(MaxDiscordMsgLen) {
-		content = stringutils.FirstN(content, MaxDiscordMsgLen-3) + "..."
-	}
 
 	tts := false
 	if len(i.ApplicationCommandData().Options[0].Options) > 2 {
@@ -83,6 +170,30 @@ func uwuify(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		}
 	}
 
+	respondUwU(s, i, content, uwulvl, tts)
+}
+
+// uwuifyMessage UwU-ifies the message a context menu was used on.
+func uwuifyMessage(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
+	msg, err := targetMessage(i)
+	if err != nil {
+		logFor(i).Error(err)
+		interactionRespondEphemeralError(s, i, true, err)
+		return
+	}
+	if strings.TrimSpace(msg.Content) == "" {
+		interactionRespondEphemeralError(s, i, false, errors.New(localized(i, msgUwUNoText)))
+		return
+	}
+	respondUwU(s, i, msg.Content, uwuLevel, false)
+}
+
+func respondUwU(s discordSession, i *discordgo.InteractionCreate, content, uwulvl string, tts bool) {
+	content = owoify_go.Owoify(content, uwulvl)
+	if len(content) > int(MaxDiscordMsgLen) {
+		content = stringutils.FirstN(content, MaxDiscordMsgLen-3) + "..."
+	}
+
 	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
@@ -91,7 +202,7 @@ func uwuify(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		},
 	})
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 	}
 }
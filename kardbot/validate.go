@@ -0,0 +1,415 @@
+package kardbot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Kardbord/Kard-bot/kardbot/config"
+	"github.com/Kardbord/imgflipgo/v2"
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// Limits on application commands not already covered by the
+// maxDiscord* constants.
+// See https://discord.com/developers/docs/interactions/application-commands#application-command-object
+const (
+	maxDiscordCommandDescription = 100
+	maxDiscordChoiceName         = 100
+	maxDiscordChoiceStringValue  = 100
+	maxDiscordOptionLength       = 6000
+	// Combined length of every name, description, and value in a command.
+	maxDiscordCommandChars   = 8000
+	maxDiscordGlobalCommands = 100
+	maxDiscordContextMenus   = 5
+)
+
+// commandViolation is a way in which a command definition breaks one of
+// Discord's limits. Path locates the offending field by the names leading
+// to it, e.g. poll.option-3.description
+type commandViolation struct {
+	Path    string
+	Problem string
+}
+
+func (v commandViolation) Error() string {
+	return fmt.Sprintf("%s: %s", v.Path, v.Problem)
+}
+
+type commandValidator struct {
+	violations []commandViolation
+}
+
+func (cv *commandValidator) report(path []string, format string, args ...any) {
+	cv.violations = append(cv.violations, commandViolation{
+		Path:    strings.Join(path, "."),
+		Problem: fmt.Sprintf(format, args...),
+	})
+}
+
+func field(path []string, name string) []string {
+	return append(append([]string{}, path...), name)
+}
+
+// validateCommands checks every command against Discord's limits, so
+// that a bad definition is caught before Discord rejects the whole batch.
+func validateCommands(cmds []*discordgo.ApplicationCommand) []commandViolation {
+	cv := &commandValidator{}
+
+	counts := map[discordgo.ApplicationCommandType]int{}
+	seen := map[string]bool{}
+	for _, cmd := range cmds {
+		path := []string{cmd.Name}
+		t := cmd.Type
+		if t == 0 {
+			t = discordgo.ChatApplicationCommand
+		}
+		counts[t]++
+
+		if seen[commandKey(cmd)] {
+			cv.report(path, "defined more than once")
+		}
+		seen[commandKey(cmd)] = true
+
+		if t == discordgo.ChatApplicationCommand {
+			cv.checkName(path, cmd.Name)
+			cv.checkDescription(path, cmd.Description)
+		} else {
+			if l := utf8.RuneCountInString(cmd.Name); l < 1 || l > 32 {
+				cv.report(field(path, "name"), "must be 1-32 characters, not %d", l)
+			}
+			if cmd.Description != "" || len(cmd.Options) > 0 {
+				cv.report(path, "context menu commands may not have a description or options")
+			}
+		}
+		if cmd.NameLocalizations != nil {
+			cv.checkNameLocalizations(path, *cmd.NameLocalizations)
+		}
+		if cmd.DescriptionLocalizations != nil {
+			cv.checkDescriptionLocalizations(path, *cmd.DescriptionLocalizations)
+		}
+
+		cv.checkOptions(path, cmd.Options, nil)
+
+		if n := commandChars(cmd); n > maxDiscordCommandChars {
+			cv.report(path, "names, descriptions, and values total %d characters, more than the maximum of %d", n, maxDiscordCommandChars)
+		}
+	}
+
+	if n := counts[discordgo.ChatApplicationCommand]; n > maxDiscordGlobalCommands {
+		cv.report([]string{"commands"}, "%d slash commands is more than the maximum of %d", n, maxDiscordGlobalCommands)
+	}
+	if n := counts[discordgo.UserApplicationCommand]; n > maxDiscordContextMenus {
+		cv.report([]string{"commands"}, "%d user commands is more than the maximum of %d", n, maxDiscordContextMenus)
+	}
+	if n := counts[discordgo.MessageApplicationCommand]; n > maxDiscordContextMenus {
+		cv.report([]string{"commands"}, "%d message commands is more than the maximum of %d", n, maxDiscordContextMenus)
+	}
+	return cv.violations
+}
+
+func (cv *commandValidator) checkName(path []string, name string) {
+	if !validCommandRegex().MatchString(name) || strings.ToLower(name) != name {
+		cv.report(field(path, "name"), "%q does not conform to Discord's naming requirements", name)
+	}
+}
+
+func (cv *commandValidator) checkDescription(path []string, desc string) {
+	if l := utf8.RuneCountInString(desc); l < 1 || l > maxDiscordCommandDescription {
+		cv.report(field(path, "description"), "must be 1-%d characters, not %d", maxDiscordCommandDescription, l)
+	}
+}
+
+func (cv *commandValidator) checkNameLocalizations(path []string, names map[discordgo.Locale]string) {
+	for locale, name := range names {
+		if !validLocalizedNameRegex.MatchString(name) || strings.ToLower(name) != name {
+			cv.report(field(path, "name_localizations."+string(locale)), "%q does not conform to Discord's naming requirements", name)
+		}
+	}
+}
+
+func (cv *commandValidator) checkDescriptionLocalizations(path []string, descs map[discordgo.Locale]string) {
+	for locale, desc := range descs {
+		if l := utf8.RuneCountInString(desc); l < 1 || l > maxDiscordCommandDescription {
+			cv.report(field(path, "description_localizations."+string(locale)), "must be 1-%d characters, not %d", maxDiscordCommandDescription, l)
+		}
+	}
+}
+
+func isSubCommand(opt *discordgo.ApplicationCommandOption) bool {
+	return opt.Type == discordgo.ApplicationCommandOptionSubCommand || opt.Type == discordgo.ApplicationCommandOptionSubCommandGroup
+}
+
+// checkOptions validates one level of options. parent is the subcommand
+// or group they belong to, or nil for the command's own options.
+func (cv *commandValidator) checkOptions(path []string, opts []*discordgo.ApplicationCommandOption, parent *discordgo.ApplicationCommandOption) {
+	if len(opts) > maxDiscordCommandOptions {
+		cv.report(field(path, "options"), "%d options is more than the maximum of %d", len(opts), maxDiscordCommandOptions)
+	}
+
+	names := map[string]bool{}
+	subCmds, optional := 0, false
+	for idx, opt := range opts {
+		if opt == nil {
+			cv.report(field(path, fmt.Sprintf("options[%d]", idx)), "is nil")
+			continue
+		}
+		optPath := field(path, opt.Name)
+
+		cv.checkName(optPath, opt.Name)
+		cv.checkDescription(optPath, opt.Description)
+		cv.checkNameLocalizations(optPath, opt.NameLocalizations)
+		cv.checkDescriptionLocalizations(optPath, opt.DescriptionLocalizations)
+		if names[opt.Name] {
+			cv.report(optPath, "more than one option has this name")
+		}
+		names[opt.Name] = true
+
+		if isSubCommand(opt) {
+			subCmds++
+			if opt.Required {
+				cv.report(field(optPath, "required"), "subcommands and groups can't be required")
+			}
+			switch {
+			case parent != nil && parent.Type == discordgo.ApplicationCommandOptionSubCommand:
+				cv.report(optPath, "subcommands can't contain subcommands or groups")
+			case parent != nil && opt.Type == discordgo.ApplicationCommandOptionSubCommandGroup:
+				cv.report(optPath, "subcommand groups can't be nested")
+			}
+			cv.checkOptions(optPath, opt.Options, opt)
+			continue
+		}
+		if parent != nil && parent.Type == discordgo.ApplicationCommandOptionSubCommandGroup {
+			cv.report(optPath, "subcommand groups may only contain subcommands")
+		}
+
+		if opt.Required && optional {
+			cv.report(field(optPath, "required"), "required options must come before optional ones")
+		}
+		optional = optional || !opt.Required
+		if len(opt.Options) > 0 {
+			cv.report(field(optPath, "options"), "only subcommands and groups can have options")
+		}
+		cv.checkChoices(optPath, opt)
+
+		if opt.MinLength != nil && (*opt.MinLength < 0 || *opt.MinLength > maxDiscordOptionLength) {
+			cv.report(field(optPath, "min_length"), "must be 0-%d", maxDiscordOptionLength)
+		}
+		if opt.MaxLength < 0 || opt.MaxLength > maxDiscordOptionLength {
+			cv.report(field(optPath, "max_length"), "must be 1-%d", maxDiscordOptionLength)
+		}
+	}
+
+	if subCmds > 0 && subCmds != len(opts) {
+		cv.report(field(path, "options"), "can't mix subcommands with other options")
+	}
+}
+
+func (cv *commandValidator) checkChoices(path []string, opt *discordgo.ApplicationCommandOption) {
+	if len(opt.Choices) == 0 {
+		return
+	}
+	if opt.Autocomplete {
+		cv.report(field(path, "autocomplete"), "options with choices can't use autocomplete")
+	}
+	if len(opt.Choices) > maxDiscordOptionChoices {
+		cv.report(field(path, "choices"), "%d choices is more than the maximum of %d", len(opt.Choices), maxDiscordOptionChoices)
+	}
+
+	for idx, choice := range opt.Choices {
+		choicePath := field(path, fmt.Sprintf("choices[%d]", idx))
+		if choice == nil {
+			cv.report(choicePath, "is nil")
+			continue
+		}
+		if l := utf8.RuneCountInString(choice.Name); l < 1 || l > maxDiscordChoiceName {
+			cv.report(field(choicePath, "name"), "must be 1-%d characters, not %d", maxDiscordChoiceName, l)
+		}
+		for locale, name := range choice.NameLocalizations {
+			if l := utf8.RuneCountInString(name); l < 1 || l > maxDiscordChoiceName {
+				cv.report(field(choicePath, "name_localizations."+string(locale)), "must be 1-%d characters, not %d", maxDiscordChoiceName, l)
+			}
+		}
+
+		// Kinds rather than types, since values are often named string types.
+		value := reflect.ValueOf(choice.Value)
+		switch opt.Type {
+		case discordgo.ApplicationCommandOptionString:
+			if value.Kind() != reflect.String {
+				cv.report(field(choicePath, "value"), "must be a string, not %T", choice.Value)
+			} else if l := utf8.RuneCountInString(value.String()); l > maxDiscordChoiceStringValue {
+				cv.report(field(choicePath, "value"), "must be at most %d characters, not %d", maxDiscordChoiceStringValue, l)
+			}
+		case discordgo.ApplicationCommandOptionInteger, discordgo.ApplicationCommandOptionNumber:
+			if !value.CanInt() && !value.CanUint() && !value.CanFloat() {
+				cv.report(field(choicePath, "value"), "must be a number, not %T", choice.Value)
+			}
+		default:
+			cv.report(field(path, "choices"), "%s options can't have choices", opt.Type)
+			return
+		}
+	}
+}
+
+// commandChars totals the characters Discord counts against a command's
+// size limit. Of a field's localizations, only the longest counts.
+func commandChars(cmd *discordgo.ApplicationCommand) int {
+	total := longest(cmd.Name, cmd.NameLocalizations) + longest(cmd.Description, cmd.DescriptionLocalizations)
+	for _, opt := range cmd.Options {
+		total += optionChars(opt)
+	}
+	return total
+}
+
+func optionChars(opt *discordgo.ApplicationCommandOption) int {
+	if opt == nil {
+		return 0
+	}
+	total := longest(opt.Name, &opt.NameLocalizations) + longest(opt.Description, &opt.DescriptionLocalizations)
+	for _, choice := range opt.Choices {
+		if choice == nil {
+			continue
+		}
+		total += longest(choice.Name, &choice.NameLocalizations) + utf8.RuneCountInString(fmt.Sprint(choice.Value))
+	}
+	for _, child := range opt.Options {
+		total += optionChars(child)
+	}
+	return total
+}
+
+func longest(s string, localizations *map[discordgo.Locale]string) int {
+	l := utf8.RuneCountInString(s)
+	if localizations == nil {
+		return l
+	}
+	for _, loc := range *localizations {
+		l = max(l, utf8.RuneCountInString(loc))
+	}
+	return l
+}
+
+// commandsAreValid logs every violation in the bot's command definitions.
+func commandsAreValid() bool {
+	violations := validateCommands(getCommands())
+	for _, v := range violations {
+		log.Errorf("Invalid command definition: %v", v)
+	}
+	return len(violations) == 0
+}
+
+// Set by ValidateConfig to skip checks that would reach out to another service.
+var offline = false
+
+// Stand-in for the imgflip templates, which can't be fetched offline.
+// Enough are generated to fill every meme command.
+func placeholderMemeTemplates() map[string]imgflipgo.Meme {
+	templates := map[string]imgflipgo.Meme{}
+	for idx := 0; idx < maxMemeCommands*maxDiscordOptionChoices; idx++ {
+		id := fmt.Sprint(100000000 + idx)
+		templates[id] = imgflipgo.Meme{
+			ID:       id,
+			Name:     fmt.Sprintf("Placeholder Meme Template %d", idx),
+			BoxCount: maxDiscordCommandOptions - reservedOptCount,
+		}
+	}
+	return templates
+}
+
+const configDir = "config"
+
+// checkConfigSyntax reports every JSON file in the config directory that
+// doesn't parse, including those no feature reads on startup.
+func checkConfigSyntax() error {
+	errs := []error{}
+	err := filepath.WalkDir(configDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".json" {
+			return err
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var v any
+		if err = json.Unmarshal(raw, &v); err != nil {
+			if syntaxErr := (*json.SyntaxError)(nil); errors.As(err, &syntaxErr) {
+				line := 1 + bytes.Count(raw[:syntaxErr.Offset], []byte("\n"))
+				err = fmt.Errorf("line %d: %w", line, err)
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+		return nil
+	})
+	return errors.Join(append(errs, err)...)
+}
+
+// checkSetupConfig checks the parts of setup.json that are otherwise
+// only read once the bot is connecting to Discord.
+func checkSetupConfig() error {
+	jsonCfg, err := config.NewJsonConfig(kardbotConfigFile)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(jsonCfg.Raw, &kardbot{}); err != nil {
+		return fmt.Errorf("%s: %w", kardbotConfigFile, err)
+	}
+
+	cfg, err := readStorageConfig()
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		return fmt.Errorf("%s: storage: %w", kardbotConfigFile, err)
+	}
+	return nil
+}
+
+// Any check of files that are only read when a feature runs, rather than
+// on startup, belongs in this list.
+func assetChecks() []func() error {
+	return []func() error{
+		checkWednesdayAssets,
+	}
+}
+
+// ValidateConfig checks every config file, the assets they refer to, and
+// every command definition against Discord's limits, without connecting
+// to Discord or any other service. Commands built from data that has to
+// be fetched, such as the meme templates, are checked using placeholder
+// data.
+func ValidateConfig() error {
+	offline = true
+	if err := checkConfigSyntax(); err != nil {
+		return err
+	}
+
+	errs := []error{}
+	checks := append([]func() error{checkSetupConfig}, localConfigLoaders()...)
+	for _, check := range append(checks, assetChecks()...) {
+		if err := check(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	templates := placeholderMemeTemplates()
+	memeTemplates = func() map[string]imgflipgo.Meme { return templates }
+	memecmds := buildMemeCommands()
+	memeCommands = func() []*discordgo.ApplicationCommand { return memecmds }
+
+	violations := validateCommands(getCommands())
+	for _, v := range violations {
+		errs = append(errs, v)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,133 @@
+package kardbot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Kardbord/imgflipgo/v2"
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestRegisteredCommandsAreValid(t *testing.T) {
+	prevTemplates, prevCmds := memeTemplates, memeCommands
+	t.Cleanup(func() { memeTemplates, memeCommands = prevTemplates, prevCmds })
+
+	templates := placeholderMemeTemplates()
+	memeTemplates = func() map[string]imgflipgo.Meme { return templates }
+	memecmds := buildMemeCommands()
+	memeCommands = func() []*discordgo.ApplicationCommand { return memecmds }
+	if len(memecmds) == 0 {
+		t.Fatal("no meme commands were built")
+	}
+
+	for _, v := range validateCommands(getCommands()) {
+		t.Error(v)
+	}
+}
+
+func TestValidateCommandsReportsPaths(t *testing.T) {
+	str := func(name string, required bool) *discordgo.ApplicationCommandOption {
+		return &discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionString, Name: name, Description: "d", Required: required}
+	}
+	subCmd := func(name string, opts ...*discordgo.ApplicationCommandOption) *discordgo.ApplicationCommandOption {
+		return &discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionSubCommand, Name: name, Description: "d", Options: opts}
+	}
+	tooManyChoices := str("pick", false)
+	for n := 0; n <= maxDiscordOptionChoices; n++ {
+		tooManyChoices.Choices = append(tooManyChoices.Choices, &discordgo.ApplicationCommandOptionChoice{Name: "c", Value: "c"})
+	}
+
+	cases := []struct {
+		name string
+		cmd  *discordgo.ApplicationCommand
+		want string
+	}{
+		{
+			name: "long option description",
+			cmd: &discordgo.ApplicationCommand{Name: "poll", Description: "d", Options: []*discordgo.ApplicationCommandOption{
+				{Type: discordgo.ApplicationCommandOptionString, Name: "option-3", Description: strings.Repeat("x", 101)},
+			}},
+			want: "poll.option-3.description",
+		},
+		{
+			name: "uppercase name",
+			cmd:  &discordgo.ApplicationCommand{Name: "Poll", Description: "d"},
+			want: "Poll.name",
+		},
+		{
+			name: "required after optional",
+			cmd:  &discordgo.ApplicationCommand{Name: "cmd", Description: "d", Options: []*discordgo.ApplicationCommandOption{str("a", false), str("b", true)}},
+			want: "cmd.b.required",
+		},
+		{
+			name: "too many choices",
+			cmd:  &discordgo.ApplicationCommand{Name: "cmd", Description: "d", Options: []*discordgo.ApplicationCommandOption{tooManyChoices}},
+			want: "cmd.pick.choices",
+		},
+		{
+			name: "long choice value",
+			cmd: &discordgo.ApplicationCommand{Name: "cmd", Description: "d", Options: []*discordgo.ApplicationCommandOption{{
+				Type: discordgo.ApplicationCommandOptionString, Name: "pick", Description: "d",
+				Choices: []*discordgo.ApplicationCommandOptionChoice{{Name: "ok", Value: strings.Repeat("x", 101)}},
+			}}},
+			want: "cmd.pick.choices[0].value",
+		},
+		{
+			name: "subcommand in a subcommand",
+			cmd:  &discordgo.ApplicationCommand{Name: "cmd", Description: "d", Options: []*discordgo.ApplicationCommandOption{subCmd("outer", subCmd("inner"))}},
+			want: "cmd.outer.inner",
+		},
+		{
+			name: "subcommands mixed with options",
+			cmd:  &discordgo.ApplicationCommand{Name: "cmd", Description: "d", Options: []*discordgo.ApplicationCommandOption{subCmd("sub"), str("a", false)}},
+			want: "cmd.options",
+		},
+		{
+			name: "total size",
+			cmd: func() *discordgo.ApplicationCommand {
+				cmd := &discordgo.ApplicationCommand{Name: "cmd", Description: "d"}
+				for n := 0; n < maxDiscordCommandOptions; n++ {
+					opt := str(strings.Repeat(string(rune('a'+n)), 32), false)
+					opt.Description = strings.Repeat("x", maxDiscordCommandDescription)
+					for c := 0; c < maxDiscordOptionChoices; c++ {
+						opt.Choices = append(opt.Choices, &discordgo.ApplicationCommandOptionChoice{Name: strings.Repeat("c", 10), Value: strings.Repeat("v", 10)})
+					}
+					cmd.Options = append(cmd.Options, opt)
+				}
+				return cmd
+			}(),
+			want: "cmd",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			violations := validateCommands([]*discordgo.ApplicationCommand{tc.cmd})
+			for _, v := range violations {
+				if v.Path == tc.want {
+					return
+				}
+			}
+			t.Errorf("no violation at %s, got %v", tc.want, violations)
+		})
+	}
+}
+
+func TestCheckConfigSyntaxReportsLine(t *testing.T) {
+	inTempConfigDir(t, map[string]string{
+		"config/good.json":        `{"a": 1}`,
+		"config/locales/bad.json": "{\n  \"a\": 1,\n}\n",
+		"config/not-json.txt":     "{",
+	})
+
+	err := checkConfigSyntax()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if want := "config/locales/bad.json: line 3:"; !strings.Contains(err.Error(), want) {
+		t.Errorf("error %q does not mention %q", err, want)
+	}
+	if strings.Contains(err.Error(), "good.json") || strings.Contains(err.Error(), "not-json.txt") {
+		t.Errorf("error mentions a file that should pass: %v", err)
+	}
+}
@@ -1,17 +1,46 @@
 package kardbot
 
 import (
-	"fmt"
+	"context"
 	"math/rand"
 
 	"github.com/bwmarrin/discordgo"
-
-	log "github.com/sirupsen/logrus"
 )
 
 const oddsCmd = "what-are-the-odds"
 
-func whatAreTheOdds(s *discordgo.Session, i *discordgo.InteractionCreate) {
+// IDs of /what-are-the-odds response messages.
+const (
+	msgOddsChance = "what-are-the-odds.chance"
+)
+
+func init() {
+	registerMessages(map[string]string{
+		msgOddsChance: "There is a %d%% chance %s.",
+	})
+	registerCommand(&command{
+		name:       oddsCmd,
+		definition: oddsCmdDefinition,
+		handler:    whatAreTheOdds,
+	})
+}
+
+func oddsCmdDefinition() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        oddsCmd,
+		Description: "What are the odds that an event will occur? Use third-person voice for best results.",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "event",
+				Description: "something that you want to know the odds of",
+				Required:    true,
+			},
+		},
+	}
+}
+
+func whatAreTheOdds(ctx context.Context, s discordSession, i *discordgo.InteractionCreate) {
 	event := i.ApplicationCommandData().Options[0].StringValue()
 	event = sentenceEndPunctRegex().ReplaceAllString(event, "")
 
@@ -21,12 +50,12 @@ func whatAreTheOdds(s *discordgo.Session, i *discordgo.InteractionCreate) {
 			AllowedMentions: &discordgo.MessageAllowedMentions{
 				Parse: []discordgo.AllowedMentionType{discordgo.AllowedMentionTypeUsers, discordgo.AllowedMentionTypeRoles, discordgo.AllowedMentionTypeEveryone},
 			},
-			Content: fmt.Sprintf("There is a %d%% chance %s.", rand.Intn(101), event),
+			Content: localized(i, msgOddsChance, rand.Intn(101), event),
 		},
 	})
 
 	if err != nil {
-		log.Error(err)
+		logFor(i).Error(err)
 		interactionRespondEphemeralError(s, i, true, err)
 	}
 }
@@ -2,8 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
+	"os"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
 
@@ -12,28 +15,26 @@ import (
 	"github.com/Kardbord/Kard-bot/kardbot"
 	"github.com/Kardbord/Kard-bot/kardbot/config"
 
-	// For runtime profiling if enabled in config
 	"net/http"
-	_ "net/http/pprof"
+	"net/http/pprof"
 )
 
 const MainConfigFile = "config/setup.json"
 
+// Trims the caller's file path down to its path within the repository.
+func callerPrettyfier(f *runtime.Frame) (string, string) {
+	split := strings.Split(f.File, "Kard-bot/")
+	filename := "Kard-bot/" + split[len(split)-1]
+	return "", fmt.Sprintf("%s:%d", filename, f.Line)
+}
+
 func init() {
 	log.SetReportCaller(true)
-	log.SetFormatter(&log.TextFormatter{
-		FullTimestamp:   true,
-		TimestampFormat: time.UnixDate,
-		CallerPrettyfier: func(f *runtime.Frame) (string, string) {
-			split := strings.Split(f.File, "Kard-bot/")
-			filename := "Kard-bot/" + split[len(split)-1]
-			return "", fmt.Sprintf("%s:%d", filename, f.Line)
-		},
-	})
 
 	cfg := struct {
 		DefaultLogLvl string `json:"default-log-level"`
-	}{"info"}
+		LogFormat     string `json:"log-format"`
+	}{"info", "text"}
 
 	jsonCfg, err := config.NewJsonConfig(MainConfigFile)
 	if err != nil {
@@ -44,6 +45,23 @@ func init() {
 		log.Fatal(err)
 	}
 
+	switch cfg.LogFormat {
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{
+			TimestampFormat:  time.RFC3339Nano,
+			CallerPrettyfier: callerPrettyfier,
+		})
+	default:
+		log.SetFormatter(&log.TextFormatter{
+			FullTimestamp:    true,
+			TimestampFormat:  time.UnixDate,
+			CallerPrettyfier: callerPrettyfier,
+		})
+		if cfg.LogFormat != "text" {
+			log.Warnf(`Unknown log format "%s". Defaulting to "text".`, cfg.LogFormat)
+		}
+	}
+
 	if lvl, err := log.ParseLevel(cfg.DefaultLogLvl); err == nil {
 		log.SetLevel(lvl)
 	} else {
@@ -52,11 +70,28 @@ func init() {
 	}
 }
 
-// Start an http server for pprof profiling data
-// if configured. No-op if not.
-// See https://pkg.go.dev/net/http/pprof
-var pprofServe = func() {
-	log.Info("pprof not enabled (this is normal)")
+// HTTP endpoints enabled in config, keyed by listen address.
+// Endpoints configured with the same address share a server.
+var httpMuxes = map[string]*http.ServeMux{}
+
+func handleHTTP(address, pattern string, handler http.Handler) {
+	mux, ok := httpMuxes[address]
+	if !ok {
+		mux = http.NewServeMux()
+		httpMuxes[address] = mux
+	}
+	mux.Handle(pattern, handler)
+}
+
+// Start an http server for each address with endpoints enabled in config.
+// No-op if there are none.
+func httpServe() {
+	for address, mux := range httpMuxes {
+		go func(address string, mux *http.ServeMux) {
+			log.Infof("Starting http server at %s", address)
+			log.Error(http.ListenAndServe(address, mux))
+		}(address, mux)
+	}
 }
 
 var PprofCfg = pprofConfig{}
@@ -68,6 +103,8 @@ type pprofConfig struct {
 	MutexProfileFraction int    `json:"mutex-profile-fraction"`
 }
 
+// Serve pprof profiling data if configured.
+// See https://pkg.go.dev/net/http/pprof
 func init() {
 	jsonCfg, err := config.NewJsonConfig(MainConfigFile)
 	if err != nil {
@@ -86,6 +123,7 @@ func init() {
 	}
 
 	if !PprofCfg.Enabled {
+		log.Info("pprof not enabled (this is normal)")
 		return
 	}
 
@@ -100,13 +138,237 @@ func init() {
 	log.Infof("Setting mutex profile fraction to %d", PprofCfg.MutexProfileFraction)
 	runtime.SetMutexProfileFraction(PprofCfg.MutexProfileFraction)
 
-	pprofServe = func() {
-		log.Infof("Starting pprof server at %s/debug/pprof/", PprofCfg.Address)
-		log.Info(http.ListenAndServe(PprofCfg.Address, nil))
+	log.Infof("Serving pprof at %s/debug/pprof/", PprofCfg.Address)
+	handleHTTP(PprofCfg.Address, "/debug/pprof/", http.HandlerFunc(pprof.Index))
+	handleHTTP(PprofCfg.Address, "/debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline))
+	handleHTTP(PprofCfg.Address, "/debug/pprof/profile", http.HandlerFunc(pprof.Profile))
+	handleHTTP(PprofCfg.Address, "/debug/pprof/symbol", http.HandlerFunc(pprof.Symbol))
+	handleHTTP(PprofCfg.Address, "/debug/pprof/trace", http.HandlerFunc(pprof.Trace))
+}
+
+type metricsConfig struct {
+	Enabled bool   `json:"enabled"`
+	Address string `json:"address"`
+}
+
+// Serve Prometheus metrics if configured.
+func init() {
+	cfg := struct {
+		Metrics metricsConfig `json:"metrics"`
+	}{}
+
+	jsonCfg, err := config.NewJsonConfig(MainConfigFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = json.Unmarshal(jsonCfg.Raw, &cfg)
+	if err != nil {
+		log.Fatal(err)
 	}
+
+	if !cfg.Metrics.Enabled {
+		return
+	}
+	if cfg.Metrics.Address == "" {
+		log.Warn("metrics are enabled but address is not set, not serving metrics")
+		return
+	}
+
+	log.Infof("Serving metrics at %s/metrics", cfg.Metrics.Address)
+	handleHTTP(cfg.Metrics.Address, "/metrics", kardbot.MetricsHandler())
 }
 
-func main() {
-	go pprofServe()
+type healthConfig struct {
+	Enabled bool   `json:"enabled"`
+	Address string `json:"address"`
+}
+
+// Serve health and readiness checks if configured.
+func init() {
+	cfg := struct {
+		Health healthConfig `json:"health"`
+	}{}
+
+	jsonCfg, err := config.NewJsonConfig(MainConfigFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = json.Unmarshal(jsonCfg.Raw, &cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if !cfg.Health.Enabled {
+		return
+	}
+	if cfg.Health.Address == "" {
+		log.Warn("health checks are enabled but address is not set, not serving health checks")
+		return
+	}
+
+	log.Infof("Serving health checks at %s/healthz and %s/readyz", cfg.Health.Address, cfg.Health.Address)
+	handleHTTP(cfg.Health.Address, "/healthz", kardbot.HealthzHandler())
+	handleHTTP(cfg.Health.Address, "/readyz", kardbot.ReadyzHandler())
+}
+
+// A subcommand of the kardbot binary, e.g. "kardbot validate-config".
+type subcommand struct {
+	name    string
+	args    string
+	summary string
+	run     func(args []string) error
+	// Older names the subcommand still answers to.
+	aliases []string
+}
+
+func (sc subcommand) is(name string) bool {
+	return sc.name == name || slices.Contains(sc.aliases, name)
+}
+
+// Any subcommand of the kardbot binary belongs in this list.
+// The first is run when no subcommand is given.
+func subcommands() []subcommand {
+	return []subcommand{
+		{"run", "", "Run the bot", runBot, nil},
+		{"validate-config", "", "Check every config file, the assets they refer to, and every command definition, offline", validateConfig, []string{"validate"}},
+		{"register-commands", "[--guild ID] [--dry-run]", "Bring the commands registered with Discord in line with the bot's own", registerCommands, nil},
+		{"unregister-commands", "[--guild ID] [--dry-run]", "Delete every command the bot has registered with Discord", unregisterCommands, nil},
+		{"export-state", "[file]", "Write the bot's persistent state to file, or stdout, as JSON", exportState, nil},
+		{"import-state", "[file]", "Read state written by export-state from file, or stdin", importState, nil},
+	}
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [command] [args]\n\nCommands:\n", os.Args[0])
+	for _, sc := range subcommands() {
+		fmt.Fprintf(out, "  %s %s\n    \t%s\n", sc.name, sc.args, sc.summary)
+	}
+	fmt.Fprintln(out, "\nThe bot must not be running when its state is exported or imported.")
+	fmt.Fprintln(out, "\"validate\" and a bare \"--dry-run\" still work, but are deprecated.")
+}
+
+// newFlagSet returns a flag set for a subcommand that prints the
+// subcommand's usage on error.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		for _, sc := range subcommands() {
+			if sc.name == name {
+				fmt.Fprintf(fs.Output(), "Usage: %s %s %s\n\n%s\n", os.Args[0], sc.name, sc.args, sc.summary)
+			}
+		}
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func runBot(args []string) error {
+	if err := newFlagSet("run").Parse(args); err != nil {
+		return err
+	}
+	httpServe()
 	kardbot.RunAndBlock(PprofCfg.Enabled)
+	return nil
+}
+
+func validateConfig(args []string) error {
+	if err := newFlagSet("validate-config").Parse(args); err != nil {
+		return err
+	}
+	if err := kardbot.ValidateConfig(); err != nil {
+		return err
+	}
+	fmt.Println("Configuration and command definitions are valid")
+	return nil
+}
+
+func registerCommands(args []string) error {
+	fs := newFlagSet("register-commands")
+	guild := fs.String("guild", "", "only register commands in this guild")
+	dryRun := fs.Bool("dry-run", false, "print the changes without making them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	return kardbot.RegisterCommands(*guild, *dryRun)
+}
+
+func unregisterCommands(args []string) error {
+	fs := newFlagSet("unregister-commands")
+	guild := fs.String("guild", "", "only unregister commands in this guild")
+	dryRun := fs.Bool("dry-run", false, "print the deletions without making them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	return kardbot.UnregisterCommands(*guild, *dryRun)
+}
+
+func exportState(args []string) error {
+	fs := newFlagSet("export-state")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 || fs.Arg(0) == "-" {
+		return kardbot.ExportState(os.Stdout)
+	}
+
+	fd, err := os.Create(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err = kardbot.ExportState(fd); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+func importState(args []string) error {
+	fs := newFlagSet("import-state")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 || fs.Arg(0) == "-" {
+		return kardbot.ImportState(os.Stdin)
+	}
+
+	fd, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	return kardbot.ImportState(fd)
+}
+
+func main() {
+	flag.Usage = usage
+	dryRun := flag.Bool("dry-run", false, "deprecated, use register-commands --dry-run")
+	flag.Parse()
+
+	cmds := subcommands()
+	name, args := cmds[0].name, flag.Args()
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	} else if *dryRun {
+		log.Warn("--dry-run on its own is deprecated, use register-commands --dry-run instead")
+		name, args = "register-commands", []string{"--dry-run"}
+	}
+
+	for _, sc := range cmds {
+		if !sc.is(name) {
+			continue
+		}
+		if name != sc.name {
+			log.Warnf("%s is deprecated, use %s instead", name, sc.name)
+		}
+		if err := sc.run(args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
 }